@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // часовые пояса пользователей; в alpine-образе нет zoneinfo
 
 	_ "painaway_test/docs"
 	"painaway_test/internal/app"
@@ -27,6 +28,9 @@ func main() {
 		log.Fatalf("failed to initialize app: %v", err)
 	}
 
+	// Фоновые напоминания
+	a.Reminders.Start()
+
 	// Запуск сервера
 	go func() {
 		if err := a.Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -46,6 +50,9 @@ func main() {
 	if err := a.Server.Shutdown(ctx); err != nil {
 		a.Logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
+	if err := a.Reminders.Stop(ctx); err != nil {
+		a.Logger.Error("Reminder scheduler did not stop in time", zap.Error(err))
+	}
 
 	a.Logger.Info("Server exited gracefully")
 }
@@ -3,13 +3,29 @@ package app
 import (
 	"fmt"
 	"net/http"
+	"os"
+	"painaway_test/internal/appointments"
+	"painaway_test/internal/attachments"
+	"painaway_test/internal/audit"
 	"painaway_test/internal/auth"
+	"painaway_test/internal/blob"
+	"painaway_test/internal/comments"
 	"painaway_test/internal/config"
 	"painaway_test/internal/diary"
+	"painaway_test/internal/doctors"
+	"painaway_test/internal/idempotency"
+	"painaway_test/internal/invites"
 	logm "painaway_test/internal/log"
+	"painaway_test/internal/mail"
+	"painaway_test/internal/messaging"
 	"painaway_test/internal/notifications"
+	"painaway_test/internal/onboarding"
+	"painaway_test/internal/questionnaires"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/reminders"
 	db "painaway_test/internal/storage"
 	"painaway_test/internal/users"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -25,6 +41,8 @@ type App struct {
 	DB     *gorm.DB
 	Hub    *notifications.Hub
 	Server *http.Server
+
+	Reminders *reminders.Scheduler
 }
 
 func New() (*App, error) {
@@ -50,12 +68,57 @@ func New() (*App, error) {
 	if err := db.AutoMigrate(dbConn); err != nil {
 		return nil, err
 	}
+	if err := db.Seed(dbConn); err != nil {
+		return nil, err
+	}
+	if cfg.ICD10Config.File != "" {
+		if err := importICD10(dbConn, cfg.ICD10Config.File, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	// Init blob storage
+	blobStorage, err := blob.New(&cfg.BlobConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Init mail sender
+	mailer, err := mail.New(&cfg.MailConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Init questionnaire definitions
+	registry, err := questionnaires.LoadRegistry(cfg.QuestionnairesConfig.Dir)
+	if err != nil {
+		return nil, err
+	}
 
 	// Init Hub notifications
 	hub := notifications.NewHub()
 
 	// Init router
-	router := buildRouter(cfg, logger, dbConn, hub)
+	router := buildRouter(cfg, logger, dbConn, hub, blobStorage, mailer, registry)
+
+	// Init reminders worker
+	scheduler := reminders.NewScheduler(
+		reminders.NewRepository(dbConn),
+		notifications.NewService(notifications.NewRepository(dbConn), hub),
+		&cfg.RemindersConfig,
+		logger,
+	)
+	// Просроченные ответы Idempotency-Key и старые попытки погасить приглашение больше не нужны
+	idempotencyRepo := idempotency.NewRepository(dbConn)
+	inviteRepo := invites.NewRepository(dbConn)
+	scheduler.OnTick(func(now time.Time) {
+		if _, err := idempotencyRepo.DeleteExpired(now); err != nil {
+			logger.Warn("failed to purge expired idempotency records", zap.Error(err))
+		}
+		if _, err := inviteRepo.DeleteAttemptsBefore(now.Add(-cfg.InvitesConfig.AttemptWindow)); err != nil {
+			logger.Warn("failed to purge old invite attempts", zap.Error(err))
+		}
+	})
 
 	address := fmt.Sprintf(":%v", cfg.HTTPServerConfig.ServerPort)
 	srv := &http.Server{
@@ -69,9 +132,26 @@ func New() (*App, error) {
 		DB:     dbConn,
 		Hub:    hub,
 		Server: srv,
+
+		Reminders: scheduler,
 	}, nil
 }
 
+func importICD10(dbConn *gorm.DB, path string, logger *zap.Logger) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open icd10 file: %w", err)
+	}
+	defer f.Close()
+
+	count, err := db.ImportICD10(dbConn, f)
+	if err != nil {
+		return fmt.Errorf("import icd10 file: %w", err)
+	}
+	logger.Info("ICD-10 codes imported", zap.String("file", path), zap.Int("count", count))
+	return nil
+}
+
 func NewLogger(env *config.Config) (*zap.Logger, error) {
 	var cfg zap.Config
 	if env.Env == "prod" {
@@ -86,21 +166,49 @@ func NewLogger(env *config.Config) (*zap.Logger, error) {
 	return cfg.Build()
 }
 
-func buildRouter(cfg *config.Config, logger *zap.Logger, dbConn *gorm.DB, hub *notifications.Hub) *gin.Engine {
+func buildRouter(cfg *config.Config, logger *zap.Logger, dbConn *gorm.DB, hub *notifications.Hub, blobStorage blob.Storage, mailer mail.Sender, registry *questionnaires.Registry) *gin.Engine {
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.Use(logm.RequestIDMiddleware())
 	router.Use(logm.LoggerMiddleware(logger))
 
 	// Repositories
 	userRepo := users.NewRepository(dbConn)
 	diaryRepo := diary.NewRepository(dbConn)
 	notifRepo := notifications.NewRepository(dbConn)
+	attachmentRepo := attachments.NewRepository(dbConn)
+	idempotencyRepo := idempotency.NewRepository(dbConn)
+	reminderRepo := reminders.NewRepository(dbConn)
+	questionnaireRepo := questionnaires.NewRepository(dbConn)
+	commentRepo := comments.NewRepository(dbConn)
+	messageRepo := messaging.NewRepository(dbConn)
+	appointmentRepo := appointments.NewRepository(dbConn)
+	inviteRepo := invites.NewRepository(dbConn)
+	doctorRepo := doctors.NewRepository(dbConn)
+	auditRepo := audit.NewRepository(dbConn)
+	roleRepo := rbac.NewRepository(dbConn)
+	onboardingRepo := onboarding.NewRepository(dbConn)
 
 	// Services
-	authService := auth.NewService(userRepo)
+	roleService := rbac.NewService(roleRepo, logger)
+	authService := auth.NewService(userRepo, roleService)
 	notifService := notifications.NewService(notifRepo, hub)
 	diaryService := diary.NewService(diaryRepo, notifService, logger)
-	userService := users.NewService(userRepo)
+	userService := users.NewService(userRepo, diaryService, roleService, mailer, logger)
+	reminderService := reminders.NewService(reminderRepo)
+	questionnaireService := questionnaires.NewService(questionnaireRepo, registry, diaryService, notifService, logger)
+	attachmentService := attachments.NewService(attachmentRepo, blobStorage, diaryService, &cfg.AttachmentsConfig, logger)
+	commentService := comments.NewService(commentRepo, diaryService, notifService, logger)
+	messageService := messaging.NewService(messageRepo, blobStorage, diaryService, hub, notifService, &cfg.AttachmentsConfig, logger)
+	appointmentService := appointments.NewService(appointmentRepo, diaryService, notifService, logger)
+	inviteService := invites.NewService(inviteRepo, diaryService, &cfg.InvitesConfig, logger)
+	doctorService := doctors.NewService(doctorRepo)
+	auditService := audit.NewService(auditRepo, logger)
+	onboardingService := onboarding.NewService(onboardingRepo, blobStorage, roleService, notifService, &cfg.AttachmentsConfig, logger)
+
+	diaryService.OnLinkEnded(messageService.HandleLinkEnded)
+	diaryService.OnLinkEnded(appointmentService.HandleLinkEnded)
+	diaryService.OnLinkEnded(questionnaireService.HandleLinkEnded)
 
 	// Swagger
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -111,10 +219,31 @@ func buildRouter(cfg *config.Config, logger *zap.Logger, dbConn *gorm.DB, hub *n
 
 	// Protected routes
 	protected := router.Group("/api")
-	protected.Use(auth.AuthMiddleware(&cfg.JWTConfig, logger))
+	protected.Use(auth.AuthMiddleware(&cfg.JWTConfig, userRepo, roleService, logger))
+	protected.Use(idempotency.Middleware(idempotencyRepo, &cfg.IdempotencyConfig, logger))
+	protected.Use(audit.Middleware(auditService, logger))
 	notifications.RegisterRoutes(protected, notifService, hub, logger)
 	diary.RegisterRoutes(protected, diaryService, logger)
-	users.RegisterRoutes(protected, userService, logger)
+	users.RegisterRoutes(protected, userService, &cfg.JWTConfig, logger)
+	attachments.RegisterRoutes(protected, attachmentService, logger)
+	comments.RegisterRoutes(protected, commentService, logger)
+	messaging.RegisterRoutes(protected, messageService, logger)
+	appointments.RegisterRoutes(protected, appointmentService, logger)
+	reminders.RegisterRoutes(protected, reminderService, logger)
+	questionnaires.RegisterRoutes(protected, questionnaireService, logger)
+	invites.RegisterRoutes(protected, inviteService, logger)
+	doctors.RegisterRoutes(protected, doctorService, logger)
+	audit.RegisterRoutes(protected, auditService, logger)
+	onboarding.RegisterRoutes(protected, onboardingService, logger)
+
+	// Admin routes
+	// права проверяются на каждом маршруте, отдельной проверки роли у группы нет
+	admin := protected.Group("/admin")
+	diary.RegisterAdminRoutes(admin, diaryService, logger)
+	audit.RegisterAdminRoutes(admin, auditService, logger)
+	rbac.RegisterAdminRoutes(admin, roleService, logger)
+	users.RegisterAdminRoutes(admin, userService, logger)
+	onboarding.RegisterAdminRoutes(admin, onboardingService, logger)
 
 	return router
 }
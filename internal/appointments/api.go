@@ -0,0 +1,230 @@
+package appointments
+
+import (
+	"errors"
+	"net/http"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/appointments/slots", rbac.RequirePermission(logger, rbac.PermAppointmentsUse), h.ListSlots)
+	rg.POST("/appointments/slots", rbac.RequirePermission(logger, rbac.PermScheduleManage), h.CreateSlot)
+	rg.DELETE("/appointments/slots/:id", rbac.RequirePermission(logger, rbac.PermScheduleManage), h.DeleteSlot)
+	rg.GET("/appointments/calendar.ics", rbac.RequirePermission(logger, rbac.PermScheduleManage), h.Calendar)
+	rg.GET("/appointments/", rbac.RequirePermission(logger, rbac.PermAppointmentsUse), h.List)
+	rg.POST("/appointments/", rbac.RequirePermission(logger, rbac.PermAppointmentsUse), h.Book)
+	rg.PATCH("/appointments/:id", rbac.RequirePermission(logger, rbac.PermAppointmentsUse), h.Reschedule)
+	rg.POST("/appointments/:id/cancel", rbac.RequirePermission(logger, rbac.PermAppointmentsUse), h.Cancel)
+}
+
+// ListSlots — GET /appointments/slots?doctor_id=&from=&to=; без doctor_id врач получает свои окна.
+func (h *Handler) ListSlots(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	doctorID := userID.(uint)
+	if v := c.Query("doctor_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid doctor_id", h.Logger)
+			return
+		}
+		doctorID = uint(id)
+	}
+
+	slots, err := h.Service.ListSlots(userID.(uint), doctorID, c.Query("from"), c.Query("to"))
+	if err != nil {
+		h.respondError(c, err, "failed to list slots")
+		return
+	}
+	c.JSON(http.StatusOK, slots)
+}
+
+func (h *Handler) CreateSlot(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.SlotInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	slot, err := h.Service.CreateSlot(userID.(uint), req)
+	if err != nil {
+		h.respondError(c, err, "failed to create slot")
+		return
+	}
+	c.JSON(http.StatusCreated, utils.SlotDTO{
+		ID:       slot.ID,
+		DoctorID: slot.DoctorID,
+		StartsAt: slot.StartsAt,
+		EndsAt:   slot.EndsAt,
+	})
+}
+
+func (h *Handler) DeleteSlot(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	slotID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid slot id", h.Logger)
+		return
+	}
+
+	if err := h.Service.DeleteSlot(userID.(uint), uint(slotID)); err != nil {
+		h.respondError(c, err, "failed to delete slot")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Calendar — расписание врача в формате .ics для импорта в календарь.
+func (h *Handler) Calendar(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	data, err := h.Service.Calendar(userID.(uint))
+	if err != nil {
+		h.respondError(c, err, "failed to build calendar")
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="schedule.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+}
+
+// List — GET /appointments/?from=&to=&status=, записи пользователя как врача или пациента.
+func (h *Handler) List(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	appts, err := h.Service.List(userID.(uint), c.Query("from"), c.Query("to"), c.Query("status"))
+	if err != nil {
+		h.respondError(c, err, "failed to list appointments")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToAppointmentDTO(appts))
+}
+
+func (h *Handler) Book(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.BookAppointmentDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	appt, err := h.Service.Book(userID.(uint), req)
+	if err != nil {
+		h.respondError(c, err, "failed to book appointment")
+		return
+	}
+
+	h.Logger.Info("appointment booked",
+		zap.Uint("patientID", appt.PatientID),
+		zap.Uint("doctorID", appt.DoctorID),
+		zap.Uint("appointmentID", appt.ID))
+	c.JSON(http.StatusCreated, h.Service.ToAppointmentDTO([]models.Appointment{*appt})[0])
+}
+
+func (h *Handler) Reschedule(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid appointment id", h.Logger)
+		return
+	}
+	var req utils.RescheduleAppointmentDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	appt, err := h.Service.Reschedule(userID.(uint), uint(appointmentID), req)
+	if err != nil {
+		h.respondError(c, err, "failed to reschedule appointment")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToAppointmentDTO([]models.Appointment{*appt})[0])
+}
+
+func (h *Handler) Cancel(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	appointmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid appointment id", h.Logger)
+		return
+	}
+	var req utils.CancelAppointmentDTO
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+			return
+		}
+	}
+
+	appt, err := h.Service.Cancel(userID.(uint), uint(appointmentID), req)
+	if err != nil {
+		h.respondError(c, err, "failed to cancel appointment")
+		return
+	}
+
+	h.Logger.Info("appointment cancelled", zap.Uint("userID", userID.(uint)), zap.Uint("appointmentID", appt.ID))
+	c.JSON(http.StatusOK, h.Service.ToAppointmentDTO([]models.Appointment{*appt})[0])
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	case errors.Is(err, ErrSlotConflict), errors.Is(err, ErrSlotTaken), errors.Is(err, ErrAppointmentOverlap),
+		errors.Is(err, ErrNotBooked):
+		response.NewErrorResponse(c, http.StatusConflict, err.Error(), h.Logger)
+	case errors.Is(err, ErrInvalidSlot), errors.Is(err, ErrInvalidAppointment), errors.Is(err, ErrInvalidPeriod):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
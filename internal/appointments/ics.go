@@ -0,0 +1,56 @@
+package appointments
+
+import (
+	"bytes"
+	"fmt"
+	"painaway_test/models"
+	"strings"
+	"time"
+)
+
+const icsTimeLayout = "20060102T150405Z"
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// renderCalendar собирает VCALENDAR (RFC 5545) из записей. Время — в UTC,
+// календарное приложение само переведёт его в пояс пользователя.
+func renderCalendar(appts []models.Appointment, now time.Time) []byte {
+	var b bytes.Buffer
+	writeLine(&b, "BEGIN:VCALENDAR")
+	writeLine(&b, "VERSION:2.0")
+	writeLine(&b, "PRODID:-//PainAway//Appointments//RU")
+	writeLine(&b, "CALSCALE:GREGORIAN")
+	writeLine(&b, "METHOD:PUBLISH")
+	writeLine(&b, "X-WR-CALNAME:"+icsEscaper.Replace("Приёмы PainAway"))
+	for _, a := range appts {
+		writeLine(&b, "BEGIN:VEVENT")
+		writeLine(&b, fmt.Sprintf("UID:appointment-%d@painaway", a.ID))
+		writeLine(&b, "DTSTAMP:"+now.UTC().Format(icsTimeLayout))
+		writeLine(&b, "LAST-MODIFIED:"+a.UpdatedAt.UTC().Format(icsTimeLayout))
+		writeLine(&b, "DTSTART:"+a.StartsAt.UTC().Format(icsTimeLayout))
+		writeLine(&b, "DTEND:"+a.EndsAt.UTC().Format(icsTimeLayout))
+		writeLine(&b, "SUMMARY:"+icsEscaper.Replace(strings.TrimSpace(fmt.Sprintf("Приём: %s %s %s", a.Patient.LastName, a.Patient.FirstName, a.Patient.FatherName))))
+		if a.Reason != "" {
+			writeLine(&b, "DESCRIPTION:"+icsEscaper.Replace(a.Reason))
+		}
+		writeLine(&b, "STATUS:CONFIRMED")
+		writeLine(&b, "END:VEVENT")
+	}
+	writeLine(&b, "END:VCALENDAR")
+	return b.Bytes()
+}
+
+// writeLine пишет строку с переносом по 75 октетов, не разрывая символы UTF-8.
+func writeLine(b *bytes.Buffer, line string) {
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,244 @@
+package appointments
+
+import (
+	"painaway_test/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	CreateSlot(slot *models.AvailabilitySlot) error
+	GetSlotByID(id uint) (*models.AvailabilitySlot, error)
+	GetSlots(doctorID uint, from, to time.Time) ([]models.AvailabilitySlot, error)
+	DeleteSlot(id uint) error
+	GetBookedSlotIDs(slotIDs []uint) (map[uint]bool, error)
+	BookSlot(appt *models.Appointment) error
+	MoveAppointment(appt *models.Appointment, slot *models.AvailabilitySlot) error
+	CancelAppointment(appt *models.Appointment) error
+	GetAppointmentByID(id uint) (*models.Appointment, error)
+	GetAppointments(userID uint, from, to time.Time, status string) ([]models.Appointment, error)
+	GetDoctorAppointments(doctorID uint, from time.Time) ([]models.Appointment, error)
+	CancelUpcomingBySubscriptionID(subscriptionID uint, reason string, at time.Time) (int64, error)
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+// Ключи advisory-блокировок: проверка пересечения и вставка идут под блокировкой
+// владельца расписания, иначе два параллельных запроса пройдут проверку оба.
+const (
+	lockDoctorSlots         = 1
+	lockPatientAppointments = 2
+)
+
+func advisoryLock(tx *gorm.DB, key int, id uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", key, id).Error
+}
+
+// CreateSlot сохраняет окно, если оно не пересекается с другими окнами врача.
+func (r *Repo) CreateSlot(slot *models.AvailabilitySlot) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := advisoryLock(tx, lockDoctorSlots, slot.DoctorID); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.AvailabilitySlot{}).
+			Where("doctor_id = ? AND starts_at < ? AND ends_at > ?", slot.DoctorID, slot.EndsAt, slot.StartsAt).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSlotConflict
+		}
+		return tx.Create(slot).Error
+	})
+}
+
+func (r *Repo) GetSlotByID(id uint) (*models.AvailabilitySlot, error) {
+	var slot models.AvailabilitySlot
+	if err := r.DB.Where("id = ?", id).First(&slot).Error; err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+func (r *Repo) GetSlots(doctorID uint, from, to time.Time) ([]models.AvailabilitySlot, error) {
+	var slots []models.AvailabilitySlot
+	if err := r.DB.
+		Where("doctor_id = ? AND starts_at >= ? AND starts_at < ?", doctorID, from, to).
+		Order("starts_at").
+		Find(&slots).Error; err != nil {
+		return nil, err
+	}
+	return slots, nil
+}
+
+// DeleteSlot удаляет окно, если на него нет действующей записи.
+func (r *Repo) DeleteSlot(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var slot models.AvailabilitySlot
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&slot).Error; err != nil {
+			return err
+		}
+		booked, err := slotBooked(tx, id)
+		if err != nil {
+			return err
+		}
+		if booked {
+			return ErrSlotTaken
+		}
+		return tx.Delete(&slot).Error
+	})
+}
+
+func (r *Repo) GetBookedSlotIDs(slotIDs []uint) (map[uint]bool, error) {
+	result := make(map[uint]bool)
+	if len(slotIDs) == 0 {
+		return result, nil
+	}
+	var ids []uint
+	if err := r.DB.Model(&models.Appointment{}).
+		Where("slot_id IN ? AND status = ?", slotIDs, StatusBooked).
+		Pluck("slot_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result, nil
+}
+
+// BookSlot создаёт запись, блокируя окно, чтобы два пациента не заняли его одновременно,
+// а пациент — два пересекающихся приёма.
+func (r *Repo) BookSlot(appt *models.Appointment) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPatientSchedule(tx, appt.PatientID, appt.StartsAt, appt.EndsAt, 0); err != nil {
+			return err
+		}
+		if err := lockFreeSlot(tx, appt.SlotID); err != nil {
+			return err
+		}
+		return tx.Create(appt).Error
+	})
+}
+
+// MoveAppointment переносит запись в другое свободное окно.
+func (r *Repo) MoveAppointment(appt *models.Appointment, slot *models.AvailabilitySlot) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPatientSchedule(tx, appt.PatientID, slot.StartsAt, slot.EndsAt, appt.ID); err != nil {
+			return err
+		}
+		if err := lockFreeSlot(tx, slot.ID); err != nil {
+			return err
+		}
+		appt.SlotID = slot.ID
+		appt.StartsAt = slot.StartsAt
+		appt.EndsAt = slot.EndsAt
+		return tx.Model(appt).Select("slot_id", "starts_at", "ends_at").Updates(appt).Error
+	})
+}
+
+// CancelAppointment отменяет запись, только если она ещё действует: повторная отмена
+// или отмена после автоматической отмены по завершённой привязке возвращает ErrNotBooked.
+func (r *Repo) CancelAppointment(appt *models.Appointment) error {
+	res := r.DB.Model(appt).
+		Where("status = ?", StatusBooked).
+		Select("status", "cancelled_by_id", "cancel_reason", "cancelled_at").
+		Updates(appt)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotBooked
+	}
+	return nil
+}
+
+func lockFreeSlot(tx *gorm.DB, slotID uint) error {
+	var slot models.AvailabilitySlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", slotID).First(&slot).Error; err != nil {
+		return err
+	}
+	booked, err := slotBooked(tx, slotID)
+	if err != nil {
+		return err
+	}
+	if booked {
+		return ErrSlotTaken
+	}
+	return nil
+}
+
+// lockPatientSchedule блокирует расписание пациента и проверяет, что у него нет
+// другой действующей записи на это время.
+func lockPatientSchedule(tx *gorm.DB, patientID uint, start, end time.Time, excludeID uint) error {
+	if err := advisoryLock(tx, lockPatientAppointments, patientID); err != nil {
+		return err
+	}
+	var count int64
+	if err := tx.Model(&models.Appointment{}).
+		Where("patient_id = ? AND status = ? AND id <> ? AND starts_at < ? AND ends_at > ?", patientID, StatusBooked, excludeID, end, start).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAppointmentOverlap
+	}
+	return nil
+}
+
+func slotBooked(tx *gorm.DB, slotID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Appointment{}).
+		Where("slot_id = ? AND status = ?", slotID, StatusBooked).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *Repo) GetAppointmentByID(id uint) (*models.Appointment, error) {
+	var appt models.Appointment
+	if err := r.DB.Preload("Doctor").Preload("Patient").Where("id = ?", id).First(&appt).Error; err != nil {
+		return nil, err
+	}
+	return &appt, nil
+}
+
+// GetAppointments — записи пользователя (как врача или как пациента) с началом в [from, to).
+func (r *Repo) GetAppointments(userID uint, from, to time.Time, status string) ([]models.Appointment, error) {
+	var appts []models.Appointment
+	query := r.DB.Preload("Doctor").Preload("Patient").
+		Where("(doctor_id = ? OR patient_id = ?) AND starts_at >= ? AND starts_at < ?", userID, userID, from, to)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("starts_at").Find(&appts).Error; err != nil {
+		return nil, err
+	}
+	return appts, nil
+}
+
+func (r *Repo) GetDoctorAppointments(doctorID uint, from time.Time) ([]models.Appointment, error) {
+	var appts []models.Appointment
+	if err := r.DB.Preload("Patient").
+		Where("doctor_id = ? AND status = ? AND ends_at >= ?", doctorID, StatusBooked, from).
+		Order("starts_at").
+		Find(&appts).Error; err != nil {
+		return nil, err
+	}
+	return appts, nil
+}
+
+// CancelUpcomingBySubscriptionID отменяет ещё не начавшиеся записи привязки.
+func (r *Repo) CancelUpcomingBySubscriptionID(subscriptionID uint, reason string, at time.Time) (int64, error) {
+	res := r.DB.Model(&models.Appointment{}).
+		Where("subscription_id = ? AND status = ? AND starts_at > ?", subscriptionID, StatusBooked, at).
+		Updates(map[string]any{"status": StatusCancelled, "cancel_reason": reason, "cancelled_at": at})
+	return res.RowsAffected, res.Error
+}
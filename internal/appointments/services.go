@@ -0,0 +1,375 @@
+package appointments
+
+import (
+	"errors"
+	"fmt"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/notifications"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const (
+	StatusBooked    = "booked"
+	StatusCancelled = "cancelled"
+
+	minSlotDuration    = 5 * time.Minute
+	maxSlotDuration    = 8 * time.Hour
+	defaultRangeDays   = 30
+	maxRangeDays       = 92
+	maxReasonLength    = 500
+	calendarPastDays   = 30
+	notificationLayout = "02.01.2006 15:04"
+)
+
+var (
+	ErrForbidden          = errors.New("access denied")
+	ErrInvalidSlot        = errors.New("invalid slot")
+	ErrInvalidAppointment = errors.New("invalid appointment")
+	ErrInvalidPeriod      = errors.New("invalid period")
+	ErrSlotConflict       = errors.New("slot overlaps an existing slot")
+	ErrSlotTaken          = errors.New("slot is already booked")
+	ErrAppointmentOverlap = errors.New("patient already has an appointment at this time")
+	ErrNotBooked          = errors.New("appointment is not active")
+)
+
+type Service struct {
+	Repo                 Repository
+	Diary                *diary.Service
+	NotificationsService *notifications.Service
+	Logger               *zap.Logger
+}
+
+func NewService(repo Repository, diarySrv *diary.Service, notifSrv *notifications.Service, logger *zap.Logger) *Service {
+	return &Service{
+		Repo:                 repo,
+		Diary:                diarySrv,
+		NotificationsService: notifSrv,
+		Logger:               logger,
+	}
+}
+
+// CreateSlot публикует окно приёма врача. Окна одного врача не должны пересекаться.
+func (s *Service) CreateSlot(doctorID uint, input utils.SlotInputDTO) (*models.AvailabilitySlot, error) {
+	slot := &models.AvailabilitySlot{
+		DoctorID: doctorID,
+		StartsAt: input.StartsAt.UTC(),
+		EndsAt:   input.EndsAt.UTC(),
+	}
+	duration := slot.EndsAt.Sub(slot.StartsAt)
+	if duration < minSlotDuration || duration > maxSlotDuration {
+		return nil, fmt.Errorf("%w: duration must be between %s and %s", ErrInvalidSlot, minSlotDuration, maxSlotDuration)
+	}
+	if !slot.StartsAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: slot must start in the future", ErrInvalidSlot)
+	}
+
+	if err := s.Repo.CreateSlot(slot); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// ListSlots — окна врача за период. Врач видит все свои окна, пациент с принятой
+// привязкой — только свободные и ещё не начавшиеся.
+func (s *Service) ListSlots(userID, doctorID uint, fromStr, toStr string) ([]utils.SlotDTO, error) {
+	from, to, err := parseRange(fromStr, toStr)
+	if err != nil {
+		return nil, err
+	}
+	own := userID == doctorID
+	if !own {
+		if _, err := s.Diary.GetAcceptedLink(doctorID, userID); err != nil {
+			return nil, mapDiaryError(err)
+		}
+	}
+
+	slots, err := s.Repo.GetSlots(doctorID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(slots))
+	for _, slot := range slots {
+		ids = append(ids, slot.ID)
+	}
+	booked, err := s.Repo.GetBookedSlotIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	dto := make([]utils.SlotDTO, 0, len(slots))
+	for _, slot := range slots {
+		if !own && (booked[slot.ID] || !slot.StartsAt.After(now)) {
+			continue
+		}
+		dto = append(dto, utils.SlotDTO{
+			ID:       slot.ID,
+			DoctorID: slot.DoctorID,
+			StartsAt: slot.StartsAt,
+			EndsAt:   slot.EndsAt,
+			Booked:   booked[slot.ID],
+		})
+	}
+	return dto, nil
+}
+
+func (s *Service) DeleteSlot(doctorID, slotID uint) error {
+	slot, err := s.Repo.GetSlotByID(slotID)
+	if err != nil {
+		return err
+	}
+	if slot.DoctorID != doctorID {
+		return ErrForbidden
+	}
+	return s.Repo.DeleteSlot(slot.ID)
+}
+
+// Book записывает пациента в свободное окно врача, с которым у него принятая привязка.
+func (s *Service) Book(patientID uint, input utils.BookAppointmentDTO) (*models.Appointment, error) {
+	reason := strings.TrimSpace(input.Reason)
+	if utf8.RuneCountInString(reason) > maxReasonLength {
+		return nil, fmt.Errorf("%w: reason is longer than %d characters", ErrInvalidAppointment, maxReasonLength)
+	}
+	slot, err := s.bookableSlot(input.SlotID)
+	if err != nil {
+		return nil, err
+	}
+	link, err := s.Diary.GetAcceptedLink(slot.DoctorID, patientID)
+	if err != nil {
+		return nil, mapDiaryError(err)
+	}
+
+	appt := &models.Appointment{
+		SlotID:         slot.ID,
+		SubscriptionID: link.ID,
+		DoctorID:       slot.DoctorID,
+		PatientID:      patientID,
+		StartsAt:       slot.StartsAt,
+		EndsAt:         slot.EndsAt,
+		Status:         StatusBooked,
+		Reason:         reason,
+	}
+	if err := s.Repo.BookSlot(appt); err != nil {
+		return nil, err
+	}
+
+	created, err := s.Repo.GetAppointmentByID(appt.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(created.DoctorID, fmt.Sprintf("Пациент %s %s записался на приём %s",
+		created.Patient.LastName, created.Patient.FirstName, localTime(created.StartsAt, created.Doctor.Timezone)), created.ID)
+	return created, nil
+}
+
+// Reschedule переносит запись пациента в другое свободное окно того же врача.
+func (s *Service) Reschedule(patientID, appointmentID uint, input utils.RescheduleAppointmentDTO) (*models.Appointment, error) {
+	appt, err := s.Repo.GetAppointmentByID(appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if appt.PatientID != patientID {
+		return nil, ErrForbidden
+	}
+	if appt.Status != StatusBooked || !appt.StartsAt.After(time.Now()) {
+		return nil, ErrNotBooked
+	}
+	if input.SlotID == appt.SlotID {
+		return appt, nil
+	}
+	slot, err := s.bookableSlot(input.SlotID)
+	if err != nil {
+		return nil, err
+	}
+	if slot.DoctorID != appt.DoctorID {
+		return nil, fmt.Errorf("%w: slot belongs to another doctor", ErrInvalidAppointment)
+	}
+	if _, err := s.Diary.GetAcceptedLink(appt.DoctorID, patientID); err != nil {
+		return nil, mapDiaryError(err)
+	}
+
+	previous := appt.StartsAt
+	if err := s.Repo.MoveAppointment(appt, slot); err != nil {
+		return nil, err
+	}
+	s.notify(appt.DoctorID, fmt.Sprintf("Пациент %s %s перенёс приём с %s на %s",
+		appt.Patient.LastName, appt.Patient.FirstName,
+		localTime(previous, appt.Doctor.Timezone), localTime(appt.StartsAt, appt.Doctor.Timezone)), appt.ID)
+	return appt, nil
+}
+
+// Cancel отменяет запись; отменить может и врач, и пациент, пока приём не закончился.
+func (s *Service) Cancel(userID, appointmentID uint, input utils.CancelAppointmentDTO) (*models.Appointment, error) {
+	appt, err := s.Repo.GetAppointmentByID(appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if appt.PatientID != userID && appt.DoctorID != userID {
+		return nil, ErrForbidden
+	}
+	if appt.Status != StatusBooked || !appt.EndsAt.After(time.Now()) {
+		return nil, ErrNotBooked
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if utf8.RuneCountInString(reason) > maxReasonLength {
+		return nil, fmt.Errorf("%w: reason is longer than %d characters", ErrInvalidAppointment, maxReasonLength)
+	}
+
+	now := time.Now()
+	appt.Status = StatusCancelled
+	appt.CancelledByID = &userID
+	appt.CancelReason = reason
+	appt.CancelledAt = &now
+	if err := s.Repo.CancelAppointment(appt); err != nil {
+		return nil, err
+	}
+
+	if userID == appt.PatientID {
+		s.notify(appt.DoctorID, fmt.Sprintf("Пациент %s %s отменил приём %s",
+			appt.Patient.LastName, appt.Patient.FirstName, localTime(appt.StartsAt, appt.Doctor.Timezone)), appt.ID)
+	} else {
+		s.notify(appt.PatientID, fmt.Sprintf("Врач %s %s отменил приём %s",
+			appt.Doctor.LastName, appt.Doctor.FirstName, localTime(appt.StartsAt, appt.Patient.Timezone)), appt.ID)
+	}
+	return appt, nil
+}
+
+// HandleLinkEnded отменяет будущие записи на приём по завершённой привязке.
+func (s *Service) HandleLinkEnded(link models.Subscription) {
+	count, err := s.Repo.CancelUpcomingBySubscriptionID(link.ID, "наблюдение завершено", time.Now())
+	if err != nil {
+		s.Logger.Error("failed to cancel appointments of ended link", zap.Uint("linkID", link.ID), zap.Error(err))
+		return
+	}
+	if count > 0 {
+		s.Logger.Info("appointments cancelled with ended link", zap.Uint("linkID", link.ID), zap.Int64("count", count))
+	}
+}
+
+func (s *Service) List(userID uint, fromStr, toStr, status string) ([]models.Appointment, error) {
+	from, to, err := parseRange(fromStr, toStr)
+	if err != nil {
+		return nil, err
+	}
+	if status != "" && status != StatusBooked && status != StatusCancelled {
+		return nil, fmt.Errorf("%w: status must be %s or %s", ErrInvalidAppointment, StatusBooked, StatusCancelled)
+	}
+	return s.Repo.GetAppointments(userID, from, to, status)
+}
+
+// Calendar — расписание врача в формате iCalendar: действующие записи начиная
+// с calendarPastDays дней назад.
+func (s *Service) Calendar(doctorID uint) ([]byte, error) {
+	appts, err := s.Repo.GetDoctorAppointments(doctorID, time.Now().AddDate(0, 0, -calendarPastDays))
+	if err != nil {
+		return nil, err
+	}
+	return renderCalendar(appts, time.Now()), nil
+}
+
+func (s *Service) bookableSlot(slotID uint) (*models.AvailabilitySlot, error) {
+	slot, err := s.Repo.GetSlotByID(slotID)
+	if err != nil {
+		return nil, err
+	}
+	if !slot.StartsAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: slot has already started", ErrInvalidAppointment)
+	}
+	return slot, nil
+}
+
+func (s *Service) notify(userID uint, message string, appointmentID uint) {
+	if err := s.NotificationsService.CreateNotification(userID, message); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("appointmentID", appointmentID),
+			zap.Uint("userID", userID),
+			zap.Error(err),
+		)
+	}
+}
+
+// localTime форматирует момент в часовом поясе получателя уведомления.
+func localTime(t time.Time, timezone string) string {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(notificationLayout)
+}
+
+// parseRange разбирает период YYYY-MM-DD (to включительно); по умолчанию —
+// defaultRangeDays дней начиная с сегодняшнего.
+func parseRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	y, m, d := time.Now().UTC().Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if fromStr != "" {
+		t, err := time.Parse(time.DateOnly, fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be YYYY-MM-DD", ErrInvalidPeriod)
+		}
+		from = t
+	}
+	to := from.AddDate(0, 0, defaultRangeDays)
+	if toStr != "" {
+		t, err := time.Parse(time.DateOnly, toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: to must be YYYY-MM-DD", ErrInvalidPeriod)
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from must not be after to", ErrInvalidPeriod)
+	}
+	if to.Sub(from) > maxRangeDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: period must not exceed %d days", ErrInvalidPeriod, maxRangeDays)
+	}
+	return from, to, nil
+}
+
+func mapDiaryError(err error) error {
+	if errors.Is(err, diary.ErrForbidden) {
+		return ErrForbidden
+	}
+	return err
+}
+
+func (s *Service) ToAppointmentDTO(appts []models.Appointment) []utils.AppointmentDTO {
+	dto := make([]utils.AppointmentDTO, 0, len(appts))
+	for _, a := range appts {
+		dto = append(dto, utils.AppointmentDTO{
+			ID:     a.ID,
+			SlotID: a.SlotID,
+			LinkID: a.SubscriptionID,
+			Doctor: utils.DoctorDTO{
+				ID:         a.Doctor.ID,
+				Username:   a.Doctor.Username,
+				LastName:   a.Doctor.LastName,
+				FirstName:  a.Doctor.FirstName,
+				FatherName: a.Doctor.FatherName,
+			},
+			Patient: utils.PatientDTO{
+				ID:          a.Patient.ID,
+				FirstName:   a.Patient.FirstName,
+				LastName:    a.Patient.LastName,
+				FatherName:  a.Patient.FatherName,
+				Sex:         a.Patient.Sex,
+				DateOfBirth: a.Patient.DateOfBirth.Format("02.01.2006"),
+			},
+			StartsAt:      a.StartsAt,
+			EndsAt:        a.EndsAt,
+			Status:        a.Status,
+			Reason:        a.Reason,
+			CancelledByID: a.CancelledByID,
+			CancelReason:  a.CancelReason,
+			CancelledAt:   a.CancelledAt,
+			CreatedAt:     a.CreatedAt,
+		})
+	}
+	return dto
+}
@@ -0,0 +1,191 @@
+package attachments
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"painaway_test/internal/audit"
+	"painaway_test/internal/blob"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.POST("/diary/notes/:id/attachments", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.Upload)
+	rg.GET("/diary/notes/:id/attachments", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.ListByNote)
+	rg.GET("/diary/attachments/:id", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.Download)
+	rg.GET("/diary/attachments/:id/thumbnail", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.Thumbnail)
+	rg.DELETE("/diary/attachments/:id", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.Delete)
+}
+
+func (h *Handler) Upload(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid note id", h.Logger)
+		return
+	}
+
+	// запас на служебные части multipart
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.Service.Config.MaxFileSize+1<<20)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			response.NewErrorResponse(c, http.StatusRequestEntityTooLarge, "file too large", h.Logger)
+			return
+		}
+		response.NewErrorResponse(c, http.StatusBadRequest, "multipart field \"file\" is required", h.Logger)
+		return
+	}
+	defer file.Close()
+
+	attachment, err := h.Service.Upload(c.Request.Context(), userID.(uint), uint(noteID), header.Filename, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.NewErrorResponse(c, http.StatusNotFound, "note not found", h.Logger)
+		case errors.Is(err, ErrForbidden):
+			response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+		case errors.Is(err, ErrFileTooLarge):
+			response.NewErrorResponse(c, http.StatusRequestEntityTooLarge, "file too large", h.Logger)
+		case errors.Is(err, ErrInvalidFile), errors.Is(err, ErrTooManyFiles):
+			response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+		default:
+			h.Logger.Error("failed to upload attachment",
+				zap.Uint("userID", userID.(uint)),
+				zap.Uint64("noteID", noteID),
+				zap.Error(err))
+			response.NewErrorResponse(c, http.StatusInternalServerError, "failed to upload attachment", h.Logger)
+		}
+		return
+	}
+
+	h.Logger.Info("attachment uploaded",
+		zap.Uint("userID", userID.(uint)),
+		zap.Uint("noteID", attachment.NoteID),
+		zap.Uint("attachmentID", attachment.ID),
+		zap.String("contentType", attachment.ContentType))
+	audit.Record(c, attachment.PatientID, audit.ActionCreate, audit.ResourceAttachment, attachment.ID)
+	c.JSON(http.StatusCreated, h.Service.ToAttachmentDTO([]models.Attachment{*attachment})[0])
+}
+
+func (h *Handler) ListByNote(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid note id", h.Logger)
+		return
+	}
+
+	attachments, patientID, err := h.Service.ListByNote(userID.(uint), uint(noteID))
+	if err != nil {
+		h.respondError(c, err, "failed to list attachments")
+		return
+	}
+	audit.Record(c, patientID, audit.ActionRead, audit.ResourceAttachment, 0)
+	c.JSON(http.StatusOK, h.Service.ToAttachmentDTO(attachments))
+}
+
+func (h *Handler) Download(c *gin.Context) {
+	h.serve(c, false)
+}
+
+func (h *Handler) Thumbnail(c *gin.Context) {
+	h.serve(c, true)
+}
+
+func (h *Handler) serve(c *gin.Context, thumbnail bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid attachment id", h.Logger)
+		return
+	}
+
+	attachment, rc, err := h.Service.Open(c.Request.Context(), userID.(uint), uint(attachmentID), thumbnail)
+	if err != nil {
+		h.respondError(c, err, "failed to open attachment")
+		return
+	}
+	defer rc.Close()
+	audit.Record(c, attachment.PatientID, audit.ActionRead, audit.ResourceAttachment, attachment.ID)
+
+	contentType := attachment.ContentType
+	disposition := "attachment"
+	if thumbnail {
+		contentType = "image/jpeg"
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, rc); err != nil {
+		h.Logger.Warn("failed to stream attachment", zap.Uint64("attachmentID", attachmentID), zap.Error(err))
+	}
+}
+
+func (h *Handler) Delete(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid attachment id", h.Logger)
+		return
+	}
+
+	if err := h.Service.Delete(c.Request.Context(), userID.(uint), uint(attachmentID)); err != nil {
+		h.respondError(c, err, "failed to delete attachment")
+		return
+	}
+
+	h.Logger.Info("attachment deleted", zap.Uint("userID", userID.(uint)), zap.Uint64("attachmentID", attachmentID))
+	audit.Record(c, userID.(uint), audit.ActionDelete, audit.ResourceAttachment, uint(attachmentID))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, blob.ErrNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
@@ -0,0 +1,53 @@
+package attachments
+
+import (
+	"painaway_test/models"
+
+	"gorm.io/gorm"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	CreateAttachment(attachment *models.Attachment) error
+	GetAttachmentByID(id uint) (*models.Attachment, error)
+	GetAttachmentsByNoteID(noteID uint) ([]models.Attachment, error)
+	CountAttachmentsByNoteID(noteID uint) (int64, error)
+	DeleteAttachment(id uint) error
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+func (r *Repo) CreateAttachment(attachment *models.Attachment) error {
+	return r.DB.Create(attachment).Error
+}
+
+func (r *Repo) GetAttachmentByID(id uint) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := r.DB.Where("id = ?", id).First(&attachment).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func (r *Repo) GetAttachmentsByNoteID(noteID uint) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	if err := r.DB.Where("note_id = ?", noteID).Order("created_at").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func (r *Repo) CountAttachmentsByNoteID(noteID uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.Attachment{}).Where("note_id = ?", noteID).Count(&count).Error
+	return count, err
+}
+
+func (r *Repo) DeleteAttachment(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.Attachment{}).Error
+}
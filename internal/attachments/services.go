@@ -0,0 +1,269 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"painaway_test/internal/blob"
+	"painaway_test/internal/config"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/gabriel-vasile/mimetype"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrForbidden    = errors.New("access denied")
+	ErrInvalidFile  = errors.New("invalid file")
+	ErrFileTooLarge = errors.New("file too large")
+	ErrTooManyFiles = errors.New("too many attachments")
+)
+
+// allowedContentTypes — что пациент может прикрепить к записи. Тип определяется
+// по содержимому файла, а не по расширению или заголовку клиента.
+var allowedContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/heic":      true,
+	"application/pdf": true,
+}
+
+type Service struct {
+	Repo    Repository
+	Storage blob.Storage
+	Diary   *diary.Service
+	Config  *config.AttachmentsConfig
+	Logger  *zap.Logger
+}
+
+func NewService(repo Repository, storage blob.Storage, diarySrv *diary.Service, cfg *config.AttachmentsConfig, logger *zap.Logger) *Service {
+	return &Service{
+		Repo:    repo,
+		Storage: storage,
+		Diary:   diarySrv,
+		Config:  cfg,
+		Logger:  logger,
+	}
+}
+
+func (s *Service) Upload(ctx context.Context, userID, noteID uint, fileName string, r io.Reader) (*models.Attachment, error) {
+	note, err := s.Diary.GetNote(noteID)
+	if err != nil {
+		return nil, err
+	}
+	if note.PatientID != userID {
+		return nil, ErrForbidden
+	}
+
+	if s.Config.MaxPerNote > 0 {
+		count, err := s.Repo.CountAttachmentsByNoteID(noteID)
+		if err != nil {
+			return nil, err
+		}
+		if count >= int64(s.Config.MaxPerNote) {
+			return nil, ErrTooManyFiles
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, s.Config.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.Config.MaxFileSize {
+		return nil, ErrFileTooLarge
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidFile)
+	}
+
+	contentType, ext, err := DetectFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("attachments/%d/%d/%s%s", note.PatientID, note.ID, RandomHex(16), ext)
+	if err := s.Storage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, err
+	}
+
+	attachment := &models.Attachment{
+		NoteID:      note.ID,
+		PatientID:   note.PatientID,
+		UploaderID:  userID,
+		FileName:    SanitizeFileName(fileName),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		StorageKey:  key,
+	}
+
+	if thumbnailable[contentType] {
+		attachment.ThumbnailKey = s.storeThumbnail(ctx, key, data)
+	}
+
+	if err := s.Repo.CreateAttachment(attachment); err != nil {
+		s.removeBlobs(ctx, attachment)
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// storeThumbnail возвращает ключ превью или пустую строку: без превью вложение остаётся рабочим.
+func (s *Service) storeThumbnail(ctx context.Context, key string, data []byte) string {
+	thumb, err := makeThumbnail(data, s.Config.ThumbnailSize)
+	if err != nil {
+		s.Logger.Warn("failed to generate thumbnail", zap.String("key", key), zap.Error(err))
+		return ""
+	}
+
+	thumbKey := strings.TrimSuffix(key, filepath.Ext(key)) + "_thumb.jpg"
+	if err := s.Storage.Put(ctx, thumbKey, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+		s.Logger.Warn("failed to store thumbnail", zap.String("key", thumbKey), zap.Error(err))
+		return ""
+	}
+	return thumbKey
+}
+
+// ListByNote возвращает вложения записи и пациента, которому она принадлежит.
+func (s *Service) ListByNote(userID, noteID uint) ([]models.Attachment, uint, error) {
+	note, err := s.Diary.GetNote(noteID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkAccess(userID, note); err != nil {
+		return nil, 0, err
+	}
+	attachments, err := s.Repo.GetAttachmentsByNoteID(noteID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return attachments, note.PatientID, nil
+}
+
+// Open отдаёт содержимое вложения (или его превью). Закрыть reader должен вызывающий.
+func (s *Service) Open(ctx context.Context, userID, attachmentID uint, thumbnail bool) (*models.Attachment, io.ReadCloser, error) {
+	attachment, err := s.Repo.GetAttachmentByID(attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	note, err := s.Diary.GetNote(attachment.NoteID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkAccess(userID, note); err != nil {
+		return nil, nil, err
+	}
+
+	key := attachment.StorageKey
+	if thumbnail {
+		if attachment.ThumbnailKey == "" {
+			return nil, nil, blob.ErrNotFound
+		}
+		key = attachment.ThumbnailKey
+	}
+
+	rc, err := s.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, rc, nil
+}
+
+func (s *Service) Delete(ctx context.Context, userID, attachmentID uint) error {
+	attachment, err := s.Repo.GetAttachmentByID(attachmentID)
+	if err != nil {
+		return err
+	}
+	if attachment.PatientID != userID {
+		return ErrForbidden
+	}
+
+	if err := s.Repo.DeleteAttachment(attachment.ID); err != nil {
+		return err
+	}
+	s.removeBlobs(ctx, attachment)
+	return nil
+}
+
+// checkAccess проверяет, что запись пациента доступна пользователю по согласию.
+func (s *Service) checkAccess(userID uint, note *models.Note) error {
+	err := s.Diary.CheckPatientData(userID, note.PatientID, diary.ScopeAttachments, note.RecordedAt)
+	if errors.Is(err, diary.ErrForbidden) {
+		return ErrForbidden
+	}
+	return err
+}
+
+func (s *Service) removeBlobs(ctx context.Context, attachment *models.Attachment) {
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.Storage.Delete(ctx, key); err != nil {
+			s.Logger.Warn("failed to delete blob", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+func (s *Service) ToAttachmentDTO(attachments []models.Attachment) []utils.AttachmentDTO {
+	dto := make([]utils.AttachmentDTO, 0, len(attachments))
+	for _, a := range attachments {
+		item := utils.AttachmentDTO{
+			ID:          a.ID,
+			NoteID:      a.NoteID,
+			FileName:    a.FileName,
+			ContentType: a.ContentType,
+			Size:        a.Size,
+			URL:         fmt.Sprintf("/api/diary/attachments/%d", a.ID),
+			CreatedAt:   a.CreatedAt,
+		}
+		if a.ThumbnailKey != "" {
+			item.ThumbnailURL = fmt.Sprintf("/api/diary/attachments/%d/thumbnail", a.ID)
+		}
+		dto = append(dto, item)
+	}
+	return dto
+}
+
+// DetectFile определяет тип файла по содержимому и проверяет, что такой тип разрешён.
+func DetectFile(data []byte) (contentType, ext string, err error) {
+	mtype := mimetype.Detect(data)
+	contentType, _, _ = strings.Cut(mtype.String(), ";")
+	if !allowedContentTypes[contentType] {
+		return "", "", fmt.Errorf("%w: content type %s is not allowed", ErrInvalidFile, contentType)
+	}
+	return contentType, mtype.Extension(), nil
+}
+
+func SanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	return name
+}
+
+func RandomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
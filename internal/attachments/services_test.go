@@ -0,0 +1,275 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"painaway_test/internal/blob"
+	"painaway_test/internal/config"
+	"painaway_test/internal/diary"
+	"painaway_test/models"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	patientID  = 1
+	doctorID   = 2
+	strangerID = 3
+)
+
+type fakeRepo struct {
+	attachments map[uint]*models.Attachment
+	nextID      uint
+}
+
+func (r *fakeRepo) CreateAttachment(a *models.Attachment) error {
+	r.nextID++
+	a.ID = r.nextID
+	r.attachments[a.ID] = a
+	return nil
+}
+
+func (r *fakeRepo) GetAttachmentByID(id uint) (*models.Attachment, error) {
+	a, ok := r.attachments[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return a, nil
+}
+
+func (r *fakeRepo) GetAttachmentsByNoteID(noteID uint) ([]models.Attachment, error) {
+	var res []models.Attachment
+	for _, a := range r.attachments {
+		if a.NoteID == noteID {
+			res = append(res, *a)
+		}
+	}
+	return res, nil
+}
+
+func (r *fakeRepo) CountAttachmentsByNoteID(noteID uint) (int64, error) {
+	list, _ := r.GetAttachmentsByNoteID(noteID)
+	return int64(len(list)), nil
+}
+
+func (r *fakeRepo) DeleteAttachment(id uint) error {
+	delete(r.attachments, id)
+	return nil
+}
+
+// fakeDiaryRepo реализует только то, что нужно для проверки доступа к записи;
+// вызов любого другого метода упадёт на nil-интерфейсе.
+type fakeDiaryRepo struct {
+	diary.Repository
+	notes   map[uint]*models.Note
+	link    *models.Subscription
+	consent *models.LinkConsent
+}
+
+func (r *fakeDiaryRepo) GetNoteByID(noteID uint) (*models.Note, error) {
+	note, ok := r.notes[noteID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return note, nil
+}
+
+func (r *fakeDiaryRepo) GetAcceptedLink(doctorID, patientID uint) (*models.Subscription, error) {
+	if r.link == nil || r.link.DoctorID != doctorID || r.link.PatientID != patientID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.link, nil
+}
+
+func (r *fakeDiaryRepo) GetCurrentConsent(subscriptionID uint) (*models.LinkConsent, error) {
+	if r.consent == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.consent, nil
+}
+
+type testEnv struct {
+	service *Service
+	diary   *fakeDiaryRepo
+	note    *models.Note
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	storage, err := blob.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	note := &models.Note{ID: 10, PatientID: patientID, RecordedAt: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	diaryRepo := &fakeDiaryRepo{
+		notes: map[uint]*models.Note{note.ID: note},
+		link:  &models.Subscription{ID: 5, DoctorID: doctorID, PatientID: patientID},
+	}
+	logger := zap.NewNop()
+	service := NewService(
+		&fakeRepo{attachments: make(map[uint]*models.Attachment)},
+		storage,
+		diary.NewService(diaryRepo, nil, logger),
+		&config.AttachmentsConfig{MaxFileSize: 1 << 20, MaxPerNote: 2, ThumbnailSize: 32},
+		logger,
+	)
+	return &testEnv{service: service, diary: diaryRepo, note: note}
+}
+
+func (e *testEnv) upload(t *testing.T) *models.Attachment {
+	t.Helper()
+	a, err := e.service.Upload(context.Background(), patientID, e.note.ID, "photo.png", bytes.NewReader(encodePNG(t, 64, 48)))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	return a
+}
+
+func TestUploadStoresFileAndThumbnail(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.upload(t)
+
+	if a.ContentType != "image/png" {
+		t.Errorf("content type = %q, want image/png", a.ContentType)
+	}
+	if a.ThumbnailKey == "" {
+		t.Error("thumbnail was not generated")
+	}
+	if !strings.HasPrefix(a.StorageKey, "attachments/1/10/") || !strings.HasSuffix(a.StorageKey, ".png") {
+		t.Errorf("unexpected storage key %q", a.StorageKey)
+	}
+}
+
+func TestUploadRejects(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\ntrailer\n<<>>\n%%EOF\n")
+	tests := []struct {
+		name    string
+		userID  uint
+		data    []byte
+		wantErr error
+	}{
+		{"plain text", patientID, []byte("just some text"), ErrInvalidFile},
+		{"html disguised as image", patientID, []byte("<html><script>alert(1)</script></html>"), ErrInvalidFile},
+		{"executable", patientID, []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff"), ErrInvalidFile},
+		{"empty file", patientID, nil, ErrInvalidFile},
+		{"too large", patientID, bytes.Repeat([]byte{0}, 1<<20+1), ErrFileTooLarge},
+		{"someone else's note", doctorID, pdf, ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			_, err := env.service.Upload(context.Background(), tt.userID, env.note.ID, "file", bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Upload error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUploadLimitPerNote(t *testing.T) {
+	env := newTestEnv(t)
+	env.upload(t)
+	env.upload(t)
+	_, err := env.service.Upload(context.Background(), patientID, env.note.ID, "photo.png", bytes.NewReader(encodePNG(t, 8, 8)))
+	if !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("third upload error = %v, want ErrTooManyFiles", err)
+	}
+}
+
+func TestOpenAccess(t *testing.T) {
+	after := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	expired := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name    string
+		userID  uint
+		noLink  bool
+		consent *models.LinkConsent
+		wantErr error
+	}{
+		{"patient", patientID, false, nil, nil},
+		{"doctor without consent record", doctorID, false, nil, nil},
+		{"doctor with attachments scope", doctorID, false, &models.LinkConsent{Scopes: []string{diary.ScopeAttachments}}, nil},
+		{"stranger", strangerID, false, nil, ErrForbidden},
+		{"doctor without link", doctorID, true, nil, ErrForbidden},
+		{"scope not granted", doctorID, false, &models.LinkConsent{Scopes: []string{diary.ScopeNotes}}, ErrForbidden},
+		{"note before data_from", doctorID, false, &models.LinkConsent{Scopes: []string{diary.ScopeAttachments}, DataFrom: &after}, ErrForbidden},
+		{"consent expired", doctorID, false, &models.LinkConsent{Scopes: []string{diary.ScopeAttachments}, ExpiresAt: &expired}, ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			a := env.upload(t)
+			if tt.noLink {
+				env.diary.link = nil
+			}
+			env.diary.consent = tt.consent
+
+			for _, thumbnail := range []bool{false, true} {
+				_, rc, err := env.service.Open(context.Background(), tt.userID, a.ID, thumbnail)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Open(thumbnail=%v) error = %v, want %v", thumbnail, err, tt.wantErr)
+				}
+				if err != nil {
+					continue
+				}
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				if len(data) == 0 {
+					t.Errorf("Open(thumbnail=%v) returned empty content", thumbnail)
+				}
+			}
+
+			_, _, err := env.service.ListByNote(tt.userID, env.note.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ListByNote error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenMissingThumbnail(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.upload(t)
+	a.ThumbnailKey = ""
+
+	if _, _, err := env.service.Open(context.Background(), patientID, a.ID, true); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("Open thumbnail error = %v, want blob.ErrNotFound", err)
+	}
+}
+
+func TestDeleteOnlyByOwner(t *testing.T) {
+	env := newTestEnv(t)
+	a := env.upload(t)
+
+	if err := env.service.Delete(context.Background(), doctorID, a.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Delete by doctor error = %v, want ErrForbidden", err)
+	}
+	if err := env.service.Delete(context.Background(), patientID, a.ID); err != nil {
+		t.Fatalf("Delete by patient: %v", err)
+	}
+	if _, err := env.service.Storage.Get(context.Background(), a.StorageKey); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("blob still exists after Delete: %v", err)
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := map[string]string{
+		"photo.png":            "photo.png",
+		"../../etc/passwd":     "passwd",
+		`C:\Users\me\scan.pdf`: "scan.pdf",
+		"a\"b\nc.jpg":          "abc.jpg",
+		"":                     "file",
+		"/":                    "file",
+	}
+	for in, want := range tests {
+		if got := SanitizeFileName(in); got != want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
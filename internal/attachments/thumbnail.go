@@ -0,0 +1,97 @@
+package attachments
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// thumbnailable — форматы, которые умеет декодировать стандартная библиотека.
+var thumbnailable = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// maxThumbnailPixels — предел размеров изображения, для которого строится превью.
+// Маленький файл может объявить огромные размеры (decompression bomb), а декодер
+// выделяет память под все пиксели сразу.
+const maxThumbnailPixels = 50_000_000
+
+// makeThumbnail уменьшает изображение так, чтобы большая сторона была не больше maxSide,
+// и кодирует результат в JPEG. Маленькие изображения не увеличиваются.
+func makeThumbnail(data []byte, maxSide int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxThumbnailPixels {
+		return nil, fmt.Errorf("image is too large for thumbnail: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			h = max(1, h*maxSide/w)
+			w = maxSide
+		} else {
+			w = max(1, w*maxSide/h)
+			h = maxSide
+		}
+	}
+
+	dst := downscale(src, w, h)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale усредняет блоки исходных пикселей (box filter). Для превью этого
+// достаточно и не требует внешних зависимостей.
+func downscale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*sh/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*sw/w
+			x1 := max(x0+1, b.Min.X+(x+1)*sw/w)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
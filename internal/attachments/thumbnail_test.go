@@ -0,0 +1,81 @@
+package attachments
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withPNGSize подменяет размеры в заголовке IHDR, не трогая данные: так выглядит
+// decompression bomb — маленький файл, объявляющий огромное изображение.
+func withPNGSize(data []byte, w, h uint32) []byte {
+	out := append([]byte(nil), data...)
+	// сигнатура (8) + длина чанка (4) + тип "IHDR" (4)
+	ihdr := out[16:29]
+	binary.BigEndian.PutUint32(ihdr[0:4], w)
+	binary.BigEndian.PutUint32(ihdr[4:8], h)
+	binary.BigEndian.PutUint32(out[29:33], crc32.ChecksumIEEE(out[12:29]))
+	return out
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	tests := []struct {
+		name         string
+		w, h         int
+		wantW, wantH int
+	}{
+		{"landscape", 640, 320, 100, 50},
+		{"portrait", 200, 800, 25, 100},
+		{"small is not enlarged", 40, 30, 40, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, err := makeThumbnail(encodePNG(t, tt.w, tt.h), 100)
+			if err != nil {
+				t.Fatalf("makeThumbnail: %v", err)
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatalf("decode thumbnail: %v", err)
+			}
+			if format != "jpeg" {
+				t.Errorf("format = %q, want jpeg", format)
+			}
+			if cfg.Width != tt.wantW || cfg.Height != tt.wantH {
+				t.Errorf("size = %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestMakeThumbnailRejectsDecompressionBomb(t *testing.T) {
+	bomb := withPNGSize(encodePNG(t, 1, 1), 100_000, 100_000)
+	if _, err := makeThumbnail(bomb, 100); err == nil {
+		t.Fatal("makeThumbnail accepted a 100000x100000 image")
+	}
+}
+
+func TestMakeThumbnailRejectsGarbage(t *testing.T) {
+	if _, err := makeThumbnail([]byte("not an image"), 100); err == nil {
+		t.Fatal("makeThumbnail accepted non-image data")
+	}
+}
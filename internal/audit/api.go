@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/audit/me", rbac.RequirePermission(logger, rbac.PermAuditOwn), h.PatientLog)
+}
+
+// RegisterAdminRoutes регистрирует маршруты администратора; права проверяются на каждом маршруте.
+func RegisterAdminRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/audit/", rbac.RequirePermission(logger, rbac.PermAuditRead), h.AdminQuery)
+}
+
+// PatientLog — GET /audit/me?resource=&action=&from=&to=&offset=&limit=, кто смотрел мои данные.
+func (h *Handler) PatientLog(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	query, ok := h.parseQuery(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.Service.PatientLog(userID.(uint), query)
+	if err != nil {
+		h.respondError(c, err, "failed to get access log")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// AdminQuery — GET /admin/audit/?patient_id=&actor_id=&resource=&action=&request_id=&from=&to=&offset=&limit=.
+func (h *Handler) AdminQuery(c *gin.Context) {
+	query, ok := h.parseQuery(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.Service.Query(query)
+	if err != nil {
+		h.respondError(c, err, "failed to query access log")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// parseQuery разбирает условия выборки; при ошибке ответ уже отправлен.
+func (h *Handler) parseQuery(c *gin.Context) (utils.AccessLogQueryDTO, bool) {
+	query := utils.AccessLogQueryDTO{
+		Action:    c.Query("action"),
+		Resource:  c.Query("resource"),
+		RequestID: c.Query("request_id"),
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+	}
+	for _, p := range []struct {
+		name string
+		dst  *uint
+	}{{"patient_id", &query.PatientID}, {"actor_id", &query.ActorID}} {
+		if v := c.Query(p.name); v != "" {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				response.NewErrorResponse(c, http.StatusBadRequest, "invalid "+p.name, h.Logger)
+				return query, false
+			}
+			*p.dst = uint(id)
+		}
+	}
+	var err error
+	if v := c.Query("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid offset", h.Logger)
+			return query, false
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid limit", h.Logger)
+			return query, false
+		}
+	}
+	return query, true
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrInvalidFilter):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"bytes"
+	"net/http"
+	logm "painaway_test/internal/log"
+	"painaway_test/internal/response"
+	"painaway_test/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const entriesKey = "auditEntries"
+
+// Record отмечает обращение к данным пациента в рамках текущего запроса.
+// В журнал запись попадёт, только если запрос завершится успешно. Вызывать до
+// записи ответа: ответ придерживается, пока запись журнала не сохранена.
+// resourceID = 0 — обращение ко всем данным этого вида (списки, отчёты).
+func Record(c *gin.Context, patientID uint, action, resource string, resourceID uint) {
+	RecordDetails(c, patientID, action, resource, resourceID, "")
+}
+
+// RecordDetails — то же, что Record, с пояснением к записи (например, какие
+// роли выдал администратор).
+func RecordDetails(c *gin.Context, patientID uint, action, resource string, resourceID uint, details string) {
+	entry := models.AccessLog{
+		PatientID: patientID,
+		Action:    action,
+		Resource:  resource,
+		Details:   details,
+	}
+	if resourceID != 0 {
+		entry.ResourceID = &resourceID
+	}
+	var entries []models.AccessLog
+	if v, ok := c.Get(entriesKey); ok {
+		entries = v.([]models.AccessLog)
+	}
+	c.Set(entriesKey, append(entries, entry))
+
+	if w, ok := c.Writer.(*deferredWriter); ok && !w.ResponseWriter.Written() {
+		w.deferred = true
+	}
+}
+
+// Middleware сохраняет отмеченные обработчиком обращения после его завершения.
+// Ответ запроса с отметками отправляется только после записи журнала; если
+// записать журнал не удалось, клиент получает 500 вместо данных.
+// Должен стоять после AuthMiddleware.
+func Middleware(service *Service, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := &deferredWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		v, ok := c.Get(entriesKey)
+		if !ok || w.Status() >= 400 {
+			w.flush()
+			return
+		}
+		entries := v.([]models.AccessLog)
+		actorID := c.GetUint("userID")
+		for i := range entries {
+			entries[i].ActorID = actorID
+			entries[i].IP = c.ClientIP()
+			entries[i].RequestID = c.GetString(logm.RequestIDKey)
+		}
+		if err := service.Record(entries); err != nil {
+			logger.Error("failed to write access log",
+				zap.Uint("actorID", actorID),
+				zap.String("requestID", c.GetString(logm.RequestIDKey)),
+				zap.Int("entries", len(entries)),
+				zap.Error(err))
+			if w.deferred {
+				w.discard()
+				response.NewErrorResponse(c, http.StatusInternalServerError, "failed to write access log", logger)
+			}
+			return
+		}
+		w.flush()
+	}
+}
+
+// deferredWriter пропускает ответ как есть, пока обработчик не отметит обращение
+// через Record; после этого статус и тело придерживаются до записи журнала.
+type deferredWriter struct {
+	gin.ResponseWriter
+	deferred bool
+	status   int
+	body     bytes.Buffer
+}
+
+func (w *deferredWriter) WriteHeader(code int) {
+	if !w.deferred {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *deferredWriter) WriteHeaderNow() {
+	if !w.deferred {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *deferredWriter) Write(b []byte) (int, error) {
+	if !w.deferred {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *deferredWriter) WriteString(s string) (int, error) {
+	if !w.deferred {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.body.WriteString(s)
+}
+
+func (w *deferredWriter) Status() int {
+	if w.deferred && w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *deferredWriter) Size() int {
+	if w.deferred {
+		return w.body.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+func (w *deferredWriter) Written() bool {
+	if w.deferred {
+		return w.status != 0 || w.body.Len() > 0
+	}
+	return w.ResponseWriter.Written()
+}
+
+func (w *deferredWriter) Flush() {
+	if !w.deferred {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// flush отправляет придержанный ответ.
+func (w *deferredWriter) flush() {
+	if !w.deferred {
+		return
+	}
+	w.deferred = false
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// discard отбрасывает придержанный ответ вместе с заголовками содержимого.
+func (w *deferredWriter) discard() {
+	w.deferred = false
+	w.body.Reset()
+	for _, h := range []string{"Content-Type", "Content-Length", "Content-Disposition", "Cache-Control"} {
+		w.Header().Del(h)
+	}
+}
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"painaway_test/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+// Repository намеренно не умеет изменять и удалять записи: журнал только дополняется.
+type Repository interface {
+	CreateEntries(entries []models.AccessLog) error
+	ListEntries(filter Filter, offset, limit int) ([]models.AccessLog, int64, error)
+}
+
+// Filter — условия выборки журнала; нулевые поля не ограничивают выборку.
+type Filter struct {
+	PatientID    uint
+	ActorID      uint
+	ExcludeActor uint
+	Action       string
+	Resource     string
+	RequestID    string
+	From         *time.Time
+	To           *time.Time
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+func (r *Repo) CreateEntries(entries []models.AccessLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return r.DB.Create(&entries).Error
+}
+
+// ListEntries — записи журнала, новые первыми, и их общее число без учёта offset/limit.
+func (r *Repo) ListEntries(filter Filter, offset, limit int) ([]models.AccessLog, int64, error) {
+	query := r.DB.Model(&models.AccessLog{})
+	if filter.PatientID != 0 {
+		query = query.Where("patient_id = ?", filter.PatientID)
+	}
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.ExcludeActor != 0 {
+		query = query.Where("actor_id <> ?", filter.ExcludeActor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Resource != "" {
+		query = query.Where("resource = ?", filter.Resource)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var entries []models.AccessLog
+	if err := query.Preload("Actor.Roles").
+		Order("created_at DESC, id DESC").
+		Offset(offset).Limit(limit).
+		Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Действия над данными пациента.
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Действия администратора над аккаунтом (ресурс ResourceAccount).
+const (
+	ActionLock          = "lock"
+	ActionUnlock        = "unlock"
+	ActionSetRoles      = "set_roles"
+	ActionResetPassword = "reset_password"
+	ActionMerge         = "merge"
+	ActionRestore       = "restore"
+)
+
+// Виды данных пациента, доступ к которым попадает в журнал.
+const (
+	ResourceNote         = "note"
+	ResourcePrescription = "prescription"
+	ResourceDiagnosis    = "diagnosis"
+	ResourceProfile      = "profile"
+	ResourceAttachment   = "attachment"
+	ResourceComment      = "comment"
+	ResourceAccount      = "account"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid audit filter")
+
+	actions = []string{
+		ActionRead, ActionCreate, ActionUpdate, ActionDelete,
+		ActionLock, ActionUnlock, ActionSetRoles, ActionResetPassword, ActionMerge, ActionRestore,
+	}
+	resources = []string{
+		ResourceNote, ResourcePrescription, ResourceDiagnosis, ResourceProfile,
+		ResourceAttachment, ResourceComment, ResourceAccount,
+	}
+)
+
+type Service struct {
+	Repo   Repository
+	Logger *zap.Logger
+}
+
+func NewService(repo Repository, logger *zap.Logger) *Service {
+	return &Service{Repo: repo, Logger: logger}
+}
+
+func (s *Service) Record(entries []models.AccessLog) error {
+	return s.Repo.CreateEntries(entries)
+}
+
+// PatientLog — кто и когда обращался к данным пациента; собственные действия
+// пациента в выдачу не попадают.
+func (s *Service) PatientLog(patientID uint, input utils.AccessLogQueryDTO) (*utils.AccessLogPageDTO, error) {
+	filter, err := buildFilter(input)
+	if err != nil {
+		return nil, err
+	}
+	filter.PatientID = patientID
+	filter.ExcludeActor = patientID
+	filter.ActorID = 0
+	filter.RequestID = ""
+	page, err := s.list(filter, input.Offset, input.Limit)
+	if err != nil {
+		return nil, err
+	}
+	// сетевые подробности нужны только для расследований, пациенту их не показываем
+	for i := range page.Items {
+		page.Items[i].IP = ""
+		page.Items[i].RequestID = ""
+	}
+	return page, nil
+}
+
+// Query — выборка журнала для администратора по любым условиям.
+func (s *Service) Query(input utils.AccessLogQueryDTO) (*utils.AccessLogPageDTO, error) {
+	filter, err := buildFilter(input)
+	if err != nil {
+		return nil, err
+	}
+	return s.list(filter, input.Offset, input.Limit)
+}
+
+func (s *Service) list(filter Filter, offset, limit int) (*utils.AccessLogPageDTO, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidFilter)
+	}
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	entries, total, err := s.Repo.ListEntries(filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]utils.AccessLogDTO, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, toAccessLogDTO(e))
+	}
+	return &utils.AccessLogPageDTO{Items: items, Total: total, Offset: offset, Limit: limit}, nil
+}
+
+func buildFilter(input utils.AccessLogQueryDTO) (Filter, error) {
+	filter := Filter{
+		PatientID: input.PatientID,
+		ActorID:   input.ActorID,
+		Action:    strings.ToLower(strings.TrimSpace(input.Action)),
+		Resource:  strings.ToLower(strings.TrimSpace(input.Resource)),
+		RequestID: strings.TrimSpace(input.RequestID),
+	}
+	if filter.Action != "" && !contains(actions, filter.Action) {
+		return Filter{}, fmt.Errorf("%w: unknown action %q", ErrInvalidFilter, filter.Action)
+	}
+	if filter.Resource != "" && !contains(resources, filter.Resource) {
+		return Filter{}, fmt.Errorf("%w: unknown resource %q", ErrInvalidFilter, filter.Resource)
+	}
+	if input.From != "" {
+		t, err := time.Parse(time.DateOnly, input.From)
+		if err != nil {
+			return Filter{}, fmt.Errorf("%w: from must be YYYY-MM-DD", ErrInvalidFilter)
+		}
+		filter.From = &t
+	}
+	if input.To != "" {
+		t, err := time.Parse(time.DateOnly, input.To)
+		if err != nil {
+			return Filter{}, fmt.Errorf("%w: to must be YYYY-MM-DD", ErrInvalidFilter)
+		}
+		t = t.AddDate(0, 0, 1)
+		filter.To = &t
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return Filter{}, fmt.Errorf("%w: from is after to", ErrInvalidFilter)
+	}
+	return filter, nil
+}
+
+func toAccessLogDTO(e models.AccessLog) utils.AccessLogDTO {
+	return utils.AccessLogDTO{
+		ID:         e.ID,
+		ActorID:    e.ActorID,
+		ActorName:  strings.TrimSpace(e.Actor.LastName + " " + e.Actor.FirstName),
+		ActorGroup: rbac.PrimaryRole(rbac.RoleNames(e.Actor.Roles)),
+		PatientID:  e.PatientID,
+		Action:     e.Action,
+		Resource:   e.Resource,
+		ResourceID: e.ResourceID,
+		IP:         e.IP,
+		RequestID:  e.RequestID,
+		Details:    e.Details,
+		CreatedAt:  e.CreatedAt,
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"painaway_test/internal/config"
+	"painaway_test/internal/rbac"
 	"painaway_test/internal/response"
 	"painaway_test/internal/utils"
 	"painaway_test/models"
@@ -62,7 +64,6 @@ func (h *Handler) Register(c *gin.Context) {
 		FatherName:  strings.TrimSpace(input.FatherName),
 		Sex:         input.Sex,
 		DateOfBirth: dob,
-		Groups:      "Patient",
 	}
 
 	if err := h.Service.Register(user); err != nil {
@@ -71,7 +72,8 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
-	token, err := utils.GenerateAccessToken(*h.JWTConfig, user.ID, user.Groups)
+	roles := rbac.RoleNames(user.Roles)
+	token, err := utils.GenerateAccessToken(*h.JWTConfig, user.ID, roles, user.SessionVersion)
 	if err != nil {
 		h.Logger.Error("failed to generate access token", zap.Error(err), zap.Uint("userID", user.ID))
 		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to generate token", h.Logger)
@@ -83,7 +85,8 @@ func (h *Handler) Register(c *gin.Context) {
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
-			"groups":   user.Groups,
+			"roles":    roles,
+			"groups":   rbac.PrimaryRole(roles),
 		},
 	})
 }
@@ -100,19 +103,26 @@ func (h *Handler) Login(c *gin.Context) {
 
 	user, err := h.Service.Login(input.Username, input.Password)
 	if err != nil {
+		if errors.Is(err, ErrAccountLocked) {
+			response.NewErrorResponse(c, http.StatusForbidden, "account is locked", h.Logger)
+			return
+		}
 		response.NewErrorResponse(c, http.StatusUnauthorized, "invalid credentials", h.Logger)
 		return
 	}
 
-	token, _ := utils.GenerateAccessToken(*h.JWTConfig, user.ID, user.Groups)
+	roles := rbac.RoleNames(user.Roles)
+	token, _ := utils.GenerateAccessToken(*h.JWTConfig, user.ID, roles, user.SessionVersion)
 	h.Logger.Info("User logged in successfully", zap.String("username", user.Username), zap.Uint("user_id", user.ID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"token": token,
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"groups":   user.Groups,
+			"id":                      user.ID,
+			"username":                user.Username,
+			"roles":                   roles,
+			"groups":                  rbac.PrimaryRole(roles),
+			"password_reset_required": user.PasswordResetRequired,
 		},
 	})
 }
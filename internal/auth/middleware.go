@@ -1,18 +1,30 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"painaway_test/internal/config"
+	"painaway_test/internal/rbac"
 	"painaway_test/internal/response"
+	"painaway_test/internal/users"
 	"painaway_test/internal/utils"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
-func AuthMiddleware(cfg *config.JWTConfig, logger *zap.Logger) gin.HandlerFunc {
+// passwordResetRoutes — что доступно после входа по временному паролю, пока он не сменён.
+var passwordResetRoutes = map[string]bool{
+	"/api/auth/profile":      true,
+	"/api/users/me/password": true,
+}
+
+// AuthMiddleware проверяет токен и состояние аккаунта и кладёт в контекст
+// пользователя, его роли и права.
+func AuthMiddleware(cfg *config.JWTConfig, userRepo users.Repository, roles *rbac.Service, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -46,8 +58,41 @@ func AuthMiddleware(cfg *config.JWTConfig, logger *zap.Logger) gin.HandlerFunc {
 			return
 		}
 
+		// блокировка, удаление и отзыв сессий действуют сразу, не дожидаясь истечения токена
+		account, err := userRepo.GetAccountState(claims.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				response.NewErrorResponse(c, http.StatusUnauthorized, "account not found", logger)
+				return
+			}
+			logger.Error("failed to check account state", zap.Uint("userID", claims.UserID), zap.Error(err))
+			response.NewErrorResponse(c, http.StatusInternalServerError, "failed to check account state", logger)
+			return
+		}
+		if account.LockedAt != nil {
+			response.NewErrorResponse(c, http.StatusForbidden, "account is locked", logger)
+			return
+		}
+		if account.SessionVersion != claims.SessionVersion {
+			response.NewErrorResponse(c, http.StatusUnauthorized, "session revoked, please log in again", logger)
+			return
+		}
+		if account.PasswordResetRequired && !passwordResetRoutes[c.FullPath()] {
+			response.NewErrorResponse(c, http.StatusForbidden, "password change required", logger)
+			return
+		}
+
+		roleNames := claims.RoleNames()
+		perms, err := roles.Permissions(roleNames)
+		if err != nil {
+			logger.Error("failed to resolve permissions", zap.Uint("userID", claims.UserID), zap.Error(err))
+			response.NewErrorResponse(c, http.StatusInternalServerError, "failed to resolve permissions", logger)
+			return
+		}
+
 		c.Set("userID", uint(claims.UserID))
-		c.Set("groups", string(claims.Groups))
+		c.Set(rbac.RolesKey, roleNames)
+		c.Set(rbac.PermissionsKey, perms)
 		c.Next()
 	}
 }
@@ -3,6 +3,7 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"painaway_test/internal/rbac"
 	"painaway_test/internal/users"
 	"painaway_test/models"
 
@@ -10,12 +11,17 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrAccountLocked — аккаунт заблокирован администратором; сообщаем об этом
+// только после проверки пароля, чтобы не раскрывать состояние чужих аккаунтов.
+var ErrAccountLocked = errors.New("account is locked")
+
 type Service struct {
 	UserRepo users.Repository
+	Roles    *rbac.Service
 }
 
-func NewService(userRepo users.Repository) *Service {
-	return &Service{UserRepo: userRepo}
+func NewService(userRepo users.Repository, roles *rbac.Service) *Service {
+	return &Service{UserRepo: userRepo, Roles: roles}
 }
 
 func (s *Service) Register(user *models.User) error {
@@ -41,6 +47,12 @@ func (s *Service) Register(user *models.User) error {
 	}
 	user.Password = string(hashed)
 
+	// новый пользователь всегда пациент, роль врача выдаётся отдельно
+	role, err := s.Roles.GetRole(rbac.RolePatient)
+	if err != nil {
+		return err
+	}
+	user.Roles = []models.Role{*role}
 	return s.UserRepo.CreateUser(user)
 }
 
@@ -56,5 +68,8 @@ func (s *Service) Login(username, password string) (*models.User, error) {
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
 		return nil, fmt.Errorf("invalid credentials")
 	}
+	if user.LockedAt != nil {
+		return nil, ErrAccountLocked
+	}
 	return user, nil
 }
@@ -0,0 +1,174 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"painaway_test/internal/config"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 — подмена S3-совместимого сервера: хранит объекты в памяти и проверяет,
+// что запросы подписаны и адресованы бакету в path-style.
+type fakeS3 struct {
+	t       *testing.T
+	bucket  string
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/") ||
+		!strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+		!strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date") {
+		f.t.Errorf("unexpected Authorization header %q", auth)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("X-Amz-Date") == "" {
+		f.t.Error("X-Amz-Date header is missing")
+	}
+
+	prefix := "/" + f.bucket + "/"
+	if !strings.HasPrefix(r.URL.EscapedPath(), prefix) {
+		f.t.Errorf("request path %q is not in bucket %q", r.URL.EscapedPath(), f.bucket)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get("X-Amz-Content-Sha256"), sha256Hex(body); got != want {
+			f.t.Errorf("payload hash = %q, want %q", got, want)
+		}
+		f.objects[key] = fakeObject{data: body, contentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		_, _ = w.Write(obj.data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3(t *testing.T) (*S3Storage, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{t: t, bucket: "painaway", objects: make(map[string]fakeObject)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	storage, err := NewS3Storage(&config.S3Config{
+		Endpoint:     srv.URL,
+		Bucket:       "painaway",
+		AccessKey:    "access",
+		SecretKey:    "secret",
+		UsePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	return storage, fake
+}
+
+func TestS3StoragePutGetDelete(t *testing.T) {
+	storage, fake := newTestS3(t)
+	ctx := context.Background()
+	key := "attachments/1/2/file name+1.png"
+
+	if err := storage.Put(ctx, key, strings.NewReader("content"), 7, "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if obj := fake.objects[key]; obj.contentType != "image/png" {
+		t.Errorf("stored content type = %q, want image/png", obj.contentType)
+	}
+
+	rc, err := storage.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "content" {
+		t.Errorf("Get returned %q, want %q", data, "content")
+	}
+
+	if err := storage.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := storage.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3StorageDeleteMissing(t *testing.T) {
+	storage, _ := newTestS3(t)
+	if err := storage.Delete(context.Background(), "missing"); err != nil {
+		t.Errorf("Delete of missing object: %v", err)
+	}
+}
+
+func TestS3StorageUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, "AccessDenied")
+	}))
+	defer srv.Close()
+
+	storage, err := NewS3Storage(&config.S3Config{Endpoint: srv.URL, Bucket: "painaway", UsePathStyle: true})
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	err = storage.Put(context.Background(), "key", strings.NewReader("x"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Put error = %v, want status 403 with body", err)
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		pathStyle bool
+		key       string
+		want      string
+	}{
+		{"path style", "http://minio:9000", true, "a/b.png", "http://minio:9000/bucket/a/b.png"},
+		{"virtual host", "https://s3.amazonaws.com", false, "a/b.png", "https://bucket.s3.amazonaws.com/a/b.png"},
+		{"escaped key", "http://minio:9000", true, "a/file name+1.png", "http://minio:9000/bucket/a/file%20name%2B1.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewS3Storage(&config.S3Config{Endpoint: tt.endpoint, Bucket: "bucket", UsePathStyle: tt.pathStyle})
+			if err != nil {
+				t.Fatalf("NewS3Storage: %v", err)
+			}
+			if got := storage.objectURL(tt.key).String(); got != tt.want {
+				t.Errorf("objectURL(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"painaway_test/internal/config"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Storage — хранилище бинарных объектов (вложения, документы).
+// Ключи формирует вызывающий код, хранилище их не интерпретирует.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func New(cfg *config.BlobConfig) (Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalStorage(cfg.LocalDir)
+	case "s3":
+		return NewS3Storage(&cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob storage driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,143 @@
+package comments
+
+import (
+	"errors"
+	"net/http"
+	"painaway_test/internal/audit"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/diary/notes/:id/comments", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.ListByNote)
+	rg.POST("/diary/notes/:id/comments", rbac.RequirePermission(logger, rbac.PermCommentsWrite), h.Create)
+	rg.PATCH("/diary/comments/:id", rbac.RequirePermission(logger, rbac.PermCommentsWrite), h.Update)
+	rg.DELETE("/diary/comments/:id", rbac.RequirePermission(logger, rbac.PermCommentsWrite), h.Delete)
+}
+
+func (h *Handler) ListByNote(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid note id", h.Logger)
+		return
+	}
+
+	comments, patientID, err := h.Service.ListByNote(userID.(uint), uint(noteID))
+	if err != nil {
+		h.respondError(c, err, "failed to list comments")
+		return
+	}
+	audit.Record(c, patientID, audit.ActionRead, audit.ResourceComment, 0)
+	c.JSON(http.StatusOK, comments)
+}
+
+func (h *Handler) Create(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid note id", h.Logger)
+		return
+	}
+	var req utils.CommentInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	comment, err := h.Service.Create(userID.(uint), uint(noteID), req)
+	if err != nil {
+		h.respondError(c, err, "failed to create comment")
+		return
+	}
+
+	h.Logger.Info("comment created",
+		zap.Uint("userID", userID.(uint)),
+		zap.Uint("noteID", comment.NoteID),
+		zap.Uint("commentID", comment.ID))
+	audit.Record(c, comment.PatientID, audit.ActionCreate, audit.ResourceComment, comment.ID)
+	c.JSON(http.StatusCreated, h.Service.ToCommentDTO(*comment, comment.PatientID))
+}
+
+func (h *Handler) Update(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid comment id", h.Logger)
+		return
+	}
+	var req utils.CommentInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	comment, err := h.Service.Update(userID.(uint), uint(commentID), req)
+	if err != nil {
+		h.respondError(c, err, "failed to update comment")
+		return
+	}
+	audit.Record(c, comment.PatientID, audit.ActionUpdate, audit.ResourceComment, comment.ID)
+	c.JSON(http.StatusOK, h.Service.ToCommentDTO(*comment, comment.PatientID))
+}
+
+func (h *Handler) Delete(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	commentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid comment id", h.Logger)
+		return
+	}
+
+	comment, err := h.Service.Delete(userID.(uint), uint(commentID))
+	if err != nil {
+		h.respondError(c, err, "failed to delete comment")
+		return
+	}
+
+	h.Logger.Info("comment deleted", zap.Uint("userID", userID.(uint)), zap.Uint64("commentID", commentID))
+	audit.Record(c, comment.PatientID, audit.ActionDelete, audit.ResourceComment, comment.ID)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	case errors.Is(err, ErrInvalidComment):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
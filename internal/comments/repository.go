@@ -0,0 +1,55 @@
+package comments
+
+import (
+	"painaway_test/models"
+
+	"gorm.io/gorm"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	CreateComment(comment *models.NoteComment) error
+	GetCommentByID(id uint) (*models.NoteComment, error)
+	GetCommentsByNoteID(noteID uint) ([]models.NoteComment, error)
+	UpdateComment(comment *models.NoteComment) error
+	DeleteComment(id uint) error
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+func (r *Repo) CreateComment(comment *models.NoteComment) error {
+	return r.DB.Create(comment).Error
+}
+
+func (r *Repo) GetCommentByID(id uint) (*models.NoteComment, error) {
+	var comment models.NoteComment
+	if err := r.DB.Preload("Author").Where("id = ?", id).First(&comment).Error; err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// GetCommentsByNoteID возвращает и удалённые комментарии: они нужны, чтобы не терять ответы в ветке.
+func (r *Repo) GetCommentsByNoteID(noteID uint) ([]models.NoteComment, error) {
+	var comments []models.NoteComment
+	if err := r.DB.Unscoped().Preload("Author").
+		Where("note_id = ?", noteID).
+		Order("created_at, id").
+		Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (r *Repo) UpdateComment(comment *models.NoteComment) error {
+	return r.DB.Model(comment).Select("body", "edited_at").Updates(comment).Error
+}
+
+func (r *Repo) DeleteComment(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.NoteComment{}).Error
+}
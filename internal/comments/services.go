@@ -0,0 +1,257 @@
+package comments
+
+import (
+	"errors"
+	"fmt"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/notifications"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const maxCommentLength = 2000
+
+var (
+	ErrForbidden      = errors.New("access denied")
+	ErrInvalidComment = errors.New("invalid comment")
+)
+
+type Service struct {
+	Repo                 Repository
+	Diary                *diary.Service
+	NotificationsService *notifications.Service
+	Logger               *zap.Logger
+}
+
+func NewService(repo Repository, diarySrv *diary.Service, notifSrv *notifications.Service, logger *zap.Logger) *Service {
+	return &Service{
+		Repo:                 repo,
+		Diary:                diarySrv,
+		NotificationsService: notifSrv,
+		Logger:               logger,
+	}
+}
+
+// Create добавляет комментарий к записи. Начать ветку может только врач с принятой
+// привязкой к пациенту; отвечать в ветке могут и врач, и сам пациент.
+func (s *Service) Create(userID, noteID uint, input utils.CommentInputDTO) (*models.NoteComment, error) {
+	note, err := s.Diary.GetNote(noteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAccess(userID, note); err != nil {
+		return nil, err
+	}
+	body, err := normalizeBody(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &models.NoteComment{
+		NoteID:    note.ID,
+		PatientID: note.PatientID,
+		AuthorID:  userID,
+		Body:      body,
+	}
+
+	var parent *models.NoteComment
+	if input.ParentID != nil {
+		parent, err = s.Repo.GetCommentByID(*input.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.NoteID != note.ID {
+			return nil, fmt.Errorf("%w: parent comment belongs to another note", ErrInvalidComment)
+		}
+		rootID := parent.ID
+		if parent.ParentID != nil {
+			rootID = *parent.ParentID
+		}
+		comment.ParentID = &rootID
+	} else if userID == note.PatientID {
+		return nil, ErrForbidden
+	}
+
+	if err := s.Repo.CreateComment(comment); err != nil {
+		return nil, err
+	}
+	created, err := s.Repo.GetCommentByID(comment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(note, created, parent)
+	return created, nil
+}
+
+// notify сообщает пациенту о комментарии врача, а автору родительского
+// комментария — об ответе на него.
+func (s *Service) notify(note *models.Note, comment, parent *models.NoteComment) {
+	recipients := make(map[uint]string)
+	noteDate := note.RecordedAt.Format("02.01.2006")
+	if comment.AuthorID != note.PatientID {
+		recipients[note.PatientID] = fmt.Sprintf("Врач %s оставил комментарий к вашей записи от %s", authorName(comment.Author), noteDate)
+	}
+	if parent != nil && parent.AuthorID != comment.AuthorID {
+		if _, ok := recipients[parent.AuthorID]; !ok {
+			recipients[parent.AuthorID] = fmt.Sprintf("%s ответил на ваш комментарий к записи от %s", authorName(comment.Author), noteDate)
+		}
+	}
+
+	for userID, message := range recipients {
+		if err := s.NotificationsService.CreateNotification(userID, message); err != nil {
+			s.Logger.Error("failed to create notification",
+				zap.Uint("commentID", comment.ID),
+				zap.Uint("userID", userID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// ListByNote возвращает дерево комментариев записи и пациента, которому она принадлежит.
+func (s *Service) ListByNote(userID, noteID uint) ([]utils.CommentDTO, uint, error) {
+	note, err := s.Diary.GetNote(noteID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkAccess(userID, note); err != nil {
+		return nil, 0, err
+	}
+	comments, err := s.Repo.GetCommentsByNoteID(noteID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.ToCommentTree(comments, note.PatientID), note.PatientID, nil
+}
+
+func (s *Service) Update(userID, commentID uint, input utils.CommentInputDTO) (*models.NoteComment, error) {
+	comment, err := s.authorComment(userID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	body, err := normalizeBody(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	if body == comment.Body {
+		return comment, nil
+	}
+
+	now := time.Now()
+	comment.Body = body
+	comment.EditedAt = &now
+	if err := s.Repo.UpdateComment(comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *Service) Delete(userID, commentID uint) (*models.NoteComment, error) {
+	comment, err := s.authorComment(userID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.DeleteComment(comment.ID); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// authorComment возвращает комментарий, если пользователь — его автор и всё ещё
+// имеет доступ к дневнику пациента.
+func (s *Service) authorComment(userID, commentID uint) (*models.NoteComment, error) {
+	comment, err := s.Repo.GetCommentByID(commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.AuthorID != userID {
+		return nil, ErrForbidden
+	}
+	note, err := s.Diary.GetNote(comment.NoteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAccess(userID, note); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// checkAccess проверяет, что запись пациента доступна пользователю по согласию.
+func (s *Service) checkAccess(userID uint, note *models.Note) error {
+	err := s.Diary.CheckPatientData(userID, note.PatientID, diary.ScopeNotes, note.RecordedAt)
+	if errors.Is(err, diary.ErrForbidden) {
+		return ErrForbidden
+	}
+	return err
+}
+
+func normalizeBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("%w: body is empty", ErrInvalidComment)
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", fmt.Errorf("%w: body is longer than %d characters", ErrInvalidComment, maxCommentLength)
+	}
+	return body, nil
+}
+
+func authorName(u models.User) string {
+	return strings.TrimSpace(u.LastName + " " + u.FirstName)
+}
+
+func (s *Service) ToCommentDTO(c models.NoteComment, patientID uint) utils.CommentDTO {
+	dto := utils.CommentDTO{
+		ID:         c.ID,
+		NoteID:     c.NoteID,
+		ParentID:   c.ParentID,
+		AuthorID:   c.AuthorID,
+		AuthorName: authorName(c.Author),
+		AuthorRole: "doctor",
+		Body:       c.Body,
+		EditedAt:   c.EditedAt,
+		CreatedAt:  c.CreatedAt,
+	}
+	if c.AuthorID == patientID {
+		dto.AuthorRole = "patient"
+	}
+	return dto
+}
+
+// ToCommentTree собирает ветки из плоского списка. Удалённые ответы пропускаются,
+// удалённый корневой комментарий остаётся заглушкой, только если в ветке есть ответы.
+func (s *Service) ToCommentTree(comments []models.NoteComment, patientID uint) []utils.CommentDTO {
+	replies := make(map[uint][]utils.CommentDTO)
+	for _, c := range comments {
+		if c.ParentID == nil || c.DeletedAt.Valid {
+			continue
+		}
+		replies[*c.ParentID] = append(replies[*c.ParentID], s.ToCommentDTO(c, patientID))
+	}
+
+	tree := make([]utils.CommentDTO, 0)
+	for _, c := range comments {
+		if c.ParentID != nil {
+			continue
+		}
+		item := s.ToCommentDTO(c, patientID)
+		item.Replies = replies[c.ID]
+		if c.DeletedAt.Valid {
+			if len(item.Replies) == 0 {
+				continue
+			}
+			item.Body = ""
+			item.EditedAt = nil
+			item.Deleted = true
+		}
+		tree = append(tree, item)
+	}
+	return tree
+}
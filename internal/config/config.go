@@ -9,10 +9,18 @@ import (
 )
 
 type Config struct {
-	Env              string           `mapstructure:"env"`
-	HTTPServerConfig HTTPServerConfig `mapstructure:"http_server"`
-	DBConfig         DBConfig         `mapstructure:"db"`
-	JWTConfig        JWTConfig        `mapstructure:"jwt"`
+	Env                  string               `mapstructure:"env"`
+	HTTPServerConfig     HTTPServerConfig     `mapstructure:"http_server"`
+	DBConfig             DBConfig             `mapstructure:"db"`
+	JWTConfig            JWTConfig            `mapstructure:"jwt"`
+	BlobConfig           BlobConfig           `mapstructure:"blob_storage"`
+	AttachmentsConfig    AttachmentsConfig    `mapstructure:"attachments"`
+	IdempotencyConfig    IdempotencyConfig    `mapstructure:"idempotency"`
+	RemindersConfig      RemindersConfig      `mapstructure:"reminders"`
+	ICD10Config          ICD10Config          `mapstructure:"icd10"`
+	QuestionnairesConfig QuestionnairesConfig `mapstructure:"questionnaires"`
+	InvitesConfig        InvitesConfig        `mapstructure:"invites"`
+	MailConfig           MailConfig           `mapstructure:"mail"`
 }
 
 type HTTPServerConfig struct {
@@ -36,6 +44,79 @@ type JWTConfig struct {
 	Duration  time.Duration `mapstructure:"duration"`
 }
 
+type BlobConfig struct {
+	Driver   string   `mapstructure:"driver"` // local / s3
+	LocalDir string   `mapstructure:"local_dir"`
+	S3       S3Config `mapstructure:"s3"`
+}
+
+type S3Config struct {
+	Endpoint     string `mapstructure:"endpoint"`
+	Region       string `mapstructure:"region"`
+	Bucket       string `mapstructure:"bucket"`
+	AccessKey    string `mapstructure:"access_key"`
+	SecretKey    string `mapstructure:"secret_key"`
+	UsePathStyle bool   `mapstructure:"use_path_style"`
+}
+
+type AttachmentsConfig struct {
+	MaxFileSize   int64 `mapstructure:"max_file_size"` // в байтах
+	MaxPerNote    int   `mapstructure:"max_per_note"`
+	ThumbnailSize int   `mapstructure:"thumbnail_size"` // сторона превью в пикселях
+}
+
+type IdempotencyConfig struct {
+	TTL time.Duration `mapstructure:"ttl"`
+	// тело запроса с Idempotency-Key больше этого размера отклоняется (0 — без ограничения);
+	// multipart-загрузки не читаются целиком и ограничиваются своими обработчиками
+	MaxBodySize int64 `mapstructure:"max_body_size"`
+}
+
+type RemindersConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	// напоминание, время которого наступило не раньше чем CatchUp назад, ещё отправляется
+	// (например, после перезапуска сервера)
+	CatchUp time.Duration `mapstructure:"catch_up"`
+	// за сколько до начала приёма напомнить о нём
+	AppointmentLead time.Duration `mapstructure:"appointment_lead"`
+}
+
+type ICD10Config struct {
+	// CSV с полным справочником МКБ-10; пусто — только встроенные коды
+	File string `mapstructure:"file"`
+}
+
+type QuestionnairesConfig struct {
+	// каталог с дополнительными определениями опросников (YAML); пусто — только встроенные
+	Dir string `mapstructure:"dir"`
+}
+
+type InvitesConfig struct {
+	// адрес страницы приложения, на которую ведёт QR-код; код добавляется параметром ?code=
+	BaseURL    string        `mapstructure:"base_url"`
+	DefaultTTL time.Duration `mapstructure:"default_ttl"`
+	MaxTTL     time.Duration `mapstructure:"max_ttl"`
+	// не больше MaxAttempts неудачных попыток погасить код за AttemptWindow
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+	AttemptWindow time.Duration `mapstructure:"attempt_window"`
+	// то же с одного IP-адреса, по всем пользователям: перебор кодов с разных аккаунтов
+	MaxAttemptsPerIP int `mapstructure:"max_attempts_per_ip"`
+}
+
+type MailConfig struct {
+	Driver string     `mapstructure:"driver"` // log / smtp
+	From   string     `mapstructure:"from"`
+	SMTP   SMTPConfig `mapstructure:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
 func LoadConfig(path string) (*Config, error) {
 	viper.AddConfigPath("./config")
 	viper.AddConfigPath("../config")
@@ -47,6 +128,10 @@ func LoadConfig(path string) (*Config, error) {
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
+	viper.SetDefault("reminders.interval", time.Minute)
+	// по этому окну чистятся старые попытки погасить приглашение
+	viper.SetDefault("invites.attempt_window", 15*time.Minute)
+
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
@@ -55,6 +140,13 @@ func LoadConfig(path string) (*Config, error) {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("unmarshal config: %w", err)
 	}
+	// на Interval заводится тикер фонового воркера — ноль или минус приведут к панике
+	if cfg.RemindersConfig.Interval <= 0 {
+		return nil, fmt.Errorf("invalid config: reminders.interval must be positive, got %s", cfg.RemindersConfig.Interval)
+	}
+	if cfg.InvitesConfig.AttemptWindow <= 0 {
+		return nil, fmt.Errorf("invalid config: invites.attempt_window must be positive, got %s", cfg.InvitesConfig.AttemptWindow)
+	}
 
 	return &cfg, nil
 }
@@ -1,15 +1,20 @@
 package diary
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"painaway_test/internal/audit"
+	"painaway_test/internal/rbac"
 	"painaway_test/internal/response"
 	"painaway_test/internal/utils"
 	"painaway_test/models"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
@@ -19,16 +24,48 @@ type Handler struct {
 
 func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
 	h := &Handler{Service: service, Logger: logger}
-	rg.POST("/diary/link_doc/", h.LinkDoc)
-	rg.POST("/diary/doc_respond", h.DocRespond)
-	rg.POST("/diary/stats/", h.CreateNote)
-	rg.POST("/diary/diagnosis", h.SetDiagnosis)
-	rg.POST("/diary/prescription", h.SetPrescription)
-	rg.GET("/diary/list_links", h.ListLinks)
-	rg.GET("/diary/stats/", h.GetUserStats)
-	rg.GET("/diary/bodyparts/", h.GetBodyParts)
-	rg.PATCH("/diary/diagnosis", h.SetDiagnosis)
-	rg.PATCH("/diary/prescription", h.SetPrescription)
+	rg.POST("/diary/link_doc/", rbac.RequirePermission(logger, rbac.PermLinksRequest), h.LinkDoc)
+	rg.POST("/diary/doc_respond", rbac.RequirePermission(logger, rbac.PermPatientsManage), h.DocRespond)
+	rg.POST("/diary/stats/", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.CreateNote)
+	rg.POST("/diary/diagnosis", rbac.RequirePermission(logger, rbac.PermTreatmentWrite), h.SetDiagnosis)
+	rg.POST("/diary/prescription", rbac.RequirePermission(logger, rbac.PermTreatmentWrite), h.SetPrescription)
+	rg.GET("/diary/list_links", rbac.RequirePermission(logger, rbac.PermLinksUse), h.ListLinks)
+	rg.GET("/diary/stats/", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.GetUserStats)
+	rg.GET("/diary/bodyparts/", rbac.RequirePermission(logger, rbac.PermBodyPartsRead), h.GetBodyParts)
+	rg.GET("/diary/analytics/bodyparts", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.GetBodyPartStats)
+	rg.POST("/diary/sync/", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.SyncPush)
+	rg.POST("/diary/prescriptions/", rbac.RequirePermission(logger, rbac.PermTreatmentWrite), h.CreatePrescription)
+	rg.GET("/diary/prescriptions/", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.ListPrescriptions)
+	rg.PATCH("/diary/prescriptions/:id", rbac.RequirePermission(logger, rbac.PermTreatmentWrite), h.UpdatePrescription)
+	rg.DELETE("/diary/prescriptions/:id", rbac.RequirePermission(logger, rbac.PermTreatmentWrite), h.DeletePrescription)
+	rg.POST("/diary/prescriptions/:id/intakes", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.LogIntake)
+	rg.GET("/diary/prescriptions/:id/intakes", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.ListIntakes)
+	rg.GET("/diary/prescriptions/:id/adherence", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.AdherenceReport)
+	rg.GET("/diary/sync/", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.SyncPull)
+	rg.PATCH("/diary/diagnosis", rbac.RequirePermission(logger, rbac.PermTreatmentWrite), h.SetDiagnosis)
+	rg.PATCH("/diary/prescription", rbac.RequirePermission(logger, rbac.PermTreatmentWrite), h.SetPrescription)
+	rg.POST("/diary/links/:id/status", rbac.RequirePermission(logger, rbac.PermLinksUse), h.SetLinkStatus)
+	rg.POST("/diary/links/:id/role", rbac.RequirePermission(logger, rbac.PermPatientsManage), h.SetCareRole)
+	rg.GET("/diary/care_team", rbac.RequirePermission(logger, rbac.PermLinksUse), h.GetCareTeam)
+	rg.GET("/diary/links/:id/consent", rbac.RequirePermission(logger, rbac.PermLinksUse), h.GetConsent)
+	rg.PUT("/diary/links/:id/consent", rbac.RequirePermission(logger, rbac.PermConsentManage), h.SetConsent)
+	rg.GET("/diary/links/:id/consent/history", rbac.RequirePermission(logger, rbac.PermLinksUse), h.GetConsentHistory)
+	rg.GET("/diary/links/:id/history", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.GetLinkHistory)
+	rg.GET("/diary/links/:id/diagnoses", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.ListDiagnoses)
+	rg.GET("/diary/icd10/", rbac.RequirePermission(logger, rbac.PermICD10Read), h.SearchICD10)
+	rg.GET("/diary/analytics/diagnoses", rbac.RequirePermission(logger, rbac.PermPatientsManage), h.GetDiagnosisStats)
+	rg.GET("/diary/analytics/factors", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.GetFactorReport)
+	rg.GET("/diary/tags/", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.ListTags)
+	rg.POST("/diary/tags/", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.CreateTag)
+	rg.DELETE("/diary/tags/:id", rbac.RequirePermission(logger, rbac.PermDiaryWrite), h.DeleteTag)
+}
+
+// RegisterAdminRoutes регистрирует маршруты администратора; права проверяются на каждом маршруте.
+func RegisterAdminRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/bodyparts/", rbac.RequirePermission(logger, rbac.PermBodyPartsManage), h.AdminListBodyParts)
+	rg.POST("/bodyparts/", rbac.RequirePermission(logger, rbac.PermBodyPartsManage), h.AdminCreateBodyPart)
+	rg.PATCH("/bodyparts/:id", rbac.RequirePermission(logger, rbac.PermBodyPartsManage), h.AdminUpdateBodyPart)
 }
 
 // :5173/api/diary/prescription/?prescription_id=undefined:1
@@ -39,15 +76,9 @@ func (h *Handler) ListLinks(c *gin.Context) {
 
 		return
 	}
-	userGroups, exists := c.Get("groups")
-	if !exists {
-		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
-
-		return
-	}
-
-	switch userGroups {
-	case "Doctor":
+	// у врача, который сам лечится, показываем привязки к его пациентам
+	switch {
+	case rbac.HasRole(c, rbac.RoleDoctor):
 		links, err := h.Service.DoctorListLinks(userID.(uint))
 		if err != nil {
 			h.Logger.Error("failed to list links",
@@ -58,13 +89,26 @@ func (h *Handler) ListLinks(c *gin.Context) {
 			return
 		}
 
+		for _, link := range links {
+			if link.Patient.ID == 0 {
+				continue
+			}
+			audit.Record(c, link.Patient.ID, audit.ActionRead, audit.ResourceProfile, 0)
+			if link.Diagnosis.Diagnosis != "" || len(link.Diagnoses) > 0 {
+				audit.Record(c, link.Patient.ID, audit.ActionRead, audit.ResourceDiagnosis, 0)
+			}
+			if link.Prescription.Prescription != "" {
+				audit.Record(c, link.Patient.ID, audit.ActionRead, audit.ResourcePrescription, 0)
+			}
+		}
+
 		h.Logger.Info("links retrieved",
 			zap.Uint("userID", userID.(uint)),
 			zap.Int("count", len(links)))
 
 		c.JSON(http.StatusOK, links)
 
-	case "Patient":
+	case rbac.HasRole(c, rbac.RolePatient):
 		links, err := h.Service.PatientListLinks(userID.(uint))
 		if err != nil {
 			h.Logger.Error("failed to list links",
@@ -103,12 +147,7 @@ func (h *Handler) LinkDoc(c *gin.Context) {
 
 	link, err := h.Service.LinkDoc(patientID.(uint), req.DocUsername)
 	if err != nil {
-		h.Logger.Error("failed to link doctor",
-			zap.Uint("patientID", patientID.(uint)),
-			zap.String("docUsername", req.DocUsername),
-			zap.Error(err))
-
-		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to link doctor", h.Logger)
+		h.respondServiceError(c, err, "failed to link doctor")
 		return
 	}
 	h.Logger.Info("doctor linked successfully",
@@ -132,12 +171,7 @@ func (h *Handler) DocRespond(c *gin.Context) {
 	}
 
 	if err := h.Service.RespondToLinkRequest(doctorID.(uint), req.PatientID, req.Action); err != nil {
-		h.Logger.Error("failed to respond to link request", zap.Uint("doctorID", doctorID.(uint)),
-			zap.Uint("patientID", req.PatientID),
-			zap.String("action", req.Action),
-			zap.Error(err))
-
-		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to respond to link request", h.Logger)
+		h.respondServiceError(c, err, "failed to respond to link request")
 		return
 	}
 	h.Logger.Info("link request responded",
@@ -148,7 +182,42 @@ func (h *Handler) DocRespond(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+func (h *Handler) SetLinkStatus(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid link id", h.Logger)
+		return
+	}
+	var req utils.LinkStatusDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	link, err := h.Service.TransitionLink(userID.(uint), uint(linkID), req.Status, req.Reason)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to change link status")
+		return
+	}
+
+	h.Logger.Info("link status changed",
+		zap.Uint("userID", userID.(uint)),
+		zap.Uint("linkID", link.ID),
+		zap.String("status", link.Status))
+	c.JSON(http.StatusOK, gin.H{"id": link.ID, "status": link.Status})
+}
+
 func (h *Handler) SetPrescription(c *gin.Context) {
+	doctorID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
 	idStr := c.Query("prescription_id")
 
 	var req utils.SetPrescriptionDTO
@@ -166,15 +235,11 @@ func (h *Handler) SetPrescription(c *gin.Context) {
 		req.Link = uint(idUint)
 	}
 
-	if err := h.Service.SetPrescription(req); err != nil {
-		h.Logger.Error("failed to respond to set prescription",
-			zap.Uint("linkID", uint(req.Link)),
-			zap.String("prescription", req.Prescription),
-			zap.Error(err))
-
-		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to set prescription", h.Logger)
+	if err := h.Service.SetPrescription(doctorID.(uint), req); err != nil {
+		h.respondServiceError(c, err, "failed to set prescription")
 		return
 	}
+	h.auditLink(c, doctorID.(uint), req.Link, audit.ActionUpdate, audit.ResourcePrescription)
 	h.Logger.Info("prescription set successfully",
 		zap.Uint("linkID", uint(req.Link)),
 		zap.String("prescription", req.Prescription))
@@ -183,6 +248,11 @@ func (h *Handler) SetPrescription(c *gin.Context) {
 }
 
 func (h *Handler) SetDiagnosis(c *gin.Context) {
+	doctorID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
 	idStr := c.Query("diagnosis_id")
 
 	var req utils.SetDiagnosisDTO
@@ -200,41 +270,487 @@ func (h *Handler) SetDiagnosis(c *gin.Context) {
 		req.Link = uint(idUint)
 	}
 
-	if err := h.Service.SetDiagnosis(req); err != nil {
-		h.Logger.Error("failed to respond to set diagnosis",
-			zap.Uint("linkID", uint(req.Link)),
-			zap.String("diagnosis", req.Diagnosis),
-			zap.Error(err))
-
-		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to set diagnosis", h.Logger)
+	if err := h.Service.SetDiagnosis(doctorID.(uint), req); err != nil {
+		h.respondServiceError(c, err, "failed to set diagnosis")
 		return
 	}
-	h.Logger.Info("diagnosis set successfully", zap.Uint("linkID", uint(req.Link)), zap.String("diagnosis", req.Diagnosis))
+	h.auditLink(c, doctorID.(uint), req.Link, audit.ActionUpdate, audit.ResourceDiagnosis)
+	h.Logger.Info("diagnosis set successfully", zap.Uint("linkID", uint(req.Link)))
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// GetCareTeam — GET /diary/care_team?patient_id=; без patient_id пациент получает свою команду.
+func (h *Handler) GetCareTeam(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	patientID := userID.(uint)
+	if v := c.Query("patient_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid patient_id", h.Logger)
+			return
+		}
+		patientID = uint(id)
+	}
+
+	team, err := h.Service.GetCareTeam(userID.(uint), patientID)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to get care team")
+		return
+	}
+	if len(team.Diagnoses) > 0 {
+		audit.Record(c, patientID, audit.ActionRead, audit.ResourceDiagnosis, 0)
+	}
+	c.JSON(http.StatusOK, team)
+}
+
+func (h *Handler) SetCareRole(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid link id", h.Logger)
+		return
+	}
+	var req utils.SetCareRoleDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	link, err := h.Service.SetCareRole(userID.(uint), uint(linkID), req.Role)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to change care team role")
+		return
+	}
+
+	h.Logger.Info("care team role changed",
+		zap.Uint("userID", userID.(uint)),
+		zap.Uint("linkID", link.ID),
+		zap.String("role", link.Role))
+	c.JSON(http.StatusOK, gin.H{"id": link.ID, "role": link.Role})
+}
+
+func (h *Handler) GetConsent(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid link id", h.Logger)
+		return
+	}
+
+	consent, err := h.Service.GetConsent(userID.(uint), uint(linkID))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to get consent")
+		return
+	}
+	c.JSON(http.StatusOK, consent)
+}
+
+// SetConsent — PUT /diary/links/:id/consent, пациент задаёт, какие данные видит врач.
+func (h *Handler) SetConsent(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid link id", h.Logger)
+		return
+	}
+	var req utils.ConsentInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	consent, err := h.Service.SetConsent(userID.(uint), uint(linkID), req)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to set consent")
+		return
+	}
+
+	h.Logger.Info("consent updated",
+		zap.Uint("patientID", userID.(uint)),
+		zap.Uint("linkID", consent.LinkID),
+		zap.Strings("scopes", consent.Scopes))
+	c.JSON(http.StatusOK, consent)
+}
+
+func (h *Handler) GetConsentHistory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid link id", h.Logger)
+		return
+	}
+
+	history, err := h.Service.GetConsentHistory(userID.(uint), uint(linkID))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to get consent history")
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// GetLinkHistory — GET /diary/links/:id/history?field=prescription|diagnosis
+func (h *Handler) GetLinkHistory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid link id", h.Logger)
+		return
+	}
+
+	field := c.Query("field")
+	revisions, err := h.Service.GetLinkHistory(userID.(uint), uint(linkID), field)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to fetch link history")
+		return
+	}
+	switch field {
+	case RevisionPrescription:
+		h.auditLink(c, userID.(uint), uint(linkID), audit.ActionRead, audit.ResourcePrescription)
+	case "":
+		h.auditLink(c, userID.(uint), uint(linkID), audit.ActionRead, audit.ResourcePrescription, audit.ResourceDiagnosis)
+	default:
+		h.auditLink(c, userID.(uint), uint(linkID), audit.ActionRead, audit.ResourceDiagnosis)
+	}
+	c.JSON(http.StatusOK, h.Service.ToRevisionDTO(revisions))
+}
+
+func (h *Handler) ListDiagnoses(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid link id", h.Logger)
+		return
+	}
+
+	diagnoses, err := h.Service.ListDiagnoses(userID.(uint), uint(linkID))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to fetch diagnoses")
+		return
+	}
+	h.auditLink(c, userID.(uint), uint(linkID), audit.ActionRead, audit.ResourceDiagnosis)
+	c.JSON(http.StatusOK, h.Service.ToDiagnosisDTO(diagnoses))
+}
+
+// SearchICD10 — GET /diary/icd10/?q=M54&limit=20, поиск по началу кода или описания.
+func (h *Handler) SearchICD10(c *gin.Context) {
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid limit", h.Logger)
+			return
+		}
+		limit = parsed
+	}
+
+	codes, err := h.Service.SearchICD10(c.Query("q"), limit)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to search ICD-10 codes")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToICD10DTO(codes))
+}
+
+func (h *Handler) GetDiagnosisStats(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	stats, patientIDs, err := h.Service.GetDiagnosisStats(userID.(uint))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to fetch diagnosis stats")
+		return
+	}
+	for _, patientID := range patientIDs {
+		audit.Record(c, patientID, audit.ActionRead, audit.ResourceDiagnosis, 0)
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
 func (h *Handler) GetUserStats(c *gin.Context) {
-	userID, err := h.resolveUserID(c)
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	patientID, ok := h.resolvePatientID(c, userID.(uint))
+	if !ok {
+		return
+	}
+
+	filter, err := parseNoteFilter(c)
 	if err != nil {
-		response.NewErrorResponse(c, http.StatusBadRequest, "invalid user id", h.Logger)
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
 		return
 	}
 
-	stats, err := h.Service.GetUserAllStats(userID)
+	stats, err := h.Service.GetUserAllStats(userID.(uint), patientID, filter)
 	if err != nil {
-		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to get body stats", h.Logger)
+		h.respondServiceError(c, err, "failed to get body stats")
 		return
 	}
+	audit.Record(c, patientID, audit.ActionRead, audit.ResourceNote, 0)
 	dtoStats := h.Service.ToNoteDTO(stats)
 
 	c.JSON(http.StatusOK, dtoStats)
 }
 
+// parseNoteFilter читает фильтры GET /diary/stats/: from, to (YYYY-MM-DD, включительно),
+// tag (можно несколько), min_/max_intensity, min_/max_mood, min_/max_sleep_quality, activity, weather.
+func parseNoteFilter(c *gin.Context) (NoteFilter, error) {
+	filter := NoteFilter{
+		Tags:          c.QueryArray("tag"),
+		ActivityLevel: c.Query("activity"),
+		Weather:       c.Query("weather"),
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return filter, fmt.Errorf("from must be in YYYY-MM-DD format")
+		}
+		filter.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return filter, fmt.Errorf("to must be in YYYY-MM-DD format")
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	bounds := []struct {
+		name string
+		dst  **int
+	}{
+		{"min_intensity", &filter.MinIntensity},
+		{"max_intensity", &filter.MaxIntensity},
+		{"min_mood", &filter.MinMood},
+		{"max_mood", &filter.MaxMood},
+		{"min_sleep_quality", &filter.MinSleepQuality},
+		{"max_sleep_quality", &filter.MaxSleepQuality},
+	}
+	for _, b := range bounds {
+		v := c.Query(b.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s", b.name)
+		}
+		*b.dst = &n
+	}
+	return filter, nil
+}
+
+// GetFactorReport — GET /diary/analytics/factors?patient_id=&from=&to=&threshold=7
+func (h *Handler) GetFactorReport(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	patientID, ok := h.resolvePatientID(c, userID.(uint))
+	if !ok {
+		return
+	}
+	threshold := 0
+	if v := c.Query("threshold"); v != "" {
+		var err error
+		if threshold, err = strconv.Atoi(v); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid threshold", h.Logger)
+			return
+		}
+	}
+
+	report, err := h.Service.FactorReport(userID.(uint), patientID, c.Query("from"), c.Query("to"), threshold)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to build factor report")
+		return
+	}
+	audit.Record(c, patientID, audit.ActionRead, audit.ResourceNote, 0)
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *Handler) ListTags(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	tags, err := h.Service.ListTags(userID.(uint))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to list tags")
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+func (h *Handler) CreateTag(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.TagInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	tag, err := h.Service.CreateTag(userID.(uint), req.Name)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to create tag")
+		return
+	}
+	c.JSON(http.StatusCreated, utils.TagDTO{ID: tag.ID, Name: tag.Name})
+}
+
+func (h *Handler) DeleteTag(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	tagID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid tag id", h.Logger)
+		return
+	}
+
+	if err := h.Service.DeleteTag(userID.(uint), uint(tagID)); err != nil {
+		h.respondServiceError(c, err, "failed to delete tag")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) GetBodyPartStats(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	patientID, ok := h.resolvePatientID(c, userID.(uint))
+	if !ok {
+		return
+	}
+
+	stats, err := h.Service.GetBodyPartStats(userID.(uint), patientID, c.GetHeader("Accept-Language"))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to get body part stats")
+		return
+	}
+	audit.Record(c, patientID, audit.ActionRead, audit.ResourceNote, 0)
+	c.JSON(http.StatusOK, stats)
+}
+
 func (h *Handler) GetBodyParts(c *gin.Context) {
-	bodyParts := h.Service.GetBodyParts()
+	bodyParts, err := h.Service.GetBodyParts(c.GetHeader("Accept-Language"))
+	if err != nil {
+		h.Logger.Error("failed to get body parts", zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to get body parts", h.Logger)
+		return
+	}
 	c.JSON(http.StatusOK, bodyParts)
 }
 
+func (h *Handler) AdminListBodyParts(c *gin.Context) {
+	parts, err := h.Service.ListBodyPartsAdmin()
+	if err != nil {
+		h.Logger.Error("failed to list body parts", zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to list body parts", h.Logger)
+		return
+	}
+	c.JSON(http.StatusOK, parts)
+}
+
+func (h *Handler) AdminCreateBodyPart(c *gin.Context) {
+	var req utils.BodyPartInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	part, err := h.Service.CreateBodyPart(req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidBodyPart) {
+			response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+			return
+		}
+		h.Logger.Error("failed to create body part", zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to create body part", h.Logger)
+		return
+	}
+
+	h.Logger.Info("body part created", zap.Uint("bodyPartID", part.ID), zap.String("code", part.Code))
+	c.JSON(http.StatusCreated, part)
+}
+
+func (h *Handler) AdminUpdateBodyPart(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid body part id", h.Logger)
+		return
+	}
+
+	var req utils.BodyPartInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	part, err := h.Service.UpdateBodyPart(uint(id), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.NewErrorResponse(c, http.StatusNotFound, "body part not found", h.Logger)
+		case errors.Is(err, ErrInvalidBodyPart):
+			response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+		default:
+			h.Logger.Error("failed to update body part", zap.Uint("bodyPartID", uint(id)), zap.Error(err))
+			response.NewErrorResponse(c, http.StatusInternalServerError, "failed to update body part", h.Logger)
+		}
+		return
+	}
+
+	h.Logger.Info("body part updated", zap.Uint("bodyPartID", part.ID))
+	c.JSON(http.StatusOK, part)
+}
+
 func (h *Handler) CreateNote(c *gin.Context) {
 	patientID, exists := c.Get("userID")
 	if !exists {
@@ -242,15 +758,18 @@ func (h *Handler) CreateNote(c *gin.Context) {
 		return
 	}
 
-	var req models.Note
+	var req utils.CreateNoteDTO
 	if err := c.ShouldBindJSON(&req); err != nil {
-		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to create note", h.Logger)
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
 		return
 	}
 
-	req.PatientID = patientID.(uint)
-
-	if err := h.Service.CreateNote(&req); err != nil {
+	note, err := h.Service.CreateNote(patientID.(uint), req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidNote) {
+			response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+			return
+		}
 		h.Logger.Error("failed to create note",
 			zap.Uint("patientID", patientID.(uint)),
 			zap.Error(err))
@@ -259,10 +778,286 @@ func (h *Handler) CreateNote(c *gin.Context) {
 		return
 	}
 
-	h.Logger.Info("note created", zap.Uint("patientID", patientID.(uint)), zap.Uint("noteID", req.ID))
+	audit.Record(c, patientID.(uint), audit.ActionCreate, audit.ResourceNote, note.ID)
+	h.Logger.Info("note created", zap.Uint("patientID", patientID.(uint)), zap.Uint("noteID", note.ID))
 	c.JSON(http.StatusOK, gin.H{"message": "Note created"})
 }
 
+func (h *Handler) SyncPush(c *gin.Context) {
+	patientID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	var req utils.SyncPushRequestDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	results, err := h.Service.SyncNotes(patientID.(uint), req.Notes)
+	if err != nil {
+		if errors.Is(err, ErrInvalidNote) {
+			response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+			return
+		}
+		h.Logger.Error("failed to sync notes", zap.Uint("patientID", patientID.(uint)), zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to sync notes", h.Logger)
+		return
+	}
+
+	audit.Record(c, patientID.(uint), audit.ActionUpdate, audit.ResourceNote, 0)
+	h.Logger.Info("notes synced", zap.Uint("patientID", patientID.(uint)), zap.Int("count", len(results)))
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func (h *Handler) SyncPull(c *gin.Context) {
+	patientID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid limit query parameter", h.Logger)
+			return
+		}
+		limit = parsed
+	}
+
+	resp, err := h.Service.PullNotes(patientID.(uint), c.Query("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid cursor", h.Logger)
+			return
+		}
+		h.Logger.Error("failed to pull notes", zap.Uint("patientID", patientID.(uint)), zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to pull notes", h.Logger)
+		return
+	}
+	audit.Record(c, patientID.(uint), audit.ActionRead, audit.ResourceNote, 0)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) CreatePrescription(c *gin.Context) {
+	doctorID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	var req utils.PrescriptionInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	p, err := h.Service.CreatePrescription(doctorID.(uint), req)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to create prescription")
+		return
+	}
+
+	h.Logger.Info("prescription created",
+		zap.Uint("doctorID", doctorID.(uint)),
+		zap.Uint("linkID", p.SubscriptionID),
+		zap.Uint("prescriptionID", p.ID))
+	audit.Record(c, p.PatientID, audit.ActionCreate, audit.ResourcePrescription, p.ID)
+	c.JSON(http.StatusCreated, h.Service.ToPrescriptionDTO([]models.Prescription{*p})[0])
+}
+
+func (h *Handler) ListPrescriptions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	linkID, err := strconv.ParseUint(c.Query("link"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid link query parameter", h.Logger)
+		return
+	}
+
+	prescriptions, err := h.Service.ListPrescriptions(userID.(uint), uint(linkID))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to list prescriptions")
+		return
+	}
+	h.auditLink(c, userID.(uint), uint(linkID), audit.ActionRead, audit.ResourcePrescription)
+	c.JSON(http.StatusOK, h.Service.ToPrescriptionDTO(prescriptions))
+}
+
+func (h *Handler) UpdatePrescription(c *gin.Context) {
+	doctorID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid prescription id", h.Logger)
+		return
+	}
+
+	var req utils.PrescriptionInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	p, err := h.Service.UpdatePrescription(doctorID.(uint), uint(id), req)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to update prescription")
+		return
+	}
+
+	h.Logger.Info("prescription updated", zap.Uint("doctorID", doctorID.(uint)), zap.Uint("prescriptionID", p.ID))
+	audit.Record(c, p.PatientID, audit.ActionUpdate, audit.ResourcePrescription, p.ID)
+	c.JSON(http.StatusOK, h.Service.ToPrescriptionDTO([]models.Prescription{*p})[0])
+}
+
+func (h *Handler) DeletePrescription(c *gin.Context) {
+	doctorID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid prescription id", h.Logger)
+		return
+	}
+
+	// после удаления пациента по назначению уже не найти, поэтому отмечаем заранее:
+	// при ошибке отметка в журнал не попадёт
+	h.auditPrescription(c, uint(id), audit.ActionDelete)
+	if err := h.Service.DeletePrescription(doctorID.(uint), uint(id)); err != nil {
+		h.respondServiceError(c, err, "failed to delete prescription")
+		return
+	}
+
+	h.Logger.Info("prescription deleted", zap.Uint("doctorID", doctorID.(uint)), zap.Uint64("prescriptionID", id))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) LogIntake(c *gin.Context) {
+	patientID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid prescription id", h.Logger)
+		return
+	}
+
+	var req utils.IntakeInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	intake, err := h.Service.LogIntake(patientID.(uint), uint(id), req)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to log intake")
+		return
+	}
+
+	h.Logger.Info("medication intake logged",
+		zap.Uint("patientID", patientID.(uint)),
+		zap.Uint("prescriptionID", intake.PrescriptionID),
+		zap.String("status", intake.Status))
+	audit.Record(c, intake.PatientID, audit.ActionUpdate, audit.ResourcePrescription, intake.PrescriptionID)
+	c.JSON(http.StatusCreated, intake)
+}
+
+func (h *Handler) ListIntakes(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid prescription id", h.Logger)
+		return
+	}
+
+	intakes, err := h.Service.ListIntakes(userID.(uint), uint(id), c.Query("from"), c.Query("to"))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to list intakes")
+		return
+	}
+	h.auditPrescription(c, uint(id), audit.ActionRead)
+	c.JSON(http.StatusOK, intakes)
+}
+
+func (h *Handler) AdherenceReport(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid prescription id", h.Logger)
+		return
+	}
+
+	report, err := h.Service.AdherenceReport(userID.(uint), uint(id), c.Query("from"), c.Query("to"))
+	if err != nil {
+		h.respondServiceError(c, err, "failed to build adherence report")
+		return
+	}
+	h.auditPrescription(c, uint(id), audit.ActionRead)
+	c.JSON(http.StatusOK, report)
+}
+
+// auditLink отмечает в журнале доступа обращение к данным пациента по привязке.
+func (h *Handler) auditLink(c *gin.Context, userID, linkID uint, action string, resources ...string) {
+	link, err := h.Service.GetParticipantLink(userID, linkID)
+	if err != nil {
+		h.Logger.Warn("failed to resolve link for access log", zap.Uint("linkID", linkID), zap.Error(err))
+		return
+	}
+	for _, resource := range resources {
+		audit.Record(c, link.PatientID, action, resource, 0)
+	}
+}
+
+func (h *Handler) auditPrescription(c *gin.Context, prescriptionID uint, action string) {
+	patientID, err := h.Service.PrescriptionPatientID(prescriptionID)
+	if err != nil {
+		return
+	}
+	audit.Record(c, patientID, action, audit.ResourcePrescription, prescriptionID)
+}
+
+// respondServiceError переводит ошибки сервиса в HTTP-статусы.
+func (h *Handler) respondServiceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	case errors.Is(err, ErrIntakeExists), errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrLinkExists),
+		errors.Is(err, ErrLinkCooldown), errors.Is(err, ErrNotAccepting):
+		response.NewErrorResponse(c, http.StatusConflict, err.Error(), h.Logger)
+	case errors.Is(err, ErrInvalidNote), errors.Is(err, ErrInvalidBodyPart), errors.Is(err, ErrInvalidPrescription),
+		errors.Is(err, ErrInvalidIntake), errors.Is(err, ErrInvalidPeriod), errors.Is(err, ErrInvalidRevisionField),
+		errors.Is(err, ErrInvalidDiagnosis), errors.Is(err, ErrInvalidCareRole), errors.Is(err, ErrInvalidConsent):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
+
 func (h *Handler) resolveUserID(c *gin.Context) (uint, error) {
 	idStr := c.Query("patient_id")
 
@@ -286,3 +1081,23 @@ func (h *Handler) resolveUserID(c *gin.Context) (uint, error) {
 
 	return uid, nil
 }
+
+// resolvePatientID — пациент из ?patient_id (по умолчанию сам пользователь)
+// с проверкой, что пользователь имеет доступ к его данным. Ошибки уже отправлены клиенту.
+func (h *Handler) resolvePatientID(c *gin.Context, userID uint) (uint, bool) {
+	patientID, err := h.resolveUserID(c)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid user id", h.Logger)
+		return 0, false
+	}
+	ok, err := h.Service.CanAccessPatient(userID, patientID)
+	if err != nil {
+		h.respondServiceError(c, err, "failed to check patient access")
+		return 0, false
+	}
+	if !ok {
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+		return 0, false
+	}
+	return patientID, true
+}
@@ -0,0 +1,269 @@
+package diary
+
+import (
+	"errors"
+	"fmt"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Области данных пациента, доступ к которым врач получает по согласию.
+const (
+	ScopeNotes          = "notes"
+	ScopeAttachments    = "attachments"
+	ScopeQuestionnaires = "questionnaires"
+	ScopeMedications    = "medications"
+	ScopeProfile        = "profile"
+)
+
+var (
+	ErrInvalidConsent = errors.New("invalid consent")
+
+	consentScopes = []string{ScopeNotes, ScopeAttachments, ScopeQuestionnaires, ScopeMedications, ScopeProfile}
+)
+
+// PatientAccess — что пользователь может видеть из данных пациента.
+type PatientAccess struct {
+	Own      bool
+	Scopes   map[string]bool
+	DataFrom *time.Time
+}
+
+func (a *PatientAccess) Allows(scope string) bool {
+	return a.Own || a.Scopes[scope]
+}
+
+// AllowsDate — попадают ли данные на момент t в разрешённый период.
+func (a *PatientAccess) AllowsDate(t time.Time) bool {
+	return a.Own || a.DataFrom == nil || !t.Before(*a.DataFrom)
+}
+
+// ClampFrom сдвигает начало запрошенного периода на начало разрешённого.
+func (a *PatientAccess) ClampFrom(from time.Time) time.Time {
+	if a.Own || a.DataFrom == nil || from.After(*a.DataFrom) {
+		return from
+	}
+	return *a.DataFrom
+}
+
+// GetPatientAccess — доступ пользователя к данным пациента: сам пациент видит всё,
+// врач — только с принятой привязкой и в рамках действующего согласия.
+func (s *Service) GetPatientAccess(userID, patientID uint) (*PatientAccess, error) {
+	if userID == patientID {
+		return &PatientAccess{Own: true}, nil
+	}
+	link, err := s.Repo.GetAcceptedLink(userID, patientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	access := &PatientAccess{Scopes: make(map[string]bool)}
+	consent, err := s.Repo.GetCurrentConsent(link.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		for _, scope := range consentScopes {
+			access.Scopes[scope] = true
+		}
+		return access, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if consentExpired(*consent) {
+		return access, nil
+	}
+	for _, scope := range consent.Scopes {
+		access.Scopes[scope] = true
+	}
+	access.DataFrom = consent.DataFrom
+	return access, nil
+}
+
+// RequireScope возвращает доступ к данным пациента или ErrForbidden, если область
+// scope не входит в согласие.
+func (s *Service) RequireScope(userID, patientID uint, scope string) (*PatientAccess, error) {
+	access, err := s.GetPatientAccess(userID, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if !access.Allows(scope) {
+		return nil, ErrForbidden
+	}
+	return access, nil
+}
+
+// getLinkAccess возвращает привязку и доступ участника к области scope: пациент видит
+// свою привязку целиком, врач — только принятую и в рамках согласия.
+func (s *Service) getLinkAccess(userID, linkID uint, scope string) (*models.Subscription, *PatientAccess, error) {
+	link, err := s.GetParticipantLink(userID, linkID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if userID == link.DoctorID && link.Status != LinkAccepted {
+		return nil, nil, ErrForbidden
+	}
+	access, err := s.RequireScope(userID, link.PatientID, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return link, access, nil
+}
+
+// CheckPatientData — доступна ли пользователю запись пациента из области scope,
+// сделанная в момент at.
+func (s *Service) CheckPatientData(userID, patientID uint, scope string, at time.Time) error {
+	access, err := s.RequireScope(userID, patientID, scope)
+	if err != nil {
+		return err
+	}
+	if !access.AllowsDate(at) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// GetConsent — действующее согласие по привязке, доступно обеим сторонам.
+func (s *Service) GetConsent(userID, linkID uint) (*utils.ConsentDTO, error) {
+	link, err := s.GetParticipantLink(userID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	consent, err := s.Repo.GetCurrentConsent(link.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &utils.ConsentDTO{LinkID: link.ID, Scopes: append([]string(nil), consentScopes...), Default: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dto := toConsentDTO(*consent)
+	return &dto, nil
+}
+
+func (s *Service) GetConsentHistory(userID, linkID uint) ([]utils.ConsentDTO, error) {
+	link, err := s.GetParticipantLink(userID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := s.Repo.GetConsentHistory(link.ID)
+	if err != nil {
+		return nil, err
+	}
+	dto := make([]utils.ConsentDTO, 0, len(consents))
+	for _, c := range consents {
+		dto = append(dto, toConsentDTO(c))
+	}
+	return dto, nil
+}
+
+// SetConsent записывает новую версию согласия. Менять согласие может только пациент.
+func (s *Service) SetConsent(patientID, linkID uint, input utils.ConsentInputDTO) (*utils.ConsentDTO, error) {
+	link, err := s.Repo.GetLinkByID(linkID)
+	if err != nil {
+		return nil, err
+	}
+	if link.PatientID != patientID {
+		return nil, ErrForbidden
+	}
+	if link.Status != LinkPending && link.Status != LinkAccepted {
+		return nil, fmt.Errorf("%w: link is %s", ErrInvalidTransition, link.Status)
+	}
+
+	consent := &models.LinkConsent{
+		SubscriptionID: link.ID,
+		PatientID:      link.PatientID,
+		DoctorID:       link.DoctorID,
+		Scopes:         []string{},
+	}
+	seen := make(map[string]bool)
+	for _, scope := range input.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !isConsentScope(scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidConsent, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			consent.Scopes = append(consent.Scopes, scope)
+		}
+	}
+	sort.Strings(consent.Scopes)
+	if input.DataFrom != "" {
+		from, err := time.Parse(time.DateOnly, input.DataFrom)
+		if err != nil {
+			return nil, fmt.Errorf("%w: data_from must be in YYYY-MM-DD format", ErrInvalidConsent)
+		}
+		consent.DataFrom = &from
+	}
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidConsent)
+		}
+		expires := input.ExpiresAt.UTC()
+		consent.ExpiresAt = &expires
+	}
+	if err := s.Repo.CreateConsent(consent); err != nil {
+		return nil, err
+	}
+
+	if err := s.NotificationsService.CreateNotification(link.DoctorID, "Пациент изменил доступ к своим данным"); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("linkID", link.ID),
+			zap.Uint("doctorID", link.DoctorID),
+			zap.Error(err),
+		)
+	}
+	dto := toConsentDTO(*consent)
+	return &dto, nil
+}
+
+func consentExpired(c models.LinkConsent) bool {
+	return c.ExpiresAt != nil && !c.ExpiresAt.After(time.Now())
+}
+
+// consentAllows — входит ли область в действующее согласие.
+func consentAllows(c models.LinkConsent, scope string) bool {
+	if consentExpired(c) {
+		return false
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func isConsentScope(scope string) bool {
+	for _, s := range consentScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func toConsentDTO(c models.LinkConsent) utils.ConsentDTO {
+	dto := utils.ConsentDTO{
+		ID:        c.ID,
+		LinkID:    c.SubscriptionID,
+		Scopes:    c.Scopes,
+		ExpiresAt: c.ExpiresAt,
+		Expired:   consentExpired(c),
+		CreatedAt: &c.CreatedAt,
+	}
+	if dto.Scopes == nil {
+		dto.Scopes = []string{}
+	}
+	if c.DataFrom != nil {
+		from := c.DataFrom.Format(time.DateOnly)
+		dto.DataFrom = &from
+	}
+	return dto
+}
@@ -1,9 +1,14 @@
 package diary
 
 import (
+	"errors"
+	"painaway_test/internal/rbac"
 	"painaway_test/models"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repo struct {
@@ -12,15 +17,62 @@ type Repo struct {
 
 type Repository interface {
 	CreateNote(note *models.Note) error
+	GetNoteByID(noteID uint) (*models.Note, error)
+	GetNoteByClientID(patientID uint, clientID string) (*models.Note, error)
+	ReplaceNote(note *models.Note) error
+	SoftDeleteNote(noteID uint, at time.Time) error
+	GetNotesChangedSince(patientID uint, afterVersion int64, limit int) ([]models.Note, error)
+	HasAcceptedLink(doctorID, patientID uint) (bool, error)
 	CreateSubscription(sub *models.Subscription) error
 	GetSubscriptionsByPatientID(patientID uint, offset, limit int) ([]models.Subscription, error)
 	GetSubscriptionsByDoctorID(doctorID uint, offset, limit int) ([]models.Subscription, error)
 	GetLinkByDoctorAndPatient(doctorID, patientID uint) (*models.Subscription, error)
-	GetAllStatByPatientID(patientID uint) ([]models.Note, error)
+	GetAcceptedLink(doctorID, patientID uint) (*models.Subscription, error)
+	GetActiveLink(doctorID, patientID uint) (*models.Subscription, error)
+	GetLatestLinkWithStatus(doctorID, patientID uint, status string) (*models.Subscription, error)
+	GetLinkWithParticipants(linkID uint) (*models.Subscription, error)
+	GetLinksByUserID(userID uint) ([]models.Subscription, error)
+	TransitionLink(link *models.Subscription, from string) (bool, error)
+	GetTeamLead(patientID uint) (*models.Subscription, error)
+	GetTeamLinks(patientID uint) ([]models.Subscription, error)
+	SetLinkRole(link *models.Subscription, role string) error
+	CreateConsent(consent *models.LinkConsent) error
+	GetCurrentConsent(subscriptionID uint) (*models.LinkConsent, error)
+	GetConsentHistory(subscriptionID uint) ([]models.LinkConsent, error)
+	GetCurrentConsents(subscriptionIDs []uint) (map[uint]models.LinkConsent, error)
+	GetAllStatByPatientID(patientID uint, filter NoteFilter) ([]models.Note, error)
+	GetTagsByUserID(userID uint) ([]TagUsage, error)
+	GetOrCreateTags(userID uint, names []string) ([]models.Tag, error)
+	GetTagByID(id uint) (*models.Tag, error)
+	DeleteTag(id uint) error
 	GetDoctorByUsername(username string) (*models.User, error)
-	GetGroupByUserID(userID uint) (string, error)
+	GetUserTimezone(userID uint) (string, error)
+	IsAcceptingPatients(doctorID uint) (bool, error)
 	GetLinkByID(linkID uint) (*models.Subscription, error)
 	UpdateLink(link *models.Subscription) error
+	CreateRevision(rev *models.LinkRevision) error
+	GetRevisions(subscriptionID uint, field string) ([]models.LinkRevision, error)
+	GetLatestRevisions(subscriptionIDs []uint) ([]models.LinkRevision, error)
+	SearchICD10(query string, limit int) ([]models.ICD10Code, error)
+	GetICD10Codes(codes []string) ([]models.ICD10Code, error)
+	GetDiagnosesBySubscriptionIDs(subscriptionIDs []uint) ([]models.Diagnosis, error)
+	ReplaceDiagnoses(subscriptionID uint, diagnoses []models.Diagnosis, revisions []models.LinkRevision) error
+	GetDiagnosisStatsByDoctorID(doctorID uint) ([]DiagnosisStat, error)
+	GetDiagnosedPatientIDsByDoctorID(doctorID uint) ([]uint, error)
+	CreatePrescription(p *models.Prescription) error
+	GetPrescriptionByID(id uint) (*models.Prescription, error)
+	GetPrescriptionsBySubscriptionID(subscriptionID uint) ([]models.Prescription, error)
+	GetActivePrescriptionsBySubscriptionIDs(subscriptionIDs []uint, day time.Time) ([]models.Prescription, error)
+	UpdatePrescription(p *models.Prescription) error
+	DeletePrescription(id uint) error
+	CreateIntake(intake *models.MedicationIntake) (bool, error)
+	HasIntakeForSlot(prescriptionID uint, scheduledFor time.Time) (bool, error)
+	GetIntakesByPrescriptionID(prescriptionID uint, from, to time.Time) ([]models.MedicationIntake, error)
+	GetNotesByPatientBetween(patientID uint, from, to time.Time) ([]models.Note, error)
+	GetBodyParts(includeInactive bool) ([]models.BodyPart, error)
+	GetBodyPartByID(id uint) (*models.BodyPart, error)
+	CreateBodyPart(part *models.BodyPart) error
+	UpdateBodyPart(part *models.BodyPart, labels []models.BodyPartLabel) error
 }
 
 func NewRepository(db *gorm.DB) Repository {
@@ -30,7 +82,7 @@ func NewRepository(db *gorm.DB) Repository {
 func (r *Repo) GetSubscriptionsByPatientID(patientID uint, offset, limit int) ([]models.Subscription, error) {
 	var subs []models.Subscription
 	if err := r.DB.Preload("Doctor").
-		Where("patient_id = ? AND status = ?", patientID, "accepted").
+		Where("patient_id = ? AND status <> ?", patientID, "archived").
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(limit).
@@ -42,7 +94,7 @@ func (r *Repo) GetSubscriptionsByPatientID(patientID uint, offset, limit int) ([
 func (r *Repo) GetSubscriptionsByDoctorID(doctorID uint, offset, limit int) ([]models.Subscription, error) {
 	var subs []models.Subscription
 	if err := r.DB.Preload("Patient").
-		Where("doctor_id = ?", doctorID).
+		Where("doctor_id = ? AND status <> ?", doctorID, "archived").
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(limit).
@@ -52,24 +104,75 @@ func (r *Repo) GetSubscriptionsByDoctorID(doctorID uint, offset, limit int) ([]m
 	return subs, nil
 }
 
-func (r *Repo) GetGroupByUserID(userID uint) (string, error) {
+func (r *Repo) GetDoctorByUsername(username string) (*models.User, error) {
+	var doctor models.User
+	if err := r.DB.Where("username = ? AND id IN (?)", username, rbac.UsersWithRole(r.DB, rbac.RoleDoctor)).
+		First(&doctor).Error; err != nil {
+		return nil, err
+	}
+	return &doctor, nil
+}
+
+func (r *Repo) GetUserTimezone(userID uint) (string, error) {
 	var user models.User
-	if err := r.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := r.DB.Select("id, timezone").First(&user, userID).Error; err != nil {
 		return "", err
 	}
-	return user.Groups, nil
+	return user.Timezone, nil
 }
 
-func (r *Repo) GetDoctorByUsername(username string) (*models.User, error) {
-	var doctor models.User
-	if err := r.DB.Where("username = ? AND groups = ?", username, "Doctor").First(&doctor).Error; err != nil {
-		return nil, err
+// IsAcceptingPatients — открыт ли у врача приём новых пациентов; без карточки в каталоге — открыт.
+func (r *Repo) IsAcceptingPatients(doctorID uint) (bool, error) {
+	var profile models.DoctorProfile
+	err := r.DB.Select("accepting_new_patients").Where("user_id = ?", doctorID).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
 	}
-	return &doctor, nil
+	if err != nil {
+		return false, err
+	}
+	return profile.AcceptingNewPatients, nil
 }
 
+// lockPatientTeam — ключ advisory-блокировки команды лечения пациента
+// (1–3 заняты расписаниями и ревизиями записей дневника).
+const lockPatientTeam = 4
+
+// CreateSubscription создаёт привязку и назначает ей роль: первый врач пациента
+// становится ведущим. Команда пациента блокируется до конца транзакции, чтобы два
+// одновременных запроса не выбрали ведущего оба и не создали две действующие
+// привязки к одному врачу; такой повтор возвращает ErrLinkExists.
 func (r *Repo) CreateSubscription(sub *models.Subscription) error {
-	return r.DB.Create(sub).Error
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", lockPatientTeam, sub.PatientID).Error; err != nil {
+			return err
+		}
+		var active int64
+		if err := tx.Model(&models.Subscription{}).
+			Where("doctor_id = ? AND patient_id = ? AND status IN ?", sub.DoctorID, sub.PatientID, []string{LinkPending, LinkAccepted}).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrLinkExists
+		}
+		var leads int64
+		if err := tx.Model(&models.Subscription{}).
+			Where("patient_id = ? AND role = ? AND status IN ?", sub.PatientID, CareRoleLead, []string{LinkPending, LinkAccepted}).
+			Count(&leads).Error; err != nil {
+			return err
+		}
+		sub.Role = CareRoleLead
+		if leads > 0 {
+			sub.Role = CareRoleConsultant
+		}
+		return tx.Create(sub).Error
+	})
+	// привязку, созданную в обход блокировки, всё равно не пропустит idx_subscription_active
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrLinkExists
+	}
+	return err
 }
 
 func (r *Repo) GetLinkByDoctorAndPatient(doctorID, patientID uint) (*models.Subscription, error) {
@@ -80,6 +183,175 @@ func (r *Repo) GetLinkByDoctorAndPatient(doctorID, patientID uint) (*models.Subs
 	return &link, nil
 }
 
+func (r *Repo) GetAcceptedLink(doctorID, patientID uint) (*models.Subscription, error) {
+	var link models.Subscription
+	if err := r.DB.Where("doctor_id = ? AND patient_id = ? AND status = ?", doctorID, patientID, "accepted").
+		Order("id DESC").
+		First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetActiveLink — привязка врача и пациента в статусе pending или accepted.
+func (r *Repo) GetActiveLink(doctorID, patientID uint) (*models.Subscription, error) {
+	var link models.Subscription
+	if err := r.DB.Where("doctor_id = ? AND patient_id = ? AND status IN ?", doctorID, patientID, []string{"pending", "accepted"}).
+		First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *Repo) GetLatestLinkWithStatus(doctorID, patientID uint, status string) (*models.Subscription, error) {
+	var link models.Subscription
+	if err := r.DB.Where("doctor_id = ? AND patient_id = ? AND status = ?", doctorID, patientID, status).
+		Order("updated_at DESC").
+		First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *Repo) GetLinkWithParticipants(linkID uint) (*models.Subscription, error) {
+	var link models.Subscription
+	if err := r.DB.Preload("Doctor").Preload("Patient").Where("id = ?", linkID).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetLinksByUserID — все привязки пользователя с обеих сторон, включая архивные.
+func (r *Repo) GetLinksByUserID(userID uint) ([]models.Subscription, error) {
+	var links []models.Subscription
+	if err := r.DB.Preload("Doctor").Preload("Patient").
+		Where("doctor_id = ? OR patient_id = ?", userID, userID).
+		Order("created_at DESC").
+		Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// TransitionLink сохраняет новый статус, только если привязка всё ещё в статусе from;
+// false — статус успели изменить параллельно.
+func (r *Repo) TransitionLink(link *models.Subscription, from string) (bool, error) {
+	res := r.DB.Model(link).
+		Where("status = ?", from).
+		Select("status", "ended_at", "ended_by_id", "end_reason").
+		Updates(link)
+	return res.RowsAffected > 0, res.Error
+}
+
+// GetTeamLead — действующая привязка ведущего врача пациента.
+func (r *Repo) GetTeamLead(patientID uint) (*models.Subscription, error) {
+	var link models.Subscription
+	if err := r.DB.Preload("Doctor").
+		Where("patient_id = ? AND role = ? AND status IN ?", patientID, "lead", []string{"pending", "accepted"}).
+		First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetTeamLinks — команда лечения пациента: привязки в статусе pending или accepted,
+// ведущий врач первым.
+func (r *Repo) GetTeamLinks(patientID uint) ([]models.Subscription, error) {
+	var links []models.Subscription
+	if err := r.DB.Preload("Doctor").
+		Where("patient_id = ? AND status IN ?", patientID, []string{"pending", "accepted"}).
+		Order("role = 'lead' DESC, created_at, id").
+		Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// SetLinkRole меняет роль врача в команде; назначение ведущим снимает эту роль
+// с прежнего ведущего врача пациента и переносит его диагнозы новому.
+func (r *Repo) SetLinkRole(link *models.Subscription, role string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if role == "lead" {
+			var previous []uint
+			if err := tx.Model(&models.Subscription{}).
+				Where("patient_id = ? AND id <> ? AND role = ? AND status IN ?", link.PatientID, link.ID, "lead", []string{"pending", "accepted"}).
+				Pluck("id", &previous).Error; err != nil {
+				return err
+			}
+			if len(previous) > 0 {
+				if err := tx.Model(&models.Subscription{}).Where("id IN ?", previous).Update("role", "consultant").Error; err != nil {
+					return err
+				}
+				if err := moveDiagnoses(tx, previous, link.ID); err != nil {
+					return err
+				}
+			}
+		}
+		link.Role = role
+		return tx.Model(link).Update("role", role).Error
+	})
+}
+
+// moveDiagnoses переносит диагнозы прежнего ведущего врача на привязку нового:
+// команда видит диагнозы ведущего. Если у нового ведущего уже есть свои, их не трогаем.
+func moveDiagnoses(tx *gorm.DB, fromLinkIDs []uint, toLinkID uint) error {
+	var count int64
+	if err := tx.Model(&models.Diagnosis{}).Where("subscription_id = ?", toLinkID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return tx.Model(&models.Diagnosis{}).
+		Where("subscription_id IN ?", fromLinkIDs).
+		Update("subscription_id", toLinkID).Error
+}
+
+func (r *Repo) CreateConsent(consent *models.LinkConsent) error {
+	return r.DB.Create(consent).Error
+}
+
+func (r *Repo) GetCurrentConsent(subscriptionID uint) (*models.LinkConsent, error) {
+	var consent models.LinkConsent
+	if err := r.DB.Where("subscription_id = ?", subscriptionID).
+		Order("created_at DESC, id DESC").
+		First(&consent).Error; err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// GetCurrentConsents — действующие согласия по набору привязок; привязок без
+// согласия в результате нет.
+func (r *Repo) GetCurrentConsents(subscriptionIDs []uint) (map[uint]models.LinkConsent, error) {
+	result := make(map[uint]models.LinkConsent)
+	if len(subscriptionIDs) == 0 {
+		return result, nil
+	}
+	var consents []models.LinkConsent
+	if err := r.DB.Raw(`SELECT DISTINCT ON (subscription_id) * FROM link_consents
+		WHERE subscription_id IN ?
+		ORDER BY subscription_id, created_at DESC, id DESC`, subscriptionIDs).
+		Scan(&consents).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range consents {
+		result[c.SubscriptionID] = c
+	}
+	return result, nil
+}
+
+// GetConsentHistory — все версии согласия по привязке, новые первыми.
+func (r *Repo) GetConsentHistory(subscriptionID uint) ([]models.LinkConsent, error) {
+	var consents []models.LinkConsent
+	if err := r.DB.Where("subscription_id = ?", subscriptionID).
+		Order("created_at DESC, id DESC").
+		Find(&consents).Error; err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
 func (r *Repo) GetLinkByID(linkID uint) (*models.Subscription, error) {
 	var link models.Subscription
 	if err := r.DB.Where("id = ?", linkID).First(&link).Error; err != nil {
@@ -92,14 +364,468 @@ func (r *Repo) UpdateLink(link *models.Subscription) error {
 	return r.DB.Save(link).Error
 }
 
-func (r *Repo) GetAllStatByPatientID(patientID uint) ([]models.Note, error) {
+func (r *Repo) CreateRevision(rev *models.LinkRevision) error {
+	return r.DB.Create(rev).Error
+}
+
+// GetRevisions — история привязки, новые версии первыми. Пустой field — все поля.
+func (r *Repo) GetRevisions(subscriptionID uint, field string) ([]models.LinkRevision, error) {
+	var revisions []models.LinkRevision
+	query := r.DB.Preload("Author").Where("subscription_id = ?", subscriptionID)
+	if field != "" {
+		query = query.Where("field = ?", field)
+	}
+	if err := query.Order("created_at DESC, id DESC").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// GetLatestRevisions — последняя версия каждого поля для каждой привязки.
+func (r *Repo) GetLatestRevisions(subscriptionIDs []uint) ([]models.LinkRevision, error) {
+	var revisions []models.LinkRevision
+	if len(subscriptionIDs) == 0 {
+		return revisions, nil
+	}
+	if err := r.DB.
+		Raw(`SELECT DISTINCT ON (subscription_id, field) * FROM link_revisions
+			WHERE subscription_id IN ?
+			ORDER BY subscription_id, field, created_at DESC, id DESC`, subscriptionIDs).
+		Scan(&revisions).Error; err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// SearchICD10 ищет по началу кода или по началу описания.
+func (r *Repo) SearchICD10(query string, limit int) ([]models.ICD10Code, error) {
+	var codes []models.ICD10Code
+	if err := r.DB.
+		Where("code ILIKE ? OR description ILIKE ?", escapeLike(query)+"%", escapeLike(query)+"%").
+		Order("code").
+		Limit(limit).
+		Find(&codes).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (r *Repo) GetICD10Codes(codes []string) ([]models.ICD10Code, error) {
+	var result []models.ICD10Code
+	if len(codes) == 0 {
+		return result, nil
+	}
+	if err := r.DB.Where("code IN ?", codes).Find(&result).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *Repo) GetDiagnosesBySubscriptionIDs(subscriptionIDs []uint) ([]models.Diagnosis, error) {
+	var diagnoses []models.Diagnosis
+	if len(subscriptionIDs) == 0 {
+		return diagnoses, nil
+	}
+	if err := r.DB.
+		Where("subscription_id IN ?", subscriptionIDs).
+		Order("subscription_id, type = 'primary' DESC, id").
+		Find(&diagnoses).Error; err != nil {
+		return nil, err
+	}
+	return diagnoses, nil
+}
+
+// ReplaceDiagnoses целиком заменяет список диагнозов привязки и в той же
+// транзакции сохраняет ревизии, описывающие изменение.
+func (r *Repo) ReplaceDiagnoses(subscriptionID uint, diagnoses []models.Diagnosis, revisions []models.LinkRevision) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", subscriptionID).Delete(&models.Diagnosis{}).Error; err != nil {
+			return err
+		}
+		if len(diagnoses) > 0 {
+			if err := tx.Create(&diagnoses).Error; err != nil {
+				return err
+			}
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+		return tx.Create(&revisions).Error
+	})
+}
+
+// DiagnosisStat — сколько пациентов врача имеют действующий диагноз с кодом.
+type DiagnosisStat struct {
+	Code          string
+	Description   string
+	PatientsCount int
+	PrimaryCount  int
+}
+
+func (r *Repo) GetDiagnosisStatsByDoctorID(doctorID uint) ([]DiagnosisStat, error) {
+	var stats []DiagnosisStat
+	err := r.DB.Table("diagnoses d").
+		Select(`d.code, COALESCE(MAX(i.description), MAX(d.description)) AS description,
+			COUNT(DISTINCT d.patient_id) AS patients_count,
+			COUNT(DISTINCT d.patient_id) FILTER (WHERE d.type = 'primary') AS primary_count`).
+		Joins("JOIN subscriptions s ON s.id = d.subscription_id").
+		Joins("LEFT JOIN icd10_codes i ON i.code = d.code").
+		Where("s.doctor_id = ? AND s.status = ? AND d.status <> ?", doctorID, "accepted", "resolved").
+		Group("d.code").
+		Order("patients_count DESC, d.code").
+		Scan(&stats).Error
+	return stats, err
+}
+
+// GetDiagnosedPatientIDsByDoctorID — пациенты, чьи диагнозы входят в GetDiagnosisStatsByDoctorID.
+func (r *Repo) GetDiagnosedPatientIDsByDoctorID(doctorID uint) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Table("diagnoses d").
+		Joins("JOIN subscriptions s ON s.id = d.subscription_id").
+		Where("s.doctor_id = ? AND s.status = ? AND d.status <> ?", doctorID, "accepted", "resolved").
+		Distinct().
+		Order("d.patient_id").
+		Pluck("d.patient_id", &ids).Error
+	return ids, err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// NoteFilter — необязательные условия отбора записей; нулевое значение не фильтрует.
+type NoteFilter struct {
+	From            *time.Time
+	To              *time.Time // не включительно
+	Tags            []string   // хотя бы одна из меток
+	MinIntensity    *int
+	MaxIntensity    *int
+	MinMood         *int
+	MaxMood         *int
+	MinSleepQuality *int
+	MaxSleepQuality *int
+	ActivityLevel   string
+	Weather         string
+}
+
+func (r *Repo) GetAllStatByPatientID(patientID uint, filter NoteFilter) ([]models.Note, error) {
 	var stats []models.Note
-	if err := r.DB.Where("patient_id = ?", patientID).Find(&stats).Error; err != nil {
+	query := r.DB.Preload("BodyParts").Preload("Tags").Where("patient_id = ?", patientID)
+	if filter.From != nil {
+		query = query.Where("recorded_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("recorded_at < ?", *filter.To)
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where(`id IN (SELECT nt.note_id FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE t.user_id = ? AND t.name IN ?)`, patientID, filter.Tags)
+	}
+	bounds := []struct {
+		cond  string
+		value *int
+	}{
+		{"intensity >= ?", filter.MinIntensity},
+		{"intensity <= ?", filter.MaxIntensity},
+		{"mood >= ?", filter.MinMood},
+		{"mood <= ?", filter.MaxMood},
+		{"sleep_quality >= ?", filter.MinSleepQuality},
+		{"sleep_quality <= ?", filter.MaxSleepQuality},
+	}
+	for _, b := range bounds {
+		if b.value != nil {
+			query = query.Where(b.cond, *b.value)
+		}
+	}
+	if filter.ActivityLevel != "" {
+		query = query.Where("activity_level = ?", filter.ActivityLevel)
+	}
+	if filter.Weather != "" {
+		query = query.Where("weather = ?", filter.Weather)
+	}
+	if err := query.Order("recorded_at").Find(&stats).Error; err != nil {
 		return nil, err
 	}
 	return stats, nil
 }
 
+// TagUsage — метка пользователя и число записей с ней.
+type TagUsage struct {
+	models.Tag
+	NotesCount int
+}
+
+func (r *Repo) GetTagsByUserID(userID uint) ([]TagUsage, error) {
+	var tags []TagUsage
+	err := r.DB.Table("tags t").
+		Select("t.*, COUNT(n.id) AS notes_count").
+		Joins("LEFT JOIN note_tags nt ON nt.tag_id = t.id").
+		Joins("LEFT JOIN notes n ON n.id = nt.note_id AND n.deleted_at IS NULL").
+		Where("t.user_id = ?", userID).
+		Group("t.id").
+		Order("t.name").
+		Scan(&tags).Error
+	return tags, err
+}
+
+// GetOrCreateTags возвращает метки пользователя по именам, создавая недостающие.
+func (r *Repo) GetOrCreateTags(userID uint, names []string) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tags, err = getOrCreateTags(tx, userID, names)
+		return err
+	})
+	return tags, err
+}
+
+func getOrCreateTags(tx *gorm.DB, userID uint, names []string) ([]models.Tag, error) {
+	var tags []models.Tag
+	if len(names) == 0 {
+		return tags, nil
+	}
+	missing := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		missing = append(missing, models.Tag{UserID: userID, Name: name})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ? AND name IN ?", userID, names).Order("name").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (r *Repo) GetTagByID(id uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.DB.First(&tag, id).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (r *Repo) DeleteTag(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// записи, с которых снята метка, должны попасть в дельту синхронизации
+		if err := tx.Exec(`UPDATE notes SET updated_at = ? WHERE id IN (SELECT note_id FROM note_tags WHERE tag_id = ?)`, time.Now(), id).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM note_tags WHERE tag_id = ?`, id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Tag{}, id).Error
+	})
+}
+
+// CreateNote сохраняет запись; метки из note.Tags (по именам) создаются в той же
+// транзакции, чтобы неудачное сохранение не оставляло пустых меток.
 func (r *Repo) CreateNote(note *models.Note) error {
-	return r.DB.Create(note).Error
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		tags, err := getOrCreateTags(tx, note.PatientID, tagNames(note.Tags))
+		if err != nil {
+			return err
+		}
+		note.Tags = tags
+		return tx.Create(note).Error
+	})
+}
+
+func (r *Repo) GetBodyParts(includeInactive bool) ([]models.BodyPart, error) {
+	var parts []models.BodyPart
+	query := r.DB.Preload("Labels")
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+	if err := query.Order("sort_order, id").Find(&parts).Error; err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+func (r *Repo) GetBodyPartByID(id uint) (*models.BodyPart, error) {
+	var part models.BodyPart
+	if err := r.DB.Preload("Labels").Where("id = ?", id).First(&part).Error; err != nil {
+		return nil, err
+	}
+	return &part, nil
+}
+
+func (r *Repo) CreateBodyPart(part *models.BodyPart) error {
+	return r.DB.Create(part).Error
+}
+
+// UpdateBodyPart сохраняет часть тела и её подписи одной транзакцией.
+func (r *Repo) UpdateBodyPart(part *models.BodyPart, labels []models.BodyPartLabel) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Labels").Save(part).Error; err != nil {
+			return err
+		}
+		if len(labels) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "body_part_id"}, {Name: "locale"}},
+			DoUpdates: clause.AssignmentColumns([]string{"label"}),
+		}).Create(&labels).Error
+	})
+}
+
+func (r *Repo) GetNoteByID(noteID uint) (*models.Note, error) {
+	var note models.Note
+	if err := r.DB.Preload("BodyParts").Preload("Tags").Where("id = ?", noteID).First(&note).Error; err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+func (r *Repo) HasAcceptedLink(doctorID, patientID uint) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Subscription{}).
+		Where("doctor_id = ? AND patient_id = ? AND status = ?", doctorID, patientID, "accepted").
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetNoteByClientID ищет запись в том числе среди удалённых, чтобы повтор
+// синхронизации не воскрешал удалённую запись.
+func (r *Repo) GetNoteByClientID(patientID uint, clientID string) (*models.Note, error) {
+	var note models.Note
+	if err := r.DB.Unscoped().Preload("BodyParts").Preload("Tags").
+		Where("patient_id = ? AND client_id = ?", patientID, clientID).
+		First(&note).Error; err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// ReplaceNote сохраняет запись и полностью заменяет её части тела и метки
+// (метки из note.Tags создаются по именам в той же транзакции).
+func (r *Repo) ReplaceNote(note *models.Note) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		tags, err := getOrCreateTags(tx, note.PatientID, tagNames(note.Tags))
+		if err != nil {
+			return err
+		}
+		note.Tags = tags
+		if err := tx.Where("note_id = ?", note.ID).Delete(&models.NoteBodyPart{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("BodyParts", "Tags").Save(note).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(note).Association("Tags").Replace(note.Tags); err != nil {
+			return err
+		}
+		for i := range note.BodyParts {
+			note.BodyParts[i].ID = 0
+			note.BodyParts[i].NoteID = note.ID
+		}
+		if len(note.BodyParts) == 0 {
+			return nil
+		}
+		return tx.Create(&note.BodyParts).Error
+	})
+}
+
+// SoftDeleteNote помечает запись удалённой; триггер поднимает её sync_version,
+// и удаление попадает в дельту синхронизации.
+func (r *Repo) SoftDeleteNote(noteID uint, at time.Time) error {
+	return r.DB.Unscoped().Model(&models.Note{}).
+		Where("id = ?", noteID).
+		Updates(map[string]interface{}{"deleted_at": at, "updated_at": at}).Error
+}
+
+func (r *Repo) GetNotesChangedSince(patientID uint, afterVersion int64, limit int) ([]models.Note, error) {
+	var notes []models.Note
+	if err := r.DB.Unscoped().Preload("BodyParts").Preload("Tags").
+		Where("patient_id = ? AND sync_version > ?", patientID, afterVersion).
+		Order("sync_version").
+		Limit(limit).
+		Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (r *Repo) CreatePrescription(p *models.Prescription) error {
+	return r.DB.Create(p).Error
+}
+
+func (r *Repo) GetPrescriptionByID(id uint) (*models.Prescription, error) {
+	var p models.Prescription
+	if err := r.DB.Where("id = ?", id).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *Repo) GetPrescriptionsBySubscriptionID(subscriptionID uint) ([]models.Prescription, error) {
+	var prescriptions []models.Prescription
+	if err := r.DB.Where("subscription_id = ?", subscriptionID).
+		Order("start_date DESC, id DESC").
+		Find(&prescriptions).Error; err != nil {
+		return nil, err
+	}
+	return prescriptions, nil
+}
+
+func (r *Repo) GetActivePrescriptionsBySubscriptionIDs(subscriptionIDs []uint, day time.Time) ([]models.Prescription, error) {
+	var prescriptions []models.Prescription
+	if len(subscriptionIDs) == 0 {
+		return prescriptions, nil
+	}
+	if err := r.DB.
+		Where("subscription_id IN ? AND start_date <= ? AND (end_date IS NULL OR end_date >= ?)", subscriptionIDs, day, day).
+		Order("medication_name").
+		Find(&prescriptions).Error; err != nil {
+		return nil, err
+	}
+	return prescriptions, nil
+}
+
+func (r *Repo) UpdatePrescription(p *models.Prescription) error {
+	return r.DB.Save(p).Error
+}
+
+func (r *Repo) DeletePrescription(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.Prescription{}).Error
+}
+
+// CreateIntake сохраняет приём; false — приём по этому слоту расписания уже отмечен.
+func (r *Repo) CreateIntake(intake *models.MedicationIntake) (bool, error) {
+	res := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(intake)
+	return res.RowsAffected > 0, res.Error
+}
+
+// GetIntakesByPrescriptionID отбирает приёмы по плановому времени, а для
+// приёмов без расписания — по фактическому.
+func (r *Repo) GetIntakesByPrescriptionID(prescriptionID uint, from, to time.Time) ([]models.MedicationIntake, error) {
+	var intakes []models.MedicationIntake
+	if err := r.DB.
+		Where("prescription_id = ? AND COALESCE(scheduled_for, taken_at, created_at) >= ? AND COALESCE(scheduled_for, taken_at, created_at) < ?", prescriptionID, from, to).
+		Order("COALESCE(scheduled_for, taken_at, created_at)").
+		Find(&intakes).Error; err != nil {
+		return nil, err
+	}
+	return intakes, nil
+}
+
+func (r *Repo) GetNotesByPatientBetween(patientID uint, from, to time.Time) ([]models.Note, error) {
+	var notes []models.Note
+	if err := r.DB.
+		Where("patient_id = ? AND recorded_at >= ? AND recorded_at < ?", patientID, from, to).
+		Order("recorded_at").
+		Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (r *Repo) HasIntakeForSlot(prescriptionID uint, scheduledFor time.Time) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.MedicationIntake{}).
+		Where("prescription_id = ? AND scheduled_for = ?", prescriptionID, scheduledFor).
+		Count(&count).Error
+	return count > 0, err
 }
@@ -1,17 +1,177 @@
 package diary
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"painaway_test/internal/notifications"
 	"painaway_test/internal/utils"
 	"painaway_test/models"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultLocale — язык, на который откатываемся, если в Accept-Language нет
+// ни одного языка из каталога.
+const DefaultLocale = "ru"
+
+// Статусы привязки врач–пациент.
+const (
+	LinkPending   = "pending"
+	LinkAccepted  = "accepted"
+	LinkRejected  = "rejected"
+	LinkCancelled = "cancelled"
+	LinkEnded     = "ended"
+	LinkArchived  = "archived"
+
+	linkRoleDoctor  = "doctor"
+	linkRolePatient = "patient"
+	linkRoleAny     = "any"
+)
+
+// linkTransitions: текущий статус → новый статус → кто может выполнить переход.
+var linkTransitions = map[string]map[string]string{
+	LinkPending: {
+		LinkAccepted:  linkRoleDoctor,
+		LinkRejected:  linkRoleDoctor,
+		LinkCancelled: linkRolePatient,
+	},
+	LinkAccepted:  {LinkEnded: linkRoleAny},
+	LinkRejected:  {LinkArchived: linkRoleAny},
+	LinkCancelled: {LinkArchived: linkRoleAny},
+	LinkEnded:     {LinkArchived: linkRoleAny},
+}
+
+// Роли врача в команде лечения пациента.
+const (
+	CareRoleLead       = "lead"
+	CareRoleConsultant = "consultant"
+	CareRoleNurse      = "nurse"
+)
+
+// Права врача в команде лечения. Просматривать дневник может любой участник
+// с принятой привязкой.
+const (
+	PermEditDiagnosis        = "edit_diagnosis"
+	PermPrescribe            = "prescribe"
+	PermAssignQuestionnaires = "assign_questionnaires"
+	PermManageTeam           = "manage_team"
+)
+
+var careRolePermissions = map[string][]string{
+	CareRoleLead:       {PermEditDiagnosis, PermPrescribe, PermAssignQuestionnaires, PermManageTeam},
+	CareRoleConsultant: {PermPrescribe, PermAssignQuestionnaires},
+	CareRoleNurse:      {},
+}
+
+// Поля привязки, у которых ведётся история версий.
+const (
+	RevisionPrescription   = "prescription"
+	RevisionDiagnosis      = "diagnosis"
+	RevisionDiagnosisCodes = "diagnosis_codes"
+)
+
+const (
+	icd10DefaultLimit = 20
+	icd10MaxLimit     = 100
+	maxDiagnoses      = 20
+)
+
+var (
+	ErrInvalidBodyPart = errors.New("invalid body part")
+	ErrInvalidNote     = errors.New("invalid note")
+	ErrInvalidCursor   = errors.New("invalid sync cursor")
+	ErrForbidden       = errors.New("access denied")
+
+	ErrInvalidPrescription = errors.New("invalid prescription")
+	ErrInvalidIntake       = errors.New("invalid intake")
+	ErrIntakeExists        = errors.New("intake for this dose is already logged")
+	ErrInvalidPeriod       = errors.New("invalid period")
+
+	ErrInvalidTransition = errors.New("invalid link status transition")
+	ErrLinkExists        = errors.New("link with this doctor already exists")
+	ErrLinkCooldown      = errors.New("request was rejected recently, try again later")
+	ErrNotAccepting      = errors.New("doctor is not accepting new patients")
+	ErrInvalidCareRole   = errors.New("invalid care team role")
+
+	ErrInvalidRevisionField = errors.New("invalid revision field")
+	ErrInvalidDiagnosis     = errors.New("invalid diagnosis")
+
+	bodyPartCodeRe   = regexp.MustCompile(`^[a-z0-9_]+$`)
+	bodyPartLocaleRe = regexp.MustCompile(`^[a-z]{2}$`)
+	uuidRe           = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	timeOfDayRe      = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+	revisionFields = map[string]bool{
+		RevisionPrescription:   true,
+		RevisionDiagnosis:      true,
+		RevisionDiagnosisCodes: true,
+	}
+	diagnosisTypes    = map[string]bool{"primary": true, "secondary": true}
+	diagnosisStatuses = map[string]bool{"active": true, "remission": true, "resolved": true}
+
+	activityLevels = map[string]bool{"sedentary": true, "light": true, "moderate": true, "vigorous": true}
+	weatherKinds   = map[string]bool{
+		"sunny":  true,
+		"cloudy": true,
+		"rain":   true,
+		"snow":   true,
+		"storm":  true,
+		"fog":    true,
+		"windy":  true,
+	}
+
+	prescriptionRoutes = map[string]bool{
+		"oral":        true,
+		"sublingual":  true,
+		"iv":          true,
+		"im":          true,
+		"sc":          true,
+		"topical":     true,
+		"transdermal": true,
+		"inhalation":  true,
+		"rectal":      true,
+		"other":       true,
+	}
+)
+
+const (
+	syncMaxBatch     = 100
+	syncDefaultLimit = 200
+	syncMaxLimit     = 500
+	// допускаем небольшое расхождение часов клиента и сервера
+	maxClockSkew = 5 * time.Minute
+
+	// приём позже планового больше чем на час считается опозданием
+	lateIntakeThreshold = time.Hour
+	defaultReportDays   = 30
+	maxReportDays       = 366
+
+	maxTagsPerNote = 20
+	maxTagLength   = 40
+	// день с максимальной интенсивностью не ниже порога считается днём сильной боли
+	defaultHighIntensity = 7
+
+	// после отказа врача повторный запрос к нему возможен не раньше чем через неделю
+	linkRequestCooldown = 7 * 24 * time.Hour
+	maxEndReasonLength  = 500
 )
 
 type Service struct {
 	Repo                 Repository
 	NotificationsService *notifications.Service
 	Logger               *zap.Logger
+
+	linkEndedHooks []func(link models.Subscription)
 }
 
 func NewService(repo Repository, notifSrv *notifications.Service, logger *zap.Logger) *Service {
@@ -38,11 +198,35 @@ func (s *Service) PatientListLinks(userID uint) ([]utils.PatientLinkDTO, error)
 		}, nil
 	}
 
+	subIDs := make([]uint, 0, len(subs))
+	for _, sub := range subs {
+		subIDs = append(subIDs, sub.ID)
+	}
+	active, err := s.Repo.GetActivePrescriptionsBySubscriptionIDs(subIDs, today())
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.currentLinkTexts(subIDs)
+	if err != nil {
+		return nil, err
+	}
+	diagnoses, err := s.linkDiagnoses(subIDs)
+	if err != nil {
+		return nil, err
+	}
+	regimens := make(map[uint][]models.Prescription)
+	for _, p := range active {
+		regimens[p.SubscriptionID] = append(regimens[p.SubscriptionID], p)
+	}
+
 	var result []utils.PatientLinkDTO
 	for _, sub := range subs {
 		dto := utils.PatientLinkDTO{
-			ID:     sub.ID,
-			Status: sub.Status,
+			ID:        sub.ID,
+			Status:    sub.Status,
+			Role:      sub.Role,
+			EndedAt:   sub.EndedAt,
+			EndReason: sub.EndReason,
 			Doctor: utils.DoctorDTO{
 				ID:         sub.Doctor.ID,
 				Username:   sub.Doctor.Username,
@@ -50,7 +234,9 @@ func (s *Service) PatientListLinks(userID uint) ([]utils.PatientLinkDTO, error)
 				FirstName:  sub.Doctor.FirstName,
 				FatherName: sub.Doctor.FatherName,
 			},
-			Prescription: sub.Prescription,
+			Prescription: current[sub.ID][RevisionPrescription],
+			Regimen:      s.ToPrescriptionDTO(regimens[sub.ID]),
+			Diagnoses:    diagnoses[sub.ID],
 		}
 		result = append(result, dto)
 	}
@@ -73,13 +259,34 @@ func (s *Service) DoctorListLinks(userID uint) ([]utils.DoctorLinkDTO, error) {
 		}, nil
 	}
 
+	subIDs := make([]uint, 0, len(subs))
+	for _, sub := range subs {
+		subIDs = append(subIDs, sub.ID)
+	}
+	current, err := s.currentLinkTexts(subIDs)
+	if err != nil {
+		return nil, err
+	}
+	diagnoses, err := s.linkDiagnoses(subIDs)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := s.Repo.GetCurrentConsents(subIDs)
+	if err != nil {
+		return nil, err
+	}
+
 	var result []utils.DoctorLinkDTO
 	for _, sub := range subs {
 		dto := utils.DoctorLinkDTO{
 			ID:           sub.ID,
 			Status:       sub.Status,
-			Prescription: utils.UpdatePrescriptionDTO{Prescription: sub.Prescription, ID: sub.ID},
-			Diagnosis:    utils.UpdateDiagnosisDTO{Diagnosis: sub.Diagnosis, ID: sub.ID},
+			Role:         sub.Role,
+			EndedAt:      sub.EndedAt,
+			EndReason:    sub.EndReason,
+			Prescription: utils.UpdatePrescriptionDTO{Prescription: current[sub.ID][RevisionPrescription], ID: sub.ID},
+			Diagnosis:    utils.UpdateDiagnosisDTO{Diagnosis: current[sub.ID][RevisionDiagnosis], ID: sub.ID},
+			Diagnoses:    diagnoses[sub.ID],
 			Patient: utils.PatientDTO{
 				ID:          sub.Patient.ID,
 				FirstName:   sub.Patient.FirstName,
@@ -89,6 +296,18 @@ func (s *Service) DoctorListLinks(userID uint) ([]utils.DoctorLinkDTO, error) {
 				DateOfBirth: sub.Patient.DateOfBirth.Format("02.01.2006"),
 			},
 		}
+		// без согласия на профиль врач видит только ФИО пациента
+		consent, hasConsent := consents[sub.ID]
+		if hasConsent && !consentAllows(consent, ScopeProfile) {
+			dto.Patient.Sex = ""
+			dto.Patient.DateOfBirth = ""
+		}
+		// назначение и диагнозы — только по принятой привязке и с согласием на medications
+		if sub.Status != LinkAccepted || hasConsent && !consentAllows(consent, ScopeMedications) {
+			dto.Prescription.Prescription = ""
+			dto.Diagnosis.Diagnosis = ""
+			dto.Diagnoses = nil
+		}
 		result = append(result, dto)
 	}
 
@@ -100,11 +319,20 @@ func (s *Service) LinkDoc(patientID uint, docUsername string) (*utils.PatientLin
 	if err != nil {
 		return nil, err
 	}
-
+	accepting, err := s.Repo.IsAcceptingPatients(doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !accepting {
+		return nil, ErrNotAccepting
+	}
+	if err := s.checkLinkRequest(doc.ID, patientID); err != nil {
+		return nil, err
+	}
 	sub := &models.Subscription{
 		PatientID: patientID,
 		DoctorID:  doc.ID,
-		Status:    "pending",
+		Status:    LinkPending,
 	}
 
 	if err := s.Repo.CreateSubscription(sub); err != nil {
@@ -113,6 +341,7 @@ func (s *Service) LinkDoc(patientID uint, docUsername string) (*utils.PatientLin
 	dto := &utils.PatientLinkDTO{
 		ID:     sub.ID,
 		Status: sub.Status,
+		Role:   sub.Role,
 		Doctor: utils.DoctorDTO{
 			ID:         doc.ID,
 			Username:   doc.Username,
@@ -135,89 +364,2201 @@ func (s *Service) LinkDoc(patientID uint, docUsername string) (*utils.PatientLin
 	return dto, nil
 }
 
+// LinkByInvite прикрепляет пациента к врачу по приглашению: сразу принятой привязкой
+// или запросом на рассмотрение. Ожидание после отказа не действует — врач сам пригласил пациента.
+func (s *Service) LinkByInvite(doctorID, patientID uint, accepted bool) (*models.Subscription, error) {
+	if doctorID == patientID {
+		return nil, fmt.Errorf("%w: cannot link to yourself", ErrInvalidTransition)
+	}
+	if _, err := s.Repo.GetActiveLink(doctorID, patientID); err == nil {
+		return nil, ErrLinkExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	sub := &models.Subscription{
+		PatientID: patientID,
+		DoctorID:  doctorID,
+		Status:    LinkPending,
+	}
+	if accepted {
+		sub.Status = LinkAccepted
+	}
+	if err := s.Repo.CreateSubscription(sub); err != nil {
+		return nil, err
+	}
+	link, err := s.Repo.GetLinkWithParticipants(sub.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	patient := strings.TrimSpace(link.Patient.LastName + " " + link.Patient.FirstName)
+	message := "Пациент " + patient + " отправил запрос на прикрепление по приглашению"
+	if accepted {
+		message = "Пациент " + patient + " прикрепился по приглашению"
+	}
+	if err := s.NotificationsService.CreateNotification(link.DoctorID, message); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("doctorID", link.DoctorID),
+			zap.Uint("patientID", patientID),
+			zap.Error(err),
+		)
+	}
+	return link, nil
+}
+
+// checkLinkRequest — можно ли пациенту отправить врачу новый запрос: не должно быть
+// действующей привязки, а после отказа нужно выждать linkRequestCooldown.
+func (s *Service) checkLinkRequest(doctorID, patientID uint) error {
+	if doctorID == patientID {
+		return fmt.Errorf("%w: cannot link to yourself", ErrInvalidTransition)
+	}
+	if _, err := s.Repo.GetActiveLink(doctorID, patientID); err == nil {
+		return ErrLinkExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	rejected, err := s.Repo.GetLatestLinkWithStatus(doctorID, patientID, LinkRejected)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if time.Since(rejected.UpdatedAt) < linkRequestCooldown {
+		return ErrLinkCooldown
+	}
+	return nil
+}
+
+// RespondToLinkRequest — ответ врача на ожидающий запрос пациента (action: accept / reject).
 func (s *Service) RespondToLinkRequest(doctorID, patientID uint, action string) error {
-	link, err := s.Repo.GetLinkByDoctorAndPatient(doctorID, patientID)
+	status, ok := map[string]string{"accept": LinkAccepted, "reject": LinkRejected}[action]
+	if !ok {
+		return fmt.Errorf("%w: action must be accept or reject", ErrInvalidTransition)
+	}
+	link, err := s.Repo.GetActiveLink(doctorID, patientID)
 	if err != nil {
 		return err
 	}
+	_, err = s.TransitionLink(doctorID, link.ID, status, "")
+	return err
+}
 
-	switch action {
-	case "accept":
-		link.Status = "accepted"
-	case "reject":
-		link.Status = "rejected"
+// TransitionLink переводит привязку в новый статус, если такой переход разрешён
+// пользователю с его ролью в привязке (см. linkTransitions).
+func (s *Service) TransitionLink(userID, linkID uint, status, reason string) (*models.Subscription, error) {
+	link, err := s.Repo.GetLinkWithParticipants(linkID)
+	if err != nil {
+		return nil, err
+	}
+	var role string
+	switch userID {
+	case link.DoctorID:
+		role = linkRoleDoctor
+	case link.PatientID:
+		role = linkRolePatient
 	default:
+		return nil, ErrForbidden
+	}
+
+	allowed, ok := linkTransitions[link.Status][status]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s → %s", ErrInvalidTransition, link.Status, status)
+	}
+	if allowed != linkRoleAny && allowed != role {
+		return nil, ErrForbidden
+	}
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > maxEndReasonLength {
+		return nil, fmt.Errorf("%w: reason is longer than %d characters", ErrInvalidTransition, maxEndReasonLength)
+	}
+
+	from := link.Status
+	link.Status = status
+	if status == LinkEnded {
+		now := time.Now()
+		link.EndedAt = &now
+		link.EndedByID = &userID
+		link.EndReason = reason
+	}
+	ok, err = s.Repo.TransitionLink(link, from)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: link status has changed", ErrInvalidTransition)
+	}
+
+	s.notifyLinkTransition(link, role)
+	if status == LinkEnded {
+		for _, hook := range s.linkEndedHooks {
+			hook(*link)
+		}
+	}
+	return link, nil
+}
+
+// UserLinks — все привязки пользователя (он врач или пациент), для администратора.
+func (s *Service) UserLinks(userID uint) ([]models.Subscription, error) {
+	return s.Repo.GetLinksByUserID(userID)
+}
+
+// CloseUserLinks завершает от имени пользователя все его действующие привязки:
+// свои запросы он отзывает, входящие отклоняет, принятые — завершает с причиной reason.
+// Нужно перед удалением аккаунта, чтобы вторая сторона узнала об этом.
+func (s *Service) CloseUserLinks(userID uint, reason string) error {
+	links, err := s.Repo.GetLinksByUserID(userID)
+	if err != nil {
 		return err
 	}
+	for _, link := range links {
+		var status string
+		switch {
+		case link.Status == LinkAccepted:
+			status = LinkEnded
+		case link.Status == LinkPending && link.PatientID == userID:
+			status = LinkCancelled
+		case link.Status == LinkPending:
+			status = LinkRejected
+		default:
+			continue
+		}
+		// привязку могли параллельно закрыть с другой стороны — это не ошибка
+		if _, err := s.TransitionLink(userID, link.ID, status, reason); err != nil && !errors.Is(err, ErrInvalidTransition) {
+			return err
+		}
+	}
+	return nil
+}
 
-	if err := s.NotificationsService.CreateNotification(
-		patientID,
-		"Ответ на запрос о прикреплении",
-	); err != nil {
+// OnLinkEnded регистрирует обработчик завершения привязки (закрыть переписку,
+// отменить записи на приём и т.п.). Обработчики вызываются синхронно и сами логируют ошибки.
+func (s *Service) OnLinkEnded(hook func(link models.Subscription)) {
+	s.linkEndedHooks = append(s.linkEndedHooks, hook)
+}
+
+func (s *Service) notifyLinkTransition(link *models.Subscription, role string) {
+	doctor := strings.TrimSpace(link.Doctor.LastName + " " + link.Doctor.FirstName)
+	patient := strings.TrimSpace(link.Patient.LastName + " " + link.Patient.FirstName)
+
+	var recipientID uint
+	var message string
+	switch link.Status {
+	case LinkAccepted:
+		recipientID, message = link.PatientID, "Врач "+doctor+" принял ваш запрос на прикрепление"
+	case LinkRejected:
+		recipientID, message = link.PatientID, "Врач "+doctor+" отклонил ваш запрос на прикрепление"
+	case LinkCancelled:
+		recipientID, message = link.DoctorID, "Пациент "+patient+" отозвал запрос на прикрепление"
+	case LinkEnded:
+		if role == linkRoleDoctor {
+			recipientID, message = link.PatientID, "Врач "+doctor+" завершил наблюдение"
+		} else {
+			recipientID, message = link.DoctorID, "Пациент "+patient+" завершил наблюдение"
+		}
+		if link.EndReason != "" {
+			message += ": " + link.EndReason
+		}
+	default:
+		return
+	}
+
+	if err := s.NotificationsService.CreateNotification(recipientID, message); err != nil {
 		s.Logger.Error("failed to create notification",
-			zap.Uint("doctorID", doctorID),
-			zap.Uint("patientID", patientID),
+			zap.Uint("linkID", link.ID),
+			zap.Uint("userID", recipientID),
 			zap.Error(err),
 		)
 	}
-	return s.Repo.UpdateLink(link)
 }
 
-func (s *Service) SetPrescription(req utils.SetPrescriptionDTO) error {
-	link, err := s.Repo.GetLinkByID(req.Link)
+var careRoleTitles = map[string]string{
+	CareRoleLead:       "ведущий врач",
+	CareRoleConsultant: "консультант",
+	CareRoleNurse:      "медсестра",
+}
+
+// GetCareTeam — команда лечения пациента. Доступна самому пациенту и врачам
+// с принятой привязкой к нему.
+func (s *Service) GetCareTeam(userID, patientID uint) (*utils.CareTeamDTO, error) {
+	ok, err := s.CanAccessPatient(userID, patientID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrForbidden
+	}
+	links, err := s.Repo.GetTeamLinks(patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	team := &utils.CareTeamDTO{
+		PatientID: patientID,
+		Members:   make([]utils.CareTeamMemberDTO, 0, len(links)),
+		Diagnoses: []utils.DiagnosisDTO{},
+	}
+	for _, link := range links {
+		permissions := careRolePermissions[link.Role]
+		if permissions == nil {
+			permissions = []string{}
+		}
+		team.Members = append(team.Members, utils.CareTeamMemberDTO{
+			LinkID:      link.ID,
+			Role:        link.Role,
+			Status:      link.Status,
+			Permissions: permissions,
+			Doctor: utils.DoctorDTO{
+				ID:         link.Doctor.ID,
+				Username:   link.Doctor.Username,
+				LastName:   link.Doctor.LastName,
+				FirstName:  link.Doctor.FirstName,
+				FatherName: link.Doctor.FatherName,
+			},
+		})
+		if link.Role == CareRoleLead && link.Status == LinkAccepted {
+			diagnoses, err := s.linkDiagnoses([]uint{link.ID})
+			if err != nil {
+				return nil, err
+			}
+			if d := diagnoses[link.ID]; d != nil {
+				team.Diagnoses = d
+			}
+		}
+	}
+	return team, nil
+}
+
+// SetCareRole меняет роль врача в команде лечения. Менять роли может пациент
+// и ведущий врач; назначение нового ведущего переводит прежнего в консультанты.
+func (s *Service) SetCareRole(userID, linkID uint, role string) (*models.Subscription, error) {
+	if _, ok := careRolePermissions[role]; !ok {
+		return nil, fmt.Errorf("%w: role must be lead, consultant or nurse", ErrInvalidCareRole)
+	}
+	link, err := s.Repo.GetLinkWithParticipants(linkID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != link.PatientID {
+		lead, err := s.Repo.GetAcceptedLink(userID, link.PatientID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrForbidden
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !HasCarePermission(lead.Role, PermManageTeam) {
+			return nil, ErrForbidden
+		}
+	}
+	if link.Status != LinkPending && link.Status != LinkAccepted {
+		return nil, fmt.Errorf("%w: link is %s", ErrInvalidTransition, link.Status)
+	}
+	if link.Role == role {
+		return link, nil
+	}
+
+	var previous *models.Subscription
+	if role == CareRoleLead {
+		previous, err = s.Repo.GetTeamLead(link.PatientID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if err := s.Repo.SetLinkRole(link, role); err != nil {
+		return nil, err
+	}
+
+	patient := strings.TrimSpace(link.Patient.LastName + " " + link.Patient.FirstName)
+	notify := func(doctorID uint, title string) {
+		if doctorID == userID {
+			return
+		}
+		message := "Ваша роль в команде лечения пациента " + patient + ": " + title
+		if err := s.NotificationsService.CreateNotification(doctorID, message); err != nil {
+			s.Logger.Error("failed to create notification",
+				zap.Uint("linkID", link.ID),
+				zap.Uint("userID", doctorID),
+				zap.Error(err),
+			)
+		}
+	}
+	notify(link.DoctorID, careRoleTitles[role])
+	if previous != nil && previous.ID != link.ID {
+		notify(previous.DoctorID, careRoleTitles[CareRoleConsultant])
 	}
-	link.Prescription = req.Prescription
+	return link, nil
+}
 
-	return s.Repo.UpdateLink(link)
+func (s *Service) SetPrescription(doctorID uint, req utils.SetPrescriptionDTO) error {
+	link, err := s.GetLinkWithPermission(doctorID, req.Link, PermPrescribe)
+	if err != nil {
+		return err
+	}
+	return s.setLinkText(doctorID, link, RevisionPrescription, req.Prescription, "Врач обновил назначение")
 }
 
-func (s *Service) SetDiagnosis(req utils.SetDiagnosisDTO) error {
-	link, err := s.Repo.GetLinkByID(req.Link)
+func (s *Service) SetDiagnosis(doctorID uint, req utils.SetDiagnosisDTO) error {
+	if req.Diagnosis == nil && req.Diagnoses == nil {
+		return fmt.Errorf("%w: diagnosis or diagnoses is required", ErrInvalidDiagnosis)
+	}
+	link, err := s.GetLinkWithPermission(doctorID, req.Link, PermEditDiagnosis)
+	if err != nil {
+		return err
+	}
+
+	// коды проверяем до записи текста, чтобы не сохранить запрос наполовину
+	var diagnoses []models.Diagnosis
+	if req.Diagnoses != nil {
+		if diagnoses, err = s.buildDiagnoses(link, *req.Diagnoses); err != nil {
+			return err
+		}
+	}
+
+	current, err := s.currentLinkTexts([]uint{link.ID})
 	if err != nil {
 		return err
 	}
-	link.Diagnosis = req.Diagnosis
+	var revisions []models.LinkRevision
+	var messages []string
+	addRevision := func(field, value, message string) {
+		if current[link.ID][field] == value {
+			return
+		}
+		revisions = append(revisions, models.LinkRevision{SubscriptionID: link.ID, Field: field, Value: value, AuthorID: doctorID})
+		messages = append(messages, message)
+	}
+	if req.Diagnosis != nil {
+		addRevision(RevisionDiagnosis, *req.Diagnosis, "Врач обновил диагноз")
+	}
+
+	if req.Diagnoses != nil {
+		addRevision(RevisionDiagnosisCodes, renderDiagnoses(diagnoses), "Врач обновил список диагнозов")
+		if err := s.Repo.ReplaceDiagnoses(link.ID, diagnoses, revisions); err != nil {
+			return err
+		}
+	} else if len(revisions) > 0 {
+		if err := s.Repo.CreateRevision(&revisions[0]); err != nil {
+			return err
+		}
+	}
 
-	return s.Repo.UpdateLink(link)
+	for _, message := range messages {
+		s.notifyLinkPatient(doctorID, link, message)
+	}
+	return nil
 }
 
-func (s *Service) GetUserAllStats(patientID uint) ([]models.Note, error) {
-	stats, err := s.Repo.GetAllStatByPatientID(patientID)
+// buildDiagnoses проверяет список по справочнику МКБ-10 и собирает записи для привязки.
+func (s *Service) buildDiagnoses(link *models.Subscription, entries []utils.DiagnosisEntryDTO) ([]models.Diagnosis, error) {
+	if len(entries) > maxDiagnoses {
+		return nil, fmt.Errorf("%w: at most %d diagnoses are allowed", ErrInvalidDiagnosis, maxDiagnoses)
+	}
+
+	codes := make([]string, 0, len(entries))
+	for i := range entries {
+		entries[i].Code = strings.ToUpper(strings.TrimSpace(entries[i].Code))
+		codes = append(codes, entries[i].Code)
+	}
+	known, err := s.Repo.GetICD10Codes(codes)
 	if err != nil {
 		return nil, err
 	}
+	descriptions := make(map[string]string, len(known))
+	for _, c := range known {
+		descriptions[c.Code] = c.Description
+	}
 
-	if len(stats) == 0 {
-		return []models.Note{}, nil
+	diagnoses := make([]models.Diagnosis, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	primaries := 0
+	for _, e := range entries {
+		if !utils.ICD10CodeRe.MatchString(e.Code) {
+			return nil, fmt.Errorf("%w: invalid ICD-10 code %q", ErrInvalidDiagnosis, e.Code)
+		}
+		icdDescription, ok := descriptions[e.Code]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown ICD-10 code %s", ErrInvalidDiagnosis, e.Code)
+		}
+		if seen[e.Code] {
+			return nil, fmt.Errorf("%w: duplicate code %s", ErrInvalidDiagnosis, e.Code)
+		}
+		seen[e.Code] = true
+
+		d := models.Diagnosis{
+			SubscriptionID: link.ID,
+			PatientID:      link.PatientID,
+			DoctorID:       link.DoctorID,
+			Code:           e.Code,
+			Description:    strings.TrimSpace(e.Description),
+			Type:           e.Type,
+			Status:         e.Status,
+		}
+		if d.Description == "" {
+			d.Description = icdDescription
+		}
+		if d.Type == "" {
+			d.Type = "secondary"
+			if len(entries) == 1 {
+				d.Type = "primary"
+			}
+		}
+		if d.Status == "" {
+			d.Status = "active"
+		}
+		if !diagnosisTypes[d.Type] {
+			return nil, fmt.Errorf("%w: type must be primary or secondary", ErrInvalidDiagnosis)
+		}
+		if !diagnosisStatuses[d.Status] {
+			return nil, fmt.Errorf("%w: status must be active, remission or resolved", ErrInvalidDiagnosis)
+		}
+		if d.Type == "primary" {
+			primaries++
+		}
+		if e.OnsetDate != "" {
+			onset, err := time.Parse(time.DateOnly, e.OnsetDate)
+			if err != nil {
+				return nil, fmt.Errorf("%w: onset_date must be YYYY-MM-DD", ErrInvalidDiagnosis)
+			}
+			if onset.After(today()) {
+				return nil, fmt.Errorf("%w: onset_date is in the future", ErrInvalidDiagnosis)
+			}
+			d.OnsetDate = &onset
+		}
+		diagnoses = append(diagnoses, d)
 	}
 
-	return stats, nil
+	if len(diagnoses) > 0 && primaries != 1 {
+		return nil, fmt.Errorf("%w: exactly one primary diagnosis is required", ErrInvalidDiagnosis)
+	}
+	return diagnoses, nil
 }
 
-func (s *Service) GetBodyParts() []BodyPart {
-	return BodyParts
+// renderDiagnoses — текстовый вид списка диагнозов для истории версий.
+func renderDiagnoses(diagnoses []models.Diagnosis) string {
+	lines := make([]string, 0, len(diagnoses))
+	for _, d := range diagnoses {
+		line := fmt.Sprintf("%s %s (%s, %s", d.Code, d.Description, d.Type, d.Status)
+		if d.OnsetDate != nil {
+			line += ", onset " + d.OnsetDate.Format(time.DateOnly)
+		}
+		lines = append(lines, line+")")
+	}
+	return strings.Join(lines, "\n")
 }
 
-func (s *Service) CreateNote(note *models.Note) error {
-	return s.Repo.CreateNote(note)
+// setLinkText сохраняет новую версию поля привязки. Повтор текущего значения версию не создаёт.
+func (s *Service) setLinkText(doctorID uint, link *models.Subscription, field, value, message string) error {
+	current, err := s.currentLinkTexts([]uint{link.ID})
+	if err != nil {
+		return err
+	}
+	if current[link.ID][field] == value {
+		return nil
+	}
+
+	if err := s.Repo.CreateRevision(&models.LinkRevision{
+		SubscriptionID: link.ID,
+		Field:          field,
+		Value:          value,
+		AuthorID:       doctorID,
+	}); err != nil {
+		return err
+	}
+
+	s.notifyLinkPatient(doctorID, link, message)
+	return nil
 }
 
-func (s *Service) ToNoteDTO(notes []models.Note) []utils.NoteDTO {
-	dto := make([]utils.NoteDTO, 0, len(notes))
+func (s *Service) notifyLinkPatient(doctorID uint, link *models.Subscription, message string) {
+	if err := s.NotificationsService.CreateNotification(link.PatientID, message); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("doctorID", doctorID),
+			zap.Uint("patientID", link.PatientID),
+			zap.Error(err),
+		)
+	}
+}
 
-	for _, n := range notes {
-		dto = append(dto, utils.NoteDTO{
-			ID:               n.ID,
-			DateRecorded:     n.CreatedAt,
-			Intensity:        n.Intensity,
-			PainType:         n.PainType,
-			TookPrescription: n.TookPrescription,
-			Description:      n.Description,
-			BodyPart:         int(n.BodyPart),
-		})
+// linkDiagnoses — кодированные диагнозы привязок: link ID -> список.
+func (s *Service) linkDiagnoses(subIDs []uint) (map[uint][]utils.DiagnosisDTO, error) {
+	diagnoses, err := s.Repo.GetDiagnosesBySubscriptionIDs(subIDs)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint][]utils.DiagnosisDTO, len(subIDs))
+	for _, id := range subIDs {
+		result[id] = []utils.DiagnosisDTO{}
 	}
+	for _, d := range diagnoses {
+		result[d.SubscriptionID] = append(result[d.SubscriptionID], s.ToDiagnosisDTO([]models.Diagnosis{d})...)
+	}
+	return result, nil
+}
 
-	return dto
+// ListDiagnoses — кодированные диагнозы привязки; доступны её пациенту и врачу
+// с согласием на область medications.
+func (s *Service) ListDiagnoses(userID, linkID uint) ([]models.Diagnosis, error) {
+	link, access, err := s.getLinkAccess(userID, linkID, ScopeMedications)
+	if err != nil {
+		return nil, err
+	}
+	diagnoses, err := s.Repo.GetDiagnosesBySubscriptionIDs([]uint{link.ID})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.Diagnosis, 0, len(diagnoses))
+	for _, d := range diagnoses {
+		if access.AllowsDate(d.CreatedAt) {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) SearchICD10(query string, limit int) ([]models.ICD10Code, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []models.ICD10Code{}, nil
+	}
+	if limit <= 0 {
+		limit = icd10DefaultLimit
+	}
+	if limit > icd10MaxLimit {
+		limit = icd10MaxLimit
+	}
+	return s.Repo.SearchICD10(query, limit)
+}
+
+// GetDiagnosisStats — распределение действующих диагнозов по пациентам врача
+// и сами пациенты, чьи диагнозы в него вошли (для журнала доступа).
+func (s *Service) GetDiagnosisStats(doctorID uint) ([]utils.DiagnosisStatDTO, []uint, error) {
+	stats, err := s.Repo.GetDiagnosisStatsByDoctorID(doctorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	patientIDs, err := s.Repo.GetDiagnosedPatientIDsByDoctorID(doctorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	dto := make([]utils.DiagnosisStatDTO, 0, len(stats))
+	for _, st := range stats {
+		dto = append(dto, utils.DiagnosisStatDTO{
+			Code:          st.Code,
+			Description:   st.Description,
+			PatientsCount: st.PatientsCount,
+			PrimaryCount:  st.PrimaryCount,
+		})
+	}
+	return dto, patientIDs, nil
+}
+
+func (s *Service) ToDiagnosisDTO(diagnoses []models.Diagnosis) []utils.DiagnosisDTO {
+	dto := make([]utils.DiagnosisDTO, 0, len(diagnoses))
+	for _, d := range diagnoses {
+		item := utils.DiagnosisDTO{
+			ID:          d.ID,
+			Code:        d.Code,
+			Description: d.Description,
+			Type:        d.Type,
+			Status:      d.Status,
+		}
+		if d.OnsetDate != nil {
+			onset := d.OnsetDate.Format(time.DateOnly)
+			item.OnsetDate = &onset
+		}
+		dto = append(dto, item)
+	}
+	return dto
+}
+
+func (s *Service) ToICD10DTO(codes []models.ICD10Code) []utils.ICD10CodeDTO {
+	dto := make([]utils.ICD10CodeDTO, 0, len(codes))
+	for _, c := range codes {
+		dto = append(dto, utils.ICD10CodeDTO{Code: c.Code, Description: c.Description})
+	}
+	return dto
+}
+
+// GetLinkHistory — история назначения и диагноза привязки; доступна её пациенту и врачу
+// с согласием на область medications.
+func (s *Service) GetLinkHistory(userID, linkID uint, field string) ([]models.LinkRevision, error) {
+	if field != "" && !revisionFields[field] {
+		return nil, fmt.Errorf("%w: field must be %s, %s or %s", ErrInvalidRevisionField, RevisionPrescription, RevisionDiagnosis, RevisionDiagnosisCodes)
+	}
+	link, access, err := s.getLinkAccess(userID, linkID, ScopeMedications)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := s.Repo.GetRevisions(link.ID, field)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.LinkRevision, 0, len(revisions))
+	for _, rev := range revisions {
+		if access.AllowsDate(rev.CreatedAt) {
+			result = append(result, rev)
+		}
+	}
+	return result, nil
+}
+
+// currentLinkTexts — актуальные значения полей привязок: link ID -> поле -> значение.
+func (s *Service) currentLinkTexts(subIDs []uint) (map[uint]map[string]string, error) {
+	revisions, err := s.Repo.GetLatestRevisions(subIDs)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]map[string]string, len(subIDs))
+	for _, rev := range revisions {
+		if result[rev.SubscriptionID] == nil {
+			result[rev.SubscriptionID] = make(map[string]string, 2)
+		}
+		result[rev.SubscriptionID][rev.Field] = rev.Value
+	}
+	return result, nil
+}
+
+func (s *Service) ToRevisionDTO(revisions []models.LinkRevision) []utils.LinkRevisionDTO {
+	dto := make([]utils.LinkRevisionDTO, 0, len(revisions))
+	for _, rev := range revisions {
+		dto = append(dto, utils.LinkRevisionDTO{
+			ID:        rev.ID,
+			Field:     rev.Field,
+			Value:     rev.Value,
+			CreatedAt: rev.CreatedAt,
+			Author: utils.DoctorDTO{
+				ID:         rev.Author.ID,
+				Username:   rev.Author.Username,
+				LastName:   rev.Author.LastName,
+				FirstName:  rev.Author.FirstName,
+				FatherName: rev.Author.FatherName,
+			},
+		})
+	}
+	return dto
+}
+
+// GetParticipantLink возвращает привязку, если пользователь — её врач или пациент.
+func (s *Service) GetParticipantLink(userID, linkID uint) (*models.Subscription, error) {
+	link, err := s.Repo.GetLinkByID(linkID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != link.DoctorID && userID != link.PatientID {
+		return nil, ErrForbidden
+	}
+	return link, nil
+}
+
+// GetDoctorLink возвращает принятую привязку, если врач является её владельцем.
+func (s *Service) GetDoctorLink(doctorID, linkID uint) (*models.Subscription, error) {
+	link, err := s.Repo.GetLinkByID(linkID)
+	if err != nil {
+		return nil, err
+	}
+	if link.DoctorID != doctorID || link.Status != "accepted" {
+		return nil, ErrForbidden
+	}
+	return link, nil
+}
+
+// GetLinkWithPermission возвращает принятую привязку врача, если его роль
+// в команде лечения даёт право perm.
+func (s *Service) GetLinkWithPermission(doctorID, linkID uint, perm string) (*models.Subscription, error) {
+	link, err := s.GetDoctorLink(doctorID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	if !HasCarePermission(link.Role, perm) {
+		return nil, ErrForbidden
+	}
+	return link, nil
+}
+
+func HasCarePermission(role, perm string) bool {
+	for _, p := range careRolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAcceptedLink возвращает принятую привязку врача и пациента или ErrForbidden, если её нет.
+func (s *Service) GetAcceptedLink(doctorID, patientID uint) (*models.Subscription, error) {
+	link, err := s.Repo.GetAcceptedLink(doctorID, patientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrForbidden
+	}
+	return link, err
+}
+
+func (s *Service) CreatePrescription(doctorID uint, input utils.PrescriptionInputDTO) (*models.Prescription, error) {
+	link, err := s.GetLinkWithPermission(doctorID, input.Link, PermPrescribe)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &models.Prescription{
+		SubscriptionID: link.ID,
+		DoctorID:       doctorID,
+		PatientID:      link.PatientID,
+		IntervalDays:   1,
+		StartDate:      today(),
+	}
+	if err := applyPrescriptionInput(p, input); err != nil {
+		return nil, err
+	}
+	if err := validatePrescription(p); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.CreatePrescription(p); err != nil {
+		return nil, err
+	}
+
+	if err := s.NotificationsService.CreateNotification(
+		p.PatientID,
+		"Врач добавил новое назначение: "+p.MedicationName,
+	); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("doctorID", doctorID),
+			zap.Uint("patientID", p.PatientID),
+			zap.Error(err),
+		)
+	}
+	return p, nil
+}
+
+// ListPrescriptions доступен пациенту привязки и врачу с согласием на область medications;
+// врач не видит курсы, закончившиеся до начала разрешённого периода.
+func (s *Service) ListPrescriptions(userID, linkID uint) ([]models.Prescription, error) {
+	link, access, err := s.getLinkAccess(userID, linkID, ScopeMedications)
+	if err != nil {
+		return nil, err
+	}
+	prescriptions, err := s.Repo.GetPrescriptionsBySubscriptionID(link.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.Prescription, 0, len(prescriptions))
+	for _, p := range prescriptions {
+		if p.EndDate == nil || access.AllowsDate(*p.EndDate) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) UpdatePrescription(doctorID, prescriptionID uint, input utils.PrescriptionInputDTO) (*models.Prescription, error) {
+	p, err := s.Repo.GetPrescriptionByID(prescriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.GetLinkWithPermission(doctorID, p.SubscriptionID, PermPrescribe); err != nil {
+		return nil, err
+	}
+
+	if err := applyPrescriptionInput(p, input); err != nil {
+		return nil, err
+	}
+	if err := validatePrescription(p); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.UpdatePrescription(p); err != nil {
+		return nil, err
+	}
+
+	if err := s.NotificationsService.CreateNotification(
+		p.PatientID,
+		"Врач изменил назначение: "+p.MedicationName,
+	); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("doctorID", doctorID),
+			zap.Uint("patientID", p.PatientID),
+			zap.Error(err),
+		)
+	}
+	return p, nil
+}
+
+// PrescriptionPatientID — пациент, которому выписано назначение.
+func (s *Service) PrescriptionPatientID(prescriptionID uint) (uint, error) {
+	p, err := s.Repo.GetPrescriptionByID(prescriptionID)
+	if err != nil {
+		return 0, err
+	}
+	return p.PatientID, nil
+}
+
+func (s *Service) DeletePrescription(doctorID, prescriptionID uint) error {
+	p, err := s.Repo.GetPrescriptionByID(prescriptionID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.GetLinkWithPermission(doctorID, p.SubscriptionID, PermPrescribe); err != nil {
+		return err
+	}
+	return s.Repo.DeletePrescription(p.ID)
+}
+
+func applyPrescriptionInput(p *models.Prescription, input utils.PrescriptionInputDTO) error {
+	if input.MedicationName != nil {
+		p.MedicationName = strings.TrimSpace(*input.MedicationName)
+	}
+	if input.Dose != nil {
+		p.Dose = *input.Dose
+	}
+	if input.Unit != nil {
+		p.Unit = strings.TrimSpace(*input.Unit)
+	}
+	if input.Route != nil {
+		p.Route = strings.ToLower(strings.TrimSpace(*input.Route))
+	}
+	if input.Frequency != nil {
+		p.Frequency = strings.TrimSpace(*input.Frequency)
+	}
+	if input.TimesOfDay != nil {
+		p.TimesOfDay = *input.TimesOfDay
+	}
+	if input.IntervalDays != nil {
+		p.IntervalDays = *input.IntervalDays
+	}
+	if input.PRN != nil {
+		p.PRN = *input.PRN
+	}
+	if input.Instructions != nil {
+		p.Instructions = strings.TrimSpace(*input.Instructions)
+	}
+	if input.StartDate != nil {
+		d, err := time.Parse(time.DateOnly, *input.StartDate)
+		if err != nil {
+			return fmt.Errorf("%w: start_date must be in YYYY-MM-DD format", ErrInvalidPrescription)
+		}
+		p.StartDate = d
+	}
+	if input.EndDate != nil {
+		if *input.EndDate == "" {
+			p.EndDate = nil
+		} else {
+			d, err := time.Parse(time.DateOnly, *input.EndDate)
+			if err != nil {
+				return fmt.Errorf("%w: end_date must be in YYYY-MM-DD format", ErrInvalidPrescription)
+			}
+			p.EndDate = &d
+		}
+	}
+	return nil
+}
+
+func validatePrescription(p *models.Prescription) error {
+	switch {
+	case p.MedicationName == "":
+		return fmt.Errorf("%w: medication_name is required", ErrInvalidPrescription)
+	case p.Dose <= 0:
+		return fmt.Errorf("%w: dose must be positive", ErrInvalidPrescription)
+	case p.Unit == "":
+		return fmt.Errorf("%w: unit is required", ErrInvalidPrescription)
+	case !prescriptionRoutes[p.Route]:
+		return fmt.Errorf("%w: unknown route %q", ErrInvalidPrescription, p.Route)
+	case p.IntervalDays < 1:
+		return fmt.Errorf("%w: interval_days must be at least 1", ErrInvalidPrescription)
+	case p.EndDate != nil && p.EndDate.Before(p.StartDate):
+		return fmt.Errorf("%w: end_date is before start_date", ErrInvalidPrescription)
+	case !p.PRN && len(p.TimesOfDay) == 0:
+		return fmt.Errorf("%w: times_of_day is required for scheduled medication", ErrInvalidPrescription)
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range p.TimesOfDay {
+		if !timeOfDayRe.MatchString(t) {
+			return fmt.Errorf("%w: invalid time of day %q, expected HH:MM", ErrInvalidPrescription, t)
+		}
+		if seen[t] {
+			return fmt.Errorf("%w: duplicate time of day %q", ErrInvalidPrescription, t)
+		}
+		seen[t] = true
+	}
+	return nil
+}
+
+func (s *Service) ToPrescriptionDTO(prescriptions []models.Prescription) []utils.PrescriptionDTO {
+	day := today()
+	dto := make([]utils.PrescriptionDTO, 0, len(prescriptions))
+	for _, p := range prescriptions {
+		item := utils.PrescriptionDTO{
+			ID:             p.ID,
+			SubscriptionID: p.SubscriptionID,
+			MedicationName: p.MedicationName,
+			Dose:           p.Dose,
+			Unit:           p.Unit,
+			Route:          p.Route,
+			Frequency:      p.Frequency,
+			TimesOfDay:     p.TimesOfDay,
+			IntervalDays:   p.IntervalDays,
+			StartDate:      p.StartDate.Format(time.DateOnly),
+			PRN:            p.PRN,
+			Instructions:   p.Instructions,
+			Active:         prescriptionActiveOn(p, day),
+		}
+		if item.TimesOfDay == nil {
+			item.TimesOfDay = []string{}
+		}
+		if p.EndDate != nil {
+			end := p.EndDate.Format(time.DateOnly)
+			item.EndDate = &end
+		}
+		dto = append(dto, item)
+	}
+	return dto
+}
+
+func (s *Service) LogIntake(patientID, prescriptionID uint, input utils.IntakeInputDTO) (*models.MedicationIntake, error) {
+	p, err := s.Repo.GetPrescriptionByID(prescriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if p.PatientID != patientID {
+		return nil, ErrForbidden
+	}
+
+	switch input.Status {
+	case "taken", "late", "skipped":
+	default:
+		return nil, fmt.Errorf("%w: status must be taken, late or skipped", ErrInvalidIntake)
+	}
+	if input.Status == "skipped" && input.ScheduledFor == nil {
+		return nil, fmt.Errorf("%w: scheduled_for is required to skip a dose", ErrInvalidIntake)
+	}
+
+	loc, err := s.patientLocation(patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	intake := &models.MedicationIntake{
+		PrescriptionID: p.ID,
+		PatientID:      patientID,
+		Status:         input.Status,
+		Reason:         strings.TrimSpace(input.Reason),
+	}
+
+	if input.ScheduledFor != nil {
+		scheduled := input.ScheduledFor.UTC()
+		if err := checkDoseSlot(*p, scheduled.In(loc)); err != nil {
+			return nil, err
+		}
+		intake.ScheduledFor = &scheduled
+
+		exists, err := s.Repo.HasIntakeForSlot(p.ID, scheduled)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrIntakeExists
+		}
+	} else if !p.PRN {
+		return nil, fmt.Errorf("%w: scheduled_for is required for a scheduled prescription", ErrInvalidIntake)
+	}
+
+	if input.Status != "skipped" {
+		takenAt := now
+		if input.TakenAt != nil {
+			if input.TakenAt.After(now.Add(maxClockSkew)) {
+				return nil, fmt.Errorf("%w: taken_at is in the future", ErrInvalidIntake)
+			}
+			takenAt = *input.TakenAt
+		}
+		takenAt = takenAt.UTC()
+		intake.TakenAt = &takenAt
+
+		if p.PRN && !prescriptionActiveOn(*p, localDate(takenAt.In(loc))) {
+			return nil, fmt.Errorf("%w: prescription is not active on this date", ErrInvalidIntake)
+		}
+		if intake.Status == "taken" && intake.ScheduledFor != nil && takenAt.Sub(*intake.ScheduledFor) > lateIntakeThreshold {
+			intake.Status = "late"
+		}
+	}
+
+	created, err := s.Repo.CreateIntake(intake)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrIntakeExists
+	}
+	return intake, nil
+}
+
+func (s *Service) ListIntakes(userID, prescriptionID uint, fromStr, toStr string) ([]models.MedicationIntake, error) {
+	from, to, err := parsePeriod(fromStr, toStr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.Repo.GetPrescriptionByID(prescriptionID)
+	if err != nil {
+		return nil, err
+	}
+	access, err := s.RequireScope(userID, p.PatientID, ScopeMedications)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.GetIntakesByPrescriptionID(p.ID, access.ClampFrom(from), to)
+}
+
+// AdherenceReport сопоставляет плановые дозы с отмеченными приёмами по дням
+// и добавляет к каждому дню среднюю интенсивность боли из дневника.
+func (s *Service) AdherenceReport(userID, prescriptionID uint, fromStr, toStr string) (*utils.AdherenceReportDTO, error) {
+	from, to, err := parsePeriod(fromStr, toStr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.Repo.GetPrescriptionByID(prescriptionID)
+	if err != nil {
+		return nil, err
+	}
+	access, err := s.RequireScope(userID, p.PatientID, ScopeMedications)
+	if err != nil {
+		return nil, err
+	}
+	from = access.ClampFrom(from)
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: period is outside of shared data range", ErrInvalidPeriod)
+	}
+
+	// дни отчёта — календарные дни пациента, как и в расписании напоминаний
+	loc, err := s.patientLocation(p.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+
+	intakes, err := s.Repo.GetIntakesByPrescriptionID(p.ID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	// интенсивность боли показываем, только если пациент открыл и дневник
+	var notes []models.Note
+	if access.Allows(ScopeNotes) {
+		if notes, err = s.Repo.GetNotesByPatientBetween(p.PatientID, start, end); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &utils.AdherenceReportDTO{
+		PrescriptionID: p.ID,
+		MedicationName: p.MedicationName,
+		From:           from.Format(time.DateOnly),
+		To:             to.AddDate(0, 0, -1).Format(time.DateOnly),
+		Days:           []utils.AdherenceDayDTO{},
+	}
+
+	index := make(map[string]int)
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		key := d.Format(time.DateOnly)
+		index[key] = len(report.Days)
+		report.Days = append(report.Days, utils.AdherenceDayDTO{Date: key, Expected: expectedDoses(*p, d)})
+	}
+
+	for _, intake := range intakes {
+		if intake.ScheduledFor == nil {
+			if intake.Status != "skipped" {
+				report.PRNTaken++
+			}
+			continue
+		}
+		i, ok := index[intake.ScheduledFor.In(loc).Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		switch intake.Status {
+		case "taken":
+			report.Days[i].Taken++
+		case "late":
+			report.Days[i].Late++
+		case "skipped":
+			report.Days[i].Skipped++
+		}
+	}
+
+	intensitySum := make(map[int]int)
+	for _, n := range notes {
+		i, ok := index[n.RecordedAt.In(loc).Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		report.Days[i].NotesCount++
+		intensitySum[i] += n.Intensity
+	}
+
+	var adherentSum, nonAdherentSum float64
+	var adherentDays, nonAdherentDays int
+	var ratios, intensities []float64
+	for i := range report.Days {
+		day := &report.Days[i]
+		day.Missed = max(0, day.Expected-day.Taken-day.Late-day.Skipped)
+		report.Expected += day.Expected
+		report.Taken += day.Taken
+		report.Late += day.Late
+		report.Skipped += day.Skipped
+		report.Missed += day.Missed
+
+		if day.NotesCount == 0 {
+			continue
+		}
+		avg := float64(intensitySum[i]) / float64(day.NotesCount)
+		day.AvgIntensity = &avg
+
+		if day.Expected == 0 {
+			continue
+		}
+		ratio := min(1, float64(day.Taken+day.Late)/float64(day.Expected))
+		ratios = append(ratios, ratio)
+		intensities = append(intensities, avg)
+		if ratio == 1 {
+			adherentSum += avg
+			adherentDays++
+		} else {
+			nonAdherentSum += avg
+			nonAdherentDays++
+		}
+	}
+
+	if report.Expected > 0 {
+		pct := float64(min(report.Taken+report.Late, report.Expected)) / float64(report.Expected) * 100
+		report.AdherencePct = &pct
+	}
+	if adherentDays > 0 {
+		avg := adherentSum / float64(adherentDays)
+		report.AvgIntensityAdherent = &avg
+	}
+	if nonAdherentDays > 0 {
+		avg := nonAdherentSum / float64(nonAdherentDays)
+		report.AvgIntensityNonAdherent = &avg
+	}
+	report.Correlation = pearson(ratios, intensities)
+
+	return report, nil
+}
+
+// checkDoseSlot проверяет, что local (время в часовом поясе пациента) — один из
+// приёмов по расписанию назначения: день приёма и время из TimesOfDay.
+func checkDoseSlot(p models.Prescription, local time.Time) error {
+	if p.PRN {
+		return fmt.Errorf("%w: prescription is taken as needed and has no schedule", ErrInvalidIntake)
+	}
+	if !prescriptionActiveOn(p, localDate(local)) {
+		return fmt.Errorf("%w: prescription is not active on this date", ErrInvalidIntake)
+	}
+	if !IsDoseDay(p, local) {
+		return fmt.Errorf("%w: no dose is scheduled on this date", ErrInvalidIntake)
+	}
+	if local.Second() != 0 || local.Nanosecond() != 0 || !slices.Contains(p.TimesOfDay, local.Format("15:04")) {
+		return fmt.Errorf("%w: scheduled_for does not match the prescription times of day", ErrInvalidIntake)
+	}
+	return nil
+}
+
+// expectedDoses — сколько доз по расписанию приходится на дату day.
+func expectedDoses(p models.Prescription, day time.Time) int {
+	if !IsDoseDay(p, day) {
+		return 0
+	}
+	return len(p.TimesOfDay)
+}
+
+// IsDoseDay — назначен ли приём по расписанию на дату day (время суток игнорируется).
+func IsDoseDay(p models.Prescription, day time.Time) bool {
+	day = localDate(day)
+	if p.PRN || !prescriptionActiveOn(p, day) {
+		return false
+	}
+	daysSinceStart := int(day.Sub(p.StartDate).Hours() / 24)
+	return p.IntervalDays <= 1 || daysSinceStart%p.IntervalDays == 0
+}
+
+// parsePeriod разбирает включительный диапазон дат YYYY-MM-DD и возвращает
+// полуинтервал [from, to). По умолчанию — последние defaultReportDays дней.
+func parsePeriod(fromStr, toStr string) (time.Time, time.Time, error) {
+	to := today()
+	if toStr != "" {
+		parsed, err := time.Parse(time.DateOnly, toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: to must be in YYYY-MM-DD format", ErrInvalidPeriod)
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -(defaultReportDays - 1))
+	if fromStr != "" {
+		parsed, err := time.Parse(time.DateOnly, fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be in YYYY-MM-DD format", ErrInvalidPeriod)
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from is after to", ErrInvalidPeriod)
+	}
+	if to.Sub(from) > maxReportDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: period is longer than %d days", ErrInvalidPeriod, maxReportDays)
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+// pearson возвращает коэффициент корреляции или nil, если данных мало
+// или одна из величин не меняется.
+func pearson(xs, ys []float64) *float64 {
+	n := len(xs)
+	if n < 3 || n != len(ys) {
+		return nil
+	}
+
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/float64(n), sumY/float64(n)
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return nil
+	}
+	r := cov / math.Sqrt(varX*varY)
+	return &r
+}
+
+func prescriptionActiveOn(p models.Prescription, day time.Time) bool {
+	return !p.StartDate.After(day) && (p.EndDate == nil || !p.EndDate.Before(day))
+}
+
+// localDate — дата момента t в его часовом поясе в том виде, в каком даты хранятся в колонках date.
+func localDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// UserLocation возвращает часовой пояс пользователя; пустой или некорректный считаем UTC.
+func UserLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (s *Service) patientLocation(patientID uint) (*time.Location, error) {
+	tz, err := s.Repo.GetUserTimezone(patientID)
+	if err != nil {
+		return nil, err
+	}
+	return UserLocation(tz), nil
+}
+
+// today — текущая дата (UTC) без времени, в том виде, в каком даты хранятся в колонках date.
+func today() time.Time {
+	y, m, d := time.Now().UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// CanAccessPatient — может ли пользователь просматривать данные пациента:
+// сам пациент или врач с принятой привязкой.
+func (s *Service) CanAccessPatient(userID, patientID uint) (bool, error) {
+	if userID == patientID {
+		return true, nil
+	}
+	return s.Repo.HasAcceptedLink(userID, patientID)
+}
+
+func (s *Service) GetNote(noteID uint) (*models.Note, error) {
+	return s.Repo.GetNoteByID(noteID)
+}
+
+// GetUserAllStats — записи дневника пациента, видимые пользователю по согласию.
+func (s *Service) GetUserAllStats(userID, patientID uint, filter NoteFilter) ([]models.Note, error) {
+	access, err := s.RequireScope(userID, patientID, ScopeNotes)
+	if err != nil {
+		return nil, err
+	}
+	if access.DataFrom != nil && (filter.From == nil || filter.From.Before(*access.DataFrom)) {
+		filter.From = access.DataFrom
+	}
+	filter.Tags = normalizeTagNames(filter.Tags)
+	stats, err := s.Repo.GetAllStatByPatientID(patientID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stats) == 0 {
+		return []models.Note{}, nil
+	}
+
+	return stats, nil
+}
+
+func (s *Service) GetBodyParts(acceptLanguage string) ([]utils.BodyPartDTO, error) {
+	return s.bodyPartCatalog(acceptLanguage, false)
+}
+
+// bodyPartCatalog — каталог с подписями на языке пользователя; отчётам нужны и
+// отключённые части, чтобы старые записи по ним не пропадали из статистики.
+func (s *Service) bodyPartCatalog(acceptLanguage string, includeInactive bool) ([]utils.BodyPartDTO, error) {
+	parts, err := s.Repo.GetBodyParts(includeInactive)
+	if err != nil {
+		return nil, err
+	}
+
+	var locales []string
+	seen := make(map[string]bool)
+	for _, part := range parts {
+		for _, l := range part.Labels {
+			if !seen[l.Locale] {
+				seen[l.Locale] = true
+				locales = append(locales, l.Locale)
+			}
+		}
+	}
+	locale := utils.PreferredLocale(acceptLanguage, locales, DefaultLocale)
+
+	result := make([]utils.BodyPartDTO, 0, len(parts))
+	for _, part := range parts {
+		result = append(result, utils.BodyPartDTO{
+			ID:          part.ID,
+			Code:        part.Code,
+			Translation: bodyPartLabel(part, locale),
+			View:        part.View,
+			Side:        part.Side,
+			ParentID:    part.ParentID,
+		})
+	}
+	return result, nil
+}
+
+func bodyPartLabel(part models.BodyPart, locale string) string {
+	fallback := part.Code
+	for _, l := range part.Labels {
+		if l.Locale == locale {
+			return l.Label
+		}
+		if l.Locale == DefaultLocale {
+			fallback = l.Label
+		}
+	}
+	return fallback
+}
+
+func (s *Service) ListBodyPartsAdmin() ([]models.BodyPart, error) {
+	return s.Repo.GetBodyParts(true)
+}
+
+func (s *Service) CreateBodyPart(input utils.BodyPartInputDTO) (*models.BodyPart, error) {
+	if input.Code == nil || input.View == nil {
+		return nil, fmt.Errorf("%w: code and view are required", ErrInvalidBodyPart)
+	}
+	if strings.TrimSpace(input.Labels[DefaultLocale]) == "" {
+		return nil, fmt.Errorf("%w: label for locale %q is required", ErrInvalidBodyPart, DefaultLocale)
+	}
+
+	part := &models.BodyPart{Side: "center", IsActive: true}
+	applyBodyPartInput(part, input)
+	if err := s.validateBodyPart(part, input.Labels); err != nil {
+		return nil, err
+	}
+
+	for locale, label := range input.Labels {
+		part.Labels = append(part.Labels, models.BodyPartLabel{Locale: locale, Label: strings.TrimSpace(label)})
+	}
+	if err := s.Repo.CreateBodyPart(part); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+func (s *Service) UpdateBodyPart(id uint, input utils.BodyPartInputDTO) (*models.BodyPart, error) {
+	part, err := s.Repo.GetBodyPartByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	applyBodyPartInput(part, input)
+	if err := s.validateBodyPart(part, input.Labels); err != nil {
+		return nil, err
+	}
+
+	labels := make([]models.BodyPartLabel, 0, len(input.Labels))
+	for locale, label := range input.Labels {
+		labels = append(labels, models.BodyPartLabel{BodyPartID: part.ID, Locale: locale, Label: strings.TrimSpace(label)})
+	}
+	if err := s.Repo.UpdateBodyPart(part, labels); err != nil {
+		return nil, err
+	}
+
+	return s.Repo.GetBodyPartByID(part.ID)
+}
+
+func applyBodyPartInput(part *models.BodyPart, input utils.BodyPartInputDTO) {
+	if input.Code != nil {
+		part.Code = strings.TrimSpace(*input.Code)
+	}
+	if input.View != nil {
+		part.View = *input.View
+	}
+	if input.Side != nil {
+		part.Side = *input.Side
+	}
+	if input.ParentID != nil {
+		if *input.ParentID == 0 {
+			part.ParentID = nil
+		} else {
+			parentID := *input.ParentID
+			part.ParentID = &parentID
+		}
+	}
+	if input.SortOrder != nil {
+		part.SortOrder = *input.SortOrder
+	}
+	if input.IsActive != nil {
+		part.IsActive = *input.IsActive
+	}
+}
+
+func (s *Service) validateBodyPart(part *models.BodyPart, labels map[string]string) error {
+	if !bodyPartCodeRe.MatchString(part.Code) {
+		return fmt.Errorf("%w: code must contain only lowercase letters, digits and underscores", ErrInvalidBodyPart)
+	}
+	if part.View != "front" && part.View != "back" {
+		return fmt.Errorf("%w: view must be front or back", ErrInvalidBodyPart)
+	}
+	if part.Side != "left" && part.Side != "right" && part.Side != "center" {
+		return fmt.Errorf("%w: side must be left, right or center", ErrInvalidBodyPart)
+	}
+	for locale, label := range labels {
+		if !bodyPartLocaleRe.MatchString(locale) || strings.TrimSpace(label) == "" {
+			return fmt.Errorf("%w: invalid label for locale %q", ErrInvalidBodyPart, locale)
+		}
+	}
+
+	// Поднимаемся по цепочке родителей: встретив саму часть, получили бы цикл
+	// вида A→B→A, на котором зациклится построение дерева.
+	visited := map[uint]bool{}
+	for parentID := part.ParentID; parentID != nil; {
+		if *parentID == part.ID {
+			return fmt.Errorf("%w: body part cannot be its own ancestor", ErrInvalidBodyPart)
+		}
+		if visited[*parentID] {
+			break
+		}
+		visited[*parentID] = true
+		parent, err := s.Repo.GetBodyPartByID(*parentID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: parent body part not found", ErrInvalidBodyPart)
+			}
+			return err
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+func (s *Service) CreateNote(patientID uint, req utils.CreateNoteDTO) (*models.Note, error) {
+	note, err := s.newNote(patientID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.CreateNote(note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// newNote валидирует входные данные и собирает запись, не сохраняя её.
+// Метки в записи заданы только именами — их создаёт репозиторий при сохранении.
+func (s *Service) newNote(patientID uint, req utils.CreateNoteDTO) (*models.Note, error) {
+	if req.Intensity < 0 || req.Intensity > 10 {
+		return nil, fmt.Errorf("%w: intensity must be between 0 and 10", ErrInvalidNote)
+	}
+
+	recordedAt := time.Now()
+	if req.RecordedAt != nil {
+		if req.RecordedAt.After(recordedAt.Add(maxClockSkew)) {
+			return nil, fmt.Errorf("%w: recorded_at is in the future", ErrInvalidNote)
+		}
+		recordedAt = *req.RecordedAt
+	}
+
+	parts := req.BodyParts
+	if len(parts) == 0 && req.BodyPart != 0 {
+		parts = []utils.NoteBodyPartDTO{{BodyPartID: req.BodyPart}}
+	}
+	noteParts, err := s.buildNoteBodyParts(parts)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateNoteContext(req); err != nil {
+		return nil, err
+	}
+
+	tagNames := normalizeTagNames(req.Tags)
+	if len(tagNames) > maxTagsPerNote {
+		return nil, fmt.Errorf("%w: at most %d tags per note", ErrInvalidNote, maxTagsPerNote)
+	}
+	for _, name := range tagNames {
+		if utf8.RuneCountInString(name) > maxTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidNote, name, maxTagLength)
+		}
+	}
+	// метки создаются при сохранении записи, в одной транзакции с ней
+	tags := make([]models.Tag, 0, len(tagNames))
+	for _, name := range tagNames {
+		tags = append(tags, models.Tag{UserID: patientID, Name: name})
+	}
+
+	return &models.Note{
+		RecordedAt:       recordedAt.UTC(),
+		Intensity:        req.Intensity,
+		PainType:         req.PainType,
+		TookPrescription: req.TookPrescription,
+		Description:      req.Description,
+		BodyPart:         parts[0].BodyPartID,
+		PatientID:        patientID,
+		BodyParts:        noteParts,
+		SleepHours:       req.SleepHours,
+		SleepQuality:     req.SleepQuality,
+		Mood:             req.Mood,
+		ActivityLevel:    req.ActivityLevel,
+		Weather:          req.Weather,
+		Tags:             tags,
+	}, nil
+}
+
+func validateNoteContext(req utils.CreateNoteDTO) error {
+	if req.SleepHours != nil && (*req.SleepHours < 0 || *req.SleepHours > 24) {
+		return fmt.Errorf("%w: sleep_hours must be between 0 and 24", ErrInvalidNote)
+	}
+	if req.SleepQuality != nil && (*req.SleepQuality < 1 || *req.SleepQuality > 5) {
+		return fmt.Errorf("%w: sleep_quality must be between 1 and 5", ErrInvalidNote)
+	}
+	if req.Mood != nil && (*req.Mood < 1 || *req.Mood > 5) {
+		return fmt.Errorf("%w: mood must be between 1 and 5", ErrInvalidNote)
+	}
+	if req.ActivityLevel != nil && !activityLevels[*req.ActivityLevel] {
+		return fmt.Errorf("%w: unknown activity_level %q", ErrInvalidNote, *req.ActivityLevel)
+	}
+	if req.Weather != nil && !weatherKinds[*req.Weather] {
+		return fmt.Errorf("%w: unknown weather %q", ErrInvalidNote, *req.Weather)
+	}
+	return nil
+}
+
+// normalizeTagNames приводит имена меток к нижнему регистру и убирает пустые и повторы.
+func normalizeTagNames(names []string) []string {
+	result := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (s *Service) ListTags(userID uint) ([]utils.TagDTO, error) {
+	tags, err := s.Repo.GetTagsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	dto := make([]utils.TagDTO, 0, len(tags))
+	for _, t := range tags {
+		dto = append(dto, utils.TagDTO{ID: t.ID, Name: t.Name, NotesCount: t.NotesCount})
+	}
+	return dto, nil
+}
+
+func (s *Service) CreateTag(userID uint, name string) (*models.Tag, error) {
+	names := normalizeTagNames([]string{name})
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: tag name is empty", ErrInvalidNote)
+	}
+	if utf8.RuneCountInString(names[0]) > maxTagLength {
+		return nil, fmt.Errorf("%w: tag is longer than %d characters", ErrInvalidNote, maxTagLength)
+	}
+	tags, err := s.Repo.GetOrCreateTags(userID, names)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &tags[0], nil
+}
+
+// DeleteTag удаляет метку пользователя и снимает её со всех записей.
+func (s *Service) DeleteTag(userID, tagID uint) error {
+	tag, err := s.Repo.GetTagByID(tagID)
+	if err != nil {
+		return err
+	}
+	if tag.UserID != userID {
+		return ErrForbidden
+	}
+	return s.Repo.DeleteTag(tag.ID)
+}
+
+// SyncNotes применяет пачку записей из офлайн-очереди. Каждая запись
+// обрабатывается независимо: ошибка в одной не отменяет остальные.
+func (s *Service) SyncNotes(patientID uint, items []utils.SyncNoteDTO) ([]utils.SyncItemResultDTO, error) {
+	if len(items) > syncMaxBatch {
+		return nil, fmt.Errorf("%w: at most %d notes per batch", ErrInvalidNote, syncMaxBatch)
+	}
+
+	results := make([]utils.SyncItemResultDTO, 0, len(items))
+	for _, item := range items {
+		results = append(results, s.syncNote(patientID, item))
+	}
+	return results, nil
+}
+
+func (s *Service) syncNote(patientID uint, item utils.SyncNoteDTO) utils.SyncItemResultDTO {
+	result := utils.SyncItemResultDTO{ClientID: item.ClientID}
+	fail := func(err error) utils.SyncItemResultDTO {
+		result.Status = "error"
+		if errors.Is(err, ErrInvalidNote) {
+			result.Error = err.Error()
+		} else {
+			s.Logger.Error("failed to sync note",
+				zap.Uint("patientID", patientID),
+				zap.String("clientID", item.ClientID),
+				zap.Error(err))
+			result.Error = "internal error"
+		}
+		return result
+	}
+
+	clientID := strings.ToLower(item.ClientID)
+	if !uuidRe.MatchString(clientID) {
+		return fail(fmt.Errorf("%w: client_id must be a UUID", ErrInvalidNote))
+	}
+	if !item.Deleted && item.RecordedAt == nil {
+		return fail(fmt.Errorf("%w: recorded_at is required", ErrInvalidNote))
+	}
+
+	existing, err := s.Repo.GetNoteByClientID(patientID, clientID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fail(err)
+	}
+
+	switch {
+	case existing == nil && item.Deleted:
+		// удаляют то, что до сервера так и не дошло — нечего делать
+		result.Status = "deleted"
+
+	case existing == nil:
+		note, err := s.newNote(patientID, item.CreateNoteDTO)
+		if err != nil {
+			return fail(err)
+		}
+		note.ClientID = &clientID
+		if err := s.Repo.CreateNote(note); err != nil {
+			// параллельный повтор мог успеть вставить ту же запись
+			if dup, lookupErr := s.Repo.GetNoteByClientID(patientID, clientID); lookupErr == nil {
+				result.Status = "unchanged"
+				result.NoteID = dup.ID
+				return result
+			}
+			return fail(err)
+		}
+		result.Status = "created"
+		result.NoteID = note.ID
+
+	case existing.DeletedAt.Valid:
+		result.Status = "deleted"
+		result.NoteID = existing.ID
+
+	case item.Deleted:
+		if err := s.Repo.SoftDeleteNote(existing.ID, time.Now()); err != nil {
+			return fail(err)
+		}
+		result.Status = "deleted"
+		result.NoteID = existing.ID
+
+	default:
+		updated, err := s.newNote(patientID, item.CreateNoteDTO)
+		if err != nil {
+			return fail(err)
+		}
+		result.NoteID = existing.ID
+		if sameNoteContent(existing, updated) {
+			result.Status = "unchanged"
+			return result
+		}
+
+		existing.RecordedAt = updated.RecordedAt
+		existing.Intensity = updated.Intensity
+		existing.PainType = updated.PainType
+		existing.TookPrescription = updated.TookPrescription
+		existing.Description = updated.Description
+		existing.BodyPart = updated.BodyPart
+		existing.BodyParts = updated.BodyParts
+		existing.SleepHours = updated.SleepHours
+		existing.SleepQuality = updated.SleepQuality
+		existing.Mood = updated.Mood
+		existing.ActivityLevel = updated.ActivityLevel
+		existing.Weather = updated.Weather
+		existing.Tags = updated.Tags
+		if err := s.Repo.ReplaceNote(existing); err != nil {
+			return fail(err)
+		}
+		result.Status = "updated"
+	}
+	return result
+}
+
+func sameNoteContent(a, b *models.Note) bool {
+	return a.RecordedAt.Truncate(time.Microsecond).Equal(b.RecordedAt.Truncate(time.Microsecond)) &&
+		a.Intensity == b.Intensity &&
+		a.PainType == b.PainType &&
+		a.TookPrescription == b.TookPrescription &&
+		a.Description == b.Description &&
+		reflect.DeepEqual(noteBodyPartsDTO(a.BodyParts), noteBodyPartsDTO(b.BodyParts)) &&
+		reflect.DeepEqual(a.SleepHours, b.SleepHours) &&
+		reflect.DeepEqual(a.SleepQuality, b.SleepQuality) &&
+		reflect.DeepEqual(a.Mood, b.Mood) &&
+		reflect.DeepEqual(a.ActivityLevel, b.ActivityLevel) &&
+		reflect.DeepEqual(a.Weather, b.Weather) &&
+		reflect.DeepEqual(tagNames(a.Tags), tagNames(b.Tags))
+}
+
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PullNotes возвращает записи пациента, изменённые после курсора, включая удалённые.
+// Курсор непрозрачен для клиента: его нужно передать обратно в следующем запросе.
+func (s *Service) PullNotes(patientID uint, cursor string, limit int) (*utils.SyncPullResponseDTO, error) {
+	afterVersion, err := parseSyncCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = syncDefaultLimit
+	}
+	limit = min(limit, syncMaxLimit)
+
+	notes, err := s.Repo.GetNotesChangedSince(patientID, afterVersion, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &utils.SyncPullResponseDTO{
+		Notes:   []utils.NoteDTO{},
+		Deleted: []utils.SyncDeletedNoteDTO{},
+		Cursor:  cursor,
+	}
+	if len(notes) > limit {
+		notes = notes[:limit]
+		resp.HasMore = true
+	}
+
+	var live []models.Note
+	for _, n := range notes {
+		if n.DeletedAt.Valid {
+			deleted := utils.SyncDeletedNoteDTO{ID: n.ID, DeletedAt: n.DeletedAt.Time}
+			if n.ClientID != nil {
+				deleted.ClientID = *n.ClientID
+			}
+			resp.Deleted = append(resp.Deleted, deleted)
+			continue
+		}
+		live = append(live, n)
+	}
+	resp.Notes = s.ToNoteDTO(live)
+
+	if len(notes) > 0 {
+		last := notes[len(notes)-1]
+		resp.Cursor = strconv.FormatInt(last.SyncVersion, 10)
+	}
+	return resp, nil
+}
+
+// parseSyncCursor разбирает курсор — sync_version последней отданной записи.
+// Старый курсор вида "<updated_at>_<id>" не переводится в ревизию, поэтому такой
+// клиент получает всё заново: повторно отданные записи он просто перезапишет.
+func parseSyncCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	if strings.Contains(cursor, "_") {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || version < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return version, nil
+}
+
+// buildNoteBodyParts разворачивает входной список в строки note_body_parts:
+// по строке на каждую часть тела и по строке на каждую зону иррадиации.
+func (s *Service) buildNoteBodyParts(parts []utils.NoteBodyPartDTO) ([]models.NoteBodyPart, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: at least one body part is required", ErrInvalidNote)
+	}
+
+	catalog, err := s.Repo.GetBodyParts(false)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[uint]bool, len(catalog))
+	for _, p := range catalog {
+		known[p.ID] = true
+	}
+
+	var result []models.NoteBodyPart
+	seen := make(map[uint]bool)
+	for _, p := range parts {
+		if !known[p.BodyPartID] {
+			return nil, fmt.Errorf("%w: unknown body part %d", ErrInvalidNote, p.BodyPartID)
+		}
+		if seen[p.BodyPartID] {
+			return nil, fmt.Errorf("%w: body part %d is listed twice", ErrInvalidNote, p.BodyPartID)
+		}
+		seen[p.BodyPartID] = true
+		if p.Intensity != nil && (*p.Intensity < 0 || *p.Intensity > 10) {
+			return nil, fmt.Errorf("%w: intensity must be between 0 and 10", ErrInvalidNote)
+		}
+
+		result = append(result, models.NoteBodyPart{BodyPartID: p.BodyPartID, Intensity: p.Intensity})
+
+		for _, target := range p.RadiatesTo {
+			if !known[target] || target == p.BodyPartID {
+				return nil, fmt.Errorf("%w: invalid radiation target %d", ErrInvalidNote, target)
+			}
+			from := p.BodyPartID
+			result = append(result, models.NoteBodyPart{BodyPartID: target, RadiatesFromID: &from})
+		}
+	}
+	return result, nil
+}
+
+// GetBodyPartStats считает, сколько раз каждая часть тела встречалась в записях
+// пациента. Каждая отмеченная часть учитывается отдельно, зоны иррадиации — в RadiatingCount.
+func (s *Service) GetBodyPartStats(userID, patientID uint, acceptLanguage string) ([]utils.BodyPartStatDTO, error) {
+	access, err := s.RequireScope(userID, patientID, ScopeNotes)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := s.Repo.GetAllStatByPatientID(patientID, NoteFilter{From: access.DataFrom})
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := s.bodyPartCatalog(acceptLanguage, true)
+	if err != nil {
+		return nil, err
+	}
+
+	type acc struct {
+		notes, radiating, intensitySum, intensityCount int
+	}
+	byPart := make(map[uint]*acc)
+	for _, n := range notes {
+		for _, p := range n.BodyParts {
+			a, ok := byPart[p.BodyPartID]
+			if !ok {
+				a = &acc{}
+				byPart[p.BodyPartID] = a
+			}
+			if p.RadiatesFromID != nil {
+				a.radiating++
+				continue
+			}
+			a.notes++
+			intensity := n.Intensity
+			if p.Intensity != nil {
+				intensity = *p.Intensity
+			}
+			a.intensitySum += intensity
+			a.intensityCount++
+		}
+	}
+
+	result := make([]utils.BodyPartStatDTO, 0, len(byPart))
+	for _, part := range catalog {
+		a, ok := byPart[part.ID]
+		if !ok {
+			continue
+		}
+		stat := utils.BodyPartStatDTO{
+			BodyPartID:     part.ID,
+			Code:           part.Code,
+			Translation:    part.Translation,
+			NotesCount:     a.notes,
+			RadiatingCount: a.radiating,
+		}
+		if a.intensityCount > 0 {
+			stat.AvgIntensity = float64(a.intensitySum) / float64(a.intensityCount)
+		}
+		result = append(result, stat)
+	}
+	return result, nil
+}
+
+// FactorReport сопоставляет контекст записей (сон, настроение, активность, погода, метки)
+// с днями сильной боли за период. День — календарный день в часовом поясе пациента;
+// интенсивность дня — максимальная за день.
+func (s *Service) FactorReport(userID, patientID uint, fromStr, toStr string, threshold int) (*utils.FactorReportDTO, error) {
+	from, to, err := parsePeriod(fromStr, toStr)
+	if err != nil {
+		return nil, err
+	}
+	if threshold == 0 {
+		threshold = defaultHighIntensity
+	}
+	if threshold < 1 || threshold > 10 {
+		return nil, fmt.Errorf("%w: threshold must be between 1 and 10", ErrInvalidPeriod)
+	}
+	access, err := s.RequireScope(userID, patientID, ScopeNotes)
+	if err != nil {
+		return nil, err
+	}
+
+	// границы периода и дни считаются по часам пациента, как и в отчёте о приёме лекарств
+	loc, err := s.patientLocation(patientID)
+	if err != nil {
+		return nil, err
+	}
+	from = access.ClampFrom(time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc))
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: period is outside of shared data range", ErrInvalidPeriod)
+	}
+
+	notes, err := s.Repo.GetAllStatByPatientID(patientID, NoteFilter{From: &from, To: &to})
+	if err != nil {
+		return nil, err
+	}
+
+	type dayAcc struct {
+		maxIntensity int
+		numeric      map[string][]float64
+		categories   map[[2]string]bool
+	}
+	days := make(map[string]*dayAcc)
+	var order []string
+	for _, n := range notes {
+		key := n.RecordedAt.In(loc).Format(time.DateOnly)
+		d, ok := days[key]
+		if !ok {
+			d = &dayAcc{numeric: make(map[string][]float64), categories: make(map[[2]string]bool)}
+			days[key] = d
+			order = append(order, key)
+		}
+		d.maxIntensity = max(d.maxIntensity, n.Intensity)
+		if n.SleepHours != nil {
+			d.numeric["sleep_hours"] = append(d.numeric["sleep_hours"], *n.SleepHours)
+		}
+		if n.SleepQuality != nil {
+			d.numeric["sleep_quality"] = append(d.numeric["sleep_quality"], float64(*n.SleepQuality))
+		}
+		if n.Mood != nil {
+			d.numeric["mood"] = append(d.numeric["mood"], float64(*n.Mood))
+		}
+		if n.ActivityLevel != nil {
+			d.categories[[2]string{"activity_level", *n.ActivityLevel}] = true
+		}
+		if n.Weather != nil {
+			d.categories[[2]string{"weather", *n.Weather}] = true
+		}
+		for _, t := range n.Tags {
+			d.categories[[2]string{"tag", t.Name}] = true
+		}
+	}
+
+	report := &utils.FactorReportDTO{
+		From:        from.Format(time.DateOnly),
+		To:          to.AddDate(0, 0, -1).Format(time.DateOnly),
+		Threshold:   threshold,
+		Days:        len(days),
+		Numeric:     []utils.NumericFactorDTO{},
+		Categorical: []utils.CategoricalFactorDTO{},
+	}
+
+	type numAcc struct {
+		values, intensities []float64
+		highSum, otherSum   float64
+		high, other         int
+	}
+	numeric := make(map[string]*numAcc)
+	type catAcc struct{ days, high int }
+	categorical := make(map[[2]string]*catAcc)
+	for _, key := range order {
+		d := days[key]
+		high := d.maxIntensity >= threshold
+		if high {
+			report.HighDays++
+		}
+		for factor, values := range d.numeric {
+			a, ok := numeric[factor]
+			if !ok {
+				a = &numAcc{}
+				numeric[factor] = a
+			}
+			var sum float64
+			for _, v := range values {
+				sum += v
+			}
+			avg := sum / float64(len(values))
+			a.values = append(a.values, avg)
+			a.intensities = append(a.intensities, float64(d.maxIntensity))
+			if high {
+				a.highSum += avg
+				a.high++
+			} else {
+				a.otherSum += avg
+				a.other++
+			}
+		}
+		for cat := range d.categories {
+			a, ok := categorical[cat]
+			if !ok {
+				a = &catAcc{}
+				categorical[cat] = a
+			}
+			a.days++
+			if high {
+				a.high++
+			}
+		}
+	}
+
+	for _, factor := range []string{"sleep_hours", "sleep_quality", "mood"} {
+		a, ok := numeric[factor]
+		if !ok {
+			continue
+		}
+		item := utils.NumericFactorDTO{
+			Factor:      factor,
+			Days:        len(a.values),
+			Correlation: pearson(a.values, a.intensities),
+		}
+		if a.high > 0 {
+			avg := a.highSum / float64(a.high)
+			item.HighDaysAvg = &avg
+		}
+		if a.other > 0 {
+			avg := a.otherSum / float64(a.other)
+			item.OtherDaysAvg = &avg
+		}
+		report.Numeric = append(report.Numeric, item)
+	}
+
+	baseShare := 0.0
+	if report.Days > 0 {
+		baseShare = float64(report.HighDays) / float64(report.Days)
+	}
+	for cat, a := range categorical {
+		item := utils.CategoricalFactorDTO{
+			Factor:    cat[0],
+			Value:     cat[1],
+			Days:      a.days,
+			HighDays:  a.high,
+			HighShare: float64(a.high) / float64(a.days),
+		}
+		if baseShare > 0 {
+			lift := item.HighShare / baseShare
+			item.Lift = &lift
+		}
+		report.Categorical = append(report.Categorical, item)
+	}
+	// сначала то, что чаще всего сопровождает сильную боль
+	sort.Slice(report.Categorical, func(i, j int) bool {
+		a, b := report.Categorical[i], report.Categorical[j]
+		if a.HighShare != b.HighShare {
+			return a.HighShare > b.HighShare
+		}
+		if a.Days != b.Days {
+			return a.Days > b.Days
+		}
+		return a.Factor+a.Value < b.Factor+b.Value
+	})
+	return report, nil
+}
+
+func (s *Service) ToNoteDTO(notes []models.Note) []utils.NoteDTO {
+	dto := make([]utils.NoteDTO, 0, len(notes))
+
+	for _, n := range notes {
+		recordedAt := n.RecordedAt
+		if recordedAt.IsZero() {
+			recordedAt = n.CreatedAt
+		}
+		var clientID string
+		if n.ClientID != nil {
+			clientID = *n.ClientID
+		}
+
+		dto = append(dto, utils.NoteDTO{
+			ID:               n.ID,
+			ClientID:         clientID,
+			UpdatedAt:        n.UpdatedAt,
+			DateRecorded:     recordedAt,
+			Intensity:        n.Intensity,
+			PainType:         n.PainType,
+			TookPrescription: n.TookPrescription,
+			Description:      n.Description,
+			BodyPart:         int(n.BodyPart),
+			BodyParts:        noteBodyPartsDTO(n.BodyParts),
+			SleepHours:       n.SleepHours,
+			SleepQuality:     n.SleepQuality,
+			Mood:             n.Mood,
+			ActivityLevel:    n.ActivityLevel,
+			Weather:          n.Weather,
+			Tags:             tagNames(n.Tags),
+		})
+	}
+
+	return dto
+}
+
+func noteBodyPartsDTO(parts []models.NoteBodyPart) []utils.NoteBodyPartDTO {
+	result := make([]utils.NoteBodyPartDTO, 0, len(parts))
+	index := make(map[uint]int)
+	for _, p := range parts {
+		if p.RadiatesFromID != nil {
+			continue
+		}
+		index[p.BodyPartID] = len(result)
+		result = append(result, utils.NoteBodyPartDTO{BodyPartID: p.BodyPartID, Intensity: p.Intensity})
+	}
+	for _, p := range parts {
+		if p.RadiatesFromID == nil {
+			continue
+		}
+		if i, ok := index[*p.RadiatesFromID]; ok {
+			result[i].RadiatesTo = append(result[i].RadiatesTo, p.BodyPartID)
+		}
+	}
+	return result
 }
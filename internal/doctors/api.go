@@ -0,0 +1,137 @@
+package doctors
+
+import (
+	"errors"
+	"net/http"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/doctors/", rbac.RequirePermission(logger, rbac.PermDoctorsRead), h.Search)
+	rg.GET("/doctors/me", rbac.RequirePermission(logger, rbac.PermDoctorProfileManage), h.GetOwnProfile)
+	rg.PATCH("/doctors/me", rbac.RequirePermission(logger, rbac.PermDoctorProfileManage), h.UpdateOwnProfile)
+	rg.GET("/doctors/:id", rbac.RequirePermission(logger, rbac.PermDoctorsRead), h.GetDoctor)
+}
+
+// Search — GET /doctors/?q=&specialty=&city=&language=&accepting=true&offset=0&limit=20.
+func (h *Handler) Search(c *gin.Context) {
+	if _, exists := c.Get("userID"); !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	filter := SearchFilter{
+		Query:     c.Query("q"),
+		Specialty: c.Query("specialty"),
+		City:      c.Query("city"),
+		Language:  c.Query("language"),
+	}
+	var err error
+	if v := c.Query("accepting"); v != "" {
+		if filter.Accepting, err = strconv.ParseBool(v); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid accepting", h.Logger)
+			return
+		}
+	}
+	offset, limit := 0, 0
+	if v := c.Query("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid offset", h.Logger)
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid limit", h.Logger)
+			return
+		}
+	}
+
+	result, err := h.Service.Search(filter, offset, limit)
+	if err != nil {
+		h.respondError(c, err, "failed to search doctors")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) GetDoctor(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	doctorID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid doctor id", h.Logger)
+		return
+	}
+
+	profile, err := h.Service.GetDoctor(userID.(uint), uint(doctorID))
+	if err != nil {
+		h.respondError(c, err, "failed to get doctor")
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+func (h *Handler) GetOwnProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	profile, err := h.Service.GetDoctor(userID.(uint), userID.(uint))
+	if err != nil {
+		h.respondError(c, err, "failed to get doctor profile")
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+func (h *Handler) UpdateOwnProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.DoctorProfileInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	profile, err := h.Service.UpdateProfile(userID.(uint), req)
+	if err != nil {
+		h.respondError(c, err, "failed to update doctor profile")
+		return
+	}
+
+	h.Logger.Info("doctor profile updated", zap.Uint("doctorID", profile.ID), zap.Bool("hidden", profile.Hidden))
+	c.JSON(http.StatusOK, profile)
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrInvalidProfile), errors.Is(err, ErrInvalidSearch):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
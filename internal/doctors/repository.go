@@ -0,0 +1,124 @@
+package doctors
+
+import (
+	"painaway_test/internal/rbac"
+	"painaway_test/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	Search(filter SearchFilter, offset, limit int) ([]DoctorRow, int64, error)
+	GetDoctor(userID uint) (*DoctorRow, error)
+	GetProfile(userID uint) (*models.DoctorProfile, error)
+	SaveProfile(profile *models.DoctorProfile) error
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+// SearchFilter — условия поиска по каталогу; пустые поля не фильтруют.
+type SearchFilter struct {
+	Query     string // по ФИО, логину, специальности и клинике
+	Specialty string
+	City      string
+	Language  string
+	Accepting bool // только принимающие новых пациентов
+}
+
+// DoctorRow — врач и его карточка; у врача, ещё не заполнившего карточку,
+// поля профиля пустые, а приём пациентов считается открытым.
+type DoctorRow struct {
+	models.User
+	Specialty            string
+	Clinic               string
+	City                 string
+	Languages            []string `gorm:"serializer:json"`
+	Bio                  string
+	AcceptingNewPatients bool
+	Hidden               bool
+}
+
+const doctorColumns = `users.*, COALESCE(p.specialty, '') AS specialty, COALESCE(p.clinic, '') AS clinic,
+	COALESCE(p.city, '') AS city, COALESCE(p.languages, '[]') AS languages, COALESCE(p.bio, '') AS bio,
+	COALESCE(p.accepting_new_patients, TRUE) AS accepting_new_patients, COALESCE(p.hidden, FALSE) AS hidden`
+
+func (r *Repo) doctors() *gorm.DB {
+	return r.DB.Table("users").
+		Joins("LEFT JOIN doctor_profiles p ON p.user_id = users.id").
+		Where("users.id IN (?)", rbac.UsersWithRole(r.DB, rbac.RoleDoctor))
+}
+
+func (r *Repo) Search(filter SearchFilter, offset, limit int) ([]DoctorRow, int64, error) {
+	query := r.doctors().Where("COALESCE(p.hidden, FALSE) = FALSE")
+	if filter.Query != "" {
+		like := "%" + escapeLike(filter.Query) + "%"
+		query = query.Where(`(users.last_name ILIKE ? OR users.first_name ILIKE ? OR users.father_name ILIKE ?
+			OR users.username ILIKE ? OR p.specialty ILIKE ? OR p.clinic ILIKE ?)`, like, like, like, like, like, like)
+	}
+	if filter.Specialty != "" {
+		query = query.Where("LOWER(p.specialty) = ?", strings.ToLower(filter.Specialty))
+	}
+	if filter.City != "" {
+		query = query.Where("LOWER(p.city) = ?", strings.ToLower(filter.City))
+	}
+	if filter.Language != "" {
+		query = query.Where("p.languages @> jsonb_build_array(?::text)", filter.Language)
+	}
+	if filter.Accepting {
+		query = query.Where("COALESCE(p.accepting_new_patients, TRUE) = TRUE")
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rows []DoctorRow
+	if err := query.Select(doctorColumns).
+		Order("users.last_name, users.first_name, users.id").
+		Offset(offset).
+		Limit(limit).
+		Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+func (r *Repo) GetDoctor(userID uint) (*DoctorRow, error) {
+	var rows []DoctorRow
+	if err := r.doctors().Select(doctorColumns).Where("users.id = ?", userID).Limit(1).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &rows[0], nil
+}
+
+func (r *Repo) GetProfile(userID uint) (*models.DoctorProfile, error) {
+	var profile models.DoctorProfile
+	if err := r.DB.Where("user_id = ?", userID).First(&profile).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *Repo) SaveProfile(profile *models.DoctorProfile) error {
+	return r.DB.Omit("User").Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"specialty", "clinic", "city", "languages", "bio", "accepting_new_patients", "hidden", "updated_at",
+		}),
+	}).Create(profile).Error
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,65 @@
+package doctors
+
+import (
+	"painaway_test/models"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB не подключается к базе: запросы только собираются, а последний
+// INSERT перехватывается, чтобы проверить, какие значения ушли бы в БД.
+type capturedInsert struct {
+	SQL  string
+	Vars []any
+}
+
+func dryRunDB(t *testing.T) (*gorm.DB, *capturedInsert) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	captured := &capturedInsert{}
+	if err := db.Callback().Create().After("gorm:create").Register("test:capture", func(tx *gorm.DB) {
+		captured.SQL = tx.Statement.SQL.String()
+		captured.Vars = tx.Statement.Vars
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+	return db, captured
+}
+
+func TestSaveProfileWritesAcceptingFalse(t *testing.T) {
+	db, stmt := dryRunDB(t)
+	repo := &Repo{DB: db}
+
+	if err := repo.SaveProfile(&models.DoctorProfile{UserID: 7, AcceptingNewPatients: false}); err != nil {
+		t.Fatalf("SaveProfile: %v", err)
+	}
+
+	sql := stmt.SQL
+	columns := sql[strings.Index(sql, "(")+1 : strings.Index(sql, ")")]
+	names := strings.Split(columns, ",")
+	index := -1
+	for i, name := range names {
+		if strings.Trim(name, `" `) == "accepting_new_patients" {
+			index = i
+		}
+	}
+	if index < 0 {
+		t.Fatalf("accepting_new_patients is not written, the column default would apply: %s", sql)
+	}
+	if v, ok := stmt.Vars[index].(bool); !ok || v {
+		t.Errorf("accepting_new_patients = %v, want false", stmt.Vars[index])
+	}
+	if !strings.Contains(sql, `"accepting_new_patients"="excluded"."accepting_new_patients"`) {
+		t.Errorf("upsert does not update accepting_new_patients: %s", sql)
+	}
+}
@@ -0,0 +1,177 @@
+package doctors
+
+import (
+	"errors"
+	"fmt"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxQueryLength     = 100
+
+	maxFieldLength = 200
+	maxBioLength   = 4000
+	maxLanguages   = 10
+)
+
+var (
+	ErrInvalidProfile = errors.New("invalid doctor profile")
+	ErrInvalidSearch  = errors.New("invalid search")
+
+	languageRe = regexp.MustCompile(`^[a-z]{2}$`)
+)
+
+type Service struct {
+	Repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{Repo: repo}
+}
+
+// Search ищет по каталогу среди врачей, которые не скрыли себя.
+func (s *Service) Search(filter SearchFilter, offset, limit int) (*utils.DoctorSearchResultDTO, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	filter.Specialty = strings.TrimSpace(filter.Specialty)
+	filter.City = strings.TrimSpace(filter.City)
+	filter.Language = strings.ToLower(strings.TrimSpace(filter.Language))
+	if utf8.RuneCountInString(filter.Query) > maxQueryLength {
+		return nil, fmt.Errorf("%w: query is longer than %d characters", ErrInvalidSearch, maxQueryLength)
+	}
+	if filter.Language != "" && !languageRe.MatchString(filter.Language) {
+		return nil, fmt.Errorf("%w: language must be a two-letter code", ErrInvalidSearch)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidSearch)
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	rows, total, err := s.Repo.Search(filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]utils.DoctorProfileDTO, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, toProfileDTO(row, false))
+	}
+	return &utils.DoctorSearchResultDTO{Items: items, Total: total, Offset: offset, Limit: limit}, nil
+}
+
+// GetDoctor — карточка врача. Скрытую карточку видит только сам врач.
+func (s *Service) GetDoctor(userID, doctorID uint) (*utils.DoctorProfileDTO, error) {
+	row, err := s.Repo.GetDoctor(doctorID)
+	if err != nil {
+		return nil, err
+	}
+	own := userID == doctorID
+	if row.Hidden && !own {
+		return nil, gorm.ErrRecordNotFound
+	}
+	dto := toProfileDTO(*row, own)
+	return &dto, nil
+}
+
+// UpdateProfile частично обновляет карточку врача, создавая её при первом сохранении.
+func (s *Service) UpdateProfile(doctorID uint, input utils.DoctorProfileInputDTO) (*utils.DoctorProfileDTO, error) {
+	profile, err := s.Repo.GetProfile(doctorID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		profile = &models.DoctorProfile{UserID: doctorID, AcceptingNewPatients: true}
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, f := range []struct {
+		name  string
+		input *string
+		dst   *string
+		max   int
+	}{
+		{"specialty", input.Specialty, &profile.Specialty, maxFieldLength},
+		{"clinic", input.Clinic, &profile.Clinic, maxFieldLength},
+		{"city", input.City, &profile.City, maxFieldLength},
+		{"bio", input.Bio, &profile.Bio, maxBioLength},
+	} {
+		if f.input == nil {
+			continue
+		}
+		value := strings.TrimSpace(*f.input)
+		if utf8.RuneCountInString(value) > f.max {
+			return nil, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidProfile, f.name, f.max)
+		}
+		*f.dst = value
+	}
+	if input.Languages != nil {
+		languages, err := normalizeLanguages(*input.Languages)
+		if err != nil {
+			return nil, err
+		}
+		profile.Languages = languages
+	}
+	if input.AcceptingNewPatients != nil {
+		profile.AcceptingNewPatients = *input.AcceptingNewPatients
+	}
+	if input.Hidden != nil {
+		profile.Hidden = *input.Hidden
+	}
+
+	if err := s.Repo.SaveProfile(profile); err != nil {
+		return nil, err
+	}
+	return s.GetDoctor(doctorID, doctorID)
+}
+
+func normalizeLanguages(languages []string) ([]string, error) {
+	seen := make(map[string]bool, len(languages))
+	result := make([]string, 0, len(languages))
+	for _, lang := range languages {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if !languageRe.MatchString(lang) {
+			return nil, fmt.Errorf("%w: language %q must be a two-letter code", ErrInvalidProfile, lang)
+		}
+		if seen[lang] {
+			continue
+		}
+		seen[lang] = true
+		result = append(result, lang)
+	}
+	if len(result) > maxLanguages {
+		return nil, fmt.Errorf("%w: no more than %d languages", ErrInvalidProfile, maxLanguages)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func toProfileDTO(row DoctorRow, own bool) utils.DoctorProfileDTO {
+	languages := row.Languages
+	if languages == nil {
+		languages = []string{}
+	}
+	return utils.DoctorProfileDTO{
+		ID:                   row.ID,
+		Username:             row.Username,
+		LastName:             row.LastName,
+		FirstName:            row.FirstName,
+		FatherName:           row.FatherName,
+		Specialty:            row.Specialty,
+		Clinic:               row.Clinic,
+		City:                 row.City,
+		Languages:            languages,
+		Bio:                  row.Bio,
+		AcceptingNewPatients: row.AcceptingNewPatients,
+		Hidden:               own && row.Hidden,
+	}
+}
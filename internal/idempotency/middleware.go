@@ -0,0 +1,183 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"painaway_test/internal/config"
+	"painaway_test/internal/response"
+	"painaway_test/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	// запрос, "выполняющийся" дольше этого, считаем брошенным (например, сервер упал)
+	staleInProgress = time.Minute
+)
+
+// Middleware обрабатывает заголовок Idempotency-Key на изменяющих запросах.
+// Первый ответ для пары пользователь+ключ сохраняется на cfg.TTL и отдаётся
+// повторно на ретраи; повтор ключа с другим телом отклоняется.
+// Тело multipart-запросов в хеш не входит: загрузки файлов не читаются в память целиком.
+// Должен стоять после AuthMiddleware.
+func Middleware(repo Repository, cfg *config.IdempotencyConfig, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(HeaderKey)
+		if key == "" || !isMutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			response.NewErrorResponse(c, http.StatusBadRequest, "Idempotency-Key is too long", logger)
+			return
+		}
+		userID := c.GetUint("userID")
+		if userID == 0 {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if !isMultipart(c.Request) {
+			if cfg.MaxBodySize > 0 {
+				c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxBodySize)
+			}
+			var err error
+			body, err = io.ReadAll(c.Request.Body)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					response.NewErrorResponse(c, http.StatusRequestEntityTooLarge, "request body is too large", logger)
+					return
+				}
+				response.NewErrorResponse(c, http.StatusBadRequest, "failed to read request body", logger)
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		record := &models.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.RequestURI(),
+			RequestHash: requestHash(c.Request.Method, c.Request.URL.RequestURI(), body),
+			ExpiresAt:   time.Now().Add(cfg.TTL),
+		}
+
+		reserved, existing, err := reserve(repo, record)
+		if err != nil {
+			logger.Error("failed to reserve idempotency key", zap.Uint("userID", userID), zap.Error(err))
+			response.NewErrorResponse(c, http.StatusInternalServerError, "failed to process Idempotency-Key", logger)
+			return
+		}
+
+		if !reserved {
+			switch {
+			case existing.RequestHash != record.RequestHash:
+				response.NewErrorResponse(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request", logger)
+			case existing.StatusCode == 0:
+				response.NewErrorResponse(c, http.StatusConflict, "request with this Idempotency-Key is still being processed", logger)
+			default:
+				c.Header(HeaderReplayed, "true")
+				c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		c.Next()
+
+		status := rec.Status()
+		if status >= http.StatusInternalServerError {
+			// ошибку сервера не запоминаем, чтобы клиент мог повторить запрос
+			if err := repo.Delete(record.ID); err != nil {
+				logger.Error("failed to release idempotency key", zap.Uint("recordID", record.ID), zap.Error(err))
+			}
+			return
+		}
+		if err := repo.Complete(record.ID, status, rec.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+			logger.Error("failed to store idempotent response", zap.Uint("recordID", record.ID), zap.Error(err))
+		}
+	}
+}
+
+// reserve занимает ключ; просроченную или брошенную запись удаляет и пробует ещё раз.
+func reserve(repo Repository, record *models.IdempotencyRecord) (bool, *models.IdempotencyRecord, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		ok, err := repo.Reserve(record)
+		if err != nil || ok {
+			return ok, nil, err
+		}
+
+		existing, err := repo.Get(record.UserID, record.Key)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, nil, err
+		}
+
+		now := time.Now()
+		abandoned := existing.StatusCode == 0 && now.Sub(existing.CreatedAt) > staleInProgress
+		if !now.After(existing.ExpiresAt) && !abandoned {
+			return false, existing, nil
+		}
+		if err := repo.Delete(existing.ID); err != nil {
+			return false, nil, err
+		}
+	}
+	return false, nil, errors.New("idempotency key is contended")
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+func requestHash(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(uri))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
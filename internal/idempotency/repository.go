@@ -0,0 +1,61 @@
+package idempotency
+
+import (
+	"painaway_test/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	Reserve(record *models.IdempotencyRecord) (bool, error)
+	Get(userID uint, key string) (*models.IdempotencyRecord, error)
+	Complete(id uint, statusCode int, contentType string, body []byte) error
+	Delete(id uint) error
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+// Reserve атомарно занимает ключ. false — ключ уже занят другим запросом.
+func (r *Repo) Reserve(record *models.IdempotencyRecord) (bool, error) {
+	res := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *Repo) Get(userID uint, key string) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	if err := r.DB.Where("user_id = ? AND key = ?", userID, key).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *Repo) Complete(id uint, statusCode int, contentType string, body []byte) error {
+	return r.DB.Model(&models.IdempotencyRecord{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"body":         body,
+		}).Error
+}
+
+func (r *Repo) Delete(id uint) error {
+	return r.DB.Where("id = ?", id).Delete(&models.IdempotencyRecord{}).Error
+}
+
+func (r *Repo) DeleteExpired(now time.Time) (int64, error) {
+	res := r.DB.Where("expires_at < ?", now).Delete(&models.IdempotencyRecord{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,135 @@
+package invites
+
+import (
+	"errors"
+	"net/http"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/invites/", rbac.RequirePermission(logger, rbac.PermInvitesManage), h.List)
+	rg.POST("/invites/", rbac.RequirePermission(logger, rbac.PermInvitesManage), h.Create)
+	rg.POST("/invites/:id/revoke", rbac.RequirePermission(logger, rbac.PermInvitesManage), h.Revoke)
+	rg.POST("/invites/redeem", rbac.RequirePermission(logger, rbac.PermLinksRequest), h.Redeem)
+}
+
+func (h *Handler) List(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	invites, err := h.Service.List(userID.(uint))
+	if err != nil {
+		h.respondError(c, err, "failed to list invites")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToInviteDTO(invites))
+}
+
+func (h *Handler) Create(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.CreateInviteDTO
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+			return
+		}
+	}
+
+	invite, err := h.Service.Create(userID.(uint), req)
+	if err != nil {
+		h.respondError(c, err, "failed to create invite")
+		return
+	}
+
+	h.Logger.Info("invite created", zap.Uint("doctorID", invite.DoctorID), zap.Uint("inviteID", invite.ID))
+	c.JSON(http.StatusCreated, h.Service.ToInviteDTO([]models.InviteCode{*invite})[0])
+}
+
+func (h *Handler) Revoke(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	inviteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid invite id", h.Logger)
+		return
+	}
+
+	invite, err := h.Service.Revoke(userID.(uint), uint(inviteID))
+	if err != nil {
+		h.respondError(c, err, "failed to revoke invite")
+		return
+	}
+
+	h.Logger.Info("invite revoked", zap.Uint("doctorID", invite.DoctorID), zap.Uint("inviteID", invite.ID))
+	c.JSON(http.StatusOK, h.Service.ToInviteDTO([]models.InviteCode{*invite})[0])
+}
+
+// Redeem — POST /invites/redeem; код вводится вручную или берётся из ссылки QR-кода.
+func (h *Handler) Redeem(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.RedeemInviteDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	link, err := h.Service.Redeem(userID.(uint), c.ClientIP(), req.Code)
+	if err != nil {
+		h.respondError(c, err, "failed to redeem invite")
+		return
+	}
+
+	h.Logger.Info("invite redeemed",
+		zap.Uint("patientID", link.PatientID),
+		zap.Uint("doctorID", link.DoctorID),
+		zap.Uint("linkID", link.ID),
+		zap.String("status", link.Status))
+	c.JSON(http.StatusOK, h.Service.ToLinkDTO(link))
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	case errors.Is(err, ErrTooManyAttempts):
+		response.NewErrorResponse(c, http.StatusTooManyRequests, err.Error(), h.Logger)
+	case errors.Is(err, diary.ErrLinkExists), errors.Is(err, diary.ErrInvalidTransition):
+		response.NewErrorResponse(c, http.StatusConflict, err.Error(), h.Logger)
+	case errors.Is(err, ErrInvalidInvite), errors.Is(err, ErrInviteUnavailable):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
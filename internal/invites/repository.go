@@ -0,0 +1,110 @@
+package invites
+
+import (
+	"painaway_test/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	CreateInvite(invite *models.InviteCode) error
+	GetInviteByID(id uint) (*models.InviteCode, error)
+	GetInviteByCode(code string) (*models.InviteCode, error)
+	GetInvitesByDoctorID(doctorID uint) ([]models.InviteCode, error)
+	RevokeInvite(invite *models.InviteCode) error
+	ClaimUse(inviteID uint, now time.Time) (bool, error)
+	ReleaseUse(inviteID uint) error
+	CreateRedemption(redemption *models.InviteRedemption) error
+	CreateAttempt(attempt *models.InviteAttempt) error
+	CountAttemptsSince(userID uint, since time.Time) (int64, error)
+	CountAttemptsByIPSince(ip string, since time.Time) (int64, error)
+	DeleteAttemptsBefore(before time.Time) (int64, error)
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+func (r *Repo) CreateInvite(invite *models.InviteCode) error {
+	return r.DB.Create(invite).Error
+}
+
+func (r *Repo) GetInviteByID(id uint) (*models.InviteCode, error) {
+	var invite models.InviteCode
+	if err := r.DB.Where("id = ?", id).First(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (r *Repo) GetInviteByCode(code string) (*models.InviteCode, error) {
+	var invite models.InviteCode
+	if err := r.DB.Preload("Doctor").Where("code = ?", code).First(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (r *Repo) GetInvitesByDoctorID(doctorID uint) ([]models.InviteCode, error) {
+	var invites []models.InviteCode
+	if err := r.DB.Where("doctor_id = ?", doctorID).
+		Order("created_at DESC, id DESC").
+		Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (r *Repo) RevokeInvite(invite *models.InviteCode) error {
+	return r.DB.Model(invite).Select("revoked_at").Updates(invite).Error
+}
+
+// ClaimUse атомарно засчитывает одно погашение кода; false — код отозван,
+// истёк или исчерпан (в том числе параллельным запросом).
+func (r *Repo) ClaimUse(inviteID uint, now time.Time) (bool, error) {
+	res := r.DB.Model(&models.InviteCode{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uses = 0 OR used_count < max_uses)", inviteID, now).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	return res.RowsAffected > 0, res.Error
+}
+
+// ReleaseUse возвращает погашение, если привязку создать не удалось.
+func (r *Repo) ReleaseUse(inviteID uint) error {
+	return r.DB.Model(&models.InviteCode{}).
+		Where("id = ? AND used_count > 0", inviteID).
+		Update("used_count", gorm.Expr("used_count - 1")).Error
+}
+
+func (r *Repo) CreateRedemption(redemption *models.InviteRedemption) error {
+	return r.DB.Create(redemption).Error
+}
+
+func (r *Repo) CreateAttempt(attempt *models.InviteAttempt) error {
+	return r.DB.Create(attempt).Error
+}
+
+func (r *Repo) CountAttemptsSince(userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.InviteAttempt{}).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *Repo) CountAttemptsByIPSince(ip string, since time.Time) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.InviteAttempt{}).
+		Where("ip = ? AND created_at >= ?", ip, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *Repo) DeleteAttemptsBefore(before time.Time) (int64, error) {
+	res := r.DB.Where("created_at < ?", before).Delete(&models.InviteAttempt{})
+	return res.RowsAffected, res.Error
+}
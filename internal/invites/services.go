@@ -0,0 +1,297 @@
+package invites
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"painaway_test/internal/config"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	StatusActive    = "active"
+	StatusExpired   = "expired"
+	StatusExhausted = "exhausted"
+	StatusRevoked   = "revoked"
+
+	// без неоднозначных символов: 0/O, 1/I
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codeLength   = 8
+	maxInviteUse = 1000
+
+	defaultTTL              = 7 * 24 * time.Hour
+	defaultMaxAttempts      = 10
+	defaultMaxAttemptsPerIP = 30
+	defaultAttemptWindow    = 15 * time.Minute
+)
+
+var (
+	ErrForbidden         = errors.New("access denied")
+	ErrInvalidInvite     = errors.New("invalid invite")
+	ErrInviteUnavailable = errors.New("invite code is invalid, expired or used up")
+	ErrTooManyAttempts   = errors.New("too many attempts, try again later")
+)
+
+type Service struct {
+	Repo   Repository
+	Diary  *diary.Service
+	Config *config.InvitesConfig
+	Logger *zap.Logger
+}
+
+func NewService(repo Repository, diarySrv *diary.Service, cfg *config.InvitesConfig, logger *zap.Logger) *Service {
+	return &Service{
+		Repo:   repo,
+		Diary:  diarySrv,
+		Config: cfg,
+		Logger: logger,
+	}
+}
+
+// Create выпускает код приглашения врача.
+func (s *Service) Create(doctorID uint, input utils.CreateInviteDTO) (*models.InviteCode, error) {
+	now := time.Now()
+	invite := &models.InviteCode{
+		DoctorID:   doctorID,
+		AutoAccept: input.AutoAccept,
+		MaxUses:    1,
+		ExpiresAt:  now.Add(s.defaultTTL()),
+	}
+	if input.MaxUses != nil {
+		if *input.MaxUses < 0 || *input.MaxUses > maxInviteUse {
+			return nil, fmt.Errorf("%w: max_uses must be between 0 and %d", ErrInvalidInvite, maxInviteUse)
+		}
+		invite.MaxUses = *input.MaxUses
+	}
+	if input.ExpiresAt != nil {
+		invite.ExpiresAt = input.ExpiresAt.UTC()
+	}
+	if !invite.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidInvite)
+	}
+	if s.Config.MaxTTL > 0 && invite.ExpiresAt.Sub(now) > s.Config.MaxTTL {
+		return nil, fmt.Errorf("%w: invite cannot be valid longer than %s", ErrInvalidInvite, s.Config.MaxTTL)
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+	invite.Code = code
+	if err := s.Repo.CreateInvite(invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+func (s *Service) List(doctorID uint) ([]models.InviteCode, error) {
+	return s.Repo.GetInvitesByDoctorID(doctorID)
+}
+
+// Revoke отзывает код; уже созданные по нему привязки не затрагиваются.
+func (s *Service) Revoke(doctorID, inviteID uint) (*models.InviteCode, error) {
+	invite, err := s.Repo.GetInviteByID(inviteID)
+	if err != nil {
+		return nil, err
+	}
+	if invite.DoctorID != doctorID {
+		return nil, ErrForbidden
+	}
+	if invite.RevokedAt != nil {
+		return invite, nil
+	}
+	now := time.Now()
+	invite.RevokedAt = &now
+	if err := s.Repo.RevokeInvite(invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// Redeem гасит код и прикрепляет пациента к врачу. Неудачные попытки считаются,
+// и после MaxAttempts за AttemptWindow (или MaxAttemptsPerIP с одного адреса)
+// погашение временно блокируется.
+func (s *Service) Redeem(patientID uint, ip, rawCode string) (*models.Subscription, error) {
+	now := time.Now()
+	since := now.Add(-s.attemptWindow())
+	attempts, err := s.Repo.CountAttemptsSince(patientID, since)
+	if err != nil {
+		return nil, err
+	}
+	if attempts >= int64(s.maxAttempts()) {
+		return nil, ErrTooManyAttempts
+	}
+	attempts, err = s.Repo.CountAttemptsByIPSince(ip, since)
+	if err != nil {
+		return nil, err
+	}
+	if attempts >= int64(s.maxAttemptsPerIP()) {
+		return nil, ErrTooManyAttempts
+	}
+
+	invite, err := s.Repo.GetInviteByCode(NormalizeCode(rawCode))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, s.failAttempt(patientID, ip)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if inviteStatus(invite, now) != StatusActive {
+		return nil, s.failAttempt(patientID, ip)
+	}
+
+	claimed, err := s.Repo.ClaimUse(invite.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrInviteUnavailable
+	}
+	link, err := s.Diary.LinkByInvite(invite.DoctorID, patientID, invite.AutoAccept)
+	if err != nil {
+		if releaseErr := s.Repo.ReleaseUse(invite.ID); releaseErr != nil {
+			s.Logger.Error("failed to release invite use", zap.Uint("inviteID", invite.ID), zap.Error(releaseErr))
+		}
+		return nil, err
+	}
+
+	if err := s.Repo.CreateRedemption(&models.InviteRedemption{
+		InviteCodeID:   invite.ID,
+		PatientID:      patientID,
+		SubscriptionID: link.ID,
+	}); err != nil {
+		s.Logger.Error("failed to record invite redemption",
+			zap.Uint("inviteID", invite.ID),
+			zap.Uint("linkID", link.ID),
+			zap.Error(err),
+		)
+	}
+	return link, nil
+}
+
+func (s *Service) failAttempt(userID uint, ip string) error {
+	if err := s.Repo.CreateAttempt(&models.InviteAttempt{UserID: userID, IP: ip}); err != nil {
+		s.Logger.Error("failed to record invite attempt", zap.Uint("userID", userID), zap.String("ip", ip), zap.Error(err))
+	}
+	return ErrInviteUnavailable
+}
+
+// NormalizeCode приводит введённый вручную код к виду из базы: верхний регистр,
+// без пробелов и дефисов.
+func NormalizeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+func generateCode() (string, error) {
+	b := make([]byte, codeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		// 256 делится на 32 без остатка, поэтому распределение равномерное
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
+
+func inviteStatus(invite *models.InviteCode, now time.Time) string {
+	switch {
+	case invite.RevokedAt != nil:
+		return StatusRevoked
+	case !invite.ExpiresAt.After(now):
+		return StatusExpired
+	case invite.MaxUses > 0 && invite.UsedCount >= invite.MaxUses:
+		return StatusExhausted
+	default:
+		return StatusActive
+	}
+}
+
+// InviteURL — ссылка для QR-кода: страница приложения с кодом в параметре.
+func (s *Service) InviteURL(code string) string {
+	if s.Config.BaseURL == "" {
+		return ""
+	}
+	sep := "?"
+	if strings.Contains(s.Config.BaseURL, "?") {
+		sep = "&"
+	}
+	return s.Config.BaseURL + sep + "code=" + url.QueryEscape(code)
+}
+
+func (s *Service) defaultTTL() time.Duration {
+	if s.Config.DefaultTTL > 0 {
+		return s.Config.DefaultTTL
+	}
+	return defaultTTL
+}
+
+func (s *Service) maxAttempts() int {
+	if s.Config.MaxAttempts > 0 {
+		return s.Config.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+func (s *Service) maxAttemptsPerIP() int {
+	if s.Config.MaxAttemptsPerIP > 0 {
+		return s.Config.MaxAttemptsPerIP
+	}
+	return defaultMaxAttemptsPerIP
+}
+
+func (s *Service) attemptWindow() time.Duration {
+	if s.Config.AttemptWindow > 0 {
+		return s.Config.AttemptWindow
+	}
+	return defaultAttemptWindow
+}
+
+func (s *Service) ToInviteDTO(invites []models.InviteCode) []utils.InviteDTO {
+	now := time.Now()
+	dto := make([]utils.InviteDTO, 0, len(invites))
+	for i := range invites {
+		inv := &invites[i]
+		dto = append(dto, utils.InviteDTO{
+			ID:         inv.ID,
+			Code:       inv.Code,
+			URL:        s.InviteURL(inv.Code),
+			AutoAccept: inv.AutoAccept,
+			MaxUses:    inv.MaxUses,
+			UsedCount:  inv.UsedCount,
+			Status:     inviteStatus(inv, now),
+			ExpiresAt:  inv.ExpiresAt,
+			RevokedAt:  inv.RevokedAt,
+			CreatedAt:  inv.CreatedAt,
+		})
+	}
+	return dto
+}
+
+func (s *Service) ToLinkDTO(link *models.Subscription) utils.PatientLinkDTO {
+	return utils.PatientLinkDTO{
+		ID:     link.ID,
+		Status: link.Status,
+		Role:   link.Role,
+		Doctor: utils.DoctorDTO{
+			ID:         link.Doctor.ID,
+			Username:   link.Doctor.Username,
+			LastName:   link.Doctor.LastName,
+			FirstName:  link.Doctor.FirstName,
+			FatherName: link.Doctor.FatherName,
+		},
+	}
+}
@@ -1,12 +1,22 @@
 package log
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+const (
+	HeaderRequestID = "X-Request-ID"
+	// RequestIDKey — ключ идентификатора запроса в gin.Context.
+	RequestIDKey = "requestID"
+
+	maxRequestIDLength = 64
+)
+
 func LoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -20,7 +30,30 @@ func LoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
 			zap.String("client_ip", c.ClientIP()),
+			zap.String("request_id", c.GetString(RequestIDKey)),
 			zap.Duration("latency", latency),
 		)
 	}
 }
+
+// RequestIDMiddleware берёт идентификатор запроса из X-Request-ID или выдаёт новый
+// и возвращает его в ответе, чтобы запрос можно было найти в логах и журнале доступа.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
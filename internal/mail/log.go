@@ -0,0 +1,25 @@
+package mail
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// LogSender не отправляет письма, а пишет их в лог. Только для разработки:
+// в лог попадают коды подтверждения.
+type LogSender struct {
+	logger *zap.Logger
+}
+
+func NewLogSender(logger *zap.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(_ context.Context, msg Message) error {
+	s.logger.Info("mail message",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body))
+	return nil
+}
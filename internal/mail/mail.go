@@ -0,0 +1,31 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"painaway_test/internal/config"
+
+	"go.uber.org/zap"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // обычный текст
+}
+
+// Sender отправляет письма пользователям (коды подтверждения, уведомления об изменениях аккаунта).
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func New(cfg *config.MailConfig, logger *zap.Logger) (Sender, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return NewLogSender(logger), nil
+	case "smtp":
+		return NewSMTPSender(cfg)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
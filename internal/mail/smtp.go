@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"painaway_test/internal/config"
+	"strconv"
+	"time"
+)
+
+// SMTPSender отправляет письма через SMTP-сервер; STARTTLS включается, если сервер его поддерживает.
+type SMTPSender struct {
+	addr string
+	from *mail.Address
+	auth smtp.Auth
+}
+
+func NewSMTPSender(cfg *config.MailConfig) (*SMTPSender, error) {
+	if cfg.SMTP.Host == "" {
+		return nil, fmt.Errorf("smtp mail: host is not configured")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("smtp mail: invalid from address: %w", err)
+	}
+	port := cfg.SMTP.Port
+	if port == 0 {
+		port = 587
+	}
+
+	s := &SMTPSender{
+		addr: net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(port)),
+		from: from,
+	}
+	if cfg.SMTP.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+	return s, nil
+}
+
+// Send не учитывает ctx: net/smtp не поддерживает отмену.
+func (s *SMTPSender) Send(_ context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("smtp mail: invalid recipient: %w", err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(msg.Body)
+
+	return smtp.SendMail(s.addr, s.auth, s.from.Address, []string{to.Address}, buf.Bytes())
+}
@@ -0,0 +1,265 @@
+package messaging
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"painaway_test/internal/attachments"
+	"painaway_test/internal/blob"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/conversations/", rbac.RequirePermission(logger, rbac.PermMessagesUse), h.List)
+	rg.POST("/conversations/", rbac.RequirePermission(logger, rbac.PermMessagesUse), h.Open)
+	rg.GET("/conversations/:id/messages", rbac.RequirePermission(logger, rbac.PermMessagesUse), h.Messages)
+	rg.POST("/conversations/:id/messages", rbac.RequirePermission(logger, rbac.PermMessagesUse), h.Send)
+	rg.POST("/conversations/:id/read", rbac.RequirePermission(logger, rbac.PermMessagesUse), h.MarkRead)
+	rg.POST("/conversations/:id/close", rbac.RequirePermission(logger, rbac.PermMessagesUse), h.Close)
+	rg.GET("/conversations/attachments/:id", rbac.RequirePermission(logger, rbac.PermMessagesUse), h.DownloadAttachment)
+}
+
+func (h *Handler) List(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	convs, err := h.Service.List(userID.(uint))
+	if err != nil {
+		h.respondError(c, err, "failed to list conversations")
+		return
+	}
+	c.JSON(http.StatusOK, convs)
+}
+
+func (h *Handler) Open(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.OpenConversationDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	conv, err := h.Service.Open(userID.(uint), req.Link)
+	if err != nil {
+		h.respondError(c, err, "failed to open conversation")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToConversationDTO(*conv))
+}
+
+// Messages — GET /conversations/:id/messages?before_id=&limit=50, от новых к старым.
+func (h *Handler) Messages(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	convID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid conversation id", h.Logger)
+		return
+	}
+	var beforeID uint64
+	if v := c.Query("before_id"); v != "" {
+		if beforeID, err = strconv.ParseUint(v, 10, 32); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid before_id", h.Logger)
+			return
+		}
+	}
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid limit", h.Logger)
+			return
+		}
+	}
+
+	page, err := h.Service.Messages(userID.(uint), uint(convID), uint(beforeID), limit)
+	if err != nil {
+		h.respondError(c, err, "failed to get messages")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *Handler) Send(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	convID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid conversation id", h.Logger)
+		return
+	}
+
+	var body string
+	var files []FileInput
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		// запас на служебные части multipart
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFilesPerMessage*h.Service.Config.MaxFileSize+1<<20)
+		form, err := c.MultipartForm()
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				response.NewErrorResponse(c, http.StatusRequestEntityTooLarge, "request too large", h.Logger)
+				return
+			}
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid multipart form", h.Logger)
+			return
+		}
+		body = strings.Join(form.Value["body"], "\n")
+		for _, header := range form.File["files"] {
+			file, err := header.Open()
+			if err != nil {
+				response.NewErrorResponse(c, http.StatusBadRequest, "invalid file", h.Logger)
+				return
+			}
+			defer file.Close()
+			files = append(files, FileInput{Name: header.Filename, Reader: file})
+		}
+	} else {
+		var req utils.SendMessageDTO
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+			return
+		}
+		body = req.Body
+	}
+
+	msg, err := h.Service.Send(c.Request.Context(), userID.(uint), uint(convID), body, files)
+	if err != nil {
+		h.respondError(c, err, "failed to send message")
+		return
+	}
+
+	h.Logger.Info("message sent",
+		zap.Uint("userID", userID.(uint)),
+		zap.Uint("conversationID", msg.ConversationID),
+		zap.Uint("messageID", msg.ID),
+		zap.Int("attachments", len(msg.Attachments)))
+	c.JSON(http.StatusCreated, h.Service.ToMessageDTO(*msg))
+}
+
+func (h *Handler) MarkRead(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	convID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid conversation id", h.Logger)
+		return
+	}
+	var req utils.MarkReadDTO
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+			return
+		}
+	}
+
+	count, err := h.Service.MarkRead(userID.(uint), uint(convID), req.UpToID)
+	if err != nil {
+		h.respondError(c, err, "failed to mark messages read")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"marked": count})
+}
+
+func (h *Handler) Close(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	convID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid conversation id", h.Logger)
+		return
+	}
+
+	conv, err := h.Service.Close(userID.(uint), uint(convID))
+	if err != nil {
+		h.respondError(c, err, "failed to close conversation")
+		return
+	}
+
+	h.Logger.Info("conversation closed", zap.Uint("userID", userID.(uint)), zap.Uint("conversationID", conv.ID))
+	c.JSON(http.StatusOK, h.Service.ToConversationDTO(*conv))
+}
+
+func (h *Handler) DownloadAttachment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid attachment id", h.Logger)
+		return
+	}
+
+	attachment, rc, err := h.Service.OpenAttachment(c.Request.Context(), userID.(uint), uint(attachmentID))
+	if err != nil {
+		h.respondError(c, err, "failed to open attachment")
+		return
+	}
+	defer rc.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, rc); err != nil {
+		h.Logger.Warn("failed to stream attachment", zap.Uint64("attachmentID", attachmentID), zap.Error(err))
+	}
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, blob.ErrNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	case errors.Is(err, ErrConversationClosed), errors.Is(err, ErrLinkInactive):
+		response.NewErrorResponse(c, http.StatusConflict, err.Error(), h.Logger)
+	case errors.Is(err, attachments.ErrFileTooLarge):
+		response.NewErrorResponse(c, http.StatusRequestEntityTooLarge, "file too large", h.Logger)
+	case errors.Is(err, ErrInvalidMessage), errors.Is(err, attachments.ErrInvalidFile):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
@@ -0,0 +1,172 @@
+package messaging
+
+import (
+	"painaway_test/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	GetOrCreateConversation(conv *models.Conversation) (*models.Conversation, error)
+	GetConversationByID(id uint) (*models.Conversation, error)
+	GetConversationBySubscriptionID(subID uint) (*models.Conversation, error)
+	GetConversationsByUserID(userID uint) ([]models.Conversation, error)
+	CloseConversation(id uint, closedBy *uint, at time.Time) error
+	ReopenConversation(id uint) error
+	CreateMessage(msg *models.Message) error
+	GetMessages(convID, beforeID uint, limit int) ([]models.Message, error)
+	GetLastMessages(convIDs []uint) (map[uint]models.Message, error)
+	CountUnread(userID uint, convIDs []uint) (map[uint]int64, error)
+	MarkRead(convID, readerID, upToID uint, at time.Time) (int64, error)
+	GetMessageAttachmentByID(id uint) (*models.MessageAttachment, *models.Message, error)
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+// GetOrCreateConversation создаёт переписку по привязке или возвращает уже существующую.
+func (r *Repo) GetOrCreateConversation(conv *models.Conversation) (*models.Conversation, error) {
+	if err := r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subscription_id"}},
+		DoNothing: true,
+	}).Create(conv).Error; err != nil {
+		return nil, err
+	}
+	return r.GetConversationBySubscriptionID(conv.SubscriptionID)
+}
+
+func (r *Repo) GetConversationByID(id uint) (*models.Conversation, error) {
+	var conv models.Conversation
+	if err := r.DB.Preload("Doctor").Preload("Patient").Where("id = ?", id).First(&conv).Error; err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+func (r *Repo) GetConversationBySubscriptionID(subID uint) (*models.Conversation, error) {
+	var conv models.Conversation
+	if err := r.DB.Preload("Doctor").Preload("Patient").Where("subscription_id = ?", subID).First(&conv).Error; err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+func (r *Repo) GetConversationsByUserID(userID uint) ([]models.Conversation, error) {
+	var convs []models.Conversation
+	if err := r.DB.Preload("Doctor").Preload("Patient").
+		Where("doctor_id = ? OR patient_id = ?", userID, userID).
+		Order("last_message_at DESC NULLS LAST, id DESC").
+		Find(&convs).Error; err != nil {
+		return nil, err
+	}
+	return convs, nil
+}
+
+func (r *Repo) CloseConversation(id uint, closedBy *uint, at time.Time) error {
+	return r.DB.Model(&models.Conversation{}).
+		Where("id = ? AND closed_at IS NULL", id).
+		Updates(map[string]any{"closed_at": at, "closed_by_id": closedBy}).Error
+}
+
+// ReopenConversation снимает закрытие, пока привязка переписки принята; по завершённой
+// привязке переписка остаётся закрытой, даже если она завершилась параллельно.
+func (r *Repo) ReopenConversation(id uint) error {
+	return r.DB.Model(&models.Conversation{}).
+		Where("id = ? AND closed_at IS NOT NULL", id).
+		Where("EXISTS (SELECT 1 FROM subscriptions s WHERE s.id = conversations.subscription_id AND s.status = ?)", "accepted").
+		Updates(map[string]any{"closed_at": nil, "closed_by_id": nil}).Error
+}
+
+func (r *Repo) CreateMessage(msg *models.Message) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Conversation{}).
+			Where("id = ?", msg.ConversationID).
+			Update("last_message_at", msg.CreatedAt).Error
+	})
+}
+
+// GetMessages возвращает сообщения от новых к старым; beforeID = 0 — с самого нового.
+func (r *Repo) GetMessages(convID, beforeID uint, limit int) ([]models.Message, error) {
+	var msgs []models.Message
+	query := r.DB.Preload("Attachments").Where("conversation_id = ?", convID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	if err := query.Order("id DESC").Limit(limit).Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (r *Repo) GetLastMessages(convIDs []uint) (map[uint]models.Message, error) {
+	result := make(map[uint]models.Message)
+	if len(convIDs) == 0 {
+		return result, nil
+	}
+	var msgs []models.Message
+	if err := r.DB.Preload("Attachments").
+		Raw(`SELECT DISTINCT ON (conversation_id) * FROM messages
+			WHERE conversation_id IN ? ORDER BY conversation_id, id DESC`, convIDs).
+		Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		result[m.ConversationID] = m
+	}
+	return result, nil
+}
+
+func (r *Repo) CountUnread(userID uint, convIDs []uint) (map[uint]int64, error) {
+	result := make(map[uint]int64)
+	if len(convIDs) == 0 {
+		return result, nil
+	}
+	var rows []struct {
+		ConversationID uint
+		Count          int64
+	}
+	if err := r.DB.Model(&models.Message{}).
+		Select("conversation_id, COUNT(*) AS count").
+		Where("conversation_id IN ? AND sender_id <> ? AND read_at IS NULL", convIDs, userID).
+		Group("conversation_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.ConversationID] = row.Count
+	}
+	return result, nil
+}
+
+// MarkRead отмечает прочитанными входящие сообщения до upToID включительно (0 — все).
+func (r *Repo) MarkRead(convID, readerID, upToID uint, at time.Time) (int64, error) {
+	query := r.DB.Model(&models.Message{}).
+		Where("conversation_id = ? AND sender_id <> ? AND read_at IS NULL", convID, readerID)
+	if upToID > 0 {
+		query = query.Where("id <= ?", upToID)
+	}
+	res := query.Update("read_at", at)
+	return res.RowsAffected, res.Error
+}
+
+func (r *Repo) GetMessageAttachmentByID(id uint) (*models.MessageAttachment, *models.Message, error) {
+	var attachment models.MessageAttachment
+	if err := r.DB.Where("id = ?", id).First(&attachment).Error; err != nil {
+		return nil, nil, err
+	}
+	var msg models.Message
+	if err := r.DB.Where("id = ?", attachment.MessageID).First(&msg).Error; err != nil {
+		return nil, nil, err
+	}
+	return &attachment, &msg, nil
+}
@@ -0,0 +1,426 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"painaway_test/internal/attachments"
+	"painaway_test/internal/blob"
+	"painaway_test/internal/config"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/notifications"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	maxMessageLength   = 4000
+	maxFilesPerMessage = 5
+	defaultPageSize    = 50
+	maxPageSize        = 200
+
+	EventMessage            = "message"
+	EventMessagesRead       = "messages_read"
+	EventConversationClosed = "conversation_closed"
+)
+
+var (
+	ErrForbidden          = errors.New("access denied")
+	ErrInvalidMessage     = errors.New("invalid message")
+	ErrConversationClosed = errors.New("conversation is closed")
+	ErrLinkInactive       = errors.New("link is not accepted")
+)
+
+// FileInput — файл, прикреплённый к сообщению.
+type FileInput struct {
+	Name   string
+	Reader io.Reader
+}
+
+type Service struct {
+	Repo                 Repository
+	Storage              blob.Storage
+	Diary                *diary.Service
+	Hub                  *notifications.Hub
+	NotificationsService *notifications.Service
+	Config               *config.AttachmentsConfig
+	Logger               *zap.Logger
+}
+
+func NewService(repo Repository, storage blob.Storage, diarySrv *diary.Service, hub *notifications.Hub, notifSrv *notifications.Service, cfg *config.AttachmentsConfig, logger *zap.Logger) *Service {
+	return &Service{
+		Repo:                 repo,
+		Storage:              storage,
+		Diary:                diarySrv,
+		Hub:                  hub,
+		NotificationsService: notifSrv,
+		Config:               cfg,
+		Logger:               logger,
+	}
+}
+
+// Open возвращает переписку по привязке, создавая её при первом обращении.
+// Начать переписку можно только по принятой привязке; закрытая участником переписка
+// по действующей привязке открывается снова.
+func (s *Service) Open(userID, linkID uint) (*models.Conversation, error) {
+	link, err := s.Diary.GetParticipantLink(userID, linkID)
+	if err != nil {
+		return nil, mapDiaryError(err)
+	}
+	if link.Status != "accepted" {
+		conv, err := s.Repo.GetConversationBySubscriptionID(link.ID)
+		if err != nil {
+			return nil, ErrLinkInactive
+		}
+		return conv, nil
+	}
+	conv, err := s.Repo.GetOrCreateConversation(&models.Conversation{
+		SubscriptionID: link.ID,
+		DoctorID:       link.DoctorID,
+		PatientID:      link.PatientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if conv.ClosedAt == nil {
+		return conv, nil
+	}
+	if err := s.Repo.ReopenConversation(conv.ID); err != nil {
+		return nil, err
+	}
+	return s.Repo.GetConversationByID(conv.ID)
+}
+
+func (s *Service) List(userID uint) ([]utils.ConversationDTO, error) {
+	convs, err := s.Repo.GetConversationsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(convs))
+	for _, c := range convs {
+		ids = append(ids, c.ID)
+	}
+	last, err := s.Repo.GetLastMessages(ids)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := s.Repo.CountUnread(userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	dto := make([]utils.ConversationDTO, 0, len(convs))
+	for _, c := range convs {
+		item := s.ToConversationDTO(c)
+		if m, ok := last[c.ID]; ok {
+			msg := s.ToMessageDTO(m)
+			item.LastMessage = &msg
+		}
+		item.UnreadCount = unread[c.ID]
+		dto = append(dto, item)
+	}
+	return dto, nil
+}
+
+func (s *Service) Get(userID, convID uint) (*models.Conversation, error) {
+	conv, err := s.Repo.GetConversationByID(convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.DoctorID != userID && conv.PatientID != userID {
+		return nil, ErrForbidden
+	}
+	return conv, nil
+}
+
+func (s *Service) Messages(userID, convID, beforeID uint, limit int) (*utils.MessagePageDTO, error) {
+	if _, err := s.Get(userID, convID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	msgs, err := s.Repo.GetMessages(convID, beforeID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &utils.MessagePageDTO{Messages: make([]utils.MessageDTO, 0, len(msgs))}
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+		next := msgs[len(msgs)-1].ID
+		page.NextBeforeID = &next
+	}
+	for _, m := range msgs {
+		page.Messages = append(page.Messages, s.ToMessageDTO(m))
+	}
+	return page, nil
+}
+
+func (s *Service) Send(ctx context.Context, userID, convID uint, body string, files []FileInput) (*models.Message, error) {
+	conv, err := s.Get(userID, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.ClosedAt != nil {
+		return nil, ErrConversationClosed
+	}
+	link, err := s.Diary.GetParticipantLink(userID, conv.SubscriptionID)
+	if err != nil {
+		return nil, mapDiaryError(err)
+	}
+	if link.Status != "accepted" {
+		return nil, ErrLinkInactive
+	}
+
+	body = strings.TrimSpace(body)
+	if body == "" && len(files) == 0 {
+		return nil, fmt.Errorf("%w: message is empty", ErrInvalidMessage)
+	}
+	if utf8.RuneCountInString(body) > maxMessageLength {
+		return nil, fmt.Errorf("%w: message is longer than %d characters", ErrInvalidMessage, maxMessageLength)
+	}
+	if len(files) > maxFilesPerMessage {
+		return nil, fmt.Errorf("%w: at most %d files per message", ErrInvalidMessage, maxFilesPerMessage)
+	}
+
+	msg := &models.Message{ConversationID: conv.ID, SenderID: userID, Body: body}
+	for _, f := range files {
+		attachment, err := s.storeFile(ctx, conv.ID, f)
+		if err != nil {
+			s.removeBlobs(ctx, msg.Attachments)
+			return nil, err
+		}
+		msg.Attachments = append(msg.Attachments, *attachment)
+	}
+	if err := s.Repo.CreateMessage(msg); err != nil {
+		s.removeBlobs(ctx, msg.Attachments)
+		return nil, err
+	}
+
+	recipientID := conv.PatientID
+	sender := conv.Doctor
+	if userID == conv.PatientID {
+		recipientID = conv.DoctorID
+		sender = conv.Patient
+	}
+	s.deliver(recipientID, sender, msg)
+	return msg, nil
+}
+
+// deliver отправляет сообщение получателю в сокет; если он не подключён,
+// оставляет уведомление о новом сообщении.
+func (s *Service) deliver(recipientID uint, sender models.User, msg *models.Message) {
+	if s.Hub.Connected(recipientID) {
+		err := s.Hub.SendEvent(recipientID, EventMessage, s.ToMessageDTO(*msg))
+		if err == nil {
+			return
+		}
+		s.Logger.Warn("failed to push message", zap.Uint("messageID", msg.ID), zap.Error(err))
+	}
+	if err := s.NotificationsService.CreateNotification(
+		recipientID,
+		fmt.Sprintf("Новое сообщение от %s %s", sender.LastName, sender.FirstName),
+	); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("messageID", msg.ID),
+			zap.Uint("recipientID", recipientID),
+			zap.Error(err),
+		)
+	}
+}
+
+func (s *Service) storeFile(ctx context.Context, convID uint, f FileInput) (*models.MessageAttachment, error) {
+	data, err := io.ReadAll(io.LimitReader(f.Reader, s.Config.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.Config.MaxFileSize {
+		return nil, attachments.ErrFileTooLarge
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", attachments.ErrInvalidFile)
+	}
+	contentType, ext, err := attachments.DetectFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("messages/%d/%s%s", convID, attachments.RandomHex(16), ext)
+	if err := s.Storage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, err
+	}
+	return &models.MessageAttachment{
+		FileName:    attachments.SanitizeFileName(f.Name),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		StorageKey:  key,
+	}, nil
+}
+
+func (s *Service) removeBlobs(ctx context.Context, list []models.MessageAttachment) {
+	for _, a := range list {
+		if err := s.Storage.Delete(ctx, a.StorageKey); err != nil {
+			s.Logger.Warn("failed to delete blob", zap.String("key", a.StorageKey), zap.Error(err))
+		}
+	}
+}
+
+// MarkRead отмечает входящие сообщения прочитанными и сообщает об этом собеседнику.
+func (s *Service) MarkRead(userID, convID, upToID uint) (int64, error) {
+	conv, err := s.Get(userID, convID)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	count, err := s.Repo.MarkRead(conv.ID, userID, upToID, now)
+	if err != nil || count == 0 {
+		return count, err
+	}
+
+	otherID := conv.DoctorID
+	if userID == conv.DoctorID {
+		otherID = conv.PatientID
+	}
+	receipt := utils.MessagesReadDTO{ConversationID: conv.ID, ReaderID: userID, UpToID: upToID, ReadAt: now}
+	if err := s.Hub.SendEvent(otherID, EventMessagesRead, receipt); err != nil {
+		s.Logger.Warn("failed to push read receipt", zap.Uint("conversationID", conv.ID), zap.Error(err))
+	}
+	return count, nil
+}
+
+// Close закрывает переписку по запросу участника. Пока привязка принята,
+// любой из участников может открыть её снова через Open.
+func (s *Service) Close(userID, convID uint) (*models.Conversation, error) {
+	conv, err := s.Get(userID, convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.ClosedAt != nil {
+		return conv, nil
+	}
+	if err := s.close(conv, &userID); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// HandleLinkEnded закрывает переписку завершённой привязки.
+func (s *Service) HandleLinkEnded(link models.Subscription) {
+	if err := s.CloseByLink(link.ID); err != nil {
+		s.Logger.Error("failed to close conversation of ended link", zap.Uint("linkID", link.ID), zap.Error(err))
+	}
+}
+
+// CloseByLink закрывает переписку привязки, если она есть.
+func (s *Service) CloseByLink(linkID uint) error {
+	conv, err := s.Repo.GetConversationBySubscriptionID(linkID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if conv.ClosedAt != nil {
+		return nil
+	}
+	return s.close(conv, nil)
+}
+
+func (s *Service) close(conv *models.Conversation, closedBy *uint) error {
+	now := time.Now()
+	if err := s.Repo.CloseConversation(conv.ID, closedBy, now); err != nil {
+		return err
+	}
+	conv.ClosedAt = &now
+	conv.ClosedByID = closedBy
+
+	dto := s.ToConversationDTO(*conv)
+	for _, id := range []uint{conv.DoctorID, conv.PatientID} {
+		if closedBy != nil && id == *closedBy {
+			continue
+		}
+		if err := s.Hub.SendEvent(id, EventConversationClosed, dto); err != nil {
+			s.Logger.Warn("failed to push conversation close", zap.Uint("conversationID", conv.ID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// OpenAttachment отдаёт файл из сообщения участнику переписки. Закрыть reader должен вызывающий.
+func (s *Service) OpenAttachment(ctx context.Context, userID, attachmentID uint) (*models.MessageAttachment, io.ReadCloser, error) {
+	attachment, msg, err := s.Repo.GetMessageAttachmentByID(attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.Get(userID, msg.ConversationID); err != nil {
+		return nil, nil, err
+	}
+	rc, err := s.Storage.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, rc, nil
+}
+
+func mapDiaryError(err error) error {
+	if errors.Is(err, diary.ErrForbidden) {
+		return ErrForbidden
+	}
+	return err
+}
+
+func (s *Service) ToConversationDTO(c models.Conversation) utils.ConversationDTO {
+	return utils.ConversationDTO{
+		ID:     c.ID,
+		LinkID: c.SubscriptionID,
+		Doctor: utils.DoctorDTO{
+			ID:         c.Doctor.ID,
+			Username:   c.Doctor.Username,
+			LastName:   c.Doctor.LastName,
+			FirstName:  c.Doctor.FirstName,
+			FatherName: c.Doctor.FatherName,
+		},
+		Patient: utils.PatientDTO{
+			ID:          c.Patient.ID,
+			FirstName:   c.Patient.FirstName,
+			LastName:    c.Patient.LastName,
+			FatherName:  c.Patient.FatherName,
+			Sex:         c.Patient.Sex,
+			DateOfBirth: c.Patient.DateOfBirth.Format("02.01.2006"),
+		},
+		ClosedAt:  c.ClosedAt,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+func (s *Service) ToMessageDTO(m models.Message) utils.MessageDTO {
+	dto := utils.MessageDTO{
+		ID:             m.ID,
+		ConversationID: m.ConversationID,
+		SenderID:       m.SenderID,
+		Body:           m.Body,
+		Attachments:    make([]utils.MessageAttachmentDTO, 0, len(m.Attachments)),
+		ReadAt:         m.ReadAt,
+		CreatedAt:      m.CreatedAt,
+	}
+	for _, a := range m.Attachments {
+		dto.Attachments = append(dto.Attachments, utils.MessageAttachmentDTO{
+			ID:          a.ID,
+			FileName:    a.FileName,
+			ContentType: a.ContentType,
+			Size:        a.Size,
+			URL:         fmt.Sprintf("/api/conversations/attachments/%d", a.ID),
+		})
+	}
+	return dto
+}
@@ -2,6 +2,7 @@ package notifications
 
 import (
 	"net/http"
+	"painaway_test/internal/rbac"
 	"painaway_test/internal/response"
 
 	"github.com/gin-gonic/gin"
@@ -17,9 +18,10 @@ type Handler struct {
 
 func RegisterRoutes(rg *gin.RouterGroup, service *Service, hub *Hub, logger *zap.Logger) {
 	h := &Handler{Service: service, Logger: logger, Hub: hub}
-	rg.GET("/diary/notifications/", h.GetNotifications)
-	rg.PATCH("/diary/notifications/", h.MarkNotificationRead)
-	rg.DELETE("/diary/notifications/", h.DeleteNotification)
+	rg.GET("/diary/notifications/", rbac.RequirePermission(logger, rbac.PermNotificationsUse), h.GetNotifications)
+	rg.PATCH("/diary/notifications/", rbac.RequirePermission(logger, rbac.PermNotificationsUse), h.MarkNotificationRead)
+	rg.DELETE("/diary/notifications/", rbac.RequirePermission(logger, rbac.PermNotificationsUse), h.DeleteNotification)
+	rg.GET("/diary/notifications/ws", rbac.RequirePermission(logger, rbac.PermNotificationsUse), h.WsNotifications)
 }
 
 var upgrader = websocket.Upgrader{
@@ -8,8 +8,16 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// Event — сообщение в сокет, не являющееся уведомлением (новое сообщение в переписке,
+// отметка о прочтении и т.п.). Уведомления по-прежнему отправляются как есть.
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
 type Hub struct {
 	mu      sync.RWMutex
+	writeMu sync.Mutex               // websocket.Conn не допускает параллельной записи
 	clients map[uint]*websocket.Conn // userID → conn
 }
 
@@ -31,12 +39,30 @@ func (h *Hub) Unregister(userID uint) {
 	delete(h.clients, userID)
 }
 
+// Connected — подключён ли пользователь к сокету прямо сейчас.
+func (h *Hub) Connected(userID uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.clients[userID]
+	return ok
+}
+
 func (h *Hub) Send(userID uint, notification *models.Notification) error {
+	return h.SendJSON(userID, notification)
+}
+
+func (h *Hub) SendEvent(userID uint, eventType string, data any) error {
+	return h.SendJSON(userID, Event{Type: eventType, Data: data})
+}
+
+func (h *Hub) SendJSON(userID uint, v any) error {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	if conn, ok := h.clients[userID]; ok {
-		return conn.WriteJSON(notification)
+		h.writeMu.Lock()
+		defer h.writeMu.Unlock()
+		return conn.WriteJSON(v)
 	}
 	return nil
 }
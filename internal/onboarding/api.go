@@ -0,0 +1,278 @@
+package onboarding
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"painaway_test/internal/attachments"
+	"painaway_test/internal/blob"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.POST("/doctor_applications/", rbac.RequirePermission(logger, rbac.PermApplicationsSubmit), h.Submit)
+	rg.GET("/doctor_applications/", rbac.RequirePermission(logger, rbac.PermApplicationsSubmit), h.ListOwn)
+	rg.POST("/doctor_applications/:id/documents", rbac.RequirePermission(logger, rbac.PermApplicationsSubmit), h.UploadDocument)
+	rg.GET("/doctor_applications/:id/documents/:doc_id", rbac.RequirePermission(logger, rbac.PermApplicationsSubmit), h.DownloadOwnDocument)
+}
+
+// RegisterAdminRoutes регистрирует очередь заявок для администратора; права проверяются на каждом маршруте.
+func RegisterAdminRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/doctor_applications/", rbac.RequirePermission(logger, rbac.PermApplicationsReview), h.Queue)
+	rg.GET("/doctor_applications/:id", rbac.RequirePermission(logger, rbac.PermApplicationsReview), h.Get)
+	rg.GET("/doctor_applications/:id/documents/:doc_id", rbac.RequirePermission(logger, rbac.PermApplicationsReview), h.DownloadDocument)
+	rg.POST("/doctor_applications/:id/approve", rbac.RequirePermission(logger, rbac.PermApplicationsReview), h.Approve)
+	rg.POST("/doctor_applications/:id/reject", rbac.RequirePermission(logger, rbac.PermApplicationsReview), h.Reject)
+}
+
+func (h *Handler) Submit(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.DoctorApplicationInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	app, err := h.Service.Submit(userID.(uint), req)
+	if err != nil {
+		h.respondError(c, err, "failed to submit application")
+		return
+	}
+
+	h.Logger.Info("doctor application submitted", zap.Uint("userID", app.UserID), zap.Uint("applicationID", app.ID))
+	c.JSON(http.StatusCreated, h.Service.ToApplicationDTO([]models.DoctorApplication{*app}, false)[0])
+}
+
+func (h *Handler) ListOwn(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	apps, err := h.Service.ListOwn(userID.(uint))
+	if err != nil {
+		h.respondError(c, err, "failed to list applications")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToApplicationDTO(apps, false))
+}
+
+// UploadDocument — POST /doctor_applications/:id/documents, multipart-поле "file".
+func (h *Handler) UploadDocument(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	appID, ok := h.parseID(c, "id", "invalid application id")
+	if !ok {
+		return
+	}
+
+	// запас на служебные части multipart
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.Service.Config.MaxFileSize+1<<20)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			response.NewErrorResponse(c, http.StatusRequestEntityTooLarge, "file too large", h.Logger)
+			return
+		}
+		response.NewErrorResponse(c, http.StatusBadRequest, "multipart field \"file\" is required", h.Logger)
+		return
+	}
+	defer file.Close()
+
+	doc, err := h.Service.AddDocument(c.Request.Context(), userID.(uint), appID, header.Filename, file)
+	if err != nil {
+		h.respondError(c, err, "failed to upload document")
+		return
+	}
+
+	h.Logger.Info("application document uploaded",
+		zap.Uint("userID", userID.(uint)),
+		zap.Uint("applicationID", appID),
+		zap.Uint("documentID", doc.ID))
+	c.JSON(http.StatusCreated, utils.DoctorApplicationDocumentDTO{
+		ID:          doc.ID,
+		FileName:    doc.FileName,
+		ContentType: doc.ContentType,
+		Size:        doc.Size,
+		CreatedAt:   doc.CreatedAt,
+	})
+}
+
+func (h *Handler) DownloadOwnDocument(c *gin.Context) {
+	h.serveDocument(c, false)
+}
+
+func (h *Handler) DownloadDocument(c *gin.Context) {
+	h.serveDocument(c, true)
+}
+
+func (h *Handler) serveDocument(c *gin.Context, reviewer bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	appID, ok := h.parseID(c, "id", "invalid application id")
+	if !ok {
+		return
+	}
+	docID, ok := h.parseID(c, "doc_id", "invalid document id")
+	if !ok {
+		return
+	}
+
+	doc, rc, err := h.Service.OpenDocument(c.Request.Context(), userID.(uint), reviewer, appID, docID)
+	if err != nil {
+		h.respondError(c, err, "failed to open document")
+		return
+	}
+	defer rc.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(doc.ContentType, "image/") {
+		disposition = "inline"
+	}
+	c.Header("Content-Type", doc.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": doc.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, no-store")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, rc); err != nil {
+		h.Logger.Warn("failed to stream document", zap.Uint("documentID", docID), zap.Error(err))
+	}
+}
+
+// Queue — GET /admin/doctor_applications/?status=&offset=&limit=, по умолчанию заявки на рассмотрении.
+func (h *Handler) Queue(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid offset", h.Logger)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid limit", h.Logger)
+		return
+	}
+
+	page, err := h.Service.Queue(c.Query("status"), offset, limit)
+	if err != nil {
+		h.respondError(c, err, "failed to list applications")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *Handler) Get(c *gin.Context) {
+	appID, ok := h.parseID(c, "id", "invalid application id")
+	if !ok {
+		return
+	}
+
+	app, err := h.Service.Get(appID)
+	if err != nil {
+		h.respondError(c, err, "failed to get application")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToApplicationDTO([]models.DoctorApplication{*app}, true)[0])
+}
+
+func (h *Handler) Approve(c *gin.Context) {
+	h.review(c, true)
+}
+
+func (h *Handler) Reject(c *gin.Context) {
+	h.review(c, false)
+}
+
+func (h *Handler) review(c *gin.Context, approve bool) {
+	reviewerID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	appID, ok := h.parseID(c, "id", "invalid application id")
+	if !ok {
+		return
+	}
+	var req utils.ReviewApplicationDTO
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+			return
+		}
+	}
+
+	var (
+		app *models.DoctorApplication
+		err error
+	)
+	if approve {
+		app, err = h.Service.Approve(reviewerID.(uint), appID, req.Note)
+	} else {
+		app, err = h.Service.Reject(reviewerID.(uint), appID, req.Note)
+	}
+	if err != nil {
+		h.respondError(c, err, "failed to review application")
+		return
+	}
+
+	h.Logger.Info("doctor application reviewed",
+		zap.Uint("reviewerID", reviewerID.(uint)),
+		zap.Uint("applicationID", app.ID),
+		zap.String("status", app.Status))
+	c.JSON(http.StatusOK, h.Service.ToApplicationDTO([]models.DoctorApplication{*app}, true)[0])
+}
+
+func (h *Handler) parseID(c *gin.Context, param, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, message, h.Logger)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, blob.ErrNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	case errors.Is(err, ErrAlreadyDoctor), errors.Is(err, ErrApplicationExists), errors.Is(err, ErrNotPending):
+		response.NewErrorResponse(c, http.StatusConflict, err.Error(), h.Logger)
+	case errors.Is(err, attachments.ErrFileTooLarge):
+		response.NewErrorResponse(c, http.StatusRequestEntityTooLarge, "file too large", h.Logger)
+	case errors.Is(err, ErrInvalidApplication), errors.Is(err, ErrTooManyDocuments), errors.Is(err, attachments.ErrInvalidFile):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
@@ -0,0 +1,162 @@
+package onboarding
+
+import (
+	"painaway_test/internal/rbac"
+	"painaway_test/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	CreateApplication(app *models.DoctorApplication) error
+	GetApplicationByID(id uint) (*models.DoctorApplication, error)
+	GetApplicationsByUserID(userID uint) ([]models.DoctorApplication, error)
+	HasPendingApplication(userID uint) (bool, error)
+	ListApplications(status string, offset, limit int) ([]models.DoctorApplication, int64, error)
+	CountDocuments(applicationID uint) (int64, error)
+	CreateDocument(doc *models.DoctorApplicationDocument) error
+	GetDocument(applicationID, documentID uint) (*models.DoctorApplicationDocument, error)
+	Approve(app *models.DoctorApplication, reviewerID uint, note string, now time.Time) (bool, error)
+	Reject(app *models.DoctorApplication, reviewerID uint, note string, now time.Time) (bool, error)
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+func (r *Repo) CreateApplication(app *models.DoctorApplication) error {
+	return r.DB.Omit("User").Create(app).Error
+}
+
+func (r *Repo) GetApplicationByID(id uint) (*models.DoctorApplication, error) {
+	var app models.DoctorApplication
+	if err := r.DB.Preload("User").Preload("Documents", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("id = ?", id).First(&app).Error; err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// GetApplicationsByUserID — заявки пользователя, новые первыми.
+func (r *Repo) GetApplicationsByUserID(userID uint) ([]models.DoctorApplication, error) {
+	var apps []models.DoctorApplication
+	if err := r.DB.Preload("Documents", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&apps).Error; err != nil {
+		return nil, err
+	}
+	return apps, nil
+}
+
+func (r *Repo) HasPendingApplication(userID uint) (bool, error) {
+	var count int64
+	if err := r.DB.Model(&models.DoctorApplication{}).
+		Where("user_id = ? AND status = ?", userID, ApplicationPending).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListApplications — очередь заявок: старые первыми, чтобы рассматривать по порядку подачи.
+func (r *Repo) ListApplications(status string, offset, limit int) ([]models.DoctorApplication, int64, error) {
+	query := r.DB.Model(&models.DoctorApplication{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var apps []models.DoctorApplication
+	if err := query.Preload("User").Preload("Documents", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Order("created_at, id").Offset(offset).Limit(limit).Find(&apps).Error; err != nil {
+		return nil, 0, err
+	}
+	return apps, total, nil
+}
+
+func (r *Repo) CountDocuments(applicationID uint) (int64, error) {
+	var count int64
+	if err := r.DB.Model(&models.DoctorApplicationDocument{}).
+		Where("application_id = ?", applicationID).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *Repo) CreateDocument(doc *models.DoctorApplicationDocument) error {
+	return r.DB.Create(doc).Error
+}
+
+func (r *Repo) GetDocument(applicationID, documentID uint) (*models.DoctorApplicationDocument, error) {
+	var doc models.DoctorApplicationDocument
+	if err := r.DB.Where("id = ? AND application_id = ?", documentID, applicationID).First(&doc).Error; err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Approve одобряет заявку, выдаёт роль врача, отзывает токены пользователя и заводит
+// карточку в каталоге по данным заявки. false — заявку уже рассмотрели.
+func (r *Repo) Approve(app *models.DoctorApplication, reviewerID uint, note string, now time.Time) (bool, error) {
+	approved := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := review(tx, app.ID, ApplicationApproved, reviewerID, note, now)
+		if err != nil || !ok {
+			return err
+		}
+		if err := rbac.GrantRole(tx, app.UserID, rbac.RoleDoctor); err != nil {
+			return err
+		}
+		// роли зашиты в токен: отзываем выданные, чтобы новая роль вступила в силу при входе
+		if err := tx.Model(&models.User{}).Where("id = ?", app.UserID).
+			UpdateColumn("session_version", gorm.Expr("session_version + 1")).Error; err != nil {
+			return err
+		}
+		// карточку, которую врач уже заполнил раньше, не трогаем
+		profile := &models.DoctorProfile{
+			UserID:               app.UserID,
+			Specialty:            app.Specialty,
+			Clinic:               app.Clinic,
+			Languages:            []string{},
+			AcceptingNewPatients: true,
+		}
+		if err := tx.Omit("User").Clauses(clause.OnConflict{DoNothing: true}).Create(profile).Error; err != nil {
+			return err
+		}
+		approved = true
+		return nil
+	})
+	return approved, err
+}
+
+func (r *Repo) Reject(app *models.DoctorApplication, reviewerID uint, note string, now time.Time) (bool, error) {
+	return review(r.DB, app.ID, ApplicationRejected, reviewerID, note, now)
+}
+
+// review переводит заявку из pending в status; условие на статус защищает от
+// двух одновременных решений по одной заявке.
+func review(db *gorm.DB, id uint, status string, reviewerID uint, note string, now time.Time) (bool, error) {
+	res := db.Model(&models.DoctorApplication{}).
+		Where("id = ? AND status = ?", id, ApplicationPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewer_id": reviewerID,
+			"review_note": note,
+			"reviewed_at": now,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
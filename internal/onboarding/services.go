@@ -0,0 +1,302 @@
+package onboarding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"painaway_test/internal/attachments"
+	"painaway_test/internal/blob"
+	"painaway_test/internal/config"
+	"painaway_test/internal/notifications"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Статусы заявки на роль врача.
+const (
+	ApplicationPending  = "pending"
+	ApplicationApproved = "approved"
+	ApplicationRejected = "rejected"
+)
+
+const (
+	maxDocuments       = 10
+	maxLicenseLength   = 64
+	maxSpecialtyLength = 100
+	maxCommentLength   = 2000
+	defaultQueueLimit  = 20
+	maxQueueLimit      = 100
+)
+
+var (
+	ErrForbidden          = errors.New("access denied")
+	ErrInvalidApplication = errors.New("invalid application")
+	ErrAlreadyDoctor      = errors.New("user is already a doctor")
+	ErrApplicationExists  = errors.New("application is already under review")
+	ErrNotPending         = errors.New("application is already reviewed")
+	ErrTooManyDocuments   = errors.New("too many documents")
+)
+
+type Service struct {
+	Repo                 Repository
+	Storage              blob.Storage
+	Roles                *rbac.Service
+	NotificationsService *notifications.Service
+	Config               *config.AttachmentsConfig
+	Logger               *zap.Logger
+}
+
+func NewService(repo Repository, storage blob.Storage, roles *rbac.Service, notifSrv *notifications.Service, cfg *config.AttachmentsConfig, logger *zap.Logger) *Service {
+	return &Service{
+		Repo:                 repo,
+		Storage:              storage,
+		Roles:                roles,
+		NotificationsService: notifSrv,
+		Config:               cfg,
+		Logger:               logger,
+	}
+}
+
+// Submit подаёт заявку на роль врача. Документы прикладываются к заявке отдельно.
+func (s *Service) Submit(userID uint, input utils.DoctorApplicationInputDTO) (*models.DoctorApplication, error) {
+	roles, err := s.Roles.UserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if role == rbac.RoleDoctor {
+			return nil, ErrAlreadyDoctor
+		}
+	}
+	pending, err := s.Repo.HasPendingApplication(userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrApplicationExists
+	}
+
+	app := &models.DoctorApplication{
+		UserID:        userID,
+		LicenseNumber: strings.TrimSpace(input.LicenseNumber),
+		Specialty:     strings.TrimSpace(input.Specialty),
+		Clinic:        strings.TrimSpace(input.Clinic),
+		Comment:       strings.TrimSpace(input.Comment),
+		Status:        ApplicationPending,
+	}
+	switch {
+	case app.LicenseNumber == "":
+		return nil, fmt.Errorf("%w: license_number is required", ErrInvalidApplication)
+	case utf8.RuneCountInString(app.LicenseNumber) > maxLicenseLength:
+		return nil, fmt.Errorf("%w: license_number is too long", ErrInvalidApplication)
+	case app.Specialty == "":
+		return nil, fmt.Errorf("%w: specialty is required", ErrInvalidApplication)
+	case utf8.RuneCountInString(app.Specialty) > maxSpecialtyLength:
+		return nil, fmt.Errorf("%w: specialty is too long", ErrInvalidApplication)
+	case utf8.RuneCountInString(app.Comment) > maxCommentLength:
+		return nil, fmt.Errorf("%w: comment is too long", ErrInvalidApplication)
+	}
+
+	if err := s.Repo.CreateApplication(app); err != nil {
+		return nil, err
+	}
+	app.Documents = []models.DoctorApplicationDocument{}
+	return app, nil
+}
+
+func (s *Service) ListOwn(userID uint) ([]models.DoctorApplication, error) {
+	return s.Repo.GetApplicationsByUserID(userID)
+}
+
+// AddDocument прикладывает документ к своей заявке, пока она на рассмотрении.
+func (s *Service) AddDocument(ctx context.Context, userID, applicationID uint, fileName string, r io.Reader) (*models.DoctorApplicationDocument, error) {
+	app, err := s.Repo.GetApplicationByID(applicationID)
+	if err != nil {
+		return nil, err
+	}
+	if app.UserID != userID {
+		return nil, ErrForbidden
+	}
+	if app.Status != ApplicationPending {
+		return nil, ErrNotPending
+	}
+	count, err := s.Repo.CountDocuments(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxDocuments {
+		return nil, ErrTooManyDocuments
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, s.Config.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.Config.MaxFileSize {
+		return nil, attachments.ErrFileTooLarge
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", attachments.ErrInvalidFile)
+	}
+	contentType, ext, err := attachments.DetectFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("doctor_applications/%d/%s%s", app.ID, attachments.RandomHex(16), ext)
+	if err := s.Storage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, err
+	}
+	doc := &models.DoctorApplicationDocument{
+		ApplicationID: app.ID,
+		FileName:      attachments.SanitizeFileName(fileName),
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		StorageKey:    key,
+	}
+	if err := s.Repo.CreateDocument(doc); err != nil {
+		if delErr := s.Storage.Delete(ctx, key); delErr != nil {
+			s.Logger.Warn("failed to remove orphaned document", zap.String("key", key), zap.Error(delErr))
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// OpenDocument отдаёт документ заявки её автору или проверяющему. Закрыть reader должен вызывающий.
+func (s *Service) OpenDocument(ctx context.Context, userID uint, reviewer bool, applicationID, documentID uint) (*models.DoctorApplicationDocument, io.ReadCloser, error) {
+	app, err := s.Repo.GetApplicationByID(applicationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !reviewer && app.UserID != userID {
+		return nil, nil, ErrForbidden
+	}
+	doc, err := s.Repo.GetDocument(app.ID, documentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := s.Storage.Get(ctx, doc.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, rc, nil
+}
+
+// Queue — заявки со статусом status (по умолчанию на рассмотрении) для администратора.
+func (s *Service) Queue(status string, offset, limit int) (*utils.DoctorApplicationPageDTO, error) {
+	if status == "" {
+		status = ApplicationPending
+	}
+	if status != ApplicationPending && status != ApplicationApproved && status != ApplicationRejected {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidApplication, status)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidApplication)
+	}
+	if limit <= 0 {
+		limit = defaultQueueLimit
+	}
+	if limit > maxQueueLimit {
+		limit = maxQueueLimit
+	}
+	apps, total, err := s.Repo.ListApplications(status, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.DoctorApplicationPageDTO{Items: s.ToApplicationDTO(apps, true), Total: total, Offset: offset, Limit: limit}, nil
+}
+
+func (s *Service) Get(applicationID uint) (*models.DoctorApplication, error) {
+	return s.Repo.GetApplicationByID(applicationID)
+}
+
+// Approve одобряет заявку: пользователь получает роль врача и уведомление.
+// Новая роль попадает в токен при следующем входе.
+func (s *Service) Approve(reviewerID, applicationID uint, note string) (*models.DoctorApplication, error) {
+	app, err := s.Repo.GetApplicationByID(applicationID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.Repo.Approve(app, reviewerID, strings.TrimSpace(note), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotPending
+	}
+	s.notify(app.UserID, "Заявка на роль врача одобрена. Сеансы на всех устройствах завершены — войдите снова, чтобы открыть кабинет врача")
+	return s.Repo.GetApplicationByID(app.ID)
+}
+
+func (s *Service) Reject(reviewerID, applicationID uint, note string) (*models.DoctorApplication, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return nil, fmt.Errorf("%w: note is required when rejecting", ErrInvalidApplication)
+	}
+	app, err := s.Repo.GetApplicationByID(applicationID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.Repo.Reject(app, reviewerID, note, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotPending
+	}
+	s.notify(app.UserID, "Заявка на роль врача отклонена: "+note)
+	return s.Repo.GetApplicationByID(app.ID)
+}
+
+func (s *Service) notify(userID uint, message string) {
+	if err := s.NotificationsService.CreateNotification(userID, message); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("userID", userID),
+			zap.Error(err),
+		)
+	}
+}
+
+// ToApplicationDTO; withApplicant добавляет имя и почту заявителя для проверяющего.
+func (s *Service) ToApplicationDTO(apps []models.DoctorApplication, withApplicant bool) []utils.DoctorApplicationDTO {
+	result := make([]utils.DoctorApplicationDTO, 0, len(apps))
+	for _, app := range apps {
+		dto := utils.DoctorApplicationDTO{
+			ID:            app.ID,
+			UserID:        app.UserID,
+			LicenseNumber: app.LicenseNumber,
+			Specialty:     app.Specialty,
+			Clinic:        app.Clinic,
+			Comment:       app.Comment,
+			Status:        app.Status,
+			ReviewNote:    app.ReviewNote,
+			ReviewedAt:    app.ReviewedAt,
+			CreatedAt:     app.CreatedAt,
+			Documents:     make([]utils.DoctorApplicationDocumentDTO, 0, len(app.Documents)),
+		}
+		if withApplicant {
+			dto.ApplicantName = strings.TrimSpace(app.User.LastName + " " + app.User.FirstName + " " + app.User.FatherName)
+			dto.ApplicantEmail = app.User.Email
+		}
+		for _, doc := range app.Documents {
+			dto.Documents = append(dto.Documents, utils.DoctorApplicationDocumentDTO{
+				ID:          doc.ID,
+				FileName:    doc.FileName,
+				ContentType: doc.ContentType,
+				Size:        doc.Size,
+				CreatedAt:   doc.CreatedAt,
+			})
+		}
+		result = append(result, dto)
+	}
+	return result
+}
@@ -0,0 +1,231 @@
+package questionnaires
+
+import (
+	"errors"
+	"net/http"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/questionnaires/", rbac.RequirePermission(logger, rbac.PermQuestionnairesRead), h.ListDefinitions)
+	rg.GET("/questionnaires/definitions/:code", rbac.RequirePermission(logger, rbac.PermQuestionnairesRead), h.GetDefinition)
+	rg.POST("/questionnaires/assignments", rbac.RequirePermission(logger, rbac.PermQuestionnairesAssign), h.Assign)
+	rg.GET("/questionnaires/assignments", rbac.RequirePermission(logger, rbac.PermQuestionnairesRead), h.ListAssignments)
+	rg.PATCH("/questionnaires/assignments/:id", rbac.RequirePermission(logger, rbac.PermQuestionnairesAssign), h.UpdateAssignment)
+	rg.POST("/questionnaires/assignments/:id/responses", rbac.RequirePermission(logger, rbac.PermQuestionnairesAnswer), h.Submit)
+	rg.GET("/questionnaires/assignments/:id/responses", rbac.RequirePermission(logger, rbac.PermQuestionnairesRead), h.ListResponses)
+	rg.GET("/diary/analytics/questionnaires", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.Trends)
+}
+
+func (h *Handler) ListDefinitions(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Service.ListDefinitions())
+}
+
+// GetDefinition — GET /questionnaires/definitions/:code?version=N, без version — последняя версия.
+func (h *Handler) GetDefinition(c *gin.Context) {
+	version := 0
+	if versionStr := c.Query("version"); versionStr != "" {
+		parsed, err := strconv.Atoi(versionStr)
+		if err != nil || parsed < 1 {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid version", h.Logger)
+			return
+		}
+		version = parsed
+	}
+
+	def, err := h.Service.GetDefinition(c.Param("code"), version)
+	if err != nil {
+		h.respondError(c, err, "failed to fetch questionnaire")
+		return
+	}
+	c.JSON(http.StatusOK, def)
+}
+
+func (h *Handler) Assign(c *gin.Context) {
+	doctorID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.QuestionnaireAssignmentInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	a, err := h.Service.Assign(doctorID.(uint), req)
+	if err != nil {
+		h.respondError(c, err, "failed to assign questionnaire")
+		return
+	}
+	h.Logger.Info("questionnaire assigned",
+		zap.Uint("doctorID", doctorID.(uint)),
+		zap.Uint("patientID", a.PatientID),
+		zap.String("code", a.Code))
+
+	dto, err := h.Service.toAssignmentDTO([]models.QuestionnaireAssignment{*a})
+	if err != nil {
+		h.respondError(c, err, "failed to assign questionnaire")
+		return
+	}
+	c.JSON(http.StatusCreated, dto[0])
+}
+
+// ListAssignments — GET /questionnaires/assignments?link=ID; без link — назначения текущего пациента.
+func (h *Handler) ListAssignments(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var linkID uint64
+	if linkStr := c.Query("link"); linkStr != "" {
+		parsed, err := strconv.ParseUint(linkStr, 10, 32)
+		if err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid link query parameter", h.Logger)
+			return
+		}
+		linkID = parsed
+	}
+
+	assignments, err := h.Service.ListAssignments(userID.(uint), uint(linkID))
+	if err != nil {
+		h.respondError(c, err, "failed to list questionnaire assignments")
+		return
+	}
+	c.JSON(http.StatusOK, assignments)
+}
+
+func (h *Handler) UpdateAssignment(c *gin.Context) {
+	doctorID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid assignment id", h.Logger)
+		return
+	}
+	var req utils.QuestionnaireAssignmentInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	a, err := h.Service.UpdateAssignment(doctorID.(uint), uint(id), req)
+	if err != nil {
+		h.respondError(c, err, "failed to update questionnaire assignment")
+		return
+	}
+	dto, err := h.Service.toAssignmentDTO([]models.QuestionnaireAssignment{*a})
+	if err != nil {
+		h.respondError(c, err, "failed to update questionnaire assignment")
+		return
+	}
+	c.JSON(http.StatusOK, dto[0])
+}
+
+func (h *Handler) Submit(c *gin.Context) {
+	patientID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid assignment id", h.Logger)
+		return
+	}
+	var req utils.QuestionnaireSubmitDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	resp, err := h.Service.Submit(patientID.(uint), uint(id), req.Answers)
+	if err != nil {
+		h.respondError(c, err, "failed to submit questionnaire")
+		return
+	}
+	h.Logger.Info("questionnaire submitted",
+		zap.Uint("patientID", patientID.(uint)),
+		zap.Uint("assignmentID", resp.AssignmentID),
+		zap.Uint("responseID", resp.ID))
+	c.JSON(http.StatusCreated, h.Service.ToResponseDTO([]models.QuestionnaireResponse{*resp})[0])
+}
+
+func (h *Handler) ListResponses(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid assignment id", h.Logger)
+		return
+	}
+
+	responses, err := h.Service.ListResponses(userID.(uint), uint(id))
+	if err != nil {
+		h.respondError(c, err, "failed to list questionnaire responses")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToResponseDTO(responses))
+}
+
+// Trends — GET /diary/analytics/questionnaires?patient_id=&code=&from=&to=
+func (h *Handler) Trends(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	patientID := userID.(uint)
+	if idStr := c.Query("patient_id"); idStr != "" {
+		parsed, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid patient id", h.Logger)
+			return
+		}
+		patientID = uint(parsed)
+	}
+
+	trends, err := h.Service.Trends(userID.(uint), patientID, c.Query("code"), c.Query("from"), c.Query("to"))
+	if err != nil {
+		h.respondError(c, err, "failed to fetch questionnaire analytics")
+		return
+	}
+	c.JSON(http.StatusOK, trends)
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, ErrUnknown):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	case errors.Is(err, ErrNotDue), errors.Is(err, ErrAssignmentInactive):
+		response.NewErrorResponse(c, http.StatusConflict, err.Error(), h.Logger)
+	case errors.Is(err, ErrInvalidAssignment), errors.Is(err, ErrInvalidAnswers), errors.Is(err, ErrInvalidPeriod):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
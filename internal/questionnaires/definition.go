@@ -0,0 +1,325 @@
+package questionnaires
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"painaway_test/models"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Встроенные определения опросников. Каждый файл — одна версия одного опросника;
+// старые версии не удаляются, чтобы ответы, собранные по ним, оставались сопоставимыми.
+//
+//go:embed definitions/*.yaml
+var builtinDefinitions embed.FS
+
+const (
+	ItemChoice = "choice" // один вариант из options
+	ItemScale  = "scale"  // целое число от min до max
+
+	ScoreSum     = "sum"     // сумма ответов
+	ScoreMean    = "mean"    // среднее по отвеченным пунктам
+	ScorePercent = "percent" // сумма в процентах от максимума по отвеченным пунктам
+)
+
+var codeRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+type Definition struct {
+	Code        string  `yaml:"code" json:"code"`
+	Version     int     `yaml:"version" json:"version"`
+	Title       string  `yaml:"title" json:"title"`
+	Description string  `yaml:"description" json:"description,omitempty"`
+	Items       []Item  `yaml:"items" json:"items"`
+	Scores      []Score `yaml:"scores" json:"scores"`
+}
+
+type Item struct {
+	ID       string   `yaml:"id" json:"id"`
+	Text     string   `yaml:"text" json:"text"`
+	Type     string   `yaml:"type" json:"type"`
+	Options  []Option `yaml:"options" json:"options,omitempty"`
+	Min      int      `yaml:"min" json:"min,omitempty"`
+	Max      int      `yaml:"max" json:"max,omitempty"`
+	MinLabel string   `yaml:"min_label" json:"min_label,omitempty"`
+	MaxLabel string   `yaml:"max_label" json:"max_label,omitempty"`
+	Required bool     `yaml:"required" json:"required"`
+}
+
+type Option struct {
+	Value int    `yaml:"value" json:"value"`
+	Label string `yaml:"label" json:"label"`
+}
+
+// Score — правило подсчёта одной шкалы опросника.
+type Score struct {
+	ID    string   `yaml:"id" json:"id"`
+	Label string   `yaml:"label" json:"label"`
+	Items []string `yaml:"items" json:"items"`
+	// Method — sum / mean / percent
+	Method string `yaml:"method" json:"method"`
+	// MinAnswered — сколько пунктов шкалы должно быть отвечено, иначе шкала не считается
+	MinAnswered int    `yaml:"min_answered" json:"min_answered"`
+	Bands       []Band `yaml:"bands" json:"bands,omitempty"`
+}
+
+// Band — интерпретация значения шкалы, границы включительные.
+type Band struct {
+	Min   float64 `yaml:"min" json:"min"`
+	Max   float64 `yaml:"max" json:"max"`
+	Label string  `yaml:"label" json:"label"`
+}
+
+func (d *Definition) item(id string) *Item {
+	for i := range d.Items {
+		if d.Items[i].ID == id {
+			return &d.Items[i]
+		}
+	}
+	return nil
+}
+
+func (it *Item) bounds() (int, int) {
+	if it.Type == ItemScale {
+		return it.Min, it.Max
+	}
+	lo, hi := math.MaxInt, math.MinInt
+	for _, o := range it.Options {
+		lo = min(lo, o.Value)
+		hi = max(hi, o.Value)
+	}
+	return lo, hi
+}
+
+func (it *Item) accepts(value float64) bool {
+	if value != math.Trunc(value) {
+		return false
+	}
+	v := int(value)
+	if it.Type == ItemScale {
+		return v >= it.Min && v <= it.Max
+	}
+	for _, o := range it.Options {
+		if o.Value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Definition) validate() error {
+	if !codeRe.MatchString(d.Code) {
+		return fmt.Errorf("invalid code %q", d.Code)
+	}
+	if d.Version < 1 {
+		return fmt.Errorf("%s: version must be positive", d.Code)
+	}
+	if d.Title == "" || len(d.Items) == 0 || len(d.Scores) == 0 {
+		return fmt.Errorf("%s v%d: title, items and scores are required", d.Code, d.Version)
+	}
+
+	seen := make(map[string]bool, len(d.Items))
+	for _, it := range d.Items {
+		if it.ID == "" || seen[it.ID] {
+			return fmt.Errorf("%s v%d: empty or duplicate item id %q", d.Code, d.Version, it.ID)
+		}
+		seen[it.ID] = true
+		switch it.Type {
+		case ItemChoice:
+			if len(it.Options) < 2 {
+				return fmt.Errorf("%s v%d: item %s needs at least two options", d.Code, d.Version, it.ID)
+			}
+		case ItemScale:
+			if it.Min >= it.Max {
+				return fmt.Errorf("%s v%d: item %s has empty range", d.Code, d.Version, it.ID)
+			}
+		default:
+			return fmt.Errorf("%s v%d: item %s has unknown type %q", d.Code, d.Version, it.ID, it.Type)
+		}
+	}
+
+	for _, sc := range d.Scores {
+		if sc.ID == "" || len(sc.Items) == 0 {
+			return fmt.Errorf("%s v%d: score needs id and items", d.Code, d.Version)
+		}
+		switch sc.Method {
+		case ScoreSum, ScoreMean, ScorePercent:
+		default:
+			return fmt.Errorf("%s v%d: score %s has unknown method %q", d.Code, d.Version, sc.ID, sc.Method)
+		}
+		for _, id := range sc.Items {
+			if !seen[id] {
+				return fmt.Errorf("%s v%d: score %s references unknown item %s", d.Code, d.Version, sc.ID, id)
+			}
+		}
+		if sc.MinAnswered > len(sc.Items) {
+			return fmt.Errorf("%s v%d: score %s min_answered exceeds item count", d.Code, d.Version, sc.ID)
+		}
+	}
+	return nil
+}
+
+// CheckAnswers проверяет ответы пациента: известные пункты, допустимые значения, обязательные пункты.
+func (d *Definition) CheckAnswers(answers map[string]float64) error {
+	for id, value := range answers {
+		it := d.item(id)
+		if it == nil {
+			return fmt.Errorf("unknown item %s", id)
+		}
+		if !it.accepts(value) {
+			return fmt.Errorf("invalid answer for item %s", id)
+		}
+	}
+	for _, it := range d.Items {
+		if _, ok := answers[it.ID]; it.Required && !ok {
+			return fmt.Errorf("item %s is required", it.ID)
+		}
+	}
+	return nil
+}
+
+// Calculate считает все шкалы опросника по ответам.
+func (d *Definition) Calculate(answers map[string]float64) []models.QuestionnaireScore {
+	results := make([]models.QuestionnaireScore, 0, len(d.Scores))
+	for _, sc := range d.Scores {
+		result := models.QuestionnaireScore{ID: sc.ID, Label: sc.Label}
+
+		// для percent шкала каждого пункта сдвигается к нулю: 0% — минимум, 100% — максимум
+		var sum, shifted, maxShifted float64
+		answered := 0
+		for _, id := range sc.Items {
+			value, ok := answers[id]
+			if !ok {
+				continue
+			}
+			lo, hi := d.item(id).bounds()
+			sum += value
+			shifted += value - float64(lo)
+			maxShifted += float64(hi - lo)
+			answered++
+		}
+
+		minAnswered := sc.MinAnswered
+		if minAnswered == 0 {
+			minAnswered = len(sc.Items)
+		}
+		if answered >= minAnswered && answered > 0 {
+			var value float64
+			switch sc.Method {
+			case ScoreSum:
+				value = sum
+			case ScoreMean:
+				value = sum / float64(answered)
+			case ScorePercent:
+				if maxShifted > 0 {
+					value = shifted / maxShifted * 100
+				}
+			}
+			value = math.Round(value*100) / 100
+			result.Value = &value
+			result.Band = sc.band(value)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (sc *Score) band(value float64) string {
+	for _, b := range sc.Bands {
+		if value >= b.Min && value <= b.Max {
+			return b.Label
+		}
+	}
+	return ""
+}
+
+// Registry — загруженные определения: код -> версия -> определение.
+type Registry struct {
+	definitions map[string]map[int]*Definition
+}
+
+// LoadRegistry читает встроенные определения и, если dir не пуст, YAML- и JSON-файлы
+// из каталога (JSON — подмножество YAML, разбираются одинаково).
+func LoadRegistry(dir string) (*Registry, error) {
+	r := &Registry{definitions: make(map[string]map[int]*Definition)}
+	if err := r.loadFS(builtinDefinitions, "definitions"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := r.loadFS(os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Registry) loadFS(fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		var def Definition
+		if err := yaml.Unmarshal(data, &def); err != nil {
+			return fmt.Errorf("questionnaire %s: %w", path, err)
+		}
+		if err := def.validate(); err != nil {
+			return fmt.Errorf("questionnaire %s: %w", path, err)
+		}
+
+		if r.definitions[def.Code] == nil {
+			r.definitions[def.Code] = make(map[int]*Definition)
+		}
+		if _, exists := r.definitions[def.Code][def.Version]; exists {
+			return fmt.Errorf("questionnaire %s: %s v%d is already defined", path, def.Code, def.Version)
+		}
+		r.definitions[def.Code][def.Version] = &def
+		return nil
+	})
+}
+
+// Get возвращает версию опросника; version = 0 — последнюю.
+func (r *Registry) Get(code string, version int) (*Definition, bool) {
+	versions, ok := r.definitions[code]
+	if !ok {
+		return nil, false
+	}
+	if version == 0 {
+		for v := range versions {
+			version = max(version, v)
+		}
+	}
+	def, ok := versions[version]
+	return def, ok
+}
+
+// Latest — последние версии всех опросников, по коду.
+func (r *Registry) Latest() []*Definition {
+	codes := make([]string, 0, len(r.definitions))
+	for code := range r.definitions {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	result := make([]*Definition, 0, len(codes))
+	for _, code := range codes {
+		def, _ := r.Get(code, 0)
+		result = append(result, def)
+	}
+	return result
+}
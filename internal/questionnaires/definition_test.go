@@ -0,0 +1,215 @@
+package questionnaires
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func builtin(t *testing.T, code string) *Definition {
+	t.Helper()
+	registry, err := LoadRegistry("")
+	if err != nil {
+		t.Fatalf("LoadRegistry: %v", err)
+	}
+	def, ok := registry.Get(code, 1)
+	if !ok {
+		t.Fatalf("definition %s v1 is not bundled", code)
+	}
+	return def
+}
+
+func answersOf(ids []string, values ...float64) map[string]float64 {
+	answers := make(map[string]float64, len(values))
+	for i, v := range values {
+		answers[ids[i]] = v
+	}
+	return answers
+}
+
+func fill(ids []string, value float64) map[string]float64 {
+	answers := make(map[string]float64, len(ids))
+	for _, id := range ids {
+		answers[id] = value
+	}
+	return answers
+}
+
+var (
+	phq9Items = []string{"q1", "q2", "q3", "q4", "q5", "q6", "q7", "q8", "q9"}
+	bpiPain   = []string{"worst", "least", "average", "now"}
+	bpiImpact = []string{"general_activity", "mood", "walking", "normal_work", "relations", "sleep", "enjoyment"}
+	odiItems  = []string{"pain_intensity", "personal_care", "lifting", "walking", "sitting", "standing", "sleeping", "sex_life", "social_life", "travelling"}
+)
+
+func merge(parts ...map[string]float64) map[string]float64 {
+	result := make(map[string]float64)
+	for _, p := range parts {
+		for k, v := range p {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+type wantScore struct {
+	id    string
+	value *float64 // nil — шкала не посчитана
+	band  string
+}
+
+func score(id string, value float64, band string) wantScore {
+	return wantScore{id: id, value: &value, band: band}
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		answers map[string]float64
+		want    []wantScore
+	}{
+		{"phq9 minimal", "phq9", fill(phq9Items, 0), []wantScore{score("total", 0, "minimal")}},
+		{"phq9 moderate lower bound", "phq9", answersOf(phq9Items, 2, 2, 2, 1, 1, 1, 1, 0, 0), []wantScore{score("total", 10, "moderate")}},
+		{"phq9 mild upper bound", "phq9", answersOf(phq9Items, 3, 3, 3, 0, 0, 0, 0, 0, 0), []wantScore{score("total", 9, "mild")}},
+		{"phq9 severe maximum", "phq9", fill(phq9Items, 3), []wantScore{score("total", 27, "severe")}},
+
+		{
+			"bpi mean severity and interference",
+			"bpi",
+			merge(answersOf(bpiPain, 8, 2, 5, 5), fill(bpiImpact, 7)),
+			[]wantScore{score("severity", 5, "moderate"), score("interference", 7, "")},
+		},
+		{
+			"bpi interference needs four answered items",
+			"bpi",
+			merge(fill(bpiPain, 10), answersOf(bpiImpact, 1, 2, 3)),
+			[]wantScore{score("severity", 10, "severe"), {id: "interference"}},
+		},
+		{
+			"bpi interference mean over answered items only",
+			"bpi",
+			merge(fill(bpiPain, 4), answersOf(bpiImpact, 2, 4, 6, 8)),
+			[]wantScore{score("severity", 4, "mild"), score("interference", 5, "")},
+		},
+		{
+			"bpi severity rounded to hundredths",
+			"bpi",
+			merge(answersOf(bpiPain, 7, 7, 7, 6), fill(bpiImpact, 0)),
+			[]wantScore{score("severity", 6.75, "moderate"), score("interference", 0, "")},
+		},
+
+		{"odi no disability", "odi", fill(odiItems, 0), []wantScore{score("disability", 0, "minimal")}},
+		{"odi maximum", "odi", fill(odiItems, 5), []wantScore{score("disability", 100, "bed_bound")}},
+		{"odi minimal upper bound", "odi", fill(odiItems, 1), []wantScore{score("disability", 20, "minimal")}},
+		{
+			"odi skipped sections leave the denominator",
+			"odi",
+			answersOf(odiItems, 2, 2, 2, 2, 2, 2, 2, 2),
+			[]wantScore{score("disability", 40, "moderate")},
+		},
+		{
+			"odi nine sections",
+			"odi",
+			answersOf(odiItems, 1, 2, 2, 2, 2, 2, 2, 1, 1),
+			[]wantScore{score("disability", 33.33, "moderate")},
+		},
+		{
+			"odi too few sections",
+			"odi",
+			answersOf(odiItems, 5, 5, 5, 5, 5, 5, 5),
+			[]wantScore{{id: "disability"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := builtin(t, tt.code)
+			if err := def.CheckAnswers(tt.answers); err != nil {
+				t.Fatalf("CheckAnswers: %v", err)
+			}
+			got := def.Calculate(tt.answers)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d scores, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				if g.ID != want.id {
+					t.Errorf("score %d id = %q, want %q", i, g.ID, want.id)
+				}
+				switch {
+				case want.value == nil && g.Value != nil:
+					t.Errorf("%s = %v, want not calculated", want.id, *g.Value)
+				case want.value != nil && g.Value == nil:
+					t.Errorf("%s is not calculated, want %v", want.id, *want.value)
+				case want.value != nil && *g.Value != *want.value:
+					t.Errorf("%s = %v, want %v", want.id, *g.Value, *want.value)
+				}
+				if g.Band != want.band {
+					t.Errorf("%s band = %q, want %q", want.id, g.Band, want.band)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAnswersRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		answers map[string]float64
+	}{
+		{"phq9 missing required item", "phq9", answersOf(phq9Items, 0, 0, 0, 0, 0, 0, 0, 0)},
+		{"phq9 value outside options", "phq9", merge(fill(phq9Items, 0), map[string]float64{"q1": 4})},
+		{"phq9 fractional value", "phq9", merge(fill(phq9Items, 0), map[string]float64{"q1": 1.5})},
+		{"phq9 unknown item", "phq9", merge(fill(phq9Items, 0), map[string]float64{"q10": 1})},
+		{"bpi above scale maximum", "bpi", merge(fill(bpiPain, 0), map[string]float64{"worst": 11})},
+		{"bpi below scale minimum", "bpi", merge(fill(bpiPain, 0), map[string]float64{"mood": -1})},
+		{"bpi missing pain rating", "bpi", answersOf(bpiPain, 1, 1, 1)},
+		{"odi value outside options", "odi", map[string]float64{"lifting": 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := builtin(t, tt.code).CheckAnswers(tt.answers); err == nil {
+				t.Error("CheckAnswers accepted invalid answers")
+			}
+		})
+	}
+}
+
+func TestItemBounds(t *testing.T) {
+	tests := []struct {
+		code, item string
+		lo, hi     int
+	}{
+		{"phq9", "q1", 0, 3},
+		{"bpi", "worst", 0, 10},
+		{"odi", "travelling", 0, 5},
+	}
+	for _, tt := range tests {
+		lo, hi := builtin(t, tt.code).item(tt.item).bounds()
+		if lo != tt.lo || hi != tt.hi {
+			t.Errorf("%s/%s bounds = [%d, %d], want [%d, %d]", tt.code, tt.item, lo, hi, tt.lo, tt.hi)
+		}
+	}
+}
+
+func TestLoadRegistryReadsJSON(t *testing.T) {
+	dir := t.TempDir()
+	def := `{"code": "nrs", "version": 1, "title": "NRS",
+		"items": [{"id": "pain", "type": "scale", "min": 0, "max": 10, "required": true}],
+		"scores": [{"id": "pain", "method": "sum", "items": ["pain"]}]}`
+	if err := os.WriteFile(filepath.Join(dir, "nrs.v1.json"), []byte(def), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := LoadRegistry(dir)
+	if err != nil {
+		t.Fatalf("LoadRegistry: %v", err)
+	}
+	if _, ok := registry.Get("nrs", 1); !ok {
+		t.Error("JSON definition was not loaded")
+	}
+	if _, ok := registry.Get("phq9", 1); !ok {
+		t.Error("builtin definitions are missing")
+	}
+}
@@ -0,0 +1,154 @@
+package questionnaires
+
+import (
+	"painaway_test/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	CreateAssignment(a *models.QuestionnaireAssignment) error
+	GetAssignmentByID(id uint) (*models.QuestionnaireAssignment, error)
+	UpdateAssignment(a *models.QuestionnaireAssignment) error
+	DeactivateAssignmentsBySubscriptionID(subscriptionID uint) (int64, error)
+	GetAssignmentsBySubscriptionID(subscriptionID uint) ([]models.QuestionnaireAssignment, error)
+	GetAssignmentsByPatientID(patientID uint) ([]models.QuestionnaireAssignment, error)
+	GetLastSubmissions(assignmentIDs []uint) (map[uint]time.Time, error)
+	SubmitResponse(r *models.QuestionnaireResponse) error
+	GetResponsesByAssignmentID(assignmentID uint) ([]models.QuestionnaireResponse, error)
+	GetResponsesByPatientID(patientID uint, code string, from, to *time.Time) ([]models.QuestionnaireResponse, error)
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+func (r *Repo) CreateAssignment(a *models.QuestionnaireAssignment) error {
+	return r.DB.Create(a).Error
+}
+
+func (r *Repo) GetAssignmentByID(id uint) (*models.QuestionnaireAssignment, error) {
+	var a models.QuestionnaireAssignment
+	if err := r.DB.First(&a, id).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *Repo) UpdateAssignment(a *models.QuestionnaireAssignment) error {
+	return r.DB.Save(a).Error
+}
+
+func (r *Repo) DeactivateAssignmentsBySubscriptionID(subscriptionID uint) (int64, error) {
+	res := r.DB.Model(&models.QuestionnaireAssignment{}).
+		Where("subscription_id = ? AND active", subscriptionID).
+		Update("active", false)
+	return res.RowsAffected, res.Error
+}
+
+func (r *Repo) GetAssignmentsBySubscriptionID(subscriptionID uint) ([]models.QuestionnaireAssignment, error) {
+	var assignments []models.QuestionnaireAssignment
+	if err := r.DB.
+		Where("subscription_id = ?", subscriptionID).
+		Order("active DESC, start_date DESC, id DESC").
+		Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+func (r *Repo) GetAssignmentsByPatientID(patientID uint) ([]models.QuestionnaireAssignment, error) {
+	var assignments []models.QuestionnaireAssignment
+	if err := r.DB.
+		Where("patient_id = ?", patientID).
+		Order("active DESC, start_date DESC, id DESC").
+		Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// GetLastSubmissions — время последнего ответа по каждому назначению.
+func (r *Repo) GetLastSubmissions(assignmentIDs []uint) (map[uint]time.Time, error) {
+	result := make(map[uint]time.Time, len(assignmentIDs))
+	if len(assignmentIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		AssignmentID uint
+		LastAt       time.Time
+	}
+	if err := r.DB.Model(&models.QuestionnaireResponse{}).
+		Select("assignment_id, MAX(submitted_at) AS last_at").
+		Where("assignment_id IN ?", assignmentIDs).
+		Group("assignment_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.AssignmentID] = row.LastAt
+	}
+	return result, nil
+}
+
+// SubmitResponse сохраняет ответ, если назначение активно и опросник пора заполнять.
+// Назначение блокируется до конца транзакции, чтобы два одновременных ответа
+// не прошли проверку срока оба.
+func (r *Repo) SubmitResponse(resp *models.QuestionnaireResponse) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var a models.QuestionnaireAssignment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", resp.AssignmentID).First(&a).Error; err != nil {
+			return err
+		}
+		if !a.Active {
+			return ErrAssignmentInactive
+		}
+		var last struct{ LastAt *time.Time }
+		if err := tx.Model(&models.QuestionnaireResponse{}).
+			Select("MAX(submitted_at) AS last_at").
+			Where("assignment_id = ?", a.ID).
+			Scan(&last).Error; err != nil {
+			return err
+		}
+		if next := nextDue(&a, last.LastAt); next == nil || next.After(today()) {
+			return ErrNotDue
+		}
+		return tx.Create(resp).Error
+	})
+}
+
+func (r *Repo) GetResponsesByAssignmentID(assignmentID uint) ([]models.QuestionnaireResponse, error) {
+	var responses []models.QuestionnaireResponse
+	if err := r.DB.
+		Where("assignment_id = ?", assignmentID).
+		Order("submitted_at DESC").
+		Find(&responses).Error; err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+func (r *Repo) GetResponsesByPatientID(patientID uint, code string, from, to *time.Time) ([]models.QuestionnaireResponse, error) {
+	var responses []models.QuestionnaireResponse
+	query := r.DB.Where("patient_id = ?", patientID)
+	if code != "" {
+		query = query.Where("code = ?", code)
+	}
+	if from != nil {
+		query = query.Where("submitted_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("submitted_at < ?", *to)
+	}
+	if err := query.Order("submitted_at").Find(&responses).Error; err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
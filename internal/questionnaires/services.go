@@ -0,0 +1,434 @@
+package questionnaires
+
+import (
+	"errors"
+	"fmt"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/notifications"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const maxIntervalDays = 365
+
+var (
+	ErrForbidden          = errors.New("access denied")
+	ErrUnknown            = errors.New("questionnaire not found")
+	ErrInvalidAssignment  = errors.New("invalid assignment")
+	ErrInvalidAnswers     = errors.New("invalid answers")
+	ErrNotDue             = errors.New("questionnaire is not due")
+	ErrInvalidPeriod      = errors.New("invalid period")
+	ErrAssignmentInactive = errors.New("assignment is not active")
+)
+
+type Service struct {
+	Repo                 Repository
+	Registry             *Registry
+	Diary                *diary.Service
+	NotificationsService *notifications.Service
+	Logger               *zap.Logger
+}
+
+func NewService(repo Repository, registry *Registry, diarySrv *diary.Service, notifSrv *notifications.Service, logger *zap.Logger) *Service {
+	return &Service{
+		Repo:                 repo,
+		Registry:             registry,
+		Diary:                diarySrv,
+		NotificationsService: notifSrv,
+		Logger:               logger,
+	}
+}
+
+func (s *Service) ListDefinitions() []utils.QuestionnaireSummaryDTO {
+	defs := s.Registry.Latest()
+	dto := make([]utils.QuestionnaireSummaryDTO, 0, len(defs))
+	for _, d := range defs {
+		dto = append(dto, utils.QuestionnaireSummaryDTO{
+			Code:        d.Code,
+			Version:     d.Version,
+			Title:       d.Title,
+			Description: d.Description,
+		})
+	}
+	return dto
+}
+
+func (s *Service) GetDefinition(code string, version int) (*Definition, error) {
+	def, ok := s.Registry.Get(code, version)
+	if !ok {
+		return nil, ErrUnknown
+	}
+	return def, nil
+}
+
+func (s *Service) Assign(doctorID uint, input utils.QuestionnaireAssignmentInputDTO) (*models.QuestionnaireAssignment, error) {
+	link, err := s.Diary.GetLinkWithPermission(doctorID, input.Link, diary.PermAssignQuestionnaires)
+	if err != nil {
+		return nil, mapDiaryError(err)
+	}
+	def, ok := s.Registry.Get(input.Code, 0)
+	if !ok {
+		return nil, ErrUnknown
+	}
+
+	a := &models.QuestionnaireAssignment{
+		SubscriptionID: link.ID,
+		DoctorID:       doctorID,
+		PatientID:      link.PatientID,
+		Code:           def.Code,
+		Version:        def.Version,
+		StartDate:      today(),
+		Active:         true,
+	}
+	if err := applyAssignmentInput(a, input); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.CreateAssignment(a); err != nil {
+		return nil, err
+	}
+
+	if err := s.NotificationsService.CreateNotification(
+		a.PatientID,
+		"Врач назначил опросник: "+def.Title,
+	); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("doctorID", doctorID),
+			zap.Uint("patientID", a.PatientID),
+			zap.Error(err),
+		)
+	}
+	return a, nil
+}
+
+func (s *Service) UpdateAssignment(doctorID, assignmentID uint, input utils.QuestionnaireAssignmentInputDTO) (*models.QuestionnaireAssignment, error) {
+	a, err := s.Repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Diary.GetLinkWithPermission(doctorID, a.SubscriptionID, diary.PermAssignQuestionnaires); err != nil {
+		return nil, mapDiaryError(err)
+	}
+	if input.Code != "" && input.Code != a.Code {
+		return nil, fmt.Errorf("%w: code cannot be changed", ErrInvalidAssignment)
+	}
+
+	if err := applyAssignmentInput(a, input); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.UpdateAssignment(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func applyAssignmentInput(a *models.QuestionnaireAssignment, input utils.QuestionnaireAssignmentInputDTO) error {
+	if input.IntervalDays != nil {
+		a.IntervalDays = *input.IntervalDays
+	}
+	if input.StartDate != nil {
+		start, err := time.Parse(time.DateOnly, *input.StartDate)
+		if err != nil {
+			return fmt.Errorf("%w: start_date must be YYYY-MM-DD", ErrInvalidAssignment)
+		}
+		a.StartDate = start
+	}
+	if input.EndDate != nil {
+		if *input.EndDate == "" {
+			a.EndDate = nil
+		} else {
+			end, err := time.Parse(time.DateOnly, *input.EndDate)
+			if err != nil {
+				return fmt.Errorf("%w: end_date must be YYYY-MM-DD", ErrInvalidAssignment)
+			}
+			a.EndDate = &end
+		}
+	}
+	if input.Active != nil {
+		a.Active = *input.Active
+	}
+
+	if a.IntervalDays < 0 || a.IntervalDays > maxIntervalDays {
+		return fmt.Errorf("%w: interval_days must be between 0 and %d", ErrInvalidAssignment, maxIntervalDays)
+	}
+	if a.EndDate != nil && a.EndDate.Before(a.StartDate) {
+		return fmt.Errorf("%w: end_date is before start_date", ErrInvalidAssignment)
+	}
+	return nil
+}
+
+// ListAssignments — назначения привязки (врачу и пациенту) или, при linkID = 0, все назначения пациента.
+func (s *Service) ListAssignments(userID, linkID uint) ([]utils.QuestionnaireAssignmentDTO, error) {
+	var assignments []models.QuestionnaireAssignment
+	var err error
+	if linkID == 0 {
+		assignments, err = s.Repo.GetAssignmentsByPatientID(userID)
+	} else {
+		link, linkErr := s.Diary.GetParticipantLink(userID, linkID)
+		if linkErr != nil {
+			return nil, mapDiaryError(linkErr)
+		}
+		assignments, err = s.Repo.GetAssignmentsBySubscriptionID(link.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.toAssignmentDTO(assignments)
+}
+
+func (s *Service) Submit(patientID, assignmentID uint, answers map[string]float64) (*models.QuestionnaireResponse, error) {
+	a, err := s.Repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if a.PatientID != patientID {
+		return nil, ErrForbidden
+	}
+
+	def, ok := s.Registry.Get(a.Code, a.Version)
+	if !ok {
+		return nil, fmt.Errorf("definition %s v%d is not loaded", a.Code, a.Version)
+	}
+	if err := def.CheckAnswers(answers); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAnswers, err)
+	}
+
+	resp := &models.QuestionnaireResponse{
+		AssignmentID: a.ID,
+		PatientID:    a.PatientID,
+		Code:         a.Code,
+		Version:      a.Version,
+		Answers:      answers,
+		Scores:       def.Calculate(answers),
+	}
+	// активность назначения и срок проверяются под блокировкой при сохранении
+	if err := s.Repo.SubmitResponse(resp); err != nil {
+		return nil, err
+	}
+
+	if err := s.NotificationsService.CreateNotification(
+		a.DoctorID,
+		"Пациент заполнил опросник: "+def.Title,
+	); err != nil {
+		s.Logger.Error("failed to create notification",
+			zap.Uint("doctorID", a.DoctorID),
+			zap.Uint("patientID", a.PatientID),
+			zap.Error(err),
+		)
+	}
+	return resp, nil
+}
+
+func (s *Service) ListResponses(userID, assignmentID uint) ([]models.QuestionnaireResponse, error) {
+	a, err := s.Repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Diary.GetParticipantLink(userID, a.SubscriptionID); err != nil {
+		return nil, mapDiaryError(err)
+	}
+	access, err := s.Diary.RequireScope(userID, a.PatientID, diary.ScopeQuestionnaires)
+	if err != nil {
+		return nil, mapDiaryError(err)
+	}
+	responses, err := s.Repo.GetResponsesByAssignmentID(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]models.QuestionnaireResponse, 0, len(responses))
+	for _, r := range responses {
+		if access.AllowsDate(r.SubmittedAt) {
+			visible = append(visible, r)
+		}
+	}
+	return visible, nil
+}
+
+// Trends — динамика шкал опросников пациента за период [from, to] (даты включительно).
+func (s *Service) Trends(userID, patientID uint, code, fromStr, toStr string) ([]utils.QuestionnaireTrendDTO, error) {
+	access, err := s.Diary.RequireScope(userID, patientID, diary.ScopeQuestionnaires)
+	if err != nil {
+		return nil, mapDiaryError(err)
+	}
+
+	from, to, err := parseDates(fromStr, toStr)
+	if err != nil {
+		return nil, err
+	}
+	if access.DataFrom != nil {
+		clamped := access.ClampFrom(*access.DataFrom)
+		if from != nil {
+			clamped = access.ClampFrom(*from)
+		}
+		from = &clamped
+	}
+	responses, err := s.Repo.GetResponsesByPatientID(patientID, code, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// серия на каждую шкалу каждого опросника, в порядке первого появления
+	var trends []utils.QuestionnaireTrendDTO
+	index := make(map[string]int)
+	for _, resp := range responses {
+		title := resp.Code
+		if def, ok := s.Registry.Get(resp.Code, resp.Version); ok {
+			title = def.Title
+		}
+		for _, score := range resp.Scores {
+			key := resp.Code + "/" + score.ID
+			i, ok := index[key]
+			if !ok {
+				i = len(trends)
+				index[key] = i
+				trends = append(trends, utils.QuestionnaireTrendDTO{
+					Code:    resp.Code,
+					Title:   title,
+					ScoreID: score.ID,
+					Label:   score.Label,
+					Points:  []utils.QuestionnaireTrendPointDTO{},
+				})
+			}
+			trends[i].Points = append(trends[i].Points, utils.QuestionnaireTrendPointDTO{
+				SubmittedAt: resp.SubmittedAt,
+				ResponseID:  resp.ID,
+				Value:       score.Value,
+				Band:        score.Band,
+			})
+		}
+	}
+	if trends == nil {
+		trends = []utils.QuestionnaireTrendDTO{}
+	}
+	return trends, nil
+}
+
+func (s *Service) toAssignmentDTO(assignments []models.QuestionnaireAssignment) ([]utils.QuestionnaireAssignmentDTO, error) {
+	ids := make([]uint, 0, len(assignments))
+	for _, a := range assignments {
+		ids = append(ids, a.ID)
+	}
+	last, err := s.Repo.GetLastSubmissions(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	day := today()
+	dto := make([]utils.QuestionnaireAssignmentDTO, 0, len(assignments))
+	for _, a := range assignments {
+		item := utils.QuestionnaireAssignmentDTO{
+			ID:           a.ID,
+			LinkID:       a.SubscriptionID,
+			PatientID:    a.PatientID,
+			Code:         a.Code,
+			Version:      a.Version,
+			Title:        a.Code,
+			IntervalDays: a.IntervalDays,
+			StartDate:    a.StartDate.Format(time.DateOnly),
+			Active:       a.Active,
+		}
+		if def, ok := s.Registry.Get(a.Code, a.Version); ok {
+			item.Title = def.Title
+		}
+		if a.EndDate != nil {
+			end := a.EndDate.Format(time.DateOnly)
+			item.EndDate = &end
+		}
+		if t, ok := last[a.ID]; ok {
+			item.LastSubmittedAt = &t
+		}
+		if a.Active {
+			if next := nextDue(&a, item.LastSubmittedAt); next != nil {
+				nextStr := next.Format(time.DateOnly)
+				item.NextDue = &nextStr
+				item.Due = !next.After(day)
+			}
+		}
+		dto = append(dto, item)
+	}
+	return dto, nil
+}
+
+func (s *Service) ToResponseDTO(responses []models.QuestionnaireResponse) []utils.QuestionnaireResponseDTO {
+	dto := make([]utils.QuestionnaireResponseDTO, 0, len(responses))
+	for _, r := range responses {
+		scores := make([]utils.QuestionnaireScoreDTO, 0, len(r.Scores))
+		for _, sc := range r.Scores {
+			scores = append(scores, utils.QuestionnaireScoreDTO{ID: sc.ID, Label: sc.Label, Value: sc.Value, Band: sc.Band})
+		}
+		dto = append(dto, utils.QuestionnaireResponseDTO{
+			ID:           r.ID,
+			AssignmentID: r.AssignmentID,
+			Code:         r.Code,
+			Version:      r.Version,
+			Answers:      r.Answers,
+			Scores:       scores,
+			SubmittedAt:  r.SubmittedAt,
+		})
+	}
+	return dto
+}
+
+// nextDue — дата, с которой опросник можно (нужно) заполнить снова; nil — больше не нужно.
+func nextDue(a *models.QuestionnaireAssignment, lastAt *time.Time) *time.Time {
+	next := a.StartDate
+	if lastAt != nil {
+		if a.IntervalDays == 0 {
+			return nil
+		}
+		y, m, d := lastAt.UTC().Date()
+		afterLast := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, 0, a.IntervalDays)
+		if afterLast.After(next) {
+			next = afterLast
+		}
+	}
+	if a.EndDate != nil && next.After(*a.EndDate) {
+		return nil
+	}
+	return &next
+}
+
+func parseDates(fromStr, toStr string) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+	if fromStr != "" {
+		t, err := time.Parse(time.DateOnly, fromStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: from must be YYYY-MM-DD", ErrInvalidPeriod)
+		}
+		from = &t
+	}
+	if toStr != "" {
+		t, err := time.Parse(time.DateOnly, toStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: to must be YYYY-MM-DD", ErrInvalidPeriod)
+		}
+		t = t.AddDate(0, 0, 1)
+		to = &t
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, fmt.Errorf("%w: from is after to", ErrInvalidPeriod)
+	}
+	return from, to, nil
+}
+
+// mapDiaryError переводит ошибку доступа diary в ошибку пакета.
+func mapDiaryError(err error) error {
+	if errors.Is(err, diary.ErrForbidden) {
+		return ErrForbidden
+	}
+	return err
+}
+
+func today() time.Time {
+	y, m, d := time.Now().UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// HandleLinkEnded снимает активные опросники завершённой привязки.
+func (s *Service) HandleLinkEnded(link models.Subscription) {
+	if _, err := s.Repo.DeactivateAssignmentsBySubscriptionID(link.ID); err != nil {
+		s.Logger.Error("failed to deactivate questionnaires of ended link", zap.Uint("linkID", link.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,30 @@
+package rbac
+
+import (
+	"net/http"
+	"painaway_test/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+// RegisterAdminRoutes регистрирует маршруты администратора; права проверяются на каждом маршруте.
+func RegisterAdminRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/roles/", RequirePermission(logger, PermRolesRead), h.ListRoles)
+}
+
+func (h *Handler) ListRoles(c *gin.Context) {
+	roles, err := h.Service.ListRoles()
+	if err != nil {
+		h.Logger.Error("failed to list roles", zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to list roles", h.Logger)
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
@@ -0,0 +1,47 @@
+package rbac
+
+import (
+	"net/http"
+	"painaway_test/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Ключи ролей и прав пользователя в gin.Context, их заполняет auth.AuthMiddleware.
+const (
+	RolesKey       = "roles"
+	PermissionsKey = "permissions"
+)
+
+// RequirePermission пропускает запрос, только если у пользователя есть все
+// перечисленные права. Должен стоять после AuthMiddleware.
+func RequirePermission(logger *zap.Logger, perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, perm := range perms {
+			if !HasPermission(c, perm) {
+				response.NewErrorResponse(c, http.StatusForbidden, "insufficient permissions", logger)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func HasPermission(c *gin.Context, perm string) bool {
+	v, ok := c.Get(PermissionsKey)
+	if !ok {
+		return false
+	}
+	perms, _ := v.(map[string]bool)
+	return perms[perm]
+}
+
+func HasRole(c *gin.Context, role string) bool {
+	for _, r := range c.GetStringSlice(RolesKey) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package rbac
+
+import "painaway_test/models"
+
+// Роли пользователей.
+const (
+	RolePatient = "Patient"
+	RoleDoctor  = "Doctor"
+	RoleAdmin   = "Admin"
+)
+
+// Права на группы действий API. Проверку доступа к конкретному пациенту или
+// записи права не заменяют: её по-прежнему делают сервисы.
+const (
+	PermProfileRead          = "profile:read"
+	PermProfileWrite         = "profile:write"
+	PermNotificationsUse     = "notifications:use"
+	PermDoctorsRead          = "doctors:read"
+	PermBodyPartsRead        = "bodyparts:read"
+	PermDiaryRead            = "diary:read"
+	PermDiaryWrite           = "diary:write"
+	PermLinksUse             = "links:use"
+	PermLinksRequest         = "links:request"
+	PermConsentManage        = "consent:manage"
+	PermPatientsManage       = "patients:manage"
+	PermTreatmentWrite       = "treatment:write"
+	PermICD10Read            = "icd10:read"
+	PermCommentsWrite        = "comments:write"
+	PermMessagesUse          = "messages:use"
+	PermAppointmentsUse      = "appointments:use"
+	PermScheduleManage       = "schedule:manage"
+	PermRemindersManage      = "reminders:manage"
+	PermQuestionnairesRead   = "questionnaires:read"
+	PermQuestionnairesAssign = "questionnaires:assign"
+	PermQuestionnairesAnswer = "questionnaires:answer"
+	PermInvitesManage        = "invites:manage"
+	PermDoctorProfileManage  = "doctor_profile:manage"
+	PermAuditOwn             = "audit:own"
+	PermAuditRead            = "audit:read"
+	PermBodyPartsManage      = "bodyparts:manage"
+	PermRolesRead            = "roles:read"
+	PermApplicationsSubmit   = "doctor_applications:submit"
+	PermApplicationsReview   = "doctor_applications:review"
+	PermUsersRead            = "users:read"
+	PermUsersManage          = "users:manage"
+)
+
+type permissionDef struct {
+	Code        string
+	Description string
+}
+
+// permissions — полный справочник прав в порядке вывода.
+var permissions = []permissionDef{
+	{PermProfileRead, "Просмотр своего профиля"},
+	{PermProfileWrite, "Изменение своего профиля, пароля и почты"},
+	{PermNotificationsUse, "Уведомления"},
+	{PermDoctorsRead, "Каталог врачей"},
+	{PermBodyPartsRead, "Справочник частей тела"},
+	{PermDiaryRead, "Просмотр дневника, назначений и диагнозов"},
+	{PermDiaryWrite, "Ведение своего дневника"},
+	{PermLinksUse, "Просмотр привязок и команды лечения"},
+	{PermLinksRequest, "Запрос привязки к врачу"},
+	{PermConsentManage, "Управление согласием на доступ к данным"},
+	{PermPatientsManage, "Ведение пациентов"},
+	{PermTreatmentWrite, "Назначения и диагнозы"},
+	{PermICD10Read, "Справочник МКБ-10"},
+	{PermCommentsWrite, "Комментарии к записям"},
+	{PermMessagesUse, "Переписка"},
+	{PermAppointmentsUse, "Запись на приём"},
+	{PermScheduleManage, "Управление расписанием приёма"},
+	{PermRemindersManage, "Напоминания"},
+	{PermQuestionnairesRead, "Просмотр опросников"},
+	{PermQuestionnairesAssign, "Назначение опросников"},
+	{PermQuestionnairesAnswer, "Заполнение опросников"},
+	{PermInvitesManage, "Приглашения пациентов"},
+	{PermDoctorProfileManage, "Карточка врача в каталоге"},
+	{PermAuditOwn, "Журнал доступа к своим данным"},
+	{PermAuditRead, "Журнал доступа ко всем данным"},
+	{PermBodyPartsManage, "Редактирование справочника частей тела"},
+	{PermRolesRead, "Просмотр ролей и прав"},
+	{PermApplicationsSubmit, "Подача заявки на роль врача"},
+	{PermApplicationsReview, "Рассмотрение заявок врачей"},
+	{PermUsersRead, "Просмотр аккаунтов пользователей"},
+	{PermUsersManage, "Управление аккаунтами пользователей"},
+}
+
+// defaultRoles — роли и их права, создаваемые при первом запуске.
+// Администратор получает все права из справочника.
+var defaultRoles = []struct {
+	Name        string
+	Description string
+	Permissions []string
+}{
+	{RolePatient, "Пациент", []string{
+		PermProfileRead, PermProfileWrite, PermNotificationsUse, PermDoctorsRead, PermBodyPartsRead,
+		PermDiaryRead, PermDiaryWrite, PermLinksUse, PermLinksRequest, PermConsentManage,
+		PermCommentsWrite, PermMessagesUse, PermAppointmentsUse, PermRemindersManage,
+		PermQuestionnairesRead, PermQuestionnairesAnswer, PermAuditOwn, PermApplicationsSubmit,
+	}},
+	{RoleDoctor, "Врач", []string{
+		PermProfileRead, PermProfileWrite, PermNotificationsUse, PermDoctorsRead, PermBodyPartsRead,
+		PermDiaryRead, PermLinksUse, PermPatientsManage, PermTreatmentWrite, PermICD10Read,
+		PermCommentsWrite, PermMessagesUse, PermAppointmentsUse, PermScheduleManage,
+		PermRemindersManage, PermQuestionnairesRead, PermQuestionnairesAssign,
+		PermInvitesManage, PermDoctorProfileManage,
+	}},
+	{RoleAdmin, "Администратор", nil},
+}
+
+// rolePriority — порядок выбора основной роли, если ролей несколько.
+var rolePriority = []string{RoleAdmin, RoleDoctor, RolePatient}
+
+// PrimaryRole — главная из ролей пользователя; её отдаём клиентам, которые
+// ещё ждут одну группу вместо списка ролей.
+func PrimaryRole(roles []string) string {
+	for _, candidate := range rolePriority {
+		for _, role := range roles {
+			if role == candidate {
+				return role
+			}
+		}
+	}
+	if len(roles) > 0 {
+		return roles[0]
+	}
+	return ""
+}
+
+// RoleNames — имена ролей, загруженных вместе с пользователем.
+func RoleNames(roles []models.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
@@ -0,0 +1,91 @@
+package rbac
+
+import (
+	"painaway_test/models"
+
+	"gorm.io/gorm"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	GetRoleGrants() (map[string][]string, error)
+	GetRoleByName(name string) (*models.Role, error)
+	GetRoles() ([]models.Role, error)
+	GetUserRoles(userID uint) ([]string, error)
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+// GetRoleGrants — права каждой роли: имя роли -> коды прав.
+func (r *Repo) GetRoleGrants() (map[string][]string, error) {
+	var rows []struct {
+		Role string
+		Code string
+	}
+	if err := r.DB.Table("roles").
+		Select("roles.name AS role, permissions.code AS code").
+		Joins("JOIN role_permissions rp ON rp.role_id = roles.id").
+		Joins("JOIN permissions ON permissions.id = rp.permission_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	grants := make(map[string][]string)
+	for _, row := range rows {
+		grants[row.Role] = append(grants[row.Role], row.Code)
+	}
+	return grants, nil
+}
+
+func (r *Repo) GetRoleByName(name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *Repo) GetRoles() ([]models.Role, error) {
+	var roles []models.Role
+	if err := r.DB.Preload("Permissions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("permissions.code")
+	}).Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *Repo) GetUserRoles(userID uint) ([]string, error) {
+	var names []string
+	if err := r.DB.Table("roles").
+		Joins("JOIN user_roles ur ON ur.role_id = roles.id").
+		Where("ur.user_id = ?", userID).
+		Order("roles.id").
+		Pluck("roles.name", &names).Error; err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// UsersWithRole — подзапрос ID пользователей с ролью role, для условий вида
+// Where("users.id IN (?)", rbac.UsersWithRole(db, rbac.RoleDoctor)).
+// Удалённые аккаунты в выборку не попадают.
+func UsersWithRole(db *gorm.DB, role string) *gorm.DB {
+	return db.Table("user_roles").
+		Select("user_roles.user_id").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Joins("JOIN users u ON u.id = user_roles.user_id AND u.deleted_at IS NULL").
+		Where("roles.name = ?", role)
+}
+
+// GrantRole выдаёт пользователю роль; выданная ранее роль не дублируется.
+// Принимает *gorm.DB, чтобы роль можно было выдать в транзакции вызывающего.
+func GrantRole(db *gorm.DB, userID uint, role string) error {
+	return db.Exec(`INSERT INTO user_roles (user_id, role_id)
+		SELECT ?, id FROM roles WHERE name = ?
+		ON CONFLICT DO NOTHING`, userID, role).Error
+}
@@ -0,0 +1,40 @@
+package rbac
+
+import (
+	"painaway_test/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeedRoles создаёт справочник прав и роли по умолчанию. Повторный запуск
+// безопасен: существующие роли и права не перезаписываются, добавляются только
+// новые права из кода.
+func SeedRoles(tx *gorm.DB) error {
+	codes := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		perm := models.Permission{Code: p.Code, Description: p.Description}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&perm).Error; err != nil {
+			return err
+		}
+		codes = append(codes, p.Code)
+	}
+
+	for _, r := range defaultRoles {
+		role := models.Role{Name: r.Name, Description: r.Description}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&role).Error; err != nil {
+			return err
+		}
+		grants := r.Permissions
+		if r.Name == RoleAdmin {
+			grants = codes
+		}
+		if err := tx.Exec(`INSERT INTO role_permissions (role_id, permission_id)
+			SELECT r.id, p.id FROM roles r, permissions p
+			WHERE r.name = ? AND p.code IN ?
+			ON CONFLICT DO NOTHING`, r.Name, grants).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package rbac
+
+import (
+	"painaway_test/models"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type Service struct {
+	Repo   Repository
+	Logger *zap.Logger
+
+	mu     sync.RWMutex
+	grants map[string]map[string]bool // роль -> набор прав; nil — ещё не загружены
+}
+
+func NewService(repo Repository, logger *zap.Logger) *Service {
+	return &Service{Repo: repo, Logger: logger}
+}
+
+// Permissions — объединение прав ролей. Права ролей загружаются из БД один раз
+// и кешируются до Reload.
+func (s *Service) Permissions(roles []string) (map[string]bool, error) {
+	s.mu.RLock()
+	grants := s.grants
+	s.mu.RUnlock()
+	if grants == nil {
+		if err := s.Reload(); err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		grants = s.grants
+		s.mu.RUnlock()
+	}
+
+	result := make(map[string]bool)
+	for _, role := range roles {
+		for perm := range grants[role] {
+			result[perm] = true
+		}
+	}
+	return result, nil
+}
+
+// Reload перечитывает права ролей из БД.
+func (s *Service) Reload() error {
+	rows, err := s.Repo.GetRoleGrants()
+	if err != nil {
+		return err
+	}
+	grants := make(map[string]map[string]bool, len(rows))
+	for role, codes := range rows {
+		set := make(map[string]bool, len(codes))
+		for _, code := range codes {
+			set[code] = true
+		}
+		grants[role] = set
+	}
+
+	s.mu.Lock()
+	s.grants = grants
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Service) UserRoles(userID uint) ([]string, error) {
+	return s.Repo.GetUserRoles(userID)
+}
+
+func (s *Service) GetRole(name string) (*models.Role, error) {
+	return s.Repo.GetRoleByName(name)
+}
+
+func (s *Service) ListRoles() ([]models.Role, error) {
+	return s.Repo.GetRoles()
+}
@@ -0,0 +1,143 @@
+package reminders
+
+import (
+	"errors"
+	"net/http"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	Service *Service
+	Logger  *zap.Logger
+}
+
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+	h := &Handler{Service: service, Logger: logger}
+	rg.GET("/reminders/", rbac.RequirePermission(logger, rbac.PermRemindersManage), h.GetSettings)
+	rg.PUT("/reminders/timezone", rbac.RequirePermission(logger, rbac.PermRemindersManage), h.SetTimezone)
+	rg.POST("/reminders/", rbac.RequirePermission(logger, rbac.PermRemindersManage), h.CreateReminder)
+	rg.PATCH("/reminders/:id", rbac.RequirePermission(logger, rbac.PermRemindersManage), h.UpdateReminder)
+	rg.DELETE("/reminders/:id", rbac.RequirePermission(logger, rbac.PermRemindersManage), h.DeleteReminder)
+}
+
+func (h *Handler) GetSettings(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+
+	settings, err := h.Service.GetSettings(userID.(uint))
+	if err != nil {
+		h.respondError(c, err, "failed to fetch reminders")
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *Handler) SetTimezone(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.TimezoneDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request", h.Logger)
+		return
+	}
+
+	if err := h.Service.SetTimezone(userID.(uint), req.Timezone); err != nil {
+		h.respondError(c, err, "failed to update timezone")
+		return
+	}
+	h.Logger.Info("timezone updated", zap.Uint("userID", userID.(uint)), zap.String("timezone", req.Timezone))
+	c.JSON(http.StatusOK, gin.H{"timezone": req.Timezone})
+}
+
+func (h *Handler) CreateReminder(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.ReminderInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request", h.Logger)
+		return
+	}
+
+	setting, err := h.Service.CreateReminder(userID.(uint), req)
+	if err != nil {
+		h.respondError(c, err, "failed to create reminder")
+		return
+	}
+	h.Logger.Info("reminder created", zap.Uint("userID", userID.(uint)), zap.Uint("reminderID", setting.ID))
+	c.JSON(http.StatusCreated, h.Service.ToReminderDTO([]models.ReminderSetting{*setting})[0])
+}
+
+func (h *Handler) UpdateReminder(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	reminderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid reminder id", h.Logger)
+		return
+	}
+	var req utils.ReminderInputDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request", h.Logger)
+		return
+	}
+
+	setting, err := h.Service.UpdateReminder(userID.(uint), uint(reminderID), req)
+	if err != nil {
+		h.respondError(c, err, "failed to update reminder")
+		return
+	}
+	c.JSON(http.StatusOK, h.Service.ToReminderDTO([]models.ReminderSetting{*setting})[0])
+}
+
+func (h *Handler) DeleteReminder(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	reminderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid reminder id", h.Logger)
+		return
+	}
+
+	if err := h.Service.DeleteReminder(userID.(uint), uint(reminderID)); err != nil {
+		h.respondError(c, err, "failed to delete reminder")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "not found", h.Logger)
+	case errors.Is(err, ErrForbidden):
+		response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+	case errors.Is(err, ErrInvalidReminder), errors.Is(err, ErrInvalidTimezone):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
+}
@@ -0,0 +1,158 @@
+package reminders
+
+import (
+	"painaway_test/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repo struct {
+	DB *gorm.DB
+}
+
+type Repository interface {
+	GetSettingsByUserID(userID uint) ([]models.ReminderSetting, error)
+	GetSettingByID(id uint) (*models.ReminderSetting, error)
+	CreateSetting(setting *models.ReminderSetting) error
+	UpdateSetting(setting *models.ReminderSetting) error
+	DeleteSetting(id uint) error
+	GetUserTimezone(userID uint) (string, error)
+	UpdateUserTimezone(userID uint, timezone string) error
+	GetTimezones(userIDs []uint) (map[uint]string, error)
+	GetEnabledSettings(kind string) ([]models.ReminderSetting, error)
+	GetUsersWithDisabledKind(kind string) ([]uint, error)
+	GetScheduledPrescriptions(from, to time.Time) ([]models.Prescription, error)
+	GetBookedAppointments(from, to time.Time) ([]models.Appointment, error)
+	HasNoteSince(patientID uint, since time.Time) (bool, error)
+	HasIntakeForSlot(prescriptionID uint, scheduledFor time.Time) (bool, error)
+	TryLog(entry *models.ReminderLog) (bool, error)
+	DeleteLogsBefore(before time.Time) (int64, error)
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &Repo{DB: db}
+}
+
+func (r *Repo) GetSettingsByUserID(userID uint) ([]models.ReminderSetting, error) {
+	var settings []models.ReminderSetting
+	if err := r.DB.Where("user_id = ?", userID).Order("kind, time_of_day, id").Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (r *Repo) GetSettingByID(id uint) (*models.ReminderSetting, error) {
+	var setting models.ReminderSetting
+	if err := r.DB.First(&setting, id).Error; err != nil {
+		return nil, err
+	}
+	return &setting, nil
+}
+
+func (r *Repo) CreateSetting(setting *models.ReminderSetting) error {
+	return r.DB.Create(setting).Error
+}
+
+func (r *Repo) UpdateSetting(setting *models.ReminderSetting) error {
+	return r.DB.Save(setting).Error
+}
+
+func (r *Repo) DeleteSetting(id uint) error {
+	return r.DB.Delete(&models.ReminderSetting{}, id).Error
+}
+
+func (r *Repo) GetUserTimezone(userID uint) (string, error) {
+	var user models.User
+	if err := r.DB.Select("timezone").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.Timezone, nil
+}
+
+func (r *Repo) UpdateUserTimezone(userID uint, timezone string) error {
+	return r.DB.Model(&models.User{}).Where("id = ?", userID).Update("timezone", timezone).Error
+}
+
+func (r *Repo) GetTimezones(userIDs []uint) (map[uint]string, error) {
+	result := make(map[uint]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+	var users []models.User
+	if err := r.DB.Select("id, timezone").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		result[u.ID] = u.Timezone
+	}
+	return result, nil
+}
+
+func (r *Repo) GetEnabledSettings(kind string) ([]models.ReminderSetting, error) {
+	var settings []models.ReminderSetting
+	if err := r.DB.Where("kind = ? AND enabled", kind).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (r *Repo) GetUsersWithDisabledKind(kind string) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Model(&models.ReminderSetting{}).
+		Where("kind = ? AND NOT enabled", kind).
+		Distinct().
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// GetScheduledPrescriptions — назначения с расписанием, действующие хотя бы
+// в один из дней [from, to]. День приёма уточняется уже в часовом поясе пациента.
+func (r *Repo) GetScheduledPrescriptions(from, to time.Time) ([]models.Prescription, error) {
+	var prescriptions []models.Prescription
+	if err := r.DB.
+		Where("NOT prn AND start_date <= ? AND (end_date IS NULL OR end_date >= ?)", to, from).
+		Find(&prescriptions).Error; err != nil {
+		return nil, err
+	}
+	return prescriptions, nil
+}
+
+// GetBookedAppointments — действующие записи на приём с началом в (from, to].
+func (r *Repo) GetBookedAppointments(from, to time.Time) ([]models.Appointment, error) {
+	var appts []models.Appointment
+	if err := r.DB.Preload("Doctor").Preload("Patient").
+		Where("status = ? AND starts_at > ? AND starts_at <= ?", "booked", from, to).
+		Find(&appts).Error; err != nil {
+		return nil, err
+	}
+	return appts, nil
+}
+
+func (r *Repo) HasNoteSince(patientID uint, since time.Time) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Note{}).
+		Where("patient_id = ? AND recorded_at >= ?", patientID, since).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *Repo) HasIntakeForSlot(prescriptionID uint, scheduledFor time.Time) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.MedicationIntake{}).
+		Where("prescription_id = ? AND scheduled_for = ?", prescriptionID, scheduledFor).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// TryLog фиксирует отправку напоминания; false — напоминание уже отправлялось.
+func (r *Repo) TryLog(entry *models.ReminderLog) (bool, error) {
+	res := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(entry)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *Repo) DeleteLogsBefore(before time.Time) (int64, error) {
+	res := r.DB.Where("scheduled_for < ?", before).Delete(&models.ReminderLog{})
+	return res.RowsAffected, res.Error
+}
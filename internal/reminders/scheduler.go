@@ -0,0 +1,332 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"painaway_test/internal/config"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/notifications"
+	"painaway_test/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// сколько хранить журнал отправленных напоминаний
+const logRetention = 7 * 24 * time.Hour
+
+// Scheduler — фоновый воркер, который раз в Interval создаёт уведомления-напоминания:
+// заполнить дневник (по настройкам пользователя), принять лекарство (по расписанию
+// назначений) и прийти на приём. Время считается в часовом поясе пользователя.
+// На каждом проходе также вызываются обработчики обслуживания (OnTick).
+type Scheduler struct {
+	Repo                 Repository
+	NotificationsService *notifications.Service
+	Config               *config.RemindersConfig
+	Logger               *zap.Logger
+
+	tickHooks []func(now time.Time)
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(repo Repository, notifSrv *notifications.Service, cfg *config.RemindersConfig, logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		Repo:                 repo,
+		NotificationsService: notifSrv,
+		Config:               cfg,
+		Logger:               logger,
+	}
+}
+
+// OnTick регистрирует обработчик, вызываемый на каждом проходе воркера (очистка
+// просроченных записей и т.п.) — даже если сами напоминания выключены.
+// Обработчики вызываются синхронно и сами логируют ошибки.
+func (s *Scheduler) OnTick(hook func(now time.Time)) {
+	s.tickHooks = append(s.tickHooks, hook)
+}
+
+// Start запускает воркер в отдельной горутине. Остановить — через Stop.
+func (s *Scheduler) Start() {
+	if !s.Config.Enabled {
+		s.Logger.Info("reminders disabled")
+		if len(s.tickHooks) == 0 {
+			return
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx)
+	}()
+	s.Logger.Info("reminder scheduler started", zap.Duration("interval", s.Config.Interval))
+}
+
+// Stop останавливает воркер и ждёт завершения текущего прохода, но не дольше, чем позволяет ctx.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.Logger.Info("reminder scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(s.Config.Interval)
+	defer ticker.Stop()
+
+	s.tick(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.tick(ctx, now)
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context, now time.Time) {
+	for _, hook := range s.tickHooks {
+		if ctx.Err() != nil {
+			return
+		}
+		hook(now)
+	}
+	if !s.Config.Enabled {
+		return
+	}
+
+	s.sendPainLogReminders(ctx, now)
+	if ctx.Err() != nil {
+		return
+	}
+	s.sendMedicationReminders(ctx, now)
+	if ctx.Err() != nil {
+		return
+	}
+	s.sendAppointmentReminders(ctx, now)
+
+	if _, err := s.Repo.DeleteLogsBefore(now.Add(-logRetention)); err != nil {
+		s.Logger.Warn("failed to purge reminder log", zap.Error(err))
+	}
+}
+
+func (s *Scheduler) sendPainLogReminders(ctx context.Context, now time.Time) {
+	settings, err := s.Repo.GetEnabledSettings(KindPainLog)
+	if err != nil {
+		s.Logger.Error("failed to load pain log reminders", zap.Error(err))
+		return
+	}
+	timezones, err := s.Repo.GetTimezones(settingUserIDs(settings))
+	if err != nil {
+		s.Logger.Error("failed to load user timezones", zap.Error(err))
+		return
+	}
+
+	for _, setting := range settings {
+		if ctx.Err() != nil {
+			return
+		}
+		loc := diary.UserLocation(timezones[setting.UserID])
+		local := now.In(loc)
+		slot, ok := slotOn(local, setting.TimeOfDay)
+		if !ok || !s.due(slot, now) {
+			continue
+		}
+
+		// запись за сегодня уже есть — напоминать не о чем
+		y, m, d := local.Date()
+		logged, err := s.Repo.HasNoteSince(setting.UserID, time.Date(y, m, d, 0, 0, 0, 0, loc))
+		if err != nil {
+			s.Logger.Error("failed to check today's notes", zap.Uint("userID", setting.UserID), zap.Error(err))
+			continue
+		}
+		if logged {
+			continue
+		}
+
+		s.send(setting.UserID, KindPainLog, setting.ID, slot, "Не забудьте заполнить дневник боли за сегодня")
+	}
+}
+
+func (s *Scheduler) sendMedicationReminders(ctx context.Context, now time.Time) {
+	// с запасом в сутки в обе стороны: дата приёма зависит от часового пояса пациента
+	day := now.UTC().Truncate(24 * time.Hour)
+	prescriptions, err := s.Repo.GetScheduledPrescriptions(day.AddDate(0, 0, -1), day.AddDate(0, 0, 1))
+	if err != nil {
+		s.Logger.Error("failed to load prescriptions for reminders", zap.Error(err))
+		return
+	}
+	if len(prescriptions) == 0 {
+		return
+	}
+
+	disabled, err := s.Repo.GetUsersWithDisabledKind(KindMedication)
+	if err != nil {
+		s.Logger.Error("failed to load medication reminder settings", zap.Error(err))
+		return
+	}
+	optedOut := make(map[uint]bool, len(disabled))
+	for _, id := range disabled {
+		optedOut[id] = true
+	}
+
+	patientIDs := make([]uint, 0, len(prescriptions))
+	for _, p := range prescriptions {
+		patientIDs = append(patientIDs, p.PatientID)
+	}
+	timezones, err := s.Repo.GetTimezones(patientIDs)
+	if err != nil {
+		s.Logger.Error("failed to load user timezones", zap.Error(err))
+		return
+	}
+
+	for _, p := range prescriptions {
+		if ctx.Err() != nil {
+			return
+		}
+		if optedOut[p.PatientID] {
+			continue
+		}
+		local := now.In(diary.UserLocation(timezones[p.PatientID]))
+		if !diary.IsDoseDay(p, local) {
+			continue
+		}
+
+		for _, tod := range p.TimesOfDay {
+			slot, ok := slotOn(local, tod)
+			if !ok || !s.due(slot, now) {
+				continue
+			}
+
+			// приём уже отмечен — напоминание не нужно
+			taken, err := s.Repo.HasIntakeForSlot(p.ID, slot.UTC())
+			if err != nil {
+				s.Logger.Error("failed to check intake", zap.Uint("prescriptionID", p.ID), zap.Error(err))
+				continue
+			}
+			if taken {
+				continue
+			}
+
+			s.send(p.PatientID, KindMedication, p.ID, slot, medicationMessage(p, tod))
+		}
+	}
+}
+
+// sendAppointmentReminders напоминает пациенту и врачу о приёме, который начнётся
+// в ближайшие AppointmentLead. Запись, сделанная позже этого срока, получает
+// напоминание сразу.
+func (s *Scheduler) sendAppointmentReminders(ctx context.Context, now time.Time) {
+	if s.Config.AppointmentLead <= 0 {
+		return
+	}
+	appts, err := s.Repo.GetBookedAppointments(now, now.Add(s.Config.AppointmentLead))
+	if err != nil {
+		s.Logger.Error("failed to load appointments for reminders", zap.Error(err))
+		return
+	}
+	if len(appts) == 0 {
+		return
+	}
+
+	disabled, err := s.Repo.GetUsersWithDisabledKind(KindAppointment)
+	if err != nil {
+		s.Logger.Error("failed to load appointment reminder settings", zap.Error(err))
+		return
+	}
+	optedOut := make(map[uint]bool, len(disabled))
+	for _, id := range disabled {
+		optedOut[id] = true
+	}
+
+	for _, a := range appts {
+		if ctx.Err() != nil {
+			return
+		}
+		if !optedOut[a.PatientID] {
+			s.send(a.PatientID, KindAppointment, a.ID, a.StartsAt, fmt.Sprintf("Напоминание: приём у врача %s %s %s",
+				a.Doctor.LastName, a.Doctor.FirstName, a.StartsAt.In(diary.UserLocation(a.Patient.Timezone)).Format("02.01.2006 15:04")))
+		}
+		if !optedOut[a.DoctorID] {
+			s.send(a.DoctorID, KindAppointment, a.ID, a.StartsAt, fmt.Sprintf("Напоминание: приём пациента %s %s %s",
+				a.Patient.LastName, a.Patient.FirstName, a.StartsAt.In(diary.UserLocation(a.Doctor.Timezone)).Format("02.01.2006 15:04")))
+		}
+	}
+}
+
+// due — наступило ли время напоминания и не устарело ли оно.
+func (s *Scheduler) due(slot, now time.Time) bool {
+	return !slot.After(now) && now.Sub(slot) <= s.Config.CatchUp
+}
+
+func (s *Scheduler) send(userID uint, kind string, refID uint, slot time.Time, message string) {
+	first, err := s.Repo.TryLog(&models.ReminderLog{
+		UserID:       userID,
+		Kind:         kind,
+		RefID:        refID,
+		ScheduledFor: slot.UTC(),
+	})
+	if err != nil {
+		s.Logger.Error("failed to record reminder", zap.Uint("userID", userID), zap.String("kind", kind), zap.Error(err))
+		return
+	}
+	if !first {
+		return
+	}
+
+	if err := s.NotificationsService.CreateNotification(userID, message); err != nil {
+		s.Logger.Error("failed to send reminder", zap.Uint("userID", userID), zap.String("kind", kind), zap.Error(err))
+		return
+	}
+	s.Logger.Info("reminder sent", zap.Uint("userID", userID), zap.String("kind", kind), zap.Uint("refID", refID), zap.Time("scheduledFor", slot))
+}
+
+func medicationMessage(p models.Prescription, tod string) string {
+	dose := strconv.FormatFloat(p.Dose, 'f', -1, 64)
+	return fmt.Sprintf("Пора принять %s %s %s (%s)", p.MedicationName, dose, p.Unit, tod)
+}
+
+// slotOn — момент времени HH:MM в день local в его часовом поясе.
+func slotOn(local time.Time, tod string) (time.Time, bool) {
+	hh, mm, ok := strings.Cut(tod, ":")
+	if !ok {
+		return time.Time{}, false
+	}
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if errH != nil || errM != nil {
+		return time.Time{}, false
+	}
+	y, mon, d := local.Date()
+	return time.Date(y, mon, d, h, m, 0, 0, local.Location()), true
+}
+
+func settingUserIDs(settings []models.ReminderSetting) []uint {
+	ids := make([]uint, 0, len(settings))
+	for _, s := range settings {
+		ids = append(ids, s.UserID)
+	}
+	return ids
+}
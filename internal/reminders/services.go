@@ -0,0 +1,179 @@
+package reminders
+
+import (
+	"errors"
+	"fmt"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"regexp"
+	"time"
+)
+
+const (
+	KindPainLog    = "pain_log"
+	KindMedication = "medication"
+	// KindAppointment только включает или выключает напоминания о записях на приём
+	KindAppointment = "appointment"
+
+	// ограничение на число напоминаний заполнить дневник у одного пользователя
+	maxPainLogReminders = 10
+)
+
+var (
+	ErrInvalidReminder = errors.New("invalid reminder")
+	ErrInvalidTimezone = errors.New("invalid timezone")
+	ErrForbidden       = errors.New("access denied")
+
+	timeOfDayRe = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+)
+
+type Service struct {
+	Repo Repository
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{Repo: repo}
+}
+
+func (s *Service) GetSettings(userID uint) (*utils.ReminderSettingsDTO, error) {
+	timezone, err := s.Repo.GetUserTimezone(userID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.Repo.GetSettingsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.ReminderSettingsDTO{
+		Timezone:  timezone,
+		Reminders: s.ToReminderDTO(settings),
+	}, nil
+}
+
+func (s *Service) SetTimezone(userID uint, timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "" || timezone == "Local" {
+		return fmt.Errorf("%w: %q", ErrInvalidTimezone, timezone)
+	}
+	return s.Repo.UpdateUserTimezone(userID, timezone)
+}
+
+func (s *Service) CreateReminder(userID uint, req utils.ReminderInputDTO) (*models.ReminderSetting, error) {
+	setting := &models.ReminderSetting{UserID: userID, Enabled: true}
+	applyReminderInput(setting, req)
+
+	existing, err := s.Repo.GetSettingsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateReminder(setting, existing); err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.CreateSetting(setting); err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
+
+func (s *Service) UpdateReminder(userID, reminderID uint, req utils.ReminderInputDTO) (*models.ReminderSetting, error) {
+	setting, err := s.getOwnSetting(userID, reminderID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Kind != nil && *req.Kind != setting.Kind {
+		return nil, fmt.Errorf("%w: kind cannot be changed", ErrInvalidReminder)
+	}
+	applyReminderInput(setting, req)
+
+	existing, err := s.Repo.GetSettingsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateReminder(setting, existing); err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.UpdateSetting(setting); err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
+
+func (s *Service) DeleteReminder(userID, reminderID uint) error {
+	setting, err := s.getOwnSetting(userID, reminderID)
+	if err != nil {
+		return err
+	}
+	return s.Repo.DeleteSetting(setting.ID)
+}
+
+func (s *Service) getOwnSetting(userID, reminderID uint) (*models.ReminderSetting, error) {
+	setting, err := s.Repo.GetSettingByID(reminderID)
+	if err != nil {
+		return nil, err
+	}
+	if setting.UserID != userID {
+		return nil, ErrForbidden
+	}
+	return setting, nil
+}
+
+func applyReminderInput(setting *models.ReminderSetting, req utils.ReminderInputDTO) {
+	if req.Kind != nil {
+		setting.Kind = *req.Kind
+	}
+	if req.TimeOfDay != nil {
+		setting.TimeOfDay = *req.TimeOfDay
+	}
+	if req.Enabled != nil {
+		setting.Enabled = *req.Enabled
+	}
+}
+
+// validateReminder проверяет настройку с учётом уже существующих (existing может
+// содержать и саму настройку — при обновлении).
+func validateReminder(setting *models.ReminderSetting, existing []models.ReminderSetting) error {
+	switch setting.Kind {
+	case KindPainLog:
+		if !timeOfDayRe.MatchString(setting.TimeOfDay) {
+			return fmt.Errorf("%w: time_of_day must be HH:MM", ErrInvalidReminder)
+		}
+		count := 0
+		for _, e := range existing {
+			if e.ID == setting.ID || e.Kind != KindPainLog {
+				continue
+			}
+			if e.TimeOfDay == setting.TimeOfDay {
+				return fmt.Errorf("%w: reminder at %s already exists", ErrInvalidReminder, setting.TimeOfDay)
+			}
+			count++
+		}
+		if count >= maxPainLogReminders {
+			return fmt.Errorf("%w: at most %d pain log reminders are allowed", ErrInvalidReminder, maxPainLogReminders)
+		}
+	case KindMedication, KindAppointment:
+		// время берётся из назначений или записей, настройка только включает или выключает напоминания
+		setting.TimeOfDay = ""
+		for _, e := range existing {
+			if e.ID != setting.ID && e.Kind == setting.Kind {
+				return fmt.Errorf("%w: %s reminder setting already exists", ErrInvalidReminder, setting.Kind)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: kind must be %s, %s or %s", ErrInvalidReminder, KindPainLog, KindMedication, KindAppointment)
+	}
+	return nil
+}
+
+func (s *Service) ToReminderDTO(settings []models.ReminderSetting) []utils.ReminderSettingDTO {
+	dto := make([]utils.ReminderSettingDTO, 0, len(settings))
+	for _, r := range settings {
+		dto = append(dto, utils.ReminderSettingDTO{
+			ID:        r.ID,
+			Kind:      r.Kind,
+			TimeOfDay: r.TimeOfDay,
+			Enabled:   r.Enabled,
+		})
+	}
+	return dto
+}
@@ -22,9 +22,24 @@ func NewErrorResponse(c *gin.Context, statusCode int, message string, logger *za
 	case 401:
 		errMsg = "UnauthorizedException"
 		logger.Warn(message, zap.Int("status", statusCode), zap.String("error_type", errMsg), zap.String("path", c.Request.URL.Path))
-	case 402:
+	case 403:
 		errMsg = "ForbiddenException"
 		logger.Warn(message, zap.Int("status", statusCode), zap.String("error_type", errMsg), zap.String("path", c.Request.URL.Path))
+	case 404:
+		errMsg = "NotFoundException"
+		logger.Warn(message, zap.Int("status", statusCode), zap.String("error_type", errMsg), zap.String("path", c.Request.URL.Path))
+	case 409:
+		errMsg = "ConflictException"
+		logger.Warn(message, zap.Int("status", statusCode), zap.String("error_type", errMsg), zap.String("path", c.Request.URL.Path))
+	case 413:
+		errMsg = "PayloadTooLargeException"
+		logger.Warn(message, zap.Int("status", statusCode), zap.String("error_type", errMsg), zap.String("path", c.Request.URL.Path))
+	case 422:
+		errMsg = "UnprocessableEntityException"
+		logger.Warn(message, zap.Int("status", statusCode), zap.String("error_type", errMsg), zap.String("path", c.Request.URL.Path))
+	case 429:
+		errMsg = "TooManyRequestsException"
+		logger.Warn(message, zap.Int("status", statusCode), zap.String("error_type", errMsg), zap.String("path", c.Request.URL.Path))
 	default:
 		errMsg = "InternalServerError"
 		logger.Error(message, zap.Int("status", statusCode), zap.String("error_type", errMsg), zap.String("path", c.Request.URL.Path))
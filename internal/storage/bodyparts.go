@@ -0,0 +1,63 @@
+package storage
+
+import "painaway_test/models"
+
+// defaultBodyParts — исходный каталог частей тела. ID совпадают со старыми
+// значениями Note.BodyPart, поэтому существующие записи остаются валидными.
+var defaultBodyParts = []models.BodyPart{
+	{ID: 1, Code: "head", View: "front", Side: "center", Labels: labels("Голова", "Head")},
+	{ID: 2, Code: "face", View: "front", Side: "center", ParentID: bodyPartRef(1), Labels: labels("Лицо", "Face")},
+	{ID: 3, Code: "neck", View: "front", Side: "center", Labels: labels("Шея", "Neck")},
+	{ID: 4, Code: "left_shoulder", View: "front", Side: "left", Labels: labels("Левое плечо", "Left shoulder")},
+	{ID: 5, Code: "right_shoulder", View: "front", Side: "right", Labels: labels("Правое плечо", "Right shoulder")},
+	{ID: 6, Code: "left_arm", View: "front", Side: "left", Labels: labels("Левая рука", "Left arm")},
+	{ID: 7, Code: "left_forearm", View: "front", Side: "left", ParentID: bodyPartRef(6), Labels: labels("Левое предплечье", "Left forearm")},
+	{ID: 8, Code: "right_arm", View: "front", Side: "right", Labels: labels("Правая рука", "Right arm")},
+	{ID: 9, Code: "right_forearm", View: "front", Side: "right", ParentID: bodyPartRef(8), Labels: labels("Правое предплечье", "Right forearm")},
+	{ID: 10, Code: "left_chest", View: "front", Side: "left", Labels: labels("Левая часть груди", "Left chest")},
+	{ID: 11, Code: "right_chest", View: "front", Side: "right", Labels: labels("Правая часть груди", "Right chest")},
+	{ID: 12, Code: "left_abdomen", View: "front", Side: "left", ParentID: bodyPartRef(15), Labels: labels("Левая часть живота", "Left abdomen")},
+	{ID: 13, Code: "left_ribs", View: "front", Side: "left", ParentID: bodyPartRef(10), Labels: labels("Левые рёбра", "Left ribs")},
+	{ID: 14, Code: "right_abdomen", View: "front", Side: "right", ParentID: bodyPartRef(15), Labels: labels("Правая часть живота", "Right abdomen")},
+	{ID: 15, Code: "abdomen", View: "front", Side: "center", Labels: labels("Живот", "Abdomen")},
+	{ID: 16, Code: "right_ribs", View: "front", Side: "right", ParentID: bodyPartRef(11), Labels: labels("Правые рёбра", "Right ribs")},
+	{ID: 17, Code: "left_thigh", View: "front", Side: "left", Labels: labels("Левое бедро", "Left thigh")},
+	{ID: 18, Code: "left_inner_thigh", View: "front", Side: "left", ParentID: bodyPartRef(17), Labels: labels("Левая внутренняя часть бедра", "Left inner thigh")},
+	{ID: 19, Code: "left_foot", View: "front", Side: "left", Labels: labels("Левая ступня", "Left foot")},
+	{ID: 20, Code: "left_calf", View: "front", Side: "left", Labels: labels("Левая икра", "Left calf")},
+	{ID: 21, Code: "left_knee", View: "front", Side: "left", Labels: labels("Левое колено", "Left knee")},
+	{ID: 22, Code: "right_thigh", View: "front", Side: "right", Labels: labels("Правое бедро", "Right thigh")},
+	{ID: 23, Code: "genitals", View: "front", Side: "center", Labels: labels("Гениталии", "Genitals")},
+	{ID: 24, Code: "right_inner_thigh", View: "front", Side: "right", ParentID: bodyPartRef(22), Labels: labels("Правая внутренняя часть бедра", "Right inner thigh")},
+	{ID: 25, Code: "right_foot", View: "front", Side: "right", Labels: labels("Правая ступня", "Right foot")},
+	{ID: 26, Code: "right_calf", View: "front", Side: "right", Labels: labels("Правая икра", "Right calf")},
+	{ID: 27, Code: "right_knee", View: "front", Side: "right", Labels: labels("Правое колено", "Right knee")},
+	{ID: 28, Code: "right_elbow", View: "front", Side: "right", ParentID: bodyPartRef(8), Labels: labels("Правый локтевой сустав", "Right elbow")},
+	{ID: 29, Code: "right_palm", View: "front", Side: "right", ParentID: bodyPartRef(8), Labels: labels("Правая ладонь", "Right palm")},
+	{ID: 30, Code: "left_elbow", View: "front", Side: "left", ParentID: bodyPartRef(6), Labels: labels("Левый локтевой сустав", "Left elbow")},
+	{ID: 31, Code: "left_palm", View: "front", Side: "left", ParentID: bodyPartRef(6), Labels: labels("Левая ладонь", "Left palm")},
+	{ID: 32, Code: "left_shoulder_back", View: "back", Side: "left", Labels: labels("Левая задняя часть плеча", "Left shoulder (back)")},
+	{ID: 33, Code: "left_leg_back", View: "back", Side: "left", Labels: labels("Левая нога (сзади)", "Left leg (back)")},
+	{ID: 34, Code: "buttocks", View: "back", Side: "center", Labels: labels("Ягодицы", "Buttocks")},
+	{ID: 35, Code: "lower_back", View: "back", Side: "center", Labels: labels("Поясница", "Lower back")},
+	{ID: 36, Code: "spine", View: "back", Side: "center", Labels: labels("Позвоночник", "Spine")},
+	{ID: 37, Code: "back_of_head", View: "back", Side: "center", Labels: labels("Задняя часть головы", "Back of the head")},
+	{ID: 38, Code: "occiput", View: "back", Side: "center", ParentID: bodyPartRef(37), Labels: labels("Затылок", "Occiput")},
+	{ID: 39, Code: "right_shoulder_back", View: "back", Side: "right", Labels: labels("Правая задняя часть плеча", "Right shoulder (back)")},
+	{ID: 40, Code: "right_leg_back", View: "back", Side: "right", Labels: labels("Правая нога (сзади)", "Right leg (back)")},
+	{ID: 41, Code: "right_back", View: "back", Side: "right", Labels: labels("Правая задняя часть спины", "Right side of the back")},
+	{ID: 42, Code: "right_clavicle", View: "front", Side: "right", Labels: labels("Правая ключица", "Right clavicle")},
+	{ID: 43, Code: "left_back", View: "back", Side: "left", Labels: labels("Левая задняя часть спины", "Left side of the back")},
+	{ID: 44, Code: "left_clavicle", View: "front", Side: "left", Labels: labels("Левая ключица", "Left clavicle")},
+}
+
+func bodyPartRef(id uint) *uint {
+	return &id
+}
+
+func labels(ru, en string) []models.BodyPartLabel {
+	return []models.BodyPartLabel{
+		{Locale: "ru", Label: ru},
+		{Locale: "en", Label: en},
+	}
+}
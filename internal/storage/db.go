@@ -26,6 +26,8 @@ func Connect(cfg *config.DBConfig) (*gorm.DB, error) {
 
 	gormConfig := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// нарушение уникальности приходит как gorm.ErrDuplicatedKey, а не ошибкой драйвера
+		TranslateError: true,
 	}
 
 	db, err := gorm.Open(postgres.Open(dsn), gormConfig)
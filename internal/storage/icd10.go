@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// icd10CSV — встроенная часть МКБ-10: коды, с которыми чаще всего работает
+// клиника боли. Полный справочник можно загрузить из файла того же формата
+// (icd10.file в конфиге).
+//
+//go:embed icd10.csv
+var icd10CSV []byte
+
+const icd10BatchSize = 500
+
+func seedICD10(tx *gorm.DB) error {
+	codes, err := ParseICD10(bytes.NewReader(icd10CSV))
+	if err != nil {
+		return fmt.Errorf("embedded icd10 table: %w", err)
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(codes, icd10BatchSize).Error
+}
+
+// ImportICD10 загружает справочник из CSV (code,description с заголовком).
+// Описания существующих кодов обновляются.
+func ImportICD10(db *gorm.DB, r io.Reader) (int, error) {
+	codes, err := ParseICD10(r)
+	if err != nil {
+		return 0, err
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description"}),
+	}).CreateInBatches(codes, icd10BatchSize).Error
+	return len(codes), err
+}
+
+func ParseICD10(r io.Reader) ([]models.ICD10Code, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimPrefix(header[0], "\ufeff") != "code" || header[1] != "description" {
+		return nil, errors.New("icd10: expected header \"code,description\"")
+	}
+
+	var codes []models.ICD10Code
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToUpper(strings.TrimSpace(record[0]))
+		if !utils.ICD10CodeRe.MatchString(code) {
+			return nil, fmt.Errorf("icd10: invalid code %q", record[0])
+		}
+		codes = append(codes, models.ICD10Code{Code: code, Description: strings.TrimSpace(record[1])})
+	}
+	return codes, nil
+}
@@ -9,10 +9,134 @@ import (
 // TODO: Полноценные миграции вместо авто
 
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := dedupeActiveLinks(db); err != nil {
+		return err
+	}
+	hadRoles := db.Migrator().HasColumn(&models.Subscription{}, "Role")
+	hadSyncVersion := db.Migrator().HasColumn(&models.Note{}, "SyncVersion")
+	if err := db.AutoMigrate(
+		&models.Role{},
+		&models.Permission{},
 		&models.User{},
 		&models.Note{},
+		&models.NoteBodyPart{},
+		&models.Tag{},
 		&models.Subscription{},
+		&models.Prescription{},
+		&models.MedicationIntake{},
 		&models.Notification{},
-	)
+		&models.Conversation{},
+		&models.Message{},
+		&models.MessageAttachment{},
+		&models.BodyPart{},
+		&models.BodyPartLabel{},
+		&models.Attachment{},
+		&models.NoteComment{},
+		&models.IdempotencyRecord{},
+		&models.AvailabilitySlot{},
+		&models.Appointment{},
+		&models.ReminderSetting{},
+		&models.ReminderLog{},
+		&models.LinkRevision{},
+		&models.ICD10Code{},
+		&models.Diagnosis{},
+		&models.QuestionnaireAssignment{},
+		&models.QuestionnaireResponse{},
+		&models.InviteCode{},
+		&models.InviteRedemption{},
+		&models.InviteAttempt{},
+		&models.DoctorProfile{},
+		&models.LinkConsent{},
+		&models.AccessLog{},
+		&models.DoctorApplication{},
+		&models.DoctorApplicationDocument{},
+		&models.EmailChange{},
+	); err != nil {
+		return err
+	}
+	if !hadRoles {
+		if err := assignCareTeamLeads(db); err != nil {
+			return err
+		}
+	}
+	if err := versionNotes(db, !hadSyncVersion); err != nil {
+		return err
+	}
+	return protectAccessLog(db)
+}
+
+// versionNotes вешает на notes триггер, который при каждой вставке и изменении
+// выдаёт записи новый sync_version. Перед этим триггер берёт блокировку пациента
+// до конца транзакции: ревизии одного пациента фиксируются по порядку, и курсор
+// синхронизации не пропускает запись, закоммиченную позже соседней.
+// Первый ключ блокировки (3) не пересекается с ключами расписаний в appointments.
+// При первом запуске существующим записям ревизии раздаются по updated_at.
+func versionNotes(db *gorm.DB, backfill bool) error {
+	if err := db.Exec(`CREATE SEQUENCE IF NOT EXISTS notes_sync_version_seq`).Error; err != nil {
+		return err
+	}
+	if backfill {
+		if err := db.Exec(`UPDATE notes n SET sync_version = v.version
+			FROM (SELECT id, row_number() OVER (ORDER BY updated_at, id) AS version FROM notes) v
+			WHERE n.id = v.id`).Error; err != nil {
+			return err
+		}
+		if err := db.Exec(`SELECT setval('notes_sync_version_seq', GREATEST((SELECT MAX(sync_version) FROM notes), 1))`).Error; err != nil {
+			return err
+		}
+	}
+	if err := db.Exec(`CREATE OR REPLACE FUNCTION notes_sync_version() RETURNS trigger AS $$
+		BEGIN
+			PERFORM pg_advisory_xact_lock(3, NEW.patient_id::int);
+			NEW.sync_version := nextval('notes_sync_version_seq');
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql`).Error; err != nil {
+		return err
+	}
+	return db.Exec(`CREATE OR REPLACE TRIGGER notes_sync_version
+		BEFORE INSERT OR UPDATE ON notes
+		FOR EACH ROW EXECUTE FUNCTION notes_sync_version()`).Error
+}
+
+// dedupeActiveLinks закрывает повторные привязки, созданные до появления индекса
+// idx_subscription_active: из нескольких pending/accepted для одной пары врач–пациент
+// остаётся принятая, а среди равных — самая ранняя.
+func dedupeActiveLinks(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.Subscription{}) {
+		return nil
+	}
+	return db.Exec(`UPDATE subscriptions s
+		SET status = CASE WHEN s.status = 'accepted' THEN 'ended' ELSE 'cancelled' END
+		WHERE s.status IN ('pending', 'accepted') AND EXISTS (
+			SELECT 1 FROM subscriptions o
+			WHERE o.doctor_id = s.doctor_id AND o.patient_id = s.patient_id AND o.id <> s.id
+				AND o.status IN ('pending', 'accepted')
+				AND ((o.status = 'accepted' AND s.status = 'pending') OR (o.status = s.status AND o.id < s.id))
+		)`).Error
+}
+
+// assignCareTeamLeads назначает ведущего врача в командах, собранных из привязок,
+// созданных до появления ролей: им становится принятая привязка, а среди равных — самая ранняя.
+func assignCareTeamLeads(db *gorm.DB) error {
+	return db.Exec(`UPDATE subscriptions SET role = 'lead'
+		WHERE id IN (
+			SELECT DISTINCT ON (patient_id) id FROM subscriptions
+			WHERE status IN ('pending', 'accepted')
+			ORDER BY patient_id, status = 'accepted' DESC, id
+		)`).Error
+}
+
+// protectAccessLog запрещает на уровне БД изменять и удалять записи журнала доступа.
+func protectAccessLog(db *gorm.DB) error {
+	if err := db.Exec(`CREATE OR REPLACE FUNCTION access_logs_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'access_logs is append-only';
+		END;
+		$$ LANGUAGE plpgsql`).Error; err != nil {
+		return err
+	}
+	return db.Exec(`CREATE OR REPLACE TRIGGER access_logs_append_only
+		BEFORE UPDATE OR DELETE ON access_logs
+		FOR EACH ROW EXECUTE FUNCTION access_logs_append_only()`).Error
 }
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"painaway_test/internal/rbac"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Seed заполняет справочники. Повторный запуск безопасен: существующие
+// строки не перезаписываются, чтобы не затирать правки из админки.
+func Seed(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := rbac.SeedRoles(tx); err != nil {
+			return err
+		}
+		if err := migrateUserGroups(tx); err != nil {
+			return err
+		}
+		if err := seedBodyParts(tx); err != nil {
+			return err
+		}
+		if err := seedICD10(tx); err != nil {
+			return err
+		}
+		if err := backfillNoteBodyParts(tx); err != nil {
+			return err
+		}
+		if err := backfillNoteRecordedAt(tx); err != nil {
+			return err
+		}
+		return backfillLinkRevisions(tx)
+	})
+}
+
+func seedBodyParts(tx *gorm.DB) error {
+	for i, part := range defaultBodyParts {
+		part.SortOrder = i + 1
+		part.IsActive = true
+		partLabels := part.Labels
+		part.Labels = nil
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&part).Error; err != nil {
+			return err
+		}
+		for _, label := range partLabels {
+			label.BodyPartID = part.ID
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&label).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// ID вставлены явно, поэтому сдвигаем sequence, иначе новые записи из админки упадут на дубликате ключа
+	return tx.Exec(`SELECT setval(pg_get_serial_sequence('body_parts', 'id'), (SELECT COALESCE(MAX(id), 1) FROM body_parts))`).Error
+}
+
+// migrateUserGroups переносит старое поле users.groups в роли пользователей
+// и удаляет его, чтобы роль не читалась из двух мест.
+func migrateUserGroups(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn("users", "groups") {
+		return nil
+	}
+	if err := tx.Exec(`
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT u.id, r.id FROM users u JOIN roles r ON r.name = u.groups
+		ON CONFLICT DO NOTHING`).Error; err != nil {
+		return err
+	}
+	return tx.Migrator().DropColumn("users", "groups")
+}
+
+// backfillNoteBodyParts переносит старое одиночное поле notes.body_part в note_body_parts.
+func backfillNoteBodyParts(tx *gorm.DB) error {
+	return tx.Exec(`
+		INSERT INTO note_body_parts (note_id, body_part_id)
+		SELECT n.id, n.body_part FROM notes n
+		WHERE NOT EXISTS (SELECT 1 FROM note_body_parts nbp WHERE nbp.note_id = n.id)`).Error
+}
+
+func backfillNoteRecordedAt(tx *gorm.DB) error {
+	return tx.Exec(`UPDATE notes SET recorded_at = created_at WHERE recorded_at IS NULL`).Error
+}
+
+// backfillLinkRevisions превращает значения, записанные до появления истории,
+// в первую версию от лечащего врача.
+func backfillLinkRevisions(tx *gorm.DB) error {
+	for _, field := range []string{"prescription", "diagnosis"} {
+		if err := tx.Exec(`
+			INSERT INTO link_revisions (subscription_id, field, value, author_id, created_at)
+			SELECT s.id, ?, s.`+field+`, s.doctor_id, s.updated_at FROM subscriptions s
+			WHERE COALESCE(s.`+field+`, '') <> ''
+			AND NOT EXISTS (SELECT 1 FROM link_revisions r WHERE r.subscription_id = s.id AND r.field = ?)`,
+			field, field).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
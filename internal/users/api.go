@@ -1,21 +1,52 @@
 package users
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"painaway_test/internal/audit"
+	"painaway_test/internal/config"
+	"painaway_test/internal/rbac"
 	"painaway_test/internal/response"
+	"painaway_test/internal/utils"
+	"painaway_test/models"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
-	Service *Service
-	Logger  *zap.Logger
+	Service   *Service
+	JWTConfig *config.JWTConfig
+	Logger    *zap.Logger
 }
 
-func RegisterRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
+func RegisterRoutes(rg *gin.RouterGroup, service *Service, jwtCfg *config.JWTConfig, logger *zap.Logger) {
+	h := &Handler{Service: service, JWTConfig: jwtCfg, Logger: logger}
+	rg.GET("/auth/profile", rbac.RequirePermission(logger, rbac.PermProfileRead), h.GetProfile)
+	rg.PATCH("/users/me", rbac.RequirePermission(logger, rbac.PermProfileWrite), h.UpdateProfile)
+	rg.POST("/users/me/password", rbac.RequirePermission(logger, rbac.PermProfileWrite), h.ChangePassword)
+	rg.POST("/users/me/email", rbac.RequirePermission(logger, rbac.PermProfileWrite), h.RequestEmailChange)
+	rg.POST("/users/me/email/confirm", rbac.RequirePermission(logger, rbac.PermProfileWrite), h.ConfirmEmailChange)
+	rg.GET("/users/:id/profile", rbac.RequirePermission(logger, rbac.PermDiaryRead), h.GetPatientProfile)
+}
+
+// RegisterAdminRoutes регистрирует управление аккаунтами; права проверяются на каждом маршруте.
+// Каждое действие над аккаунтом попадает в журнал доступа.
+func RegisterAdminRoutes(rg *gin.RouterGroup, service *Service, logger *zap.Logger) {
 	h := &Handler{Service: service, Logger: logger}
-	rg.GET("/auth/profile", h.GetProfile)
+	rg.GET("/users/", rbac.RequirePermission(logger, rbac.PermUsersRead), h.AdminListUsers)
+	rg.GET("/users/:id", rbac.RequirePermission(logger, rbac.PermUsersRead), h.AdminGetUser)
+	rg.PUT("/users/:id/roles", rbac.RequirePermission(logger, rbac.PermUsersManage), h.AdminSetRoles)
+	rg.POST("/users/:id/lock", rbac.RequirePermission(logger, rbac.PermUsersManage), h.AdminLock)
+	rg.POST("/users/:id/unlock", rbac.RequirePermission(logger, rbac.PermUsersManage), h.AdminUnlock)
+	rg.POST("/users/:id/password_reset", rbac.RequirePermission(logger, rbac.PermUsersManage), h.AdminResetPassword)
+	rg.POST("/users/:id/merge", rbac.RequirePermission(logger, rbac.PermUsersManage), h.AdminMerge)
+	rg.DELETE("/users/:id", rbac.RequirePermission(logger, rbac.PermUsersManage), h.AdminDelete)
+	rg.POST("/users/:id/restore", rbac.RequirePermission(logger, rbac.PermUsersManage), h.AdminRestore)
 }
 
 func (h *Handler) GetProfile(c *gin.Context) {
@@ -35,17 +66,370 @@ func (h *Handler) GetProfile(c *gin.Context) {
 	}
 	h.Logger.Info("user profile retrieved", zap.Uint("userID", userID.(uint)))
 
-	respData := gin.H{
-		"id":            user.ID,
-		"username":      user.Username,
-		"email":         user.Email,
-		"first_name":    user.FirstName,
-		"last_name":     user.LastName,
-		"father_name":   user.FatherName,
-		"sex":           user.Sex,
-		"date_of_birth": user.DateOfBirth.Format("02.01.2006"),
-		"groups":        user.Groups,
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// UpdateProfile — PATCH /users/me, личные данные и телефон.
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.UpdateProfileDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	user, err := h.Service.UpdateProfile(userID.(uint), req)
+	if err != nil {
+		h.respondError(c, err, "failed to update profile")
+		return
+	}
+
+	audit.Record(c, user.ID, audit.ActionUpdate, audit.ResourceProfile, 0)
+	h.Logger.Info("user profile updated", zap.Uint("userID", user.ID))
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+// ChangePassword — POST /users/me/password. Остальные сессии отзываются,
+// текущий клиент получает новый токен.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.ChangePasswordDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	user, err := h.Service.ChangePassword(c.Request.Context(), userID.(uint), req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		h.respondError(c, err, "failed to change password")
+		return
+	}
+	roles := rbac.RoleNames(user.Roles)
+	token, err := utils.GenerateAccessToken(*h.JWTConfig, user.ID, roles, user.SessionVersion)
+	if err != nil {
+		h.Logger.Error("failed to generate access token", zap.Error(err), zap.Uint("userID", user.ID))
+		response.NewErrorResponse(c, http.StatusInternalServerError, "failed to generate token", h.Logger)
+		return
+	}
+
+	audit.RecordDetails(c, user.ID, audit.ActionUpdate, audit.ResourceAccount, user.ID, "password changed")
+	h.Logger.Info("user password changed", zap.Uint("userID", user.ID))
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// RequestEmailChange — POST /users/me/email, отправляет код на новый адрес.
+func (h *Handler) RequestEmailChange(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.ChangeEmailDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	if err := h.Service.RequestEmailChange(c.Request.Context(), userID.(uint), req.NewEmail, req.Password); err != nil {
+		h.respondError(c, err, "failed to request email change")
+		return
+	}
+
+	h.Logger.Info("email change requested", zap.Uint("userID", userID.(uint)))
+	c.Status(http.StatusAccepted)
+}
+
+// ConfirmEmailChange — POST /users/me/email/confirm {"code": "123456"}.
+func (h *Handler) ConfirmEmailChange(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	var req utils.ConfirmEmailDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
 	}
 
-	c.JSON(http.StatusOK, respData)
+	user, err := h.Service.ConfirmEmailChange(c.Request.Context(), userID.(uint), req.Code)
+	if err != nil {
+		h.respondError(c, err, "failed to confirm email change")
+		return
+	}
+
+	audit.RecordDetails(c, user.ID, audit.ActionUpdate, audit.ResourceAccount, user.ID, "email changed")
+	h.Logger.Info("user email changed", zap.Uint("userID", user.ID))
+	c.JSON(http.StatusOK, profileResponse(user))
+}
+
+func profileResponse(user *models.User) gin.H {
+	return gin.H{
+		"id":                      user.ID,
+		"username":                user.Username,
+		"email":                   user.Email,
+		"first_name":              user.FirstName,
+		"last_name":               user.LastName,
+		"father_name":             user.FatherName,
+		"sex":                     user.Sex,
+		"date_of_birth":           user.DateOfBirth.Format("02.01.2006"),
+		"phone":                   user.Phone,
+		"roles":                   rbac.RoleNames(user.Roles),
+		"groups":                  rbac.PrimaryRole(rbac.RoleNames(user.Roles)),
+		"password_reset_required": user.PasswordResetRequired,
+	}
+}
+
+// GetPatientProfile — GET /users/:id/profile, карточка пациента для лечащего врача.
+func (h *Handler) GetPatientProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return
+	}
+	patientID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid user id", h.Logger)
+		return
+	}
+
+	profile, err := h.Service.GetPatientProfile(userID.(uint), uint(patientID))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrForbidden):
+			response.NewErrorResponse(c, http.StatusForbidden, "access denied", h.Logger)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.NewErrorResponse(c, http.StatusNotFound, "user not found", h.Logger)
+		default:
+			h.Logger.Error("failed to get patient profile",
+				zap.Uint("patientID", uint(patientID)),
+				zap.Error(err))
+			response.NewErrorResponse(c, http.StatusInternalServerError, "failed to fetch patient profile", h.Logger)
+		}
+		return
+	}
+	audit.Record(c, profile.ID, audit.ActionRead, audit.ResourceProfile, 0)
+	c.JSON(http.StatusOK, profile)
+}
+
+// AdminListUsers — GET /admin/users/?q=&role=&status=&offset=&limit=.
+func (h *Handler) AdminListUsers(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid offset", h.Logger)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid limit", h.Logger)
+		return
+	}
+
+	page, err := h.Service.ListUsers(c.Query("q"), c.Query("role"), c.Query("status"), offset, limit)
+	if err != nil {
+		h.respondError(c, err, "failed to list users")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// AdminGetUser — GET /admin/users/:id, профиль и сводка привязок.
+func (h *Handler) AdminGetUser(c *gin.Context) {
+	userID, ok := h.parseUserID(c)
+	if !ok {
+		return
+	}
+
+	detail, err := h.Service.GetUserDetail(userID)
+	if err != nil {
+		h.respondError(c, err, "failed to get user")
+		return
+	}
+	audit.Record(c, userID, audit.ActionRead, audit.ResourceProfile, 0)
+	c.JSON(http.StatusOK, detail)
+}
+
+// AdminSetRoles — PUT /admin/users/:id/roles, полный список ролей; сессии пользователя отзываются.
+func (h *Handler) AdminSetRoles(c *gin.Context) {
+	adminID, userID, ok := h.adminAndUser(c)
+	if !ok {
+		return
+	}
+	var req utils.SetUserRolesDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	roles, err := h.Service.SetRoles(adminID, userID, req.Roles)
+	if err != nil {
+		h.respondError(c, err, "failed to set roles")
+		return
+	}
+
+	audit.RecordDetails(c, userID, audit.ActionSetRoles, audit.ResourceAccount, userID, "roles: "+strings.Join(roles, ", "))
+	h.Logger.Info("user roles changed", zap.Uint("adminID", adminID), zap.Uint("userID", userID), zap.Strings("roles", roles))
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (h *Handler) AdminLock(c *gin.Context) {
+	adminID, userID, ok := h.adminAndUser(c)
+	if !ok {
+		return
+	}
+	var req utils.LockUserDTO
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+			return
+		}
+	}
+
+	if err := h.Service.Lock(adminID, userID, req.Reason); err != nil {
+		h.respondError(c, err, "failed to lock user")
+		return
+	}
+
+	audit.RecordDetails(c, userID, audit.ActionLock, audit.ResourceAccount, userID, strings.TrimSpace(req.Reason))
+	h.Logger.Info("user locked", zap.Uint("adminID", adminID), zap.Uint("userID", userID))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) AdminUnlock(c *gin.Context) {
+	adminID, userID, ok := h.adminAndUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Unlock(userID); err != nil {
+		h.respondError(c, err, "failed to unlock user")
+		return
+	}
+
+	audit.Record(c, userID, audit.ActionUnlock, audit.ResourceAccount, userID)
+	h.Logger.Info("user unlocked", zap.Uint("adminID", adminID), zap.Uint("userID", userID))
+	c.Status(http.StatusNoContent)
+}
+
+// AdminResetPassword — POST /admin/users/:id/password_reset, возвращает временный пароль.
+func (h *Handler) AdminResetPassword(c *gin.Context) {
+	adminID, userID, ok := h.adminAndUser(c)
+	if !ok {
+		return
+	}
+
+	password, err := h.Service.ForcePasswordReset(userID)
+	if err != nil {
+		h.respondError(c, err, "failed to reset password")
+		return
+	}
+
+	audit.Record(c, userID, audit.ActionResetPassword, audit.ResourceAccount, userID)
+	h.Logger.Info("user password reset", zap.Uint("adminID", adminID), zap.Uint("userID", userID))
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, utils.PasswordResetDTO{TemporaryPassword: password})
+}
+
+// AdminMerge — POST /admin/users/:id/merge {"source_id": ...}, переносит дубликат в аккаунт :id.
+func (h *Handler) AdminMerge(c *gin.Context) {
+	adminID, targetID, ok := h.adminAndUser(c)
+	if !ok {
+		return
+	}
+	var req utils.MergeUsersDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid request body", h.Logger)
+		return
+	}
+
+	if err := h.Service.Merge(adminID, req.SourceID, targetID); err != nil {
+		h.respondError(c, err, "failed to merge users")
+		return
+	}
+
+	audit.RecordDetails(c, targetID, audit.ActionMerge, audit.ResourceAccount, targetID, fmt.Sprintf("merged from user %d", req.SourceID))
+	audit.RecordDetails(c, req.SourceID, audit.ActionMerge, audit.ResourceAccount, req.SourceID, fmt.Sprintf("merged into user %d", targetID))
+	h.Logger.Info("users merged", zap.Uint("adminID", adminID), zap.Uint("sourceID", req.SourceID), zap.Uint("targetID", targetID))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) AdminDelete(c *gin.Context) {
+	adminID, userID, ok := h.adminAndUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Delete(adminID, userID); err != nil {
+		h.respondError(c, err, "failed to delete user")
+		return
+	}
+
+	audit.Record(c, userID, audit.ActionDelete, audit.ResourceAccount, userID)
+	h.Logger.Info("user deleted", zap.Uint("adminID", adminID), zap.Uint("userID", userID))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) AdminRestore(c *gin.Context) {
+	adminID, userID, ok := h.adminAndUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Restore(userID); err != nil {
+		h.respondError(c, err, "failed to restore user")
+		return
+	}
+
+	audit.Record(c, userID, audit.ActionRestore, audit.ResourceAccount, userID)
+	h.Logger.Info("user restored", zap.Uint("adminID", adminID), zap.Uint("userID", userID))
+	c.Status(http.StatusNoContent)
+}
+
+// adminAndUser — администратор из токена и аккаунт из пути; при ошибке ответ уже отправлен.
+func (h *Handler) adminAndUser(c *gin.Context) (uint, uint, bool) {
+	adminID, exists := c.Get("userID")
+	if !exists {
+		response.NewErrorResponse(c, http.StatusUnauthorized, "unauthorized", h.Logger)
+		return 0, 0, false
+	}
+	userID, ok := h.parseUserID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	return adminID.(uint), userID, true
+}
+
+func (h *Handler) parseUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.NewErrorResponse(c, http.StatusBadRequest, "invalid user id", h.Logger)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *Handler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.NewErrorResponse(c, http.StatusNotFound, "user not found", h.Logger)
+	case errors.Is(err, ErrInvalidInput), errors.Is(err, ErrSelfAction), errors.Is(err, ErrInvalidCode):
+		response.NewErrorResponse(c, http.StatusBadRequest, err.Error(), h.Logger)
+	case errors.Is(err, ErrWrongPassword):
+		response.NewErrorResponse(c, http.StatusForbidden, err.Error(), h.Logger)
+	case errors.Is(err, ErrAccountState), errors.Is(err, ErrMergeConflict), errors.Is(err, ErrEmailTaken):
+		response.NewErrorResponse(c, http.StatusConflict, err.Error(), h.Logger)
+	case errors.Is(err, ErrTooManyAttempts):
+		response.NewErrorResponse(c, http.StatusTooManyRequests, err.Error(), h.Logger)
+	default:
+		h.Logger.Error(message, zap.Error(err))
+		response.NewErrorResponse(c, http.StatusInternalServerError, message, h.Logger)
+	}
 }
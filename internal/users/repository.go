@@ -2,7 +2,11 @@ package users
 
 import (
 	"errors"
+	"fmt"
+	"painaway_test/internal/rbac"
 	"painaway_test/models"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -17,6 +21,23 @@ type Repository interface {
 	GetUserByID(ID uint) (*models.User, error)
 	IsUserExistWithEmail(email string) (bool, error)
 	IsUserExistWithUsername(username string) (bool, error)
+	GetAccountState(ID uint) (*models.User, error)
+	ListUsers(filter UserFilter, offset, limit int) ([]models.User, int64, error)
+	ReplaceRoles(ID uint, roles []string) error
+	UpdateAccount(ID uint, fields map[string]interface{}, revokeSessions bool) error
+	SoftDelete(ID uint, now time.Time) error
+	CreateEmailChange(change *models.EmailChange) error
+	GetPendingEmailChange(userID uint, now time.Time) (*models.EmailChange, error)
+	IncrementEmailChangeAttempts(ID uint) error
+	ConfirmEmailChange(change *models.EmailChange, now time.Time) (bool, error)
+	MergeUsers(sourceID, targetID uint, now time.Time) error
+}
+
+// UserFilter — условия выборки аккаунтов для администратора; пустые поля не ограничивают.
+type UserFilter struct {
+	Query  string // подстрока логина, почты или ФИО
+	Role   string
+	Status string // active / locked / deleted; без статуса — все, кроме удалённых
 }
 
 func NewRepository(db *gorm.DB) Repository {
@@ -51,10 +72,11 @@ func (r *Repo) IsUserExistWithUsername(username string) (bool, error) {
 	return true, nil
 }
 
+// GetUserByUsername ищет среди неудалённых аккаунтов.
 func (r *Repo) GetUserByUsername(username string) (*models.User, error) {
 	var user models.User
-	if err := r.DB.
-		Where("username = ?", username).
+	if err := r.DB.Preload("Roles").
+		Where("username = ? AND deleted_at IS NULL", username).
 		First(&user).Error; err != nil {
 		return nil, err
 	}
@@ -63,10 +85,287 @@ func (r *Repo) GetUserByUsername(username string) (*models.User, error) {
 
 func (r *Repo) GetUserByID(ID uint) (*models.User, error) {
 	var user models.User
-	if err := r.DB.
+	if err := r.DB.Preload("Roles").
 		Where("id = ?", ID).
 		First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
+
+// GetAccountState — только поля, нужные для проверки токена на каждом запросе;
+// удалённый аккаунт не находится.
+func (r *Repo) GetAccountState(ID uint) (*models.User, error) {
+	var user models.User
+	if err := r.DB.Select("id", "locked_at", "password_reset_required", "session_version").
+		Where("id = ? AND deleted_at IS NULL", ID).
+		First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *Repo) ListUsers(filter UserFilter, offset, limit int) ([]models.User, int64, error) {
+	query := r.DB.Model(&models.User{})
+	if filter.Query != "" {
+		like := "%" + escapeLike(filter.Query) + "%"
+		query = query.Where(`(username ILIKE ? OR email ILIKE ?
+			OR (last_name || ' ' || first_name || ' ' || father_name) ILIKE ?)`, like, like, like)
+	}
+	if filter.Role != "" {
+		query = query.Where("users.id IN (?)", rbac.UsersWithRole(r.DB, filter.Role))
+	}
+	switch filter.Status {
+	case "active":
+		query = query.Where("deleted_at IS NULL AND locked_at IS NULL")
+	case "locked":
+		query = query.Where("deleted_at IS NULL AND locked_at IS NOT NULL")
+	case "deleted":
+		query = query.Where("deleted_at IS NOT NULL")
+	default:
+		query = query.Where("deleted_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []models.User
+	if err := query.Preload("Roles").
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// ReplaceRoles заменяет роли пользователя и отзывает его сессии: в выданных
+// токенах остались старые роли.
+func (r *Repo) ReplaceRoles(ID uint, roles []string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", ID).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := rbac.GrantRole(tx, ID, role); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.User{}).Where("id = ?", ID).
+			UpdateColumn("session_version", gorm.Expr("session_version + 1")).Error
+	})
+}
+
+// UpdateAccount меняет поля состояния аккаунта; revokeSessions — заодно
+// отозвать все выданные пользователю токены.
+func (r *Repo) UpdateAccount(ID uint, fields map[string]interface{}, revokeSessions bool) error {
+	if revokeSessions {
+		fields["session_version"] = gorm.Expr("session_version + 1")
+	}
+	return r.DB.Model(&models.User{}).Where("id = ?", ID).Updates(fields).Error
+}
+
+// SoftDelete помечает аккаунт удалённым, отзывает его сессии и коды приглашений,
+// чтобы к удалённому врачу нельзя было прикрепиться.
+func (r *Repo) SoftDelete(ID uint, now time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.InviteCode{}).
+			Where("doctor_id = ? AND revoked_at IS NULL", ID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", ID).Updates(map[string]interface{}{
+			"deleted_at":      now,
+			"session_version": gorm.Expr("session_version + 1"),
+		}).Error
+	})
+}
+
+// CreateEmailChange заводит новый запрос смены почты; прежние неподтверждённые
+// запросы пользователя удаляются, действует только последний код.
+func (r *Repo) CreateEmailChange(change *models.EmailChange) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND confirmed_at IS NULL", change.UserID).
+			Delete(&models.EmailChange{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+}
+
+func (r *Repo) GetPendingEmailChange(userID uint, now time.Time) (*models.EmailChange, error) {
+	var change models.EmailChange
+	if err := r.DB.Where("user_id = ? AND confirmed_at IS NULL AND expires_at > ?", userID, now).
+		Order("id DESC").
+		First(&change).Error; err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+func (r *Repo) IncrementEmailChangeAttempts(ID uint) error {
+	return r.DB.Model(&models.EmailChange{}).Where("id = ?", ID).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+// ConfirmEmailChange записывает новый адрес в аккаунт; false — запрос уже подтверждён
+// параллельным запросом.
+func (r *Repo) ConfirmEmailChange(change *models.EmailChange, now time.Time) (bool, error) {
+	confirmed := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.EmailChange{}).
+			Where("id = ? AND confirmed_at IS NULL", change.ID).
+			Update("confirmed_at", now)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", change.UserID).
+			Update("email", change.NewEmail).Error; err != nil {
+			return err
+		}
+		confirmed = true
+		return nil
+	})
+	return confirmed, err
+}
+
+// mergedColumns — ссылки на пользователя, которые при слиянии переводятся
+// на основной аккаунт. access_logs сюда не входит: журнал неизменяем и хранит
+// исходные ID, а само слияние фиксируется в нём отдельной записью.
+var mergedColumns = []struct{ table, column string }{
+	{"subscriptions", "doctor_id"},
+	{"subscriptions", "patient_id"},
+	{"subscriptions", "ended_by_id"},
+	{"link_revisions", "author_id"},
+	{"link_consents", "doctor_id"},
+	{"link_consents", "patient_id"},
+	{"diagnoses", "doctor_id"},
+	{"diagnoses", "patient_id"},
+	{"prescriptions", "doctor_id"},
+	{"prescriptions", "patient_id"},
+	{"medication_intakes", "patient_id"},
+	{"notes", "patient_id"},
+	{"tags", "user_id"},
+	{"attachments", "patient_id"},
+	{"attachments", "uploader_id"},
+	{"note_comments", "patient_id"},
+	{"note_comments", "author_id"},
+	{"conversations", "doctor_id"},
+	{"conversations", "patient_id"},
+	{"conversations", "closed_by_id"},
+	{"messages", "sender_id"},
+	{"notifications", "user_id"},
+	{"availability_slots", "doctor_id"},
+	{"appointments", "doctor_id"},
+	{"appointments", "patient_id"},
+	{"appointments", "cancelled_by_id"},
+	{"reminder_settings", "user_id"},
+	{"reminder_logs", "user_id"},
+	{"questionnaire_assignments", "doctor_id"},
+	{"questionnaire_assignments", "patient_id"},
+	{"questionnaire_responses", "patient_id"},
+	{"invite_codes", "doctor_id"},
+	{"invite_redemptions", "patient_id"},
+	{"invite_attempts", "user_id"},
+	{"doctor_profiles", "user_id"},
+	{"doctor_applications", "user_id"},
+	{"doctor_applications", "reviewer_id"},
+}
+
+// MergeUsers переносит все данные аккаунта sourceID в targetID, добавляет
+// основному аккаунту роли дубликата и помечает дубликат удалённым.
+// Если перенос нарушил бы уникальность привязок или заявок, возвращает ErrMergeConflict.
+func (r *Repo) MergeUsers(sourceID, targetID uint, now time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkMergeConflicts(tx, sourceID, targetID); err != nil {
+			return err
+		}
+
+		// строки, которые после переноса совпали бы с уже имеющимися у основного аккаунта
+		prepare := []string{
+			`UPDATE notes SET client_id = NULL
+				WHERE patient_id = @src AND client_id IN (SELECT client_id FROM notes WHERE patient_id = @dst AND client_id IS NOT NULL)`,
+			`UPDATE note_tags SET tag_id = t2.id FROM tags t1 JOIN tags t2 ON t2.user_id = @dst AND t2.name = t1.name
+				WHERE note_tags.tag_id = t1.id AND t1.user_id = @src`,
+			`DELETE FROM tags t1 USING tags t2 WHERE t1.user_id = @src AND t2.user_id = @dst AND t1.name = t2.name`,
+			`DELETE FROM reminder_logs s USING reminder_logs t
+				WHERE s.user_id = @src AND t.user_id = @dst AND s.kind = t.kind AND s.ref_id = t.ref_id AND s.scheduled_for = t.scheduled_for`,
+			`DELETE FROM doctor_profiles WHERE user_id = @src AND EXISTS (SELECT 1 FROM doctor_profiles WHERE user_id = @dst)`,
+			`DELETE FROM idempotency_records WHERE user_id = @src`,
+			`DELETE FROM email_changes WHERE user_id = @src`,
+		}
+		args := map[string]interface{}{"src": sourceID, "dst": targetID}
+		for _, stmt := range prepare {
+			if err := tx.Exec(stmt, args).Error; err != nil {
+				return err
+			}
+		}
+		for _, c := range mergedColumns {
+			stmt := fmt.Sprintf("UPDATE %s SET %s = @dst WHERE %s = @src", c.table, c.column, c.column)
+			if err := tx.Exec(stmt, args).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+			SELECT @dst, role_id FROM user_roles WHERE user_id = @src
+			ON CONFLICT DO NOTHING`, args).Error; err != nil {
+			return err
+		}
+		// роли основного аккаунта могли измениться — его старые токены тоже отзываем
+		if err := tx.Model(&models.User{}).Where("id = ?", targetID).
+			UpdateColumn("session_version", gorm.Expr("session_version + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", sourceID).Updates(map[string]interface{}{
+			"deleted_at":      now,
+			"merged_into_id":  targetID,
+			"session_version": gorm.Expr("session_version + 1"),
+		}).Error
+	})
+}
+
+// checkMergeConflicts ищет данные, которые нельзя просто перенести: две активные
+// привязки к одному человеку, привязку между самими аккаунтами, два ведущих врача
+// или две заявки на рассмотрении. Такие случаи поддержка разбирает вручную.
+func checkMergeConflicts(tx *gorm.DB, sourceID, targetID uint) error {
+	args := map[string]interface{}{"src": sourceID, "dst": targetID}
+	checks := []struct {
+		query  string
+		reason string
+	}{
+		{`SELECT COUNT(*) FROM subscriptions
+			WHERE (doctor_id = @src AND patient_id = @dst) OR (doctor_id = @dst AND patient_id = @src)`,
+			"accounts are linked to each other"},
+		{`SELECT COUNT(*) FROM subscriptions a JOIN subscriptions b
+				ON a.status IN ('pending', 'accepted') AND b.status IN ('pending', 'accepted')
+			WHERE (a.patient_id = @src AND b.patient_id = @dst AND a.doctor_id = b.doctor_id)
+				OR (a.doctor_id = @src AND b.doctor_id = @dst AND a.patient_id = b.patient_id)`,
+			"both accounts have an active link with the same user"},
+		{`SELECT COUNT(*) FROM subscriptions a JOIN subscriptions b
+				ON a.role = 'lead' AND b.role = 'lead'
+				AND a.status IN ('pending', 'accepted') AND b.status IN ('pending', 'accepted')
+			WHERE a.patient_id = @src AND b.patient_id = @dst`,
+			"both accounts have a lead doctor"},
+		{`SELECT COUNT(*) FROM doctor_applications a JOIN doctor_applications b
+				ON a.status = 'pending' AND b.status = 'pending'
+			WHERE a.user_id = @src AND b.user_id = @dst`,
+			"both accounts have a pending doctor application"},
+	}
+	for _, check := range checks {
+		var count int64
+		if err := tx.Raw(check.query, args).Scan(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s", ErrMergeConflict, check.reason)
+		}
+	}
+	return nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -1,17 +1,607 @@
 package users
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	netmail "net/mail"
+	"painaway_test/internal/diary"
+	"painaway_test/internal/mail"
+	"painaway_test/internal/rbac"
+	"painaway_test/internal/utils"
 	"painaway_test/models"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Состояния аккаунта в админке.
+const (
+	StatusActive  = "active"
+	StatusLocked  = "locked"
+	StatusDeleted = "deleted"
+)
+
+const (
+	defaultUserListLimit = 50
+	maxUserListLimit     = 200
+	maxLockReasonLength  = 500
+	tempPasswordLength   = 12
+	// без похожих символов (0/O, 1/l/I), чтобы пароль можно было продиктовать
+	tempPasswordAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// причина завершения привязок удаляемого аккаунта, её увидит вторая сторона
+	deletedLinkReason = "аккаунт удалён"
+
+	minPasswordLength = 6
+	maxNameLength     = 100
+	maxSexLength      = 16
+	maxEmailLength    = 254
+
+	emailCodeLength      = 6
+	emailCodeTTL         = 30 * time.Minute
+	emailCodeAttempts    = 5
+	emailCodeResendDelay = time.Minute
+)
+
+var (
+	phoneRe         = regexp.MustCompile(`^\+?[0-9]{10,15}$`)
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+	minDateOfBirth  = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+var (
+	ErrForbidden     = errors.New("access denied")
+	ErrInvalidInput  = errors.New("invalid input")
+	ErrSelfAction    = errors.New("this action is not allowed on your own account")
+	ErrAccountState  = errors.New("action is not allowed in the current account state")
+	ErrMergeConflict = errors.New("accounts cannot be merged automatically")
+
+	ErrWrongPassword   = errors.New("current password is incorrect")
+	ErrEmailTaken      = errors.New("email already registered")
+	ErrInvalidCode     = errors.New("invalid or expired code")
+	ErrTooManyAttempts = errors.New("too many attempts, try again later")
 )
 
 type Service struct {
-	Repo Repository
+	Repo   Repository
+	Diary  *diary.Service
+	Roles  *rbac.Service
+	Mail   mail.Sender
+	Logger *zap.Logger
 }
 
-func NewService(repo Repository) *Service {
-	return &Service{Repo: repo}
+func NewService(repo Repository, diaryService *diary.Service, roles *rbac.Service, mailer mail.Sender, logger *zap.Logger) *Service {
+	return &Service{Repo: repo, Diary: diaryService, Roles: roles, Mail: mailer, Logger: logger}
 }
 
 func (s *Service) GetProfile(userID uint) (*models.User, error) {
 	return s.Repo.GetUserByID(userID)
 }
+
+// GetPatientProfile — карточка пациента для врача; доступна, только если пациент
+// разрешил врачу видеть профиль.
+func (s *Service) GetPatientProfile(userID, patientID uint) (*utils.PatientDTO, error) {
+	if _, err := s.Diary.RequireScope(userID, patientID, diary.ScopeProfile); err != nil {
+		if errors.Is(err, diary.ErrForbidden) {
+			return nil, ErrForbidden
+		}
+		return nil, err
+	}
+	user, err := s.Repo.GetUserByID(patientID)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.PatientDTO{
+		ID:          user.ID,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		FatherName:  user.FatherName,
+		Sex:         user.Sex,
+		DateOfBirth: user.DateOfBirth.Format("02.01.2006"),
+	}, nil
+}
+
+// UpdateProfile меняет личные данные пользователя; почта и пароль меняются отдельно.
+func (s *Service) UpdateProfile(userID uint, input utils.UpdateProfileDTO) (*models.User, error) {
+	fields := map[string]interface{}{}
+	for _, f := range []struct {
+		column   string
+		value    *string
+		required bool
+	}{
+		{"first_name", input.FirstName, true},
+		{"last_name", input.LastName, true},
+		{"father_name", input.FatherName, false},
+	} {
+		if f.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*f.value)
+		if f.required && value == "" {
+			return nil, fmt.Errorf("%w: %s must not be empty", ErrInvalidInput, f.column)
+		}
+		if utf8.RuneCountInString(value) > maxNameLength {
+			return nil, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidInput, f.column, maxNameLength)
+		}
+		fields[f.column] = value
+	}
+	if input.Sex != nil {
+		sex := strings.TrimSpace(*input.Sex)
+		if sex == "" || utf8.RuneCountInString(sex) > maxSexLength {
+			return nil, fmt.Errorf("%w: invalid sex", ErrInvalidInput)
+		}
+		fields["sex"] = sex
+	}
+	if input.DateOfBirth != nil {
+		dob, err := time.Parse(time.DateOnly, *input.DateOfBirth)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date_of_birth must be in YYYY-MM-DD format", ErrInvalidInput)
+		}
+		if dob.Before(minDateOfBirth) || dob.After(time.Now()) {
+			return nil, fmt.Errorf("%w: date_of_birth is out of range", ErrInvalidInput)
+		}
+		fields["date_of_birth"] = dob
+	}
+	if input.Phone != nil {
+		phone := phoneSeparators.Replace(strings.TrimSpace(*input.Phone))
+		if phone != "" && !phoneRe.MatchString(phone) {
+			return nil, fmt.Errorf("%w: phone must contain 10 to 15 digits", ErrInvalidInput)
+		}
+		fields["phone"] = phone
+	}
+
+	if len(fields) > 0 {
+		if err := s.Repo.UpdateAccount(userID, fields, false); err != nil {
+			return nil, err
+		}
+	}
+	return s.Repo.GetUserByID(userID)
+}
+
+// ChangePassword меняет пароль после проверки текущего и отзывает все сессии
+// пользователя. Возвращает аккаунт с новой версией сессий, чтобы выдать токен
+// текущему клиенту.
+func (s *Service) ChangePassword(ctx context.Context, userID uint, current, password string) (*models.User, error) {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)); err != nil {
+		return nil, ErrWrongPassword
+	}
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("%w: password must be at least %d characters long", ErrInvalidInput, minPasswordLength)
+	}
+	if password == current {
+		return nil, fmt.Errorf("%w: new password must differ from the current one", ErrInvalidInput)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.UpdateAccount(userID, map[string]interface{}{
+		"password":                string(hashed),
+		"password_reset_required": false,
+	}, true); err != nil {
+		return nil, err
+	}
+
+	s.sendMail(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Пароль изменён",
+		Body:    "Пароль от вашего аккаунта PainAway изменён, все остальные сеансы завершены. Если это были не вы, обратитесь в поддержку.",
+	})
+	return s.Repo.GetUserByID(userID)
+}
+
+// RequestEmailChange отправляет код подтверждения на новый адрес. Почта аккаунта
+// меняется только после ConfirmEmailChange.
+func (s *Service) RequestEmailChange(ctx context.Context, userID uint, newEmail, password string) error {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	addr, err := netmail.ParseAddress(newEmail)
+	if err != nil || addr.Address != newEmail || len(newEmail) > maxEmailLength {
+		return fmt.Errorf("%w: invalid email", ErrInvalidInput)
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return fmt.Errorf("%w: new email matches the current one", ErrInvalidInput)
+	}
+	taken, err := s.Repo.IsUserExistWithEmail(newEmail)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	now := time.Now()
+	pending, err := s.Repo.GetPendingEmailChange(userID, now)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if pending != nil && now.Sub(pending.CreatedAt) < emailCodeResendDelay {
+		return ErrTooManyAttempts
+	}
+
+	code, err := randomDigits(emailCodeLength)
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.CreateEmailChange(&models.EmailChange{
+		UserID:    userID,
+		NewEmail:  newEmail,
+		CodeHash:  hashCode(code),
+		ExpiresAt: now.Add(emailCodeTTL),
+	}); err != nil {
+		return err
+	}
+	return s.Mail.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Подтверждение почты",
+		Body: fmt.Sprintf("Код подтверждения новой почты для аккаунта PainAway: %s\nКод действует %d минут.",
+			code, int(emailCodeTTL.Minutes())),
+	})
+}
+
+// ConfirmEmailChange проверяет код и записывает новый адрес; на старый адрес
+// уходит уведомление о смене.
+func (s *Service) ConfirmEmailChange(ctx context.Context, userID uint, code string) (*models.User, error) {
+	change, err := s.Repo.GetPendingEmailChange(userID, time.Now())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCode
+		}
+		return nil, err
+	}
+	if change.Attempts >= emailCodeAttempts {
+		return nil, ErrTooManyAttempts
+	}
+	if subtle.ConstantTimeCompare([]byte(hashCode(strings.TrimSpace(code))), []byte(change.CodeHash)) != 1 {
+		if err := s.Repo.IncrementEmailChangeAttempts(change.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCode
+	}
+
+	// адрес могли занять, пока код шёл на почту
+	taken, err := s.Repo.IsUserExistWithEmail(change.NewEmail)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailTaken
+	}
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.Repo.ConfirmEmailChange(change, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	s.sendMail(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Почта аккаунта изменена",
+		Body:    "Почта вашего аккаунта PainAway изменена на " + change.NewEmail + ". Если это были не вы, обратитесь в поддержку.",
+	})
+	return s.Repo.GetUserByID(userID)
+}
+
+// sendMail — письмо-уведомление; ошибку только логируем, действие уже выполнено.
+func (s *Service) sendMail(ctx context.Context, msg mail.Message) {
+	if err := s.Mail.Send(ctx, msg); err != nil {
+		s.Logger.Error("failed to send mail", zap.String("subject", msg.Subject), zap.Error(err))
+	}
+}
+
+// ListUsers — поиск аккаунтов для администратора.
+func (s *Service) ListUsers(query, role, status string, offset, limit int) (*utils.AdminUserPageDTO, error) {
+	filter := UserFilter{
+		Query:  strings.TrimSpace(query),
+		Role:   strings.TrimSpace(role),
+		Status: strings.ToLower(strings.TrimSpace(status)),
+	}
+	if filter.Status != "" && filter.Status != StatusActive && filter.Status != StatusLocked && filter.Status != StatusDeleted {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidInput, filter.Status)
+	}
+	if filter.Role != "" {
+		if _, err := s.Roles.GetRole(filter.Role); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidInput, filter.Role)
+			}
+			return nil, err
+		}
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidInput)
+	}
+	if limit <= 0 {
+		limit = defaultUserListLimit
+	}
+	if limit > maxUserListLimit {
+		limit = maxUserListLimit
+	}
+
+	users, total, err := s.Repo.ListUsers(filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]utils.AdminUserDTO, 0, len(users))
+	for _, user := range users {
+		items = append(items, toAdminUserDTO(&user))
+	}
+	return &utils.AdminUserPageDTO{Items: items, Total: total, Offset: offset, Limit: limit}, nil
+}
+
+// GetUserDetail — карточка аккаунта со сводкой привязок, в том числе удалённого.
+func (s *Service) GetUserDetail(userID uint) (*utils.AdminUserDetailDTO, error) {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.Diary.UserLinks(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &utils.AdminUserDetailDTO{
+		User:       toAdminUserDTO(user),
+		LinkCounts: map[string]int{},
+		Links:      make([]utils.AdminUserLinkDTO, 0, len(links)),
+	}
+	for _, link := range links {
+		dto := utils.AdminUserLinkDTO{
+			ID:        link.ID,
+			Status:    link.Status,
+			Role:      link.Role,
+			CreatedAt: link.CreatedAt,
+			EndedAt:   link.EndedAt,
+		}
+		counterpart := link.Patient
+		dto.Side = "doctor"
+		if link.PatientID == userID {
+			counterpart = link.Doctor
+			dto.Side = "patient"
+		}
+		dto.CounterpartID = counterpart.ID
+		dto.CounterpartName = strings.TrimSpace(counterpart.LastName + " " + counterpart.FirstName + " " + counterpart.FatherName)
+		detail.Links = append(detail.Links, dto)
+		detail.LinkCounts[link.Status]++
+	}
+	return detail, nil
+}
+
+// SetRoles заменяет роли пользователя. Снять роль администратора с самого себя
+// нельзя, чтобы не остаться без доступа к админке.
+func (s *Service) SetRoles(adminID, userID uint, roles []string) ([]string, error) {
+	user, err := s.activeUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(roles))
+	seen := make(map[string]bool, len(roles))
+	for _, name := range roles {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, err := s.Roles.GetRole(name); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidInput, name)
+			}
+			return nil, err
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: at least one role is required", ErrInvalidInput)
+	}
+	if adminID == user.ID && !seen[rbac.RoleAdmin] {
+		return nil, ErrSelfAction
+	}
+
+	if err := s.Repo.ReplaceRoles(user.ID, names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// Lock блокирует аккаунт: вход запрещён, выданные токены перестают приниматься.
+func (s *Service) Lock(adminID, userID uint, reason string) error {
+	if adminID == userID {
+		return ErrSelfAction
+	}
+	if _, err := s.activeUser(userID); err != nil {
+		return err
+	}
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > maxLockReasonLength {
+		return fmt.Errorf("%w: reason is longer than %d characters", ErrInvalidInput, maxLockReasonLength)
+	}
+	return s.Repo.UpdateAccount(userID, map[string]interface{}{
+		"locked_at":   time.Now(),
+		"lock_reason": reason,
+	}, true)
+}
+
+func (s *Service) Unlock(userID uint) error {
+	user, err := s.activeUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.LockedAt == nil {
+		return nil
+	}
+	return s.Repo.UpdateAccount(userID, map[string]interface{}{
+		"locked_at":   nil,
+		"lock_reason": "",
+	}, false)
+}
+
+// ForcePasswordReset заменяет пароль временным и отзывает сессии. Временный пароль
+// возвращается один раз, передать его пользователю должна поддержка; после входа
+// с ним пользователь обязан сменить пароль.
+func (s *Service) ForcePasswordReset(userID uint) (string, error) {
+	if _, err := s.activeUser(userID); err != nil {
+		return "", err
+	}
+	password, err := randomPassword(tempPasswordLength)
+	if err != nil {
+		return "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Repo.UpdateAccount(userID, map[string]interface{}{
+		"password":                string(hashed),
+		"password_reset_required": true,
+	}, true); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// Merge переносит данные дубликата sourceID в аккаунт targetID; дубликат
+// после этого считается удалённым.
+func (s *Service) Merge(adminID, sourceID, targetID uint) error {
+	if sourceID == 0 {
+		return fmt.Errorf("%w: source_id is required", ErrInvalidInput)
+	}
+	if sourceID == targetID {
+		return fmt.Errorf("%w: cannot merge an account into itself", ErrInvalidInput)
+	}
+	if adminID == sourceID {
+		return ErrSelfAction
+	}
+	if _, err := s.activeUser(sourceID); err != nil {
+		return err
+	}
+	if _, err := s.activeUser(targetID); err != nil {
+		return err
+	}
+	return s.Repo.MergeUsers(sourceID, targetID, time.Now())
+}
+
+// Delete мягко удаляет аккаунт: данные остаются, вход закрыт, действующие привязки
+// завершаются с уведомлением второй стороны, коды приглашений отзываются.
+func (s *Service) Delete(adminID, userID uint) error {
+	if adminID == userID {
+		return ErrSelfAction
+	}
+	if _, err := s.activeUser(userID); err != nil {
+		return err
+	}
+	if err := s.Diary.CloseUserLinks(userID, deletedLinkReason); err != nil {
+		return err
+	}
+	return s.Repo.SoftDelete(userID, time.Now())
+}
+
+// Restore возвращает удалённый аккаунт. Объединённый дубликат восстановить
+// нельзя: его данные уже перенесены.
+func (s *Service) Restore(userID uint) error {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.DeletedAt == nil || user.MergedIntoID != nil {
+		return ErrAccountState
+	}
+	return s.Repo.UpdateAccount(userID, map[string]interface{}{
+		"deleted_at": nil,
+	}, false)
+}
+
+// activeUser — неудалённый аккаунт; с удалённым доступно только восстановление.
+func (s *Service) activeUser(userID uint) (*models.User, error) {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, ErrAccountState
+	}
+	return user, nil
+}
+
+func toAdminUserDTO(user *models.User) utils.AdminUserDTO {
+	status := StatusActive
+	switch {
+	case user.DeletedAt != nil:
+		status = StatusDeleted
+	case user.LockedAt != nil:
+		status = StatusLocked
+	}
+	return utils.AdminUserDTO{
+		ID:                    user.ID,
+		Username:              user.Username,
+		Email:                 user.Email,
+		FirstName:             user.FirstName,
+		LastName:              user.LastName,
+		FatherName:            user.FatherName,
+		Sex:                   user.Sex,
+		DateOfBirth:           user.DateOfBirth.Format("02.01.2006"),
+		Roles:                 rbac.RoleNames(user.Roles),
+		Status:                status,
+		LockedAt:              user.LockedAt,
+		LockReason:            user.LockReason,
+		PasswordResetRequired: user.PasswordResetRequired,
+		DeletedAt:             user.DeletedAt,
+		MergedIntoID:          user.MergedIntoID,
+		CreatedAt:             user.CreatedAt,
+	}
+}
+
+func randomDigits(length int) (string, error) {
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		b[i] = byte('0' + n.Int64())
+	}
+	return string(b), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomPassword(length int) (string, error) {
+	size := big.NewInt(int64(len(tempPasswordAlphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		b[i] = tempPasswordAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
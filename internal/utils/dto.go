@@ -3,18 +3,27 @@ package utils
 import "time"
 
 type PatientLinkDTO struct {
-	ID           uint      `json:"id"`
-	Status       string    `json:"status"`
-	Doctor       DoctorDTO `json:"doctor"`
-	Prescription string    `json:"prescription"`
+	ID           uint              `json:"id"`
+	Status       string            `json:"status"`
+	Role         string            `json:"role,omitempty"` // роль врача в команде лечения
+	EndedAt      *time.Time        `json:"ended_at,omitempty"`
+	EndReason    string            `json:"end_reason,omitempty"`
+	Doctor       DoctorDTO         `json:"doctor"`
+	Prescription string            `json:"prescription"`
+	Regimen      []PrescriptionDTO `json:"regimen"` // действующие назначения
+	Diagnoses    []DiagnosisDTO    `json:"diagnoses"`
 }
 
 type DoctorLinkDTO struct {
 	ID           uint                  `json:"id"`
 	Status       string                `json:"status"`
+	Role         string                `json:"role,omitempty"`
+	EndedAt      *time.Time            `json:"ended_at,omitempty"`
+	EndReason    string                `json:"end_reason,omitempty"`
 	Patient      PatientDTO            `json:"patient"`
 	Prescription UpdatePrescriptionDTO `json:"prescription"`
 	Diagnosis    UpdateDiagnosisDTO    `json:"diagnosis"`
+	Diagnoses    []DiagnosisDTO        `json:"diagnoses"`
 }
 
 type DoctorDTO struct {
@@ -39,9 +48,41 @@ type SetPrescriptionDTO struct {
 	Prescription string `json:"prescription"`
 }
 
+// SetDiagnosisDTO обновляет текстовое заключение и/или список кодированных
+// диагнозов; не переданное поле не меняется. diagnoses заменяет список целиком.
 type SetDiagnosisDTO struct {
-	Link      uint   `json:"link"`
-	Diagnosis string `json:"diagnosis"`
+	Link      uint                 `json:"link"`
+	Diagnosis *string              `json:"diagnosis"`
+	Diagnoses *[]DiagnosisEntryDTO `json:"diagnoses"`
+}
+
+type DiagnosisEntryDTO struct {
+	Code        string `json:"code"`
+	Description string `json:"description"` // по умолчанию — из справочника МКБ-10
+	Type        string `json:"type"`        // primary / secondary
+	OnsetDate   string `json:"onset_date"`  // YYYY-MM-DD
+	Status      string `json:"status"`      // active / remission / resolved, по умолчанию active
+}
+
+type DiagnosisDTO struct {
+	ID          uint    `json:"id"`
+	Code        string  `json:"code"`
+	Description string  `json:"description"`
+	Type        string  `json:"type"`
+	OnsetDate   *string `json:"onset_date,omitempty"`
+	Status      string  `json:"status"`
+}
+
+type ICD10CodeDTO struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+type DiagnosisStatDTO struct {
+	Code          string `json:"code"`
+	Description   string `json:"description"`
+	PatientsCount int    `json:"patients_count"`
+	PrimaryCount  int    `json:"primary_count"`
 }
 type UpdatePrescriptionDTO struct {
 	ID           uint   `json:"id"`
@@ -53,21 +94,733 @@ type UpdateDiagnosisDTO struct {
 	Diagnosis string `json:"diagnosis"`
 }
 
+type LinkRevisionDTO struct {
+	ID        uint      `json:"id"`
+	Field     string    `json:"field"` // prescription / diagnosis
+	Value     string    `json:"value"`
+	Author    DoctorDTO `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type SelectDoctorRequestDTO struct {
 	DocUsername string `json:"doc_username" binding:"required"`
 }
 
+// LinkStatusDTO — смена статуса привязки: accepted / rejected (врач), cancelled (пациент),
+// ended (любая сторона, reason необязателен), archived.
+type LinkStatusDTO struct {
+	Status string `json:"status" binding:"required"`
+	Reason string `json:"reason"`
+}
+
 type DocRespondRequestDTO struct {
 	PatientID uint   `json:"patient_id" binding:"required"`
 	Action    string `json:"action" binding:"required"` // "accept" | "reject"
 }
 
 type NoteDTO struct {
-	ID               uint      `json:"id" binding:"required"`
-	DateRecorded     time.Time `json:"date_recorded" binding:"required"`
-	Intensity        int       `json:"intensity" binding:"required"`
-	PainType         string    `json:"pain_type" binding:"required"`
-	TookPrescription bool      `json:"tookPrescription" binding:"required"`
-	Description      string    `json:"description" binding:"required"`
-	BodyPart         int       `json:"body_part" binding:"required"`
+	ID               uint              `json:"id" binding:"required"`
+	ClientID         string            `json:"client_id,omitempty"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+	DateRecorded     time.Time         `json:"date_recorded" binding:"required"`
+	Intensity        int               `json:"intensity" binding:"required"`
+	PainType         string            `json:"pain_type" binding:"required"`
+	TookPrescription bool              `json:"tookPrescription" binding:"required"`
+	Description      string            `json:"description" binding:"required"`
+	BodyPart         int               `json:"body_part" binding:"required"`
+	BodyParts        []NoteBodyPartDTO `json:"body_parts"`
+	SleepHours       *float64          `json:"sleep_hours"`
+	SleepQuality     *int              `json:"sleep_quality"`
+	Mood             *int              `json:"mood"`
+	ActivityLevel    *string           `json:"activity_level"`
+	Weather          *string           `json:"weather"`
+	Tags             []string          `json:"tags"`
+}
+
+type NoteBodyPartDTO struct {
+	BodyPartID uint   `json:"id"`
+	Intensity  *int   `json:"intensity,omitempty"`
+	RadiatesTo []uint `json:"radiates_to,omitempty"`
+}
+
+// CreateNoteDTO принимает как новый список body_parts, так и одиночный body_part от старых клиентов.
+type CreateNoteDTO struct {
+	RecordedAt       *time.Time        `json:"recorded_at"`
+	Intensity        int               `json:"intensity"`
+	PainType         string            `json:"pain_type"`
+	TookPrescription bool              `json:"took_prescription"`
+	Description      string            `json:"description"`
+	BodyPart         uint              `json:"body_part"`
+	BodyParts        []NoteBodyPartDTO `json:"body_parts"`
+	SleepHours       *float64          `json:"sleep_hours"`
+	SleepQuality     *int              `json:"sleep_quality"`  // 1–5
+	Mood             *int              `json:"mood"`           // 1–5
+	ActivityLevel    *string           `json:"activity_level"` // sedentary / light / moderate / vigorous
+	Weather          *string           `json:"weather"`        // sunny / cloudy / rain / snow / storm / fog / windy
+	Tags             []string          `json:"tags"`           // имена меток; новые создаются автоматически
+}
+
+type BodyPartStatDTO struct {
+	BodyPartID     uint    `json:"body_part_id"`
+	Code           string  `json:"code"`
+	Translation    string  `json:"translation"`
+	NotesCount     int     `json:"notes_count"`
+	RadiatingCount int     `json:"radiating_count"`
+	AvgIntensity   float64 `json:"avg_intensity"`
+}
+
+type BodyPartDTO struct {
+	ID          uint   `json:"id"`
+	Code        string `json:"code"`
+	Translation string `json:"translation"`
+	View        string `json:"view"`
+	Side        string `json:"side"`
+	ParentID    *uint  `json:"parent_id"`
+}
+
+// BodyPartInputDTO используется и для создания, и для частичного обновления.
+// parent_id = 0 снимает родительскую область.
+type BodyPartInputDTO struct {
+	Code      *string           `json:"code"`
+	View      *string           `json:"view"`
+	Side      *string           `json:"side"`
+	ParentID  *uint             `json:"parent_id"`
+	SortOrder *int              `json:"sort_order"`
+	IsActive  *bool             `json:"is_active"`
+	Labels    map[string]string `json:"labels"`
+}
+
+type AttachmentDTO struct {
+	ID           uint      `json:"id"`
+	NoteID       uint      `json:"note_id"`
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CommentDTO — комментарий к записи; у корневых комментариев в Replies ответы ветки.
+// Удалённый комментарий с ответами остаётся в ветке с пустым текстом и Deleted = true.
+type CommentDTO struct {
+	ID         uint         `json:"id"`
+	NoteID     uint         `json:"note_id"`
+	ParentID   *uint        `json:"parent_id,omitempty"`
+	AuthorID   uint         `json:"author_id"`
+	AuthorName string       `json:"author_name"`
+	AuthorRole string       `json:"author_role"` // doctor / patient
+	Body       string       `json:"body"`
+	Deleted    bool         `json:"deleted,omitempty"`
+	EditedAt   *time.Time   `json:"edited_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	Replies    []CommentDTO `json:"replies,omitempty"`
+}
+
+type CommentInputDTO struct {
+	Body     string `json:"body" binding:"required"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+type ConversationDTO struct {
+	ID          uint        `json:"id"`
+	LinkID      uint        `json:"link_id"`
+	Doctor      DoctorDTO   `json:"doctor"`
+	Patient     PatientDTO  `json:"patient"`
+	LastMessage *MessageDTO `json:"last_message,omitempty"`
+	UnreadCount int64       `json:"unread_count"`
+	ClosedAt    *time.Time  `json:"closed_at,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+type OpenConversationDTO struct {
+	Link uint `json:"link_id" binding:"required"`
+}
+
+type MessageDTO struct {
+	ID             uint                   `json:"id"`
+	ConversationID uint                   `json:"conversation_id"`
+	SenderID       uint                   `json:"sender_id"`
+	Body           string                 `json:"body"`
+	Attachments    []MessageAttachmentDTO `json:"attachments"`
+	ReadAt         *time.Time             `json:"read_at,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+type MessageAttachmentDTO struct {
+	ID          uint   `json:"id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+// MessagePageDTO — страница сообщений от новых к старым; следующая страница
+// запрашивается с before_id = NextBeforeID.
+type MessagePageDTO struct {
+	Messages     []MessageDTO `json:"messages"`
+	NextBeforeID *uint        `json:"next_before_id,omitempty"`
+}
+
+// SendMessageDTO — тело JSON-запроса; с файлами сообщение отправляется как
+// multipart/form-data с полем body и одним или несколькими полями files.
+type SendMessageDTO struct {
+	Body string `json:"body"`
+}
+
+type MarkReadDTO struct {
+	UpToID uint `json:"up_to_id"` // 0 — все сообщения
+}
+
+// MessagesReadDTO — отметка о прочтении, отправляется собеседнику через сокет.
+type MessagesReadDTO struct {
+	ConversationID uint      `json:"conversation_id"`
+	ReaderID       uint      `json:"reader_id"`
+	UpToID         uint      `json:"up_to_id"`
+	ReadAt         time.Time `json:"read_at"`
+}
+
+type SlotDTO struct {
+	ID       uint      `json:"id"`
+	DoctorID uint      `json:"doctor_id"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Booked   bool      `json:"booked"`
+}
+
+// SlotInputDTO — время в RFC 3339 со смещением, например 2025-03-01T10:00:00+03:00.
+type SlotInputDTO struct {
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+}
+
+type AppointmentDTO struct {
+	ID            uint       `json:"id"`
+	SlotID        uint       `json:"slot_id"`
+	LinkID        uint       `json:"link_id"`
+	Doctor        DoctorDTO  `json:"doctor"`
+	Patient       PatientDTO `json:"patient"`
+	StartsAt      time.Time  `json:"starts_at"`
+	EndsAt        time.Time  `json:"ends_at"`
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason,omitempty"`
+	CancelledByID *uint      `json:"cancelled_by_id,omitempty"`
+	CancelReason  string     `json:"cancel_reason,omitempty"`
+	CancelledAt   *time.Time `json:"cancelled_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type BookAppointmentDTO struct {
+	SlotID uint   `json:"slot_id" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+type RescheduleAppointmentDTO struct {
+	SlotID uint `json:"slot_id" binding:"required"`
+}
+
+type CancelAppointmentDTO struct {
+	Reason string `json:"reason"`
+}
+
+type InviteDTO struct {
+	ID         uint       `json:"id"`
+	Code       string     `json:"code"`
+	URL        string     `json:"url"` // для QR-кода
+	AutoAccept bool       `json:"auto_accept"`
+	MaxUses    int        `json:"max_uses"` // 0 — без ограничения
+	UsedCount  int        `json:"used_count"`
+	Status     string     `json:"status"` // active / expired / exhausted / revoked
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateInviteDTO — max_uses по умолчанию 1; без expires_at код действует default_ttl из конфига.
+type CreateInviteDTO struct {
+	MaxUses    *int       `json:"max_uses"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	AutoAccept bool       `json:"auto_accept"`
+}
+
+type RedeemInviteDTO struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DoctorProfileDTO — карточка врача в каталоге.
+type DoctorProfileDTO struct {
+	ID                   uint     `json:"id"`
+	Username             string   `json:"username"`
+	LastName             string   `json:"last_name"`
+	FirstName            string   `json:"first_name"`
+	FatherName           string   `json:"father_name"`
+	Specialty            string   `json:"specialty"`
+	Clinic               string   `json:"clinic"`
+	City                 string   `json:"city"`
+	Languages            []string `json:"languages"`
+	Bio                  string   `json:"bio"`
+	AcceptingNewPatients bool     `json:"accepting_new_patients"`
+	Hidden               bool     `json:"hidden,omitempty"` // только в собственной карточке
+}
+
+// DoctorProfileInputDTO — частичное обновление собственной карточки врача.
+type DoctorProfileInputDTO struct {
+	Specialty            *string   `json:"specialty"`
+	Clinic               *string   `json:"clinic"`
+	City                 *string   `json:"city"`
+	Languages            *[]string `json:"languages"`
+	Bio                  *string   `json:"bio"`
+	AcceptingNewPatients *bool     `json:"accepting_new_patients"`
+	Hidden               *bool     `json:"hidden"`
+}
+
+type DoctorSearchResultDTO struct {
+	Items  []DoctorProfileDTO `json:"items"`
+	Total  int64              `json:"total"`
+	Offset int                `json:"offset"`
+	Limit  int                `json:"limit"`
+}
+
+// CareTeamMemberDTO — врач в команде лечения пациента.
+type CareTeamMemberDTO struct {
+	LinkID      uint      `json:"link_id"`
+	Role        string    `json:"role"` // lead / consultant / nurse
+	Status      string    `json:"status"`
+	Permissions []string  `json:"permissions"`
+	Doctor      DoctorDTO `json:"doctor"`
+}
+
+type CareTeamDTO struct {
+	PatientID uint                `json:"patient_id"`
+	Members   []CareTeamMemberDTO `json:"members"`
+	Diagnoses []DiagnosisDTO      `json:"diagnoses"` // диагнозы, поставленные ведущим врачом
+}
+
+type SetCareRoleDTO struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ConsentDTO — действующее согласие пациента по привязке. Default = true, пока
+// пациент ни разу не задавал согласие: тогда врачу открыты все данные.
+type ConsentDTO struct {
+	ID        uint       `json:"id,omitempty"`
+	LinkID    uint       `json:"link_id"`
+	Scopes    []string   `json:"scopes"`
+	DataFrom  *string    `json:"data_from,omitempty"` // YYYY-MM-DD
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired"`
+	Default   bool       `json:"default"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// ConsentInputDTO целиком заменяет согласие; пустой scopes закрывает доступ ко всем данным.
+type ConsentInputDTO struct {
+	Scopes    []string   `json:"scopes"`
+	DataFrom  string     `json:"data_from"` // YYYY-MM-DD, пусто — без ограничения
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// SyncNoteDTO — запись из офлайн-очереди клиента. client_id — UUID, по нему
+// повторная отправка той же записи не создаёт дубликат.
+type SyncNoteDTO struct {
+	ClientID string `json:"client_id"`
+	Deleted  bool   `json:"deleted"`
+	CreateNoteDTO
+}
+
+type SyncPushRequestDTO struct {
+	Notes []SyncNoteDTO `json:"notes" binding:"required"`
+}
+
+type SyncItemResultDTO struct {
+	ClientID string `json:"client_id"`
+	Status   string `json:"status"` // created / updated / unchanged / deleted / error
+	NoteID   uint   `json:"note_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type SyncDeletedNoteDTO struct {
+	ID        uint      `json:"id"`
+	ClientID  string    `json:"client_id,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type SyncPullResponseDTO struct {
+	Notes   []NoteDTO            `json:"notes"`
+	Deleted []SyncDeletedNoteDTO `json:"deleted"`
+	Cursor  string               `json:"cursor"`
+	HasMore bool                 `json:"has_more"`
+}
+
+type PrescriptionDTO struct {
+	ID             uint     `json:"id"`
+	SubscriptionID uint     `json:"subscription_id"`
+	MedicationName string   `json:"medication_name"`
+	Dose           float64  `json:"dose"`
+	Unit           string   `json:"unit"`
+	Route          string   `json:"route"`
+	Frequency      string   `json:"frequency,omitempty"`
+	TimesOfDay     []string `json:"times_of_day"`
+	IntervalDays   int      `json:"interval_days"`
+	StartDate      string   `json:"start_date"`
+	EndDate        *string  `json:"end_date,omitempty"`
+	PRN            bool     `json:"prn"`
+	Instructions   string   `json:"instructions,omitempty"`
+	Active         bool     `json:"active"`
+}
+
+// PrescriptionInputDTO — создание и частичное обновление назначения.
+// Даты в формате YYYY-MM-DD; пустой end_date при обновлении снимает дату окончания.
+type PrescriptionInputDTO struct {
+	Link           uint      `json:"link"`
+	MedicationName *string   `json:"medication_name"`
+	Dose           *float64  `json:"dose"`
+	Unit           *string   `json:"unit"`
+	Route          *string   `json:"route"`
+	Frequency      *string   `json:"frequency"`
+	TimesOfDay     *[]string `json:"times_of_day"`
+	IntervalDays   *int      `json:"interval_days"`
+	StartDate      *string   `json:"start_date"`
+	EndDate        *string   `json:"end_date"`
+	PRN            *bool     `json:"prn"`
+	Instructions   *string   `json:"instructions"`
+}
+
+type IntakeInputDTO struct {
+	Status       string     `json:"status" binding:"required"` // taken / skipped / late
+	ScheduledFor *time.Time `json:"scheduled_for"`             // плановый приём из расписания; пусто только для PRN
+	TakenAt      *time.Time `json:"taken_at"`
+	Reason       string     `json:"reason"`
+}
+
+type AdherenceDayDTO struct {
+	Date         string   `json:"date"`
+	Expected     int      `json:"expected"`
+	Taken        int      `json:"taken"`
+	Late         int      `json:"late"`
+	Skipped      int      `json:"skipped"`
+	Missed       int      `json:"missed"`
+	AvgIntensity *float64 `json:"avg_intensity"`
+	NotesCount   int      `json:"notes_count"`
+}
+
+type AdherenceReportDTO struct {
+	PrescriptionID uint   `json:"prescription_id"`
+	MedicationName string `json:"medication_name"`
+	From           string `json:"from"`
+	To             string `json:"to"`
+	Expected       int    `json:"expected"`
+	Taken          int    `json:"taken"`
+	Late           int    `json:"late"`
+	Skipped        int    `json:"skipped"`
+	Missed         int    `json:"missed"`
+	PRNTaken       int    `json:"prn_taken"`
+	// AdherencePct — доля принятых (в том числе с опозданием) доз от плановых
+	AdherencePct *float64 `json:"adherence_pct"`
+	// Средняя интенсивность боли в дни, когда все плановые дозы приняты, и в дни с пропусками
+	AvgIntensityAdherent    *float64 `json:"avg_intensity_adherent"`
+	AvgIntensityNonAdherent *float64 `json:"avg_intensity_non_adherent"`
+	// Correlation — коэффициент Пирсона между дневной долей принятых доз и средней интенсивностью боли
+	Correlation *float64          `json:"correlation"`
+	Days        []AdherenceDayDTO `json:"days"`
+}
+
+type ReminderSettingDTO struct {
+	ID        uint   `json:"id"`
+	Kind      string `json:"kind"`
+	TimeOfDay string `json:"time_of_day,omitempty"`
+	Enabled   bool   `json:"enabled"`
+}
+
+type ReminderSettingsDTO struct {
+	Timezone  string               `json:"timezone"`
+	Reminders []ReminderSettingDTO `json:"reminders"`
+}
+
+// ReminderInputDTO — создание и частичное обновление напоминания.
+type ReminderInputDTO struct {
+	Kind      *string `json:"kind"`
+	TimeOfDay *string `json:"time_of_day"`
+	Enabled   *bool   `json:"enabled"`
+}
+
+type TimezoneDTO struct {
+	Timezone string `json:"timezone" binding:"required"`
+}
+
+type QuestionnaireSummaryDTO struct {
+	Code        string `json:"code"`
+	Version     int    `json:"version"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// QuestionnaireAssignmentInputDTO — назначение и частичное обновление.
+// interval_days = 0 — однократно; пустой end_date при обновлении снимает дату окончания.
+type QuestionnaireAssignmentInputDTO struct {
+	Link         uint    `json:"link"`
+	Code         string  `json:"code"`
+	IntervalDays *int    `json:"interval_days"`
+	StartDate    *string `json:"start_date"`
+	EndDate      *string `json:"end_date"`
+	Active       *bool   `json:"active"`
+}
+
+type QuestionnaireAssignmentDTO struct {
+	ID              uint       `json:"id"`
+	LinkID          uint       `json:"link_id"`
+	PatientID       uint       `json:"patient_id"`
+	Code            string     `json:"code"`
+	Version         int        `json:"version"`
+	Title           string     `json:"title"`
+	IntervalDays    int        `json:"interval_days"`
+	StartDate       string     `json:"start_date"`
+	EndDate         *string    `json:"end_date,omitempty"`
+	Active          bool       `json:"active"`
+	LastSubmittedAt *time.Time `json:"last_submitted_at"`
+	NextDue         *string    `json:"next_due"`
+	Due             bool       `json:"due"`
+}
+
+type QuestionnaireSubmitDTO struct {
+	Answers map[string]float64 `json:"answers" binding:"required"`
+}
+
+type QuestionnaireScoreDTO struct {
+	ID    string   `json:"id"`
+	Label string   `json:"label"`
+	Value *float64 `json:"value"`
+	Band  string   `json:"band,omitempty"`
+}
+
+type QuestionnaireResponseDTO struct {
+	ID           uint                    `json:"id"`
+	AssignmentID uint                    `json:"assignment_id"`
+	Code         string                  `json:"code"`
+	Version      int                     `json:"version"`
+	Answers      map[string]float64      `json:"answers"`
+	Scores       []QuestionnaireScoreDTO `json:"scores"`
+	SubmittedAt  time.Time               `json:"submitted_at"`
+}
+
+type QuestionnaireTrendPointDTO struct {
+	SubmittedAt time.Time `json:"submitted_at"`
+	ResponseID  uint      `json:"response_id"`
+	Value       *float64  `json:"value"`
+	Band        string    `json:"band,omitempty"`
+}
+
+// QuestionnaireTrendDTO — динамика одной шкалы опросника у пациента.
+type QuestionnaireTrendDTO struct {
+	Code    string                       `json:"code"`
+	Title   string                       `json:"title"`
+	ScoreID string                       `json:"score_id"`
+	Label   string                       `json:"label"`
+	Points  []QuestionnaireTrendPointDTO `json:"points"`
+}
+
+type TagDTO struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name"`
+	NotesCount int    `json:"notes_count"`
+}
+
+type TagInputDTO struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// NumericFactorDTO — числовой фактор (сон, настроение) в дни с сильной болью и в остальные дни.
+type NumericFactorDTO struct {
+	Factor       string   `json:"factor"`
+	Days         int      `json:"days"` // дней, когда фактор был отмечен
+	HighDaysAvg  *float64 `json:"high_days_avg"`
+	OtherDaysAvg *float64 `json:"other_days_avg"`
+	Correlation  *float64 `json:"correlation"` // Пирсон между значением фактора и максимальной интенсивностью за день
+}
+
+// CategoricalFactorDTO — как часто значение фактора (активность, погода, метка) совпадает с днями сильной боли.
+type CategoricalFactorDTO struct {
+	Factor    string   `json:"factor"` // activity_level / weather / tag
+	Value     string   `json:"value"`
+	Days      int      `json:"days"`
+	HighDays  int      `json:"high_days"`
+	HighShare float64  `json:"high_share"` // доля дней с сильной болью среди дней с этим значением
+	Lift      *float64 `json:"lift"`       // HighShare / общая доля дней с сильной болью
+}
+
+type FactorReportDTO struct {
+	From        string                 `json:"from"`
+	To          string                 `json:"to"`
+	Threshold   int                    `json:"threshold"` // день с сильной болью — максимальная интенсивность не ниже порога
+	Days        int                    `json:"days"`
+	HighDays    int                    `json:"high_days"`
+	Numeric     []NumericFactorDTO     `json:"numeric"`
+	Categorical []CategoricalFactorDTO `json:"categorical"`
+}
+
+type AccessLogDTO struct {
+	ID         uint      `json:"id"`
+	ActorID    uint      `json:"actor_id"`
+	ActorName  string    `json:"actor_name"`
+	ActorGroup string    `json:"actor_group"`
+	PatientID  uint      `json:"patient_id"`
+	Action     string    `json:"action"`
+	Resource   string    `json:"resource"`
+	ResourceID *uint     `json:"resource_id,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Details    string    `json:"details,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type AccessLogPageDTO struct {
+	Items  []AccessLogDTO `json:"items"`
+	Total  int64          `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+}
+
+// AccessLogQueryDTO — условия выборки журнала доступа из строки запроса; даты в формате YYYY-MM-DD.
+type AccessLogQueryDTO struct {
+	PatientID uint   `json:"patient_id"`
+	ActorID   uint   `json:"actor_id"`
+	Action    string `json:"action"`
+	Resource  string `json:"resource"`
+	RequestID string `json:"request_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Offset    int    `json:"offset"`
+	Limit     int    `json:"limit"`
+}
+
+type DoctorApplicationInputDTO struct {
+	LicenseNumber string `json:"license_number"`
+	Specialty     string `json:"specialty"`
+	Clinic        string `json:"clinic"`
+	Comment       string `json:"comment"`
+}
+
+type DoctorApplicationDocumentDTO struct {
+	ID          uint      `json:"id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type DoctorApplicationDTO struct {
+	ID             uint                           `json:"id"`
+	UserID         uint                           `json:"user_id"`
+	ApplicantName  string                         `json:"applicant_name,omitempty"`
+	ApplicantEmail string                         `json:"applicant_email,omitempty"`
+	LicenseNumber  string                         `json:"license_number"`
+	Specialty      string                         `json:"specialty"`
+	Clinic         string                         `json:"clinic"`
+	Comment        string                         `json:"comment"`
+	Status         string                         `json:"status"`
+	ReviewNote     string                         `json:"review_note,omitempty"`
+	ReviewedAt     *time.Time                     `json:"reviewed_at,omitempty"`
+	CreatedAt      time.Time                      `json:"created_at"`
+	Documents      []DoctorApplicationDocumentDTO `json:"documents"`
+}
+
+type DoctorApplicationPageDTO struct {
+	Items  []DoctorApplicationDTO `json:"items"`
+	Total  int64                  `json:"total"`
+	Offset int                    `json:"offset"`
+	Limit  int                    `json:"limit"`
+}
+
+// ReviewApplicationDTO — решение по заявке; при отказе note обязателен.
+type ReviewApplicationDTO struct {
+	Note string `json:"note"`
+}
+
+// AdminUserDTO — аккаунт в админке; Status — active / locked / deleted.
+type AdminUserDTO struct {
+	ID                    uint       `json:"id"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	FirstName             string     `json:"first_name"`
+	LastName              string     `json:"last_name"`
+	FatherName            string     `json:"father_name"`
+	Sex                   string     `json:"sex"`
+	DateOfBirth           string     `json:"date_of_birth"`
+	Roles                 []string   `json:"roles"`
+	Status                string     `json:"status"`
+	LockedAt              *time.Time `json:"locked_at,omitempty"`
+	LockReason            string     `json:"lock_reason,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	DeletedAt             *time.Time `json:"deleted_at,omitempty"`
+	MergedIntoID          *uint      `json:"merged_into_id,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+type AdminUserPageDTO struct {
+	Items  []AdminUserDTO `json:"items"`
+	Total  int64          `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+}
+
+// AdminUserLinkDTO — привязка пользователя; Side — его сторона в ней (doctor / patient).
+type AdminUserLinkDTO struct {
+	ID              uint       `json:"id"`
+	Side            string     `json:"side"`
+	CounterpartID   uint       `json:"counterpart_id"`
+	CounterpartName string     `json:"counterpart_name"`
+	Status          string     `json:"status"`
+	Role            string     `json:"role"`
+	CreatedAt       time.Time  `json:"created_at"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+}
+
+// AdminUserDetailDTO — карточка аккаунта с привязками; LinkCounts — число привязок по статусам.
+type AdminUserDetailDTO struct {
+	User       AdminUserDTO       `json:"user"`
+	LinkCounts map[string]int     `json:"link_counts"`
+	Links      []AdminUserLinkDTO `json:"links"`
+}
+
+type SetUserRolesDTO struct {
+	Roles []string `json:"roles"`
+}
+
+type LockUserDTO struct {
+	Reason string `json:"reason"`
+}
+
+// PasswordResetDTO — временный пароль показывается администратору один раз.
+type PasswordResetDTO struct {
+	TemporaryPassword string `json:"temporary_password"`
+}
+
+// MergeUsersDTO — дубликат, данные которого переносятся в аккаунт из пути запроса.
+type MergeUsersDTO struct {
+	SourceID uint `json:"source_id"`
+}
+
+// UpdateProfileDTO — PATCH /users/me; поле, которого нет в запросе, не меняется.
+type UpdateProfileDTO struct {
+	FirstName   *string `json:"first_name"`
+	LastName    *string `json:"last_name"`
+	FatherName  *string `json:"father_name"`
+	Sex         *string `json:"sex"`
+	DateOfBirth *string `json:"date_of_birth"` // YYYY-MM-DD
+	Phone       *string `json:"phone"`         // пустая строка удаляет номер
+}
+
+type ChangePasswordDTO struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangeEmailDTO — запрос смены почты; подтверждается кодом, отправленным на новый адрес.
+type ChangeEmailDTO struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+type ConfirmEmailDTO struct {
+	Code string `json:"code"`
 }
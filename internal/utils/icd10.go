@@ -0,0 +1,6 @@
+package utils
+
+import "regexp"
+
+// ICD10CodeRe — формат кода МКБ-10: буква, две цифры и необязательная подрубрика.
+var ICD10CodeRe = regexp.MustCompile(`^[A-Z][0-9]{2}(\.[0-9A-Z]{1,2})?$`)
@@ -8,17 +8,31 @@ import (
 )
 
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Groups string `json:"groups"`
+	UserID uint     `json:"user_id"`
+	Roles  []string `json:"roles"`
+	// Groups — единственная группа из токенов, выданных до появления ролей.
+	Groups string `json:"groups,omitempty"`
+	// SessionVersion — версия сессий пользователя на момент выдачи; после отзыва
+	// сессий (блокировка, сброс пароля, смена ролей) токен перестаёт приниматься.
+	SessionVersion uint `json:"sv,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(cfg config.JWTConfig, userID uint, groups string) (string, error) {
+// RoleNames — роли из токена; для старых токенов — их группа.
+func (c *Claims) RoleNames() []string {
+	if len(c.Roles) == 0 && c.Groups != "" {
+		return []string{c.Groups}
+	}
+	return c.Roles
+}
+
+func GenerateAccessToken(cfg config.JWTConfig, userID uint, roles []string, sessionVersion uint) (string, error) {
 	now := time.Now()
 
 	claims := Claims{
-		UserID: userID,
-		Groups: groups,
+		UserID:         userID,
+		Roles:          roles,
+		SessionVersion: sessionVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.Duration)),
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PreferredLocale выбирает язык из заголовка Accept-Language с учётом q-весов.
+// Регион отбрасывается ("en-US" -> "en"). Если ни один язык не поддерживается,
+// возвращается fallback.
+func PreferredLocale(header string, supported []string, fallback string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lang, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+
+		lang, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(lang)), "-")
+		candidates = append(candidates, candidate{lang: lang, q: q})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		for _, s := range supported {
+			if c.lang == s {
+				return s
+			}
+		}
+	}
+	return fallback
+}
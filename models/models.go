@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 //TODO: Разбить на сущности
 
@@ -14,16 +18,56 @@ type User struct {
 	FatherName  string    `gorm:"not null" json:"father_name"`
 	Sex         string    `gorm:"not null" json:"sex"`
 	DateOfBirth time.Time `gorm:"not null" json:"date_of_birth"`
-	Groups      string    `gorm:"default:Patient; not null" json:"groups"`
+	Phone       string    `gorm:"not null;default:''" json:"phone"`     // +79991234567
+	Timezone    string    `gorm:"not null;default:UTC" json:"timezone"` // IANA, например Europe/Moscow
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Состояние аккаунта, меняется администратором
+	LockedAt              *time.Time `json:"-"`
+	LockReason            string     `gorm:"not null;default:''" json:"-"`
+	PasswordResetRequired bool       `gorm:"not null;default:false" json:"-"` // вход по временному паролю, его нужно сменить
+	SessionVersion        uint       `gorm:"not null;default:0" json:"-"`     // токены с другой версией отозваны
+	// DeletedAt — аккаунт удалён администратором. Обычный *time.Time, а не gorm.DeletedAt:
+	// имя удалённого врача или пациента должно оставаться видно в истории привязок.
+	DeletedAt    *time.Time `gorm:"index" json:"-"`
+	MergedIntoID *uint      `json:"-"` // дубликат: в какой аккаунт перенесены его данные
+
+	Roles []Role `gorm:"many2many:user_roles" json:"-"`
+}
+
+// Role — роль пользователя (Patient, Doctor, Admin). Что разрешено роли, задаёт
+// role_permissions; у пользователя может быть несколько ролей.
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"size:32;uniqueIndex;not null" json:"name"`
+	Description string       `gorm:"not null;default:''" json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+}
+
+// Permission — право на группу действий API, например diary:read или treatment:write.
+type Permission struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Code        string `gorm:"size:64;uniqueIndex;not null" json:"code"`
+	Description string `gorm:"not null;default:''" json:"description"`
 }
 
+// Subscription — привязка пациента к врачу. Переходы между статусами проверяет diary.Service:
+// pending → accepted / rejected / cancelled, accepted → ended, rejected / cancelled / ended → archived.
+// Между врачом и пациентом может быть не больше одной привязки в статусе pending или accepted.
+// Действующие привязки пациента образуют его команду лечения; Role задаёт права врача
+// в команде, ведущий врач (lead) у пациента не больше одного.
 type Subscription struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	DoctorID     uint      `gorm:"not null" json:"doctor_id"`
-	PatientID    uint      `gorm:"not null" json:"patient_id"`
-	Status       string    `gorm:"not null;default:pending" json:"status"` // pending / accepted / rejected
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	DoctorID  uint       `gorm:"not null;uniqueIndex:idx_subscription_active,where:status = 'pending' OR status = 'accepted'" json:"doctor_id"`
+	PatientID uint       `gorm:"not null;uniqueIndex:idx_subscription_active,where:status = 'pending' OR status = 'accepted';uniqueIndex:idx_subscription_lead,where:role = 'lead' AND (status = 'pending' OR status = 'accepted')" json:"patient_id"`
+	Status    string     `gorm:"not null;default:pending" json:"status"`  // pending / accepted / rejected / cancelled / ended / archived
+	Role      string     `gorm:"not null;default:consultant" json:"role"` // lead / consultant / nurse
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	EndedByID *uint      `json:"ended_by_id,omitempty"`
+	EndReason string     `json:"end_reason,omitempty"`
+	// Prescription и Diagnosis больше не обновляются: текущее значение берётся
+	// из последней LinkRevision. Колонки оставлены для переноса старых данных.
 	Prescription string    `json:"prescription,omitempty"`
 	Diagnosis    string    `json:"diagnosis,omitempty"`
 	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
@@ -33,16 +77,170 @@ type Subscription struct {
 	Patient User `gorm:"foreignKey:PatientID" json:"patient"`
 }
 
+// Prescription — структурированное назначение препарата в рамках привязки врач–пациент.
+type Prescription struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint           `gorm:"not null;index" json:"subscription_id"`
+	DoctorID       uint           `gorm:"not null" json:"doctor_id"`
+	PatientID      uint           `gorm:"not null;index" json:"patient_id"`
+	MedicationName string         `gorm:"not null" json:"medication_name"`
+	Dose           float64        `gorm:"not null" json:"dose"`
+	Unit           string         `gorm:"not null" json:"unit"`                           // mg / ml / tablet / ...
+	Route          string         `gorm:"not null" json:"route"`                          // oral / iv / topical / ...
+	Frequency      string         `json:"frequency,omitempty"`                            // свободное описание для пациента, например "2 раза в день"
+	TimesOfDay     []string       `gorm:"type:jsonb;serializer:json" json:"times_of_day"` // "08:00", "20:00" в часовом поясе пациента
+	IntervalDays   int            `gorm:"not null;default:1" json:"interval_days"`        // 1 — каждый день, 2 — через день
+	StartDate      time.Time      `gorm:"type:date;not null" json:"start_date"`
+	EndDate        *time.Time     `gorm:"type:date" json:"end_date,omitempty"`
+	PRN            bool           `gorm:"not null;default:false" json:"prn"` // по требованию, без расписания
+	Instructions   string         `json:"instructions,omitempty"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+type MedicationIntake struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	PrescriptionID uint       `gorm:"not null;index;uniqueIndex:idx_intake_prescription_slot" json:"prescription_id"`
+	PatientID      uint       `gorm:"not null;index" json:"patient_id"`
+	Status         string     `gorm:"not null" json:"status"`                                                  // taken / skipped / late
+	ScheduledFor   *time.Time `gorm:"uniqueIndex:idx_intake_prescription_slot" json:"scheduled_for,omitempty"` // плановый приём; пусто для PRN
+	TakenAt        *time.Time `json:"taken_at,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
 type Note struct {
-	ID               uint      `gorm:"primaryKey" json:"id"`
-	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updated_at"`
-	Intensity        int       `gorm:"not null" json:"intensity"`
-	PainType         string    `gorm:"not null" json:"pain_type"`
-	TookPrescription bool      `gorm:"not null" json:"took_prescription"`
-	Description      string    `json:"description,omitempty"`
-	BodyPart         uint      `gorm:"not null" json:"body_part"`
-	PatientID        uint      `gorm:"not null" json:"patient_id"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	ClientID         *string        `gorm:"uniqueIndex:idx_notes_patient_client" json:"client_id,omitempty"` // UUID, сгенерированный офлайн-клиентом
+	RecordedAt       time.Time      `gorm:"index" json:"recorded_at"`                                        // когда пациент сделал запись (может быть раньше CreatedAt)
+	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time      `gorm:"autoUpdateTime;index" json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	Intensity        int            `gorm:"not null" json:"intensity"`
+	PainType         string         `gorm:"not null" json:"pain_type"`
+	TookPrescription bool           `gorm:"not null" json:"took_prescription"`
+	Description      string         `json:"description,omitempty"`
+	BodyPart         uint           `gorm:"not null" json:"body_part"` // основная часть тела, оставлена для старых клиентов
+	PatientID        uint           `gorm:"not null;uniqueIndex:idx_notes_patient_client;index:idx_notes_patient_sync,priority:1" json:"patient_id"`
+	// Ревизия для синхронизации: триггер берёт её из последовательности при каждой записи,
+	// и для одного пациента ревизии фиксируются строго по возрастанию.
+	SyncVersion int64 `gorm:"not null;default:0;index:idx_notes_patient_sync,priority:2" json:"-"`
+
+	// Контекст записи, все поля необязательные
+	SleepHours    *float64 `json:"sleep_hours,omitempty"`
+	SleepQuality  *int     `json:"sleep_quality,omitempty"`  // 1–5
+	Mood          *int     `json:"mood,omitempty"`           // 1–5
+	ActivityLevel *string  `json:"activity_level,omitempty"` // sedentary / light / moderate / vigorous
+	Weather       *string  `json:"weather,omitempty"`        // sunny / cloudy / rain / snow / storm / fog / windy
+
+	BodyParts []NoteBodyPart `gorm:"foreignKey:NoteID;constraint:OnDelete:CASCADE" json:"body_parts"`
+	Tags      []Tag          `gorm:"many2many:note_tags;constraint:OnDelete:CASCADE" json:"tags"`
+}
+
+// Tag — пользовательская метка записи (триггеры, обстоятельства): "стресс", "кофе", "перелёт".
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_tags_user_name" json:"user_id"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_tags_user_name" json:"name"` // в нижнем регистре
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type NoteBodyPart struct {
+	ID             uint  `gorm:"primaryKey" json:"-"`
+	NoteID         uint  `gorm:"not null;index" json:"-"`
+	BodyPartID     uint  `gorm:"not null" json:"body_part_id"`
+	Intensity      *int  `json:"intensity,omitempty"`
+	RadiatesFromID *uint `json:"radiates_from_id,omitempty"` // заполнено, если боль отдаёт сюда из другой части тела
+}
+
+type BodyPart struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Code      string    `gorm:"unique;not null" json:"code"`
+	View      string    `gorm:"not null" json:"view"`                // front / back
+	Side      string    `gorm:"not null;default:center" json:"side"` // left / right / center
+	ParentID  *uint     `json:"parent_id,omitempty"`
+	SortOrder int       `gorm:"not null;default:0" json:"sort_order"`
+	IsActive  bool      `gorm:"not null" json:"is_active"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	Labels []BodyPartLabel `gorm:"foreignKey:BodyPartID" json:"labels,omitempty"`
+}
+
+type BodyPartLabel struct {
+	ID         uint   `gorm:"primaryKey" json:"-"`
+	BodyPartID uint   `gorm:"not null;uniqueIndex:idx_body_part_locale" json:"-"`
+	Locale     string `gorm:"not null;uniqueIndex:idx_body_part_locale" json:"locale"`
+	Label      string `gorm:"not null" json:"label"`
+}
+
+type Attachment struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	NoteID       uint      `gorm:"not null;index" json:"note_id"`
+	PatientID    uint      `gorm:"not null;index" json:"patient_id"`
+	UploaderID   uint      `gorm:"not null" json:"uploader_id"`
+	FileName     string    `gorm:"not null" json:"file_name"`
+	ContentType  string    `gorm:"not null" json:"content_type"`
+	Size         int64     `gorm:"not null" json:"size"`
+	StorageKey   string    `gorm:"not null" json:"-"`
+	ThumbnailKey string    `json:"-"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// NoteComment — комментарий врача к записи дневника или ответ в ветке комментария.
+// Ветка одноуровневая: ParentID всегда указывает на корневой комментарий.
+type NoteComment struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	NoteID    uint           `gorm:"not null;index" json:"note_id"`
+	PatientID uint           `gorm:"not null;index" json:"patient_id"`
+	AuthorID  uint           `gorm:"not null" json:"author_id"`
+	ParentID  *uint          `gorm:"index" json:"parent_id,omitempty"`
+	Body      string         `gorm:"type:text;not null" json:"body"`
+	EditedAt  *time.Time     `json:"edited_at,omitempty"`
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Author User `gorm:"foreignKey:AuthorID" json:"-"`
+}
+
+// Conversation — переписка врача и пациента в рамках принятой привязки, одна на привязку.
+// После закрытия новые сообщения не принимаются, история остаётся доступной.
+type Conversation struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"not null;uniqueIndex" json:"subscription_id"`
+	DoctorID       uint       `gorm:"not null;index" json:"doctor_id"`
+	PatientID      uint       `gorm:"not null;index" json:"patient_id"`
+	LastMessageAt  *time.Time `gorm:"index" json:"last_message_at,omitempty"`
+	ClosedAt       *time.Time `json:"closed_at,omitempty"`
+	ClosedByID     *uint      `json:"closed_by_id,omitempty"` // пусто, если закрыта автоматически
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	Doctor  User `gorm:"foreignKey:DoctorID" json:"-"`
+	Patient User `gorm:"foreignKey:PatientID" json:"-"`
+}
+
+type Message struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	ConversationID uint       `gorm:"not null;index:idx_message_conversation" json:"conversation_id"`
+	SenderID       uint       `gorm:"not null" json:"sender_id"`
+	Body           string     `gorm:"type:text" json:"body"`
+	ReadAt         *time.Time `json:"read_at,omitempty"` // когда прочитал получатель
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+
+	Attachments []MessageAttachment `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE" json:"attachments"`
+}
+
+type MessageAttachment struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	MessageID   uint      `gorm:"not null;index" json:"message_id"`
+	FileName    string    `gorm:"not null" json:"file_name"`
+	ContentType string    `gorm:"not null" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	StorageKey  string    `gorm:"not null" json:"-"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
 type Notification struct {
@@ -53,3 +251,270 @@ type Notification struct {
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
+
+// IdempotencyRecord хранит первый ответ на запрос с заголовком Idempotency-Key.
+// StatusCode = 0, пока исходный запрос ещё выполняется.
+type IdempotencyRecord struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key         string `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Method      string `gorm:"not null"`
+	Path        string `gorm:"not null"`
+	RequestHash string `gorm:"not null"`
+	StatusCode  int    `gorm:"not null;default:0"`
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// AvailabilitySlot — окно приёма, опубликованное врачом. Время хранится в UTC.
+type AvailabilitySlot struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DoctorID  uint      `gorm:"not null;index:idx_slot_doctor_start" json:"doctor_id"`
+	StartsAt  time.Time `gorm:"not null;index:idx_slot_doctor_start" json:"starts_at"`
+	EndsAt    time.Time `gorm:"not null" json:"ends_at"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Appointment — запись пациента на приём в одно из окон врача. На одно окно
+// может быть не больше одной действующей (booked) записи.
+type Appointment struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SlotID         uint       `gorm:"not null;uniqueIndex:idx_appointment_slot_booked,where:status = 'booked'" json:"slot_id"`
+	SubscriptionID uint       `gorm:"not null" json:"subscription_id"`
+	DoctorID       uint       `gorm:"not null;index" json:"doctor_id"`
+	PatientID      uint       `gorm:"not null;index" json:"patient_id"`
+	StartsAt       time.Time  `gorm:"not null;index" json:"starts_at"`
+	EndsAt         time.Time  `gorm:"not null" json:"ends_at"`
+	Status         string     `gorm:"not null;default:booked" json:"status"` // booked / cancelled
+	Reason         string     `json:"reason,omitempty"`                      // повод обращения со слов пациента
+	CancelledByID  *uint      `json:"cancelled_by_id,omitempty"`
+	CancelReason   string     `json:"cancel_reason,omitempty"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	Doctor  User `gorm:"foreignKey:DoctorID" json:"-"`
+	Patient User `gorm:"foreignKey:PatientID" json:"-"`
+}
+
+// ReminderSetting — пользовательская настройка напоминания.
+// pain_log — напомнить заполнить дневник в TimeOfDay; medication — включить
+// или выключить напоминания по расписанию назначений (TimeOfDay не используется).
+type ReminderSetting struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Kind      string    `gorm:"not null" json:"kind"`  // pain_log / medication / appointment
+	TimeOfDay string    `json:"time_of_day,omitempty"` // HH:MM в часовом поясе пользователя
+	Enabled   bool      `gorm:"not null" json:"enabled"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ReminderLog защищает от повторной отправки одного и того же напоминания.
+type ReminderLog struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"not null;uniqueIndex:idx_reminder_log_slot"`
+	Kind         string    `gorm:"not null;uniqueIndex:idx_reminder_log_slot"`
+	RefID        uint      `gorm:"not null;uniqueIndex:idx_reminder_log_slot"` // настройка или назначение
+	ScheduledFor time.Time `gorm:"not null;uniqueIndex:idx_reminder_log_slot"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+// LinkRevision — версия текстового назначения или диагноза в привязке врач–пациент.
+// Записи только добавляются; актуальное значение — последняя версия по полю.
+type LinkRevision struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint      `gorm:"not null;index:idx_link_revision_field" json:"subscription_id"`
+	Field          string    `gorm:"not null;index:idx_link_revision_field" json:"field"` // prescription / diagnosis
+	Value          string    `gorm:"type:text;not null" json:"value"`
+	AuthorID       uint      `gorm:"not null" json:"author_id"`
+	CreatedAt      time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+
+	Author User `gorm:"foreignKey:AuthorID" json:"-"`
+}
+
+// ICD10Code — справочник МКБ-10.
+type ICD10Code struct {
+	Code        string `gorm:"primaryKey;size:8" json:"code"`
+	Description string `gorm:"not null" json:"description"`
+}
+
+// Diagnosis — кодированный диагноз пациента в рамках привязки врач–пациент.
+type Diagnosis struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"not null;index" json:"subscription_id"`
+	PatientID      uint       `gorm:"not null;index" json:"patient_id"`
+	DoctorID       uint       `gorm:"not null" json:"doctor_id"`
+	Code           string     `gorm:"size:8;not null;index" json:"code"`
+	Description    string     `gorm:"not null" json:"description"`
+	Type           string     `gorm:"not null;default:secondary" json:"type"` // primary / secondary
+	OnsetDate      *time.Time `gorm:"type:date" json:"onset_date"`
+	Status         string     `gorm:"not null;default:active" json:"status"` // active / remission / resolved
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// QuestionnaireAssignment — опросник, назначенный врачом пациенту по расписанию.
+// Версия фиксируется при назначении, чтобы серия ответов оставалась сопоставимой.
+type QuestionnaireAssignment struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"not null;index" json:"subscription_id"`
+	DoctorID       uint       `gorm:"not null" json:"doctor_id"`
+	PatientID      uint       `gorm:"not null;index" json:"patient_id"`
+	Code           string     `gorm:"not null" json:"code"`
+	Version        int        `gorm:"not null" json:"version"`
+	IntervalDays   int        `gorm:"not null;default:0" json:"interval_days"` // 0 — однократно
+	StartDate      time.Time  `gorm:"type:date;not null" json:"start_date"`
+	EndDate        *time.Time `gorm:"type:date" json:"end_date"`
+	Active         bool       `gorm:"not null" json:"active"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// QuestionnaireResponse — заполненный опросник с посчитанными шкалами.
+type QuestionnaireResponse struct {
+	ID           uint                 `gorm:"primaryKey" json:"id"`
+	AssignmentID uint                 `gorm:"not null;index" json:"assignment_id"`
+	PatientID    uint                 `gorm:"not null;index:idx_questionnaire_response_patient" json:"patient_id"`
+	Code         string               `gorm:"not null;index:idx_questionnaire_response_patient" json:"code"`
+	Version      int                  `gorm:"not null" json:"version"`
+	Answers      map[string]float64   `gorm:"type:jsonb;serializer:json" json:"answers"`
+	Scores       []QuestionnaireScore `gorm:"type:jsonb;serializer:json" json:"scores"`
+	SubmittedAt  time.Time            `gorm:"autoCreateTime;index" json:"submitted_at"`
+}
+
+// QuestionnaireScore — значение шкалы; Value = nil, если ответов недостаточно для подсчёта.
+type QuestionnaireScore struct {
+	ID    string   `json:"id"`
+	Label string   `json:"label"`
+	Value *float64 `json:"value"`
+	Band  string   `json:"band,omitempty"`
+}
+
+// InviteCode — код приглашения врача. Пациент, погасивший код, прикрепляется к врачу
+// без поиска по логину: сразу принятой привязкой (AutoAccept) или запросом на рассмотрение.
+type InviteCode struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	DoctorID   uint       `gorm:"not null;index" json:"doctor_id"`
+	Code       string     `gorm:"size:16;unique;not null" json:"code"`
+	AutoAccept bool       `gorm:"not null;default:false" json:"auto_accept"`
+	MaxUses    int        `gorm:"not null;default:1" json:"max_uses"` // 0 — без ограничения
+	UsedCount  int        `gorm:"not null;default:0" json:"used_count"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+
+	Doctor User `gorm:"foreignKey:DoctorID" json:"-"`
+}
+
+// InviteRedemption — кто и когда погасил код и какая привязка при этом создана.
+type InviteRedemption struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	InviteCodeID   uint      `gorm:"not null;index" json:"invite_code_id"`
+	PatientID      uint      `gorm:"not null" json:"patient_id"`
+	SubscriptionID uint      `gorm:"not null" json:"subscription_id"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// InviteAttempt — неудачная попытка погасить код; по ним ограничивается перебор кодов.
+type InviteAttempt struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index:idx_invite_attempt_user"`
+	IP        string    `gorm:"size:64;not null;default:'';index:idx_invite_attempt_ip"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index:idx_invite_attempt_user;index:idx_invite_attempt_ip"`
+}
+
+// DoctorProfile — карточка врача в каталоге. Скрытый врач не находится поиском,
+// но прикрепиться к нему по логину или приглашению по-прежнему можно.
+type DoctorProfile struct {
+	UserID               uint      `gorm:"primaryKey" json:"user_id"`
+	Specialty            string    `gorm:"index" json:"specialty"`
+	Clinic               string    `json:"clinic"`
+	City                 string    `gorm:"index" json:"city"`
+	Languages            []string  `gorm:"type:jsonb;serializer:json" json:"languages"` // ISO 639-1: ru, en, ...
+	Bio                  string    `gorm:"type:text" json:"bio"`
+	AcceptingNewPatients bool      `gorm:"not null" json:"accepting_new_patients"`
+	Hidden               bool      `gorm:"not null;default:false" json:"hidden"`
+	CreatedAt            time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt            time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// LinkConsent — согласие пациента на доступ врача к данным в рамках привязки.
+// Записи только добавляются: действует последняя, предыдущие остаются для аудита.
+// Пока согласие не записано ни разу, врач с принятой привязкой видит все данные.
+type LinkConsent struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"not null;index" json:"subscription_id"`
+	PatientID      uint       `gorm:"not null;index" json:"patient_id"`
+	DoctorID       uint       `gorm:"not null" json:"doctor_id"`
+	Scopes         []string   `gorm:"type:jsonb;serializer:json" json:"scopes"` // notes / attachments / questionnaires / medications / profile
+	DataFrom       *time.Time `gorm:"type:date" json:"data_from,omitempty"`     // данные раньше этой даты врачу не видны
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`                     // после этого момента доступ закрыт
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// AccessLog — запись журнала доступа к медицинским данным пациента и действий
+// администратора над аккаунтами; PatientID — чьи данные или аккаунт затронуты.
+// Журнал только дополняется: изменить или удалить запись не даёт триггер в БД.
+type AccessLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ActorID    uint      `gorm:"not null;index" json:"actor_id"`
+	PatientID  uint      `gorm:"not null;index:idx_access_log_patient" json:"patient_id"`
+	Action     string    `gorm:"size:16;not null" json:"action"`         // read / create / update / delete, для account — lock / merge / ...
+	Resource   string    `gorm:"size:32;not null;index" json:"resource"` // note / prescription / diagnosis / profile / attachment / comment / account
+	ResourceID *uint     `json:"resource_id,omitempty"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	RequestID  string    `gorm:"size:64;index" json:"request_id"`
+	Details    string    `gorm:"not null;default:''" json:"details,omitempty"` // подробности действий администратора над аккаунтом
+	CreatedAt  time.Time `gorm:"autoCreateTime;index;index:idx_access_log_patient" json:"created_at"`
+
+	Actor User `gorm:"foreignKey:ActorID" json:"-"`
+}
+
+// DoctorApplication — заявка пользователя на роль врача. Пока заявка на рассмотрении,
+// новую подать нельзя; после одобрения пользователь получает роль Doctor.
+type DoctorApplication struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"not null;index;uniqueIndex:idx_doctor_application_pending,where:status = 'pending'" json:"user_id"`
+	LicenseNumber string     `gorm:"size:64;not null" json:"license_number"`
+	Specialty     string     `gorm:"not null" json:"specialty"`
+	Clinic        string     `gorm:"not null;default:''" json:"clinic"`
+	Comment       string     `gorm:"type:text;not null;default:''" json:"comment"`
+	Status        string     `gorm:"size:16;not null;default:pending;index" json:"status"` // pending / approved / rejected
+	ReviewerID    *uint      `json:"reviewer_id,omitempty"`
+	ReviewNote    string     `gorm:"type:text;not null;default:''" json:"review_note,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	User      User                        `gorm:"foreignKey:UserID" json:"-"`
+	Documents []DoctorApplicationDocument `gorm:"foreignKey:ApplicationID;constraint:OnDelete:CASCADE" json:"documents"`
+}
+
+// DoctorApplicationDocument — скан диплома, лицензии и т.п., приложенный к заявке.
+type DoctorApplicationDocument struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ApplicationID uint      `gorm:"not null;index" json:"application_id"`
+	FileName      string    `gorm:"not null" json:"file_name"`
+	ContentType   string    `gorm:"not null" json:"content_type"`
+	Size          int64     `gorm:"not null" json:"size"`
+	StorageKey    string    `gorm:"not null" json:"-"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// EmailChange — запрос на смену почты. Новый адрес записывается в аккаунт, только
+// когда пользователь введёт код, отправленный на этот адрес.
+type EmailChange struct {
+	ID          uint      `gorm:"primaryKey"`
+	UserID      uint      `gorm:"not null;index"`
+	NewEmail    string    `gorm:"not null"`
+	CodeHash    string    `gorm:"size:64;not null"` // SHA-256 кода в hex
+	Attempts    int       `gorm:"not null;default:0"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	ConfirmedAt *time.Time
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}